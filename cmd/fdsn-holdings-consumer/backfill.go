@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+)
+
+// the number of keys read from the holdings at a time when backfilling.
+const backfillBatch = 1000
+
+var backfillBucket = flag.String("backfill", "", "index the files in this S3 bucket that are in the holdings without a record index and exit")
+
+// backfill indexes the files from bucket that are in the holdings without a record index, e.g., files saved
+// before the index was added.  Files that can't be read are skipped, the holdings are left as they are.
+// Files with records out of time order still have no index after backfilling.
+func backfill(bucket string) error {
+	var last string
+	var indexed, skipped int
+
+	for {
+		keys, err := unindexedKeys(last, backfillBatch)
+		if err != nil {
+			return err
+		}
+
+		if len(keys) == 0 {
+			break
+		}
+
+		for _, k := range keys {
+			h, err := holdingS3(bucket, k)
+			if err != nil {
+				log.Printf("skipping %s: %s", k, err)
+				skipped++
+				continue
+			}
+
+			if err = h.save(); err != nil {
+				return fmt.Errorf("error saving holding for %s %s: %w", bucket, k, err)
+			}
+			indexed++
+		}
+
+		last = keys[len(keys)-1]
+	}
+
+	log.Printf("backfilled the record index for %d files from %s, skipped %d", indexed, bucket, skipped)
+
+	return nil
+}
+
+// unindexedKeys returns up to n keys, after last in key order, of the holdings without a record index.
+func unindexedKeys(last string, n int) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT key FROM fdsn.holdings
+	WHERE record_index IS NULL
+	AND error_data = false
+	AND key > $1
+	ORDER BY key
+	LIMIT $2`, last, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var k string
+		if err = rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 
 	"github.com/GeoNet/fdsn/internal/holdings"
 	"github.com/lib/pq"
@@ -43,7 +44,18 @@ func (h *holding) save() error {
 }
 
 func (h *holding) saveHoldings() (int64, error) {
-	r, err := saveHoldings.Exec(h.Network, h.Station, h.Channel, h.Location, h.Start, h.NumSamples, h.key, h.errorData, h.errorMsg)
+	// the record index and the size of the file it is for are NULL when there isn't one.
+	var index []byte
+	var size sql.NullInt64
+	if h.Index != nil {
+		var err error
+		if index, err = h.Index.MarshalBinary(); err != nil {
+			return 0, err
+		}
+		size = sql.NullInt64{Int64: h.Size, Valid: true}
+	}
+
+	r, err := saveHoldings.Exec(h.Network, h.Station, h.Channel, h.Location, h.Start, h.NumSamples, h.key, h.errorData, h.errorMsg, index, size)
 	if err != nil {
 		return 0, err
 	}
@@ -21,6 +21,8 @@ func TestSaveHoldings(t *testing.T) {
 			Location:   "01",
 			Start:      time.Date(2016, time.January, 2, 0, 0, 0, 0, time.UTC),
 			NumSamples: 500000,
+			Index:      holdings.Index{{Offset: 0, Start: time.Date(2016, time.January, 2, 0, 0, 0, 0, time.UTC)}},
+			Size:       512,
 		},
 	}
 
@@ -50,6 +52,15 @@ func TestSaveHoldings(t *testing.T) {
 		t.Error("expected holdings in the db")
 	}
 
+	var size int64
+	if err = db.QueryRow(`select record_size from fdsn.holdings where key = 'NZ.ABAZ.01.ACE.D.2016.097'`).Scan(&size); err != nil {
+		t.Error(err)
+	}
+
+	if size != 512 {
+		t.Errorf("expected record size 512 got %d", size)
+	}
+
 	// it is not an error to save the same key more than once.
 	err = h.save()
 	if err != nil {
@@ -72,8 +83,8 @@ func setup(t *testing.T) {
 		t.Fatal("ERROR: problem pinging DB")
 	}
 
-	saveHoldings, err = db.Prepare(`INSERT INTO fdsn.holdings (streamPK, start_time, numsamples, key, error_data, error_msg)
-	SELECT streamPK, $5, $6, $7, $8, $9
+	saveHoldings, err = db.Prepare(`INSERT INTO fdsn.holdings (streamPK, start_time, numsamples, key, error_data, error_msg, record_index, record_size)
+	SELECT streamPK, $5, $6, $7, $8, $9, $10, $11
 	FROM fdsn.stream
 	WHERE network = $1
 	AND station = $2
@@ -84,7 +95,9 @@ func setup(t *testing.T) {
 	start_time = EXCLUDED.start_time,
 	numsamples = EXCLUDED.numsamples,
 	error_data = EXCLUDED.error_data,
-	error_msg = EXCLUDED.error_msg`)
+	error_msg = EXCLUDED.error_msg,
+	record_index = EXCLUDED.record_index,
+	record_size = EXCLUDED.record_size`)
 	if err != nil {
 		t.Fatalf("preparing saveHoldings statement: %s", err.Error())
 	}
@@ -7,6 +7,9 @@
 // Large data reindexing tasks.  Reindexing files that already exist in the bucket
 // would require sending messages in the notification format to the SQS queue.
 // See github.com/GeoNet/kit/aws/s3 for the Event type.
+//
+// Files in the holdings without a record index, e.g., saved before the index was added,
+// are indexed with -backfill <bucket>.
 package main
 
 import (
@@ -52,12 +55,23 @@ type event struct {
 
 // init and check aws variables
 func initAwsClient() {
+	var err error
+
+	s3Client, err = s3.NewWithMaxRetries(3)
+	if err != nil {
+		log.Fatalf("error creating S3 client: %s", err)
+	}
+
+	// the queue isn't needed for backfilling.
+	if *backfillBucket != "" {
+		return
+	}
+
 	queueURL = os.Getenv("SQS_QUEUE_URL")
 	if queueURL == "" {
 		log.Fatal("SQS_QUEUE_URL is not set")
 	}
 
-	var err error
 	sqsClient, err = sqs.NewWithMaxRetries(100)
 	if err != nil {
 		log.Fatalf("error creating SQS client: %s", err)
@@ -65,11 +79,6 @@ func initAwsClient() {
 	// if err = sqsClient.CheckQueue(queueURL); err != nil {
 	// 	log.Fatalf("error checking queueURL %s:  %s", queueURL, err.Error())
 	// }
-
-	s3Client, err = s3.NewWithMaxRetries(3)
-	if err != nil {
-		log.Fatalf("error creating S3 client: %s", err)
-	}
 }
 
 func main() {
@@ -100,8 +109,8 @@ func main() {
 	// based on a nscl with zero strings "".""."".""
 	// if the error is corrected the stream will change to some valid nscl.
 	// To handle this the streamPK is updated on conflict.
-	saveHoldings, err = db.Prepare(`INSERT INTO fdsn.holdings (streamPK, start_time, numsamples, key, error_data, error_msg)
-	SELECT streamPK, $5, $6, $7, $8, $9
+	saveHoldings, err = db.Prepare(`INSERT INTO fdsn.holdings (streamPK, start_time, numsamples, key, error_data, error_msg, record_index, record_size)
+	SELECT streamPK, $5, $6, $7, $8, $9, $10, $11
 	FROM fdsn.stream
 	WHERE network = $1
 	AND station = $2
@@ -112,7 +121,9 @@ func main() {
 	start_time = EXCLUDED.start_time,
 	numsamples = EXCLUDED.numsamples,
 	error_data = EXCLUDED.error_data,
-	error_msg = EXCLUDED.error_msg`)
+	error_msg = EXCLUDED.error_msg,
+	record_index = EXCLUDED.record_index,
+	record_size = EXCLUDED.record_size`)
 	if err != nil {
 		log.Fatalf("preparing saveHoldings statement: %s", err.Error())
 	}
@@ -136,6 +147,13 @@ ping:
 		break ping
 	}
 
+	if *backfillBucket != "" {
+		if err = backfill(*backfillBucket); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Println("listening for messages")
 
 	var r sqs.Raw
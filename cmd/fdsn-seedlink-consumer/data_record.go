@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	ms "github.com/GeoNet/kit/seis/ms"
+	"github.com/lib/pq"
+)
+
+// http://www.postgresql.org/docs/9.4/static/errcodes-appendix.html
+const (
+	errorUniqueViolation pq.ErrorCode = "23505"
+)
+
+// saveRecordSQL upserts a record, a record received again replaces the previous one.
+const saveRecordSQL = `INSERT INTO fdsn.record (streamPK, start_time, latency_data, latency_tx, raw)
+	SELECT streamPK, $5, $6, $7, $8
+	FROM fdsn.stream
+	WHERE network = $1
+	AND station = $2
+	AND channel = $3
+	AND location = $4
+	ON CONFLICT (streamPK, start_time) DO UPDATE SET
+	latency_data = EXCLUDED.latency_data,
+	latency_tx = EXCLUDED.latency_tx,
+	raw = EXCLUDED.raw`
+
+// record is a miniSEED record received from SeedLink.
+type record struct {
+	network, station, channel, location string
+	start                               time.Time
+	latencyData                         float64 // seconds from the first sample to receiving the record.
+	latencyTx                           float64 // seconds from the last sample to receiving the record.
+	raw                                 []byte
+}
+
+// newRecord decodes the miniSEED record in raw received at now.
+func newRecord(raw []byte, now time.Time) (record, error) {
+	msr, err := ms.NewRecord(raw)
+	if err != nil {
+		return record{}, err
+	}
+
+	if msr.Network() == "" || msr.Station() == "" || msr.Channel() == "" {
+		return record{}, fmt.Errorf("record with an empty stream code %s", msr.SrcName(false))
+	}
+
+	return record{
+		network:     msr.Network(),
+		station:     msr.Station(),
+		channel:     msr.Channel(),
+		location:    msr.Location(),
+		start:       msr.StartTime(),
+		latencyData: now.Sub(msr.StartTime()).Seconds(),
+		latencyTx:   now.Sub(msr.EndTime()).Seconds(),
+		raw:         append([]byte(nil), raw...),
+	}, nil
+}
+
+// save upserts r to fdsn.record, adding the stream to fdsn.stream if needed.
+func (r *record) save() error {
+	n, err := r.saveRecord()
+
+	switch {
+	case err != nil:
+		return err
+	case n == 1:
+		return nil
+	}
+
+	_, err = r.saveStream()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.saveRecord()
+
+	return err
+}
+
+func (r *record) saveRecord() (int64, error) {
+	res, err := saveRecord.Exec(r.network, r.station, r.channel, r.location, r.start, r.latencyData, r.latencyTx, r.raw)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *record) saveStream() (int64, error) {
+	res, err := db.Exec(`INSERT INTO fdsn.stream (network, station, channel, location) VALUES($1, $2, $3, $4)`,
+		r.network, r.station, r.channel, r.location)
+	if err != nil {
+		if u, ok := err.(*pq.Error); ok && u.Code == errorUniqueViolation {
+			return 1, nil
+		} else {
+			return 0, err
+		}
+	}
+
+	return res.RowsAffected()
+}
+
+// purgeRecords deletes the records that start before t.
+func purgeRecords(t time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM fdsn.record WHERE start_time < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
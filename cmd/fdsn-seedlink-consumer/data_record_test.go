@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSaveRecord(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	start := time.Date(2016, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+	r, err := newRecord(testRecord("ABAZ", start), start.Add(90*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec(`DELETE FROM fdsn.record WHERE start_time = $1`, start); err != nil {
+		t.Error(err)
+	}
+
+	if err = r.save(); err != nil {
+		t.Error(err)
+	}
+
+	// it is not an error to save the same record more than once.
+	if err = r.save(); err != nil {
+		t.Error(err)
+	}
+
+	var count int
+	var latency float64
+
+	if err = db.QueryRow(`SELECT count(*), max(latency_data) FROM fdsn.record WHERE start_time = $1`, start).Scan(&count, &latency); err != nil {
+		t.Error(err)
+	}
+
+	if count != 1 || latency != 90 {
+		t.Errorf("expected 1 record with a data latency of 90 s got %d %f", count, latency)
+	}
+
+	n, err := purgeRecords(start.Add(time.Second))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n < 1 {
+		t.Error("expected the record to be purged")
+	}
+}
+
+func setup(t *testing.T) {
+	var err error
+
+	db, err = sql.Open("postgres", "host=localhost connect_timeout=300 user=fdsn_w password=test dbname=fdsn sslmode=disable statement_timeout=600000")
+	if err != nil {
+		t.Fatalf("ERROR: problem with DB config: %s", err)
+	}
+
+	db.SetMaxIdleConns(1)
+	db.SetMaxOpenConns(1)
+
+	if err = db.Ping(); err != nil {
+		t.Fatal("ERROR: problem pinging DB")
+	}
+
+	saveRecord, err = db.Prepare(saveRecordSQL)
+	if err != nil {
+		t.Fatalf("preparing saveRecord statement: %s", err.Error())
+	}
+}
+
+func teardown() {
+	db.Close()
+}
@@ -0,0 +1,175 @@
+// fdsn-seedlink-consumer receives miniSEED records from a SeedLink server and saves them
+// to fdsn.record, along with their latency, so that fdsn-ws dataselect can serve data
+// only seconds old.  Records older than the retention period are purged.
+//
+// Only one instance should be run for each SeedLink server and set of streams.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GeoNet/kit/cfg"
+	"github.com/GeoNet/kit/health"
+	"github.com/GeoNet/kit/metrics"
+	"github.com/GeoNet/kit/seis/sl"
+)
+
+const (
+	healthCheckAged    = 5 * time.Minute  //need to have a good heartbeat within this time
+	healthCheckStartup = 5 * time.Minute  //ignore heartbeat messages for this time after starting
+	healthCheckTimeout = 30 * time.Second //health check timeout
+	healthCheckService = ":7777"          //end point to listen to for SOH checks
+	healthCheckPath    = "/soh"
+
+	defaultRetention = 48 * time.Hour   // the default period to keep records for.
+	purgeInterval    = 10 * time.Minute // how often old records are purged.
+	reconnectWait    = 30 * time.Second // the wait before reconnecting to the SeedLink server.
+)
+
+var (
+	db         *sql.DB
+	saveRecord *sql.Stmt
+)
+
+func main() {
+	//check health
+	if health.RunningHealthCheck() {
+		healthCheck()
+	}
+
+	server := os.Getenv("SEEDLINK_SERVER")
+	if server == "" {
+		log.Fatal("SEEDLINK_SERVER is not set")
+	}
+
+	streams := os.Getenv("SEEDLINK_STREAMS")
+	if streams == "" {
+		log.Fatal("SEEDLINK_STREAMS is not set")
+	}
+
+	retention, err := envDuration("RECORD_RETENTION", defaultRetention)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p, err := cfg.PostgresEnv()
+	if err != nil {
+		log.Fatalf("error reading DB config from the environment vars: %s", err)
+	}
+
+	db, err = sql.Open("postgres", p.Connection())
+	if err != nil {
+		log.Fatalf("error with DB config: %s", err)
+	}
+	defer db.Close()
+
+	saveRecord, err = db.Prepare(saveRecordSQL)
+	if err != nil {
+		log.Fatalf("preparing saveRecord statement: %s", err.Error())
+	}
+	defer saveRecord.Close()
+
+	db.SetMaxIdleConns(p.MaxIdle)
+	db.SetMaxOpenConns(p.MaxOpen)
+
+	// provide a soh heartbeat
+	health := health.New(healthCheckService, healthCheckAged, healthCheckStartup)
+
+ping:
+	for {
+		err = db.Ping()
+		if err != nil {
+			log.Println("problem pinging DB sleeping and retrying")
+			time.Sleep(time.Second * 30)
+			continue ping
+		}
+		break ping
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go purge(ctx, retention)
+
+	opts := []sl.SLinkOpt{sl.SetServer(server), sl.SetStreams(streams)}
+	if s := os.Getenv("SEEDLINK_SELECTORS"); s != "" {
+		opts = append(opts, sl.SetSelectors(s))
+	}
+
+	c := consumer{
+		slink: sl.NewSLink(opts...),
+		retry: reconnectWait,
+		process: func(r record) error {
+			if err := r.save(); err != nil {
+				return fmt.Errorf("error saving record %s.%s.%s.%s %s: %w", r.network, r.station, r.location, r.channel, r.start.Format(time.RFC3339Nano), err)
+			}
+			metrics.MsgProc()
+			health.Ok() // update soh
+			return nil
+		},
+	}
+
+	log.Printf("collecting %s from %s", streams, server)
+
+	c.run(ctx)
+
+	log.Println("system stop... ")
+}
+
+// purge deletes records older than retention every purgeInterval until ctx is cancelled.
+func purge(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := purgeRecords(time.Now().UTC().Add(-retention))
+		if err != nil {
+			log.Printf("error purging records: %s", err)
+		} else if n > 0 {
+			log.Printf("purged %d records older than %s", n, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// envDuration returns the duration in the env var key, or def if it is not set.
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	s := os.Getenv(key)
+	if s == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %s", key, s)
+	}
+
+	return d, nil
+}
+
+// check health by calling the http soh endpoint
+// cmd: ./fdsn-seedlink-consumer  -check
+func healthCheck() {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	msg, err := health.Check(ctx, healthCheckService+healthCheckPath, healthCheckTimeout)
+	if err != nil {
+		log.Printf("status: %v", err)
+		os.Exit(1)
+	}
+	log.Printf("status: %s", string(msg))
+	os.Exit(0)
+}
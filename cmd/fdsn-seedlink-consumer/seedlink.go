@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/GeoNet/kit/metrics"
+	"github.com/GeoNet/kit/seis/sl"
+)
+
+// consumer collects miniSEED records from a SeedLink server, reconnecting when the connection fails.
+type consumer struct {
+	slink   *sl.SLink
+	retry   time.Duration      // the wait before reconnecting.
+	process func(record) error // called for each record received.
+	last    map[streamID]time.Time
+}
+
+// streamID identifies a stream, the latest record start received for each stream is kept so data is
+// requested from it when reconnecting.
+type streamID struct {
+	network, station, location, channel string
+}
+
+// run collects records until ctx is cancelled.
+func (c *consumer) run(ctx context.Context) {
+	for {
+		if len(c.last) > 0 {
+			start, stations := c.resume()
+			c.slink.SetStart(start)
+			c.slink.SetState(stations...)
+		}
+
+		err := c.slink.CollectWithContext(ctx, c.collect)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("seedlink connection to %s closed, reconnecting in %s: %v", c.slink.Server, c.retry, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.retry):
+		}
+	}
+}
+
+// resume returns the times to request data from when reconnecting.  SeedLink requests are made for each
+// NET_STA in the streams, possibly with wildcards, so each is requested from the earliest of the latest
+// records received for the streams it matches.  A lagging stream is requested from its own time, data
+// already received for the other streams is received and saved again.  start is the earliest time for
+// all the streams, used for the stations there is no state for.
+func (c *consumer) resume() (start time.Time, stations []sl.Station) {
+	for _, t := range c.last {
+		if start.IsZero() || t.Before(start) {
+			start = t
+		}
+	}
+
+	for _, s := range strings.Split(c.slink.Streams, ",") {
+		// the same as the SeedLink client, NET_STA:selectors or STA for any network.
+		s, _, _ = strings.Cut(s, ":")
+		network, station, ok := strings.Cut(s, "_")
+		if !ok {
+			network, station = "*", s
+		}
+
+		var t time.Time
+		for k, v := range c.last {
+			if match(network, k.network) && match(station, k.station) && (t.IsZero() || v.Before(t)) {
+				t = v
+			}
+		}
+
+		if !t.IsZero() {
+			stations = append(stations, sl.Station{Network: network, Station: station, Sequence: -1, Timestamp: t})
+		}
+	}
+
+	// the SeedLink client can find the state for another stream matching a wildcard stream, it must
+	// not be later than the wildcard stream.
+	for i := range stations {
+		for j := range stations {
+			if i != j && match(stations[i].Network, stations[j].Network) && match(stations[i].Station, stations[j].Station) &&
+				stations[i].Timestamp.Before(stations[j].Timestamp) {
+				stations[j].Timestamp = stations[i].Timestamp
+			}
+		}
+	}
+
+	return start, stations
+}
+
+// match returns true if the SeedLink pattern, with the * and ? wildcards, matches s.
+func match(pattern, s string) bool {
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok
+}
+
+// collect implements sl.CollectFunc.  Packets that aren't miniSEED records are skipped, an error
+// processing a record closes the connection so it is received again after reconnecting.
+func (c *consumer) collect(seq string, data []byte) (bool, error) {
+	metrics.MsgRx()
+
+	r, err := newRecord(data, time.Now().UTC())
+	if err != nil {
+		log.Printf("skipping seedlink packet %s: %s", seq, err)
+		return false, nil
+	}
+
+	if err = c.process(r); err != nil {
+		return false, err
+	}
+
+	if c.last == nil {
+		c.last = make(map[streamID]time.Time)
+	}
+
+	id := streamID{network: r.network, station: r.station, location: r.location, channel: r.channel}
+	if r.start.After(c.last[id]) {
+		c.last[id] = r.start
+	}
+
+	return false, nil
+}
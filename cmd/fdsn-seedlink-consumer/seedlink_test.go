@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ms "github.com/GeoNet/kit/seis/ms"
+	"github.com/GeoNet/kit/seis/sl"
+)
+
+// seedLink is a small in-process SeedLink server.  Each connection is sent the records
+// after the handshake and then closed.
+type seedLink struct {
+	net.Listener
+	records [][]byte
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newSeedLink(t *testing.T, records [][]byte) *seedLink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &seedLink{Listener: l, records: records}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	return s
+}
+
+func (s *seedLink) serve(c net.Conn) {
+	defer func() { _ = c.Close() }()
+
+	r := bufio.NewReader(c)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.TrimSpace(line)
+		if cmd == "" {
+			continue
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+
+		switch f := strings.Fields(cmd); f[0] {
+		case "HELLO":
+			_, err = c.Write([]byte("SeedLink v3.1 (test) :: SLPROTO:3.1 NSWILDCARD\r\ntest\r\n"))
+		case "INFO":
+			_, err = c.Write(infoPacket(`<seedlink software="test"><capability name="info:id"/></seedlink>`))
+		case "STATION", "SELECT", "TIME", "DATA":
+			_, err = c.Write([]byte("OK\r\n"))
+		case "END":
+			for i, v := range s.records {
+				if _, err = c.Write(append([]byte(fmt.Sprintf("SL%06X", i+1)), v...)); err != nil {
+					return
+				}
+			}
+			return
+		default:
+			_, err = c.Write([]byte("ERROR\r\n"))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// infoPacket returns a SeedLink INFO packet with the xml.
+func infoPacket(xml string) []byte {
+	p := make([]byte, sl.PacketSize)
+	copy(p, "SLINFO  ")
+	binary.BigEndian.PutUint16(p[8+44:8+46], 64)
+	copy(p[8+64:], xml)
+	return p
+}
+
+// testRecord returns a 512 byte miniSEED record with 60 samples at 1 Hz.
+func testRecord(station string, start time.Time) []byte {
+	hdr := ms.RecordHeader{
+		SequenceNumber:       [6]byte{'0', '0', '0', '0', '0', '1'},
+		DataQualityIndicator: 'D',
+		ReservedByte:         ' ',
+		NumberOfSamples:      60,
+		SampleRateFactor:     1,
+		SampleRateMultiplier: 1,
+		BeginningOfData:      64,
+	}
+	hdr.SetNetwork("NZ")
+	hdr.SetStation(station)
+	hdr.SetLocation("10")
+	hdr.SetChannel("HHZ")
+	hdr.SetStartTime(start)
+
+	record := make([]byte, 512)
+	copy(record, ms.EncodeRecordHeader(hdr))
+
+	return record
+}
+
+func TestConsumer(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Second).Add(-2 * time.Minute)
+
+	s := newSeedLink(t, [][]byte{
+		testRecord("WEL", start),
+		make([]byte, 512), // not a miniSEED record, skipped.
+		testRecord("WEL", start.Add(time.Minute)),
+		testRecord("SNZO", start),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var received []record
+
+	c := consumer{
+		slink: sl.NewSLink(sl.SetServer(s.Addr().String()), sl.SetStreams("NZ_*"), sl.SetSelectors("10HHZ"), sl.SetTimeout(time.Second)),
+		retry: 10 * time.Millisecond,
+		process: func(r record) error {
+			received = append(received, r)
+			// stop after the records have been received twice, once for each connection.
+			if len(received) == 6 {
+				cancel()
+			}
+			return nil
+		},
+	}
+
+	c.run(ctx)
+
+	if len(received) != 6 {
+		t.Fatalf("expected 6 records got %d", len(received))
+	}
+
+	r := received[0]
+	if r.network != "NZ" || r.station != "WEL" || r.location != "10" || r.channel != "HHZ" || !r.start.Equal(start) || len(r.raw) != 512 {
+		t.Errorf("unexpected record %s.%s.%s.%s %s %d bytes", r.network, r.station, r.location, r.channel, r.start, len(r.raw))
+	}
+
+	// the record starts two minutes ago and the last sample is 59 s later.
+	if r.latencyData < 120 || r.latencyData > 130 || math.Abs(r.latencyData-r.latencyTx-59) > 1e-6 {
+		t.Errorf("unexpected latency data %f tx %f", r.latencyData, r.latencyTx)
+	}
+
+	if v := c.last[streamID{network: "NZ", station: "WEL", location: "10", channel: "HHZ"}]; !v.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected the last WEL record start %s got %s", start.Add(time.Minute), v)
+	}
+	if v := c.last[streamID{network: "NZ", station: "SNZO", location: "10", channel: "HHZ"}]; !v.Equal(start) {
+		t.Errorf("expected the last SNZO record start %s got %s", start, v)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stations, times []string
+	for _, v := range s.commands {
+		switch {
+		case strings.HasPrefix(v, "STATION"):
+			stations = append(stations, v)
+		case strings.HasPrefix(v, "TIME"):
+			times = append(times, v)
+		}
+	}
+
+	if len(stations) != 2 || stations[0] != "STATION * NZ" {
+		t.Errorf("unexpected station commands %v", stations)
+	}
+
+	// the reconnection requests data from the last record of the stream that is furthest behind.
+	if len(times) != 1 || times[0] != "TIME "+start.Format("2006,01,02,15,04,05") {
+		t.Errorf("unexpected time commands %v", times)
+	}
+}
+
+func TestConsumerResume(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Second).Add(-10 * time.Minute)
+
+	s := newSeedLink(t, [][]byte{
+		testRecord("WEL", start),
+		testRecord("WEL", start.Add(5*time.Minute)),
+		testRecord("SNZO", start.Add(time.Minute)),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var received int
+
+	c := consumer{
+		slink: sl.NewSLink(sl.SetServer(s.Addr().String()), sl.SetStreams("NZ_WEL,NZ_SNZO"), sl.SetTimeout(time.Second)),
+		retry: 10 * time.Millisecond,
+		process: func(r record) error {
+			received++
+			if received == 6 {
+				cancel()
+			}
+			return nil
+		},
+	}
+
+	c.run(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var times []string
+	for _, v := range s.commands {
+		if strings.HasPrefix(v, "TIME") {
+			times = append(times, v)
+		}
+	}
+
+	// each station is requested from its own last record.
+	expected := []string{
+		"TIME " + start.Add(5*time.Minute).Format("2006,01,02,15,04,05"),
+		"TIME " + start.Add(time.Minute).Format("2006,01,02,15,04,05"),
+	}
+
+	if len(times) != 2 || times[0] != expected[0] || times[1] != expected[1] {
+		t.Errorf("expected time commands %v got %v", expected, times)
+	}
+}
+
+func TestConsumerResumeWildcard(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	c := consumer{
+		slink: sl.NewSLink(sl.SetStreams("NZ_*,NZ_WEL:HHZ,SNZO")),
+		last: map[streamID]time.Time{
+			{network: "NZ", station: "WEL", location: "10", channel: "HHZ"}:  start.Add(time.Hour),
+			{network: "NZ", station: "WEL", location: "10", channel: "HHN"}:  start.Add(2 * time.Hour),
+			{network: "NZ", station: "KHZ", location: "10", channel: "HHZ"}:  start.Add(3 * time.Hour),
+			{network: "IU", station: "SNZO", location: "10", channel: "BHZ"}: start,
+		},
+	}
+
+	s, stations := c.resume()
+
+	if !s.Equal(start) {
+		t.Errorf("expected start %s got %s", start, s)
+	}
+
+	expected := []sl.Station{
+		{Network: "NZ", Station: "*", Sequence: -1, Timestamp: start.Add(time.Hour)},
+		{Network: "NZ", Station: "WEL", Sequence: -1, Timestamp: start.Add(time.Hour)},
+		{Network: "*", Station: "SNZO", Sequence: -1, Timestamp: start},
+	}
+
+	if len(stations) != len(expected) {
+		t.Fatalf("expected %d stations got %d", len(expected), len(stations))
+	}
+
+	for i, v := range expected {
+		if stations[i] != v {
+			t.Errorf("expected %+v got %+v", v, stations[i])
+		}
+	}
+}
+
+func TestConsumerProcessError(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Second)
+
+	s := newSeedLink(t, [][]byte{testRecord("WEL", start), testRecord("WEL", start.Add(time.Minute))})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var calls int
+
+	c := consumer{
+		slink: sl.NewSLink(sl.SetServer(s.Addr().String()), sl.SetStreams("NZ_WEL"), sl.SetTimeout(time.Second)),
+		retry: 10 * time.Millisecond,
+		process: func(r record) error {
+			calls++
+			if calls == 1 {
+				return fmt.Errorf("DB unavailable")
+			}
+			cancel()
+			return nil
+		},
+	}
+
+	c.run(ctx)
+
+	// the first record failed and wasn't recorded as received, the connection was reopened
+	// without a start time and the record received again.
+	if v := c.last[streamID{network: "NZ", station: "WEL", location: "10", channel: "HHZ"}]; calls != 2 || !v.Equal(start) {
+		t.Errorf("expected 2 calls and the last record start %s got %d %s", start, calls, v)
+	}
+}
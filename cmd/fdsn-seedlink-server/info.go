@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/xml"
+	"time"
+
+	ms "github.com/GeoNet/kit/seis/ms"
+)
+
+const (
+	software       = "fdsn-seedlink-server"
+	infoTimeFormat = "2006/01/02 15:04:05.0000"
+)
+
+// helloLines returns the response to HELLO, the version and capabilities then the organization.
+func helloLines() string {
+	return "SeedLink v3.1 (" + software + ") :: SLPROTO:3.1 NSWILDCARD\r\n" + organization + "\r\n"
+}
+
+type infoXML struct {
+	XMLName      xml.Name         `xml:"seedlink"`
+	Software     string           `xml:"software,attr"`
+	Organization string           `xml:"organization,attr"`
+	Started      string           `xml:"started,attr"`
+	Capability   []infoCapability `xml:"capability,omitempty"`
+	Station      []infoStation    `xml:"station,omitempty"`
+}
+
+type infoCapability struct {
+	Name string `xml:"name,attr"`
+}
+
+type infoStation struct {
+	Name        string       `xml:"name,attr"`
+	Network     string       `xml:"network,attr"`
+	Description string       `xml:"description,attr"`
+	BeginSeq    string       `xml:"begin_seq,attr"`
+	EndSeq      string       `xml:"end_seq,attr"`
+	StreamCheck string       `xml:"stream_check,attr"`
+	Stream      []infoStream `xml:"stream,omitempty"`
+}
+
+type infoStream struct {
+	Location  string `xml:"location,attr"`
+	Seedname  string `xml:"seedname,attr"`
+	Type      string `xml:"type,attr"`
+	BeginTime string `xml:"begin_time,attr"`
+	EndTime   string `xml:"end_time,attr"`
+}
+
+// streamInfo is a stream with records in fdsn.record.
+type streamInfo struct {
+	network, station, location, channel string
+	start, end                          time.Time
+}
+
+var capabilities = []infoCapability{
+	{Name: "dialup"},
+	{Name: "multistation"},
+	{Name: "window-extraction"},
+	{Name: "info:id"},
+	{Name: "info:capabilities"},
+	{Name: "info:stations"},
+	{Name: "info:streams"},
+}
+
+// infoLevels are the INFO levels that are supported.
+var infoLevels = map[string]bool{"ID": true, "CAPABILITIES": true, "STATIONS": true, "STREAMS": true}
+
+// infoDocument returns the xml for an INFO level.  streams are used for the STATIONS and STREAMS levels.
+func infoDocument(level string, streams []streamInfo) ([]byte, error) {
+	doc := infoXML{
+		Software:     software,
+		Organization: organization,
+		Started:      started.Format(infoTimeFormat),
+	}
+
+	switch level {
+	case "CAPABILITIES":
+		doc.Capability = capabilities
+	case "STATIONS", "STREAMS":
+		index := make(map[string]int)
+		var begin, end []time.Time
+
+		for _, s := range streams {
+			k := s.network + "_" + s.station
+			i, ok := index[k]
+			if !ok {
+				i = len(doc.Station)
+				index[k] = i
+				doc.Station = append(doc.Station, infoStation{Name: s.station, Network: s.network, StreamCheck: "enabled"})
+				begin = append(begin, s.start)
+				end = append(end, s.end)
+			}
+
+			if s.start.Before(begin[i]) {
+				begin[i] = s.start
+			}
+			if s.end.After(end[i]) {
+				end[i] = s.end
+			}
+
+			if level == "STREAMS" {
+				doc.Station[i].Stream = append(doc.Station[i].Stream, infoStream{
+					Location:  s.location,
+					Seedname:  s.channel,
+					Type:      "D",
+					BeginTime: s.start.Format(infoTimeFormat),
+					EndTime:   s.end.Format(infoTimeFormat),
+				})
+			}
+		}
+
+		for i := range doc.Station {
+			doc.Station[i].BeginSeq = sequence(begin[i])
+			doc.Station[i].EndSeq = sequence(end[i])
+		}
+	}
+
+	return xml.Marshal(doc)
+}
+
+// infoPackets returns the SeedLink INFO packets for doc.  Each packet is a miniSEED log record with part of
+// doc, all but the last packet have the sequence INFO *.
+func infoPackets(doc []byte) [][]byte {
+	const dataOffset = ms.RecordHeaderSize + ms.BlocketteHeaderSize + ms.Blockette1000Size
+	const chunk = recordLength - dataOffset
+
+	var packets [][]byte
+
+	now := time.Now().UTC()
+
+	for len(doc) > 0 || len(packets) == 0 {
+		n := min(chunk, len(doc))
+
+		hdr := ms.RecordHeader{
+			SequenceNumber:               [6]byte{'0', '0', '0', '0', '0', '0'},
+			DataQualityIndicator:         'D',
+			ReservedByte:                 ' ',
+			NumberOfSamples:              uint16(n),
+			NumberOfBlockettesThatFollow: 1,
+			BeginningOfData:              dataOffset,
+			FirstBlockette:               ms.RecordHeaderSize,
+		}
+		hdr.SetNetwork("SL")
+		hdr.SetStation("INFO")
+		hdr.SetChannel("LOG")
+		hdr.SetStartTime(now)
+
+		p := make([]byte, 8+recordLength)
+		copy(p, "SLINFO  ")
+		copy(p[8:], ms.EncodeRecordHeader(hdr))
+		copy(p[8+ms.RecordHeaderSize:], ms.EncodeBlocketteHeader(ms.BlocketteHeader{BlocketteType: 1000}))
+		copy(p[8+ms.RecordHeaderSize+ms.BlocketteHeaderSize:], ms.EncodeBlockette1000(ms.Blockette1000{
+			Encoding:     uint8(ms.EncodingASCII),
+			WordOrder:    uint8(ms.BigEndian),
+			RecordLength: 9, // 2^9 = 512
+		}))
+		copy(p[8+dataOffset:], doc[:n])
+
+		doc = doc[n:]
+		packets = append(packets, p)
+	}
+
+	for _, p := range packets[:len(packets)-1] {
+		p[7] = '*'
+	}
+
+	return packets
+}
@@ -0,0 +1,253 @@
+// fdsn-seedlink-server is a SeedLink v3 server for the miniSEED data served by fdsn-ws dataselect.
+// Real time data comes from the records saved to fdsn.record by fdsn-seedlink-consumer, time window
+// requests (TIME, or DATA and FETCH with a sequence number) are also served from the miniSEED archive
+// using the holdings.  Network and station patterns use the FDSN wildcards * and ?, the same as dataselect.
+// The data served is the same as dataselect, the networks and stations in DATASELECT_ROUTES, or the
+// default routes for S3_BUCKET, that are not in FDSN_RESTRICTED.
+//
+// Sequence numbers are the record start time in seconds modulo 2^24, so they can be used to resume a
+// connection to any instance of the server for up to 194 days.  DATA and FETCH with a sequence number
+// resume with the records that start after that second.  FETCH without a sequence number sends END
+// straight away.  SeedLink v4 is not supported.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/kit/cfg"
+	"github.com/GeoNet/kit/health"
+	_ "github.com/lib/pq"
+)
+
+const (
+	healthCheckAged    = 5 * time.Minute  //need to have a good heartbeat within this time
+	healthCheckStartup = 5 * time.Minute  //ignore heartbeat messages for this time after starting
+	healthCheckTimeout = 30 * time.Second //health check timeout
+	healthCheckService = ":7777"          //end point to listen to for SOH checks
+	healthCheckPath    = "/soh"
+
+	defaultPort        = ":18000"
+	defaultMaxWindow   = 24 * time.Hour   // the default longest time window a client can request.
+	defaultConnections = 100              // the default maximum number of client connections.
+	pollInterval       = time.Second      // how often fdsn.record is polled for new records.
+	pingInterval       = 30 * time.Second // how often the DB is checked for the soh heartbeat.
+)
+
+var (
+	organization   = "GeoNet"
+	started        = time.Now().UTC()
+	dataRoutes     archive.Routes         // the data that is served and where it is stored, see DATASELECT_ROUTES.
+	restrictedData []archive.StreamAccess // data that is not served, see FDSN_RESTRICTED.
+)
+
+func main() {
+	//check health
+	if health.RunningHealthCheck() {
+		healthCheck()
+	}
+
+	port := os.Getenv("SEEDLINK_PORT")
+	if port == "" {
+		port = defaultPort
+	}
+
+	if o := os.Getenv("SEEDLINK_ORGANIZATION"); o != "" {
+		organization = o
+	}
+
+	maxWindow, err := envDuration("SEEDLINK_MAX_WINDOW", defaultMaxWindow)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	maxConnections, err := envInt("SEEDLINK_MAX_CONNECTIONS", defaultConnections)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if restrictedData, err = archive.ParseStreamAccess(os.Getenv("FDSN_RESTRICTED")); err != nil {
+		log.Fatalf("error reading FDSN_RESTRICTED: %s", err)
+	}
+
+	s3Client, err := archive.NewS3Client(3)
+	if err != nil {
+		log.Fatalf("error creating S3 client: %s", err)
+	}
+
+	if dataRoutes, err = archive.LoadRoutes(os.Getenv("DATASELECT_ROUTES"), os.Getenv("S3_BUCKET"), s3Client); err != nil {
+		log.Fatalf("error reading the dataselect routes: %s", err)
+	}
+
+	p, err := cfg.PostgresEnv()
+	if err != nil {
+		log.Fatalf("error reading DB config from the environment vars: %s", err)
+	}
+
+	db, err := sql.Open("postgres", p.Connection())
+	if err != nil {
+		log.Fatalf("error with DB config: %s", err)
+	}
+	defer db.Close()
+
+	db.SetMaxIdleConns(p.MaxIdle)
+	db.SetMaxOpenConns(p.MaxOpen)
+
+	// provide a soh heartbeat
+	health := health.New(healthCheckService, healthCheckAged, healthCheckStartup)
+
+ping:
+	for {
+		err = db.Ping()
+		if err != nil {
+			log.Println("problem pinging DB sleeping and retrying")
+			time.Sleep(time.Second * 30)
+			continue ping
+		}
+		break ping
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := db.Ping(); err != nil {
+				log.Printf("error pinging DB: %s", err)
+			} else {
+				health.Ok() // update soh
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	l, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server{
+		source:         dbSource{db: db},
+		poll:           pollInterval,
+		maxWindow:      maxWindow,
+		maxConnections: maxConnections,
+	}
+
+	log.Printf("starting SeedLink server on %s", port)
+
+	srv.serve(ctx, l)
+
+	log.Println("system stop... ")
+}
+
+// server accepts SeedLink connections.
+type server struct {
+	source         dataSource
+	poll           time.Duration
+	maxWindow      time.Duration
+	maxConnections int
+}
+
+// serve accepts connections on l until ctx is cancelled.  Connections over the limit are closed.
+func (s server) serve(ctx context.Context, l net.Listener) {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	sem := make(chan struct{}, s.maxConnections)
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("error accepting connection: %s", err)
+			}
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			log.Printf("closing connection from %s, there are already %d connections", c.RemoteAddr(), s.maxConnections)
+			_ = c.Close()
+			continue
+		}
+
+		go func() {
+			defer func() { <-sem }()
+			defer func() { _ = c.Close() }()
+
+			sess := session{conn: c, source: s.source, poll: s.poll, maxWindow: s.maxWindow}
+
+			err := sess.serve(ctx)
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("connection from %s closed: %s", c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// envDuration returns the duration in the env var key, or def if it is not set.
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	s := os.Getenv(key)
+	if s == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %s", key, s)
+	}
+
+	return d, nil
+}
+
+// envInt returns the positive int in the env var key, or def if it is not set.
+func envInt(key string, def int) (int, error) {
+	s := os.Getenv(key)
+	if s == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil || i <= 0 {
+		return 0, fmt.Errorf("invalid %s %s", key, s)
+	}
+
+	return i, nil
+}
+
+// check health by calling the http soh endpoint
+// cmd: ./fdsn-seedlink-server  -check
+func healthCheck() {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	msg, err := health.Check(ctx, healthCheckService+healthCheckPath, healthCheckTimeout)
+	if err != nil {
+		log.Printf("status: %v", err)
+		os.Exit(1)
+	}
+	log.Printf("status: %s", string(msg))
+	os.Exit(0)
+}
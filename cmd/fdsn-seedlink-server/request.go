@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/fdsn/internal/fdsn"
+)
+
+// SeedLink time arguments e.g., 2024,01,02,15,04,05
+const timeFormat = "2006,01,02,15,04,05"
+
+// sequenceMod is the range of the six hex digit SeedLink sequence numbers.
+const sequenceMod = 1 << 24
+
+// stationRequest is a STATION command with its selectors and time window.
+type stationRequest struct {
+	network, station string   // with the FDSN wildcards * and ?
+	selectors        []string // location and channel selectors e.g., 10HH? or HH?
+
+	start, end time.Time // the start of the data to send, zero for data received from now on.  end is zero for no end.
+}
+
+// searches returns the patterns for the network, station and each selector for querying the holdings and records.
+func (r stationRequest) searches() ([]fdsn.DataSearch, error) {
+	ne, err := fdsn.GenRegex([]string{r.network}, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %s", r.network)
+	}
+
+	st, err := fdsn.GenRegex([]string{r.station}, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid station %s", r.station)
+	}
+
+	selectors := r.selectors
+	if len(selectors) == 0 {
+		selectors = []string{"*"}
+	}
+
+	var d []fdsn.DataSearch
+
+	for _, s := range selectors {
+		lo, ch, err := parseSelector(s)
+		if err != nil {
+			return nil, err
+		}
+
+		d = append(d, fdsn.DataSearch{
+			Start:    r.start,
+			End:      r.end,
+			Network:  ne[0],
+			Station:  st[0],
+			Location: lo,
+			Channel:  ch,
+		})
+	}
+
+	return d, nil
+}
+
+// parseSelector returns the location and channel patterns for a SeedLink selector, LLCCC or CCC with
+// an optional .D type.  Only data records can be selected and negated selectors are not supported.
+// -- is the empty location.
+func parseSelector(s string) (location, channel string, err error) {
+	if strings.HasPrefix(s, "!") {
+		return "", "", fmt.Errorf("negated selectors are not supported: %s", s)
+	}
+
+	if p, t, ok := strings.Cut(s, "."); ok {
+		if t != "D" {
+			return "", "", fmt.Errorf("only data records can be selected: %s", s)
+		}
+		s = p
+	}
+
+	var lo, ch string
+
+	switch len(s) {
+	case 1:
+		if s != "*" {
+			return "", "", fmt.Errorf("invalid selector %s", s)
+		}
+		lo, ch = "*", "*"
+	case 3:
+		lo, ch = "*", s
+	case 5:
+		lo, ch = s[:2], s[2:]
+	default:
+		return "", "", fmt.Errorf("invalid selector %s", s)
+	}
+
+	c, err := fdsn.GenRegex([]string{ch}, false, false)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid selector %s", s)
+	}
+
+	if lo == "--" {
+		return `^$`, c[0], nil
+	}
+
+	l, err := fdsn.GenRegex([]string{lo}, false, false)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid selector %s", s)
+	}
+
+	return l[0], c[0], nil
+}
+
+// parseTime parses a SeedLink time argument.
+func parseTime(s string) (time.Time, error) {
+	// the seconds can be left off.
+	if strings.Count(s, ",") == 4 {
+		s += ",00"
+	}
+
+	return time.Parse(timeFormat, s)
+}
+
+// sequence returns the SeedLink sequence number for a record, the start time in seconds modulo 2^24.
+func sequence(start time.Time) string {
+	return fmt.Sprintf("%06X", start.Unix()%sequenceMod)
+}
+
+// sequenceTime returns the latest time at or before now with the sequence number seq.
+func sequenceTime(seq string, now time.Time) (time.Time, error) {
+	s, err := strconv.ParseInt(seq, 16, 64)
+	if err != nil || s < 0 || s >= sequenceMod {
+		return time.Time{}, fmt.Errorf("invalid sequence number %s", seq)
+	}
+
+	n := now.Unix()
+
+	return time.Unix(n-((n-s)%sequenceMod+sequenceMod)%sequenceMod, 0).UTC(), nil
+}
+
+// served returns true if the data for network and station is served by dataselect and is not restricted.
+func served(network, station string) bool {
+	return dataRoutes.Stream(network, station) != nil && !archive.AnyMatches(restrictedData, network, station)
+}
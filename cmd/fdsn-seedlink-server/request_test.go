@@ -0,0 +1,137 @@
+package main
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func loc() string {
+	_, _, l, _ := runtime.Caller(1)
+	return "L" + strconv.Itoa(l)
+}
+
+func TestParseSelector(t *testing.T) {
+	in := []struct {
+		id                string
+		selector          string
+		location, channel string
+		err               bool
+	}{
+		{id: loc(), selector: "*", location: `^.*$`, channel: `^.*$`},
+		{id: loc(), selector: "HHZ", location: `^.*$`, channel: `^HHZ$`},
+		{id: loc(), selector: "HH?", location: `^.*$`, channel: `^HH.$`},
+		{id: loc(), selector: "10HH?", location: `^10$`, channel: `^HH.$`},
+		{id: loc(), selector: "??EH?.D", location: `^..$`, channel: `^EH.$`},
+		{id: loc(), selector: "--LHZ", location: `^$`, channel: `^LHZ$`},
+		{id: loc(), selector: "!LHZ", err: true},
+		{id: loc(), selector: "HHZ.E", err: true},
+		{id: loc(), selector: "HHZZ", err: true},
+		{id: loc(), selector: "", err: true},
+	}
+
+	for _, v := range in {
+		l, c, err := parseSelector(v.selector)
+		if v.err {
+			if err == nil {
+				t.Errorf("%s expected an error for %q", v.id, v.selector)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s unexpected error %s", v.id, err)
+			continue
+		}
+		if l != v.location || c != v.channel {
+			t.Errorf("%s expected %s %s got %s %s", v.id, v.location, v.channel, l, c)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	in := []struct {
+		id   string
+		s    string
+		time time.Time
+		err  bool
+	}{
+		{id: loc(), s: "2024,01,02,15,04,05", time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{id: loc(), s: "2024,01,02,15,04", time: time.Date(2024, 1, 2, 15, 4, 0, 0, time.UTC)},
+		{id: loc(), s: "2024-01-02T15:04:05", err: true},
+	}
+
+	for _, v := range in {
+		tm, err := parseTime(v.s)
+		if v.err != (err != nil) {
+			t.Errorf("%s unexpected error %v", v.id, err)
+			continue
+		}
+		if !tm.Equal(v.time) {
+			t.Errorf("%s expected %s got %s", v.id, v.time, tm)
+		}
+	}
+}
+
+func TestSequenceTime(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	in := []struct {
+		id   string
+		time time.Time
+	}{
+		{id: loc(), time: now},
+		{id: loc(), time: now.Add(-time.Hour)},
+		{id: loc(), time: now.Add(-100 * 24 * time.Hour)},
+		{id: loc(), time: now.Add(-sequenceMod*time.Second + time.Second)},
+	}
+
+	for _, v := range in {
+		tm, err := sequenceTime(sequence(v.time), now)
+		if err != nil {
+			t.Errorf("%s unexpected error %s", v.id, err)
+			continue
+		}
+		if !tm.Equal(v.time) {
+			t.Errorf("%s expected %s got %s", v.id, v.time, tm)
+		}
+	}
+
+	for _, s := range []string{"", "XYZ", "1000000", "-1"} {
+		if _, err := sequenceTime(s, now); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestStationRequestSearches(t *testing.T) {
+	r := stationRequest{network: "NZ", station: "W?L", selectors: []string{"10HHZ", "EH?"}}
+
+	d, err := r.searches()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d) != 2 {
+		t.Fatalf("expected 2 searches got %d", len(d))
+	}
+
+	if d[0].Network != `^NZ$` || d[0].Station != `^W.L$` || d[0].Location != `^10$` || d[0].Channel != `^HHZ$` {
+		t.Errorf("unexpected search %+v", d[0])
+	}
+
+	if d[1].Location != `^.*$` || d[1].Channel != `^EH.$` {
+		t.Errorf("unexpected search %+v", d[1])
+	}
+
+	r.selectors = nil
+
+	d, err = r.searches()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d) != 1 || d[0].Location != `^.*$` || d[0].Channel != `^.*$` {
+		t.Errorf("expected all streams got %+v", d)
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/kit/metrics"
+)
+
+const (
+	handshakeTimeout = 2 * time.Minute  // the time allowed between commands before END.
+	writeTimeout     = 30 * time.Second // the time allowed to write a response or packet.
+	receiptOverlap   = 30 * time.Second // polls for records received since the last poll, less this to allow for clock skew and slow commits.
+	lateRecords      = time.Minute      // how long after the end of a time window to wait for late records.
+)
+
+// session is a SeedLink client connection.
+type session struct {
+	conn      net.Conn
+	source    dataSource
+	poll      time.Duration // how often fdsn.record is polled for new records.
+	maxWindow time.Duration // the longest time window that can be requested.
+
+	requests []*request
+	current  *request // the request for the latest STATION command, until the action command.
+
+	mu sync.Mutex // for writes to conn after END.
+}
+
+// request is a station request and its state once data is being sent.
+type request struct {
+	stationRequest
+	fetch    bool // FETCH, the request is finished after the data available now has been sent.
+	resume   bool // DATA or FETCH with a sequence number, only records starting at or after start are sent.
+	searches []fdsn.DataSearch
+	done     bool
+}
+
+// errBye is returned when the client closes the session.
+var errBye = errors.New("BYE")
+
+// serve runs the session until the client closes the connection, all the requests are finished, or ctx is cancelled.
+func (s *session) serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = s.conn.Close()
+	}()
+
+	r := bufio.NewReader(s.conn)
+
+	for {
+		if err := s.conn.SetReadDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+			return err
+		}
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(f[0]) {
+		case "END":
+			s.implicitData()
+			if len(s.requests) == 0 {
+				err = s.write([]byte("ERROR\r\n"))
+				break
+			}
+			return s.stream(ctx, r)
+		case "BYE":
+			return nil
+		default:
+			err = s.command(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// command responds to a handshaking command.  Uni-station mode, action commands without a STATION
+// command, is not supported.
+func (s *session) command(f []string) error {
+	cmd, args := strings.ToUpper(f[0]), f[1:]
+
+	switch cmd {
+	case "HELLO":
+		return s.write([]byte(helloLines()))
+	case "INFO":
+		return s.info(args)
+	case "STATION":
+		if len(args) < 1 || len(args) > 2 {
+			return s.fail(cmd, fmt.Errorf("expected a station and optional network"))
+		}
+		network := "*"
+		if len(args) == 2 {
+			network = args[1]
+		}
+		s.implicitData()
+		r := &request{stationRequest: stationRequest{network: strings.ToUpper(network), station: strings.ToUpper(args[0])}}
+		if _, err := r.stationRequest.searches(); err != nil {
+			return s.fail(cmd, err)
+		}
+		s.current = r
+		return s.ok()
+	case "SELECT":
+		if s.current == nil {
+			return s.fail(cmd, fmt.Errorf("no STATION"))
+		}
+		if len(args) == 0 {
+			s.current.selectors = nil
+			return s.ok()
+		}
+		for _, v := range args {
+			if _, _, err := parseSelector(strings.ToUpper(v)); err != nil {
+				return s.fail(cmd, err)
+			}
+		}
+		s.current.selectors = append(s.current.selectors, upper(args)...)
+		return s.ok()
+	case "DATA", "FETCH", "TIME":
+		if s.current == nil {
+			return s.fail(cmd, fmt.Errorf("no STATION"))
+		}
+		if err := s.action(cmd, args); err != nil {
+			return s.fail(cmd, err)
+		}
+		s.requests = append(s.requests, s.current)
+		s.current = nil
+		return s.ok()
+	default:
+		return s.fail(cmd, fmt.Errorf("not supported"))
+	}
+}
+
+// implicitData adds the current request, if there wasn't an action command for it, as a DATA request
+// for the records received from now on.
+func (s *session) implicitData() {
+	if s.current == nil {
+		return
+	}
+
+	if err := s.action("DATA", nil); err != nil {
+		log.Printf("%s STATION %s %s: %s", s.conn.RemoteAddr(), s.current.station, s.current.network, err)
+	} else {
+		s.requests = append(s.requests, s.current)
+	}
+
+	s.current = nil
+}
+
+// action sets the time window for the current request from a DATA, FETCH, or TIME command.
+func (s *session) action(cmd string, args []string) error {
+	now := time.Now().UTC()
+	r := s.current
+
+	switch cmd {
+	case "DATA", "FETCH":
+		if len(args) > 2 {
+			return fmt.Errorf("expected an optional sequence number and start time")
+		}
+		r.fetch = cmd == "FETCH"
+		if len(args) > 0 {
+			t, err := sequenceTime(args[0], now)
+			if err != nil {
+				return err
+			}
+			// the sequence number is the start second of the last record the client has for the station,
+			// resume after it rather than sending the records it already has again.
+			r.start = t.Add(time.Second)
+			r.resume = true
+		}
+	case "TIME":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("expected a start and optional end time")
+		}
+		t, err := parseTime(args[0])
+		if err != nil {
+			return err
+		}
+		r.start = t
+		if len(args) == 2 {
+			if r.end, err = parseTime(args[1]); err != nil {
+				return err
+			}
+			if !r.end.After(r.start) {
+				return fmt.Errorf("the end time must be after the start time")
+			}
+		}
+	}
+
+	if !r.start.IsZero() {
+		end := r.end
+		if end.IsZero() || end.After(now) {
+			end = now
+		}
+		if end.Sub(r.start) > s.maxWindow {
+			return fmt.Errorf("the time window is longer than %s", s.maxWindow)
+		}
+	}
+
+	var err error
+	r.searches, err = r.stationRequest.searches()
+
+	return err
+}
+
+// info writes the INFO packets for a level.
+func (s *session) info(args []string) error {
+	if len(args) != 1 || !infoLevels[strings.ToUpper(args[0])] {
+		return s.fail("INFO", fmt.Errorf("unsupported level %v", args))
+	}
+
+	level := strings.ToUpper(args[0])
+
+	var streams []streamInfo
+	if level == "STATIONS" || level == "STREAMS" {
+		var err error
+		if streams, err = s.source.streams(); err != nil {
+			log.Printf("error finding the streams for INFO %s: %s", level, err)
+			return s.write([]byte("ERROR\r\n"))
+		}
+		streams = allowedStreams(streams)
+	}
+
+	doc, err := infoDocument(level, streams)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range infoPackets(doc) {
+		if err := s.write(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allowedStreams removes the streams that are not served.
+func allowedStreams(streams []streamInfo) []streamInfo {
+	var allowed []streamInfo
+
+	for _, v := range streams {
+		if served(v.network, v.station) {
+			allowed = append(allowed, v)
+		}
+	}
+
+	return allowed
+}
+
+// stream sends the data for the requests.  Records already available are sent first, the archive
+// and then fdsn.record, followed by records as they are received.  r is read for INFO keep alives
+// and BYE.
+func (s *session) stream(ctx context.Context, r *bufio.Reader) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	go func() {
+		cancel(s.commands(r))
+	}()
+
+	// the records that have been sent and when they were received, for removing duplicates.
+	sent := make(map[string]time.Time)
+	started := time.Now().UTC()
+
+	send := func(rr rawRecord) error {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if !served(rr.network, rr.station) {
+			return nil
+		}
+
+		id := rr.network + "." + rr.station + "." + rr.location + "." + rr.channel + " " + rr.start.Format(time.RFC3339Nano)
+		if _, ok := sent[id]; ok {
+			return nil
+		}
+
+		received := rr.received
+		if received.IsZero() {
+			received = started
+		}
+		sent[id] = received
+
+		return s.write(append([]byte("SL"+sequence(rr.start)), rr.raw...))
+	}
+
+	for _, v := range s.requests {
+		// FETCH only sends the data available now, with no start time there is none.
+		v.done = v.fetch
+
+		if v.start.IsZero() {
+			continue
+		}
+
+		fn := send
+		if v.resume {
+			// the archive also has the records that start before, and overlap, the start time.
+			fn = func(rr rawRecord) error {
+				if rr.start.Before(v.start) {
+					return nil
+				}
+				return send(rr)
+			}
+		}
+
+		var searches []fdsn.DataSearch
+
+		for _, d := range v.searches {
+			archive := d
+			if archive.End.IsZero() || archive.End.After(started) {
+				archive.End = started
+			}
+
+			if err := s.source.archive(archive, fn); err != nil {
+				return done(ctx, err)
+			}
+
+			searches = append(searches, window(d))
+		}
+
+		if err := s.source.records(searches, time.Time{}, fn); err != nil {
+			return done(ctx, err)
+		}
+	}
+
+	cursor := started
+
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+
+	for {
+		if s.finished(time.Now().UTC()) {
+			return s.write([]byte("END"))
+		}
+
+		select {
+		case <-ctx.Done():
+			return done(ctx, nil)
+		case <-ticker.C:
+		}
+
+		now := time.Now().UTC()
+		from := cursor.Add(-receiptOverlap)
+
+		// one query for all the requests that are still streaming.
+		var searches []fdsn.DataSearch
+
+		for _, v := range s.requests {
+			if v.done {
+				continue
+			}
+
+			for _, d := range v.searches {
+				if d.Start.IsZero() {
+					d.Start = started.Add(-time.Hour)
+				}
+
+				searches = append(searches, window(d))
+			}
+		}
+
+		if err := s.source.records(searches, from, send); err != nil {
+			return done(ctx, err)
+		}
+
+		for k, v := range sent {
+			if v.Before(from) {
+				delete(sent, k)
+			}
+		}
+
+		cursor = now
+	}
+}
+
+// finished returns true when all the requests are done.  A request with an end time is done once
+// the time allowed for late records has passed.
+func (s *session) finished(now time.Time) bool {
+	for _, v := range s.requests {
+		if !v.end.IsZero() && now.After(v.end.Add(lateRecords)) {
+			v.done = true
+		}
+		if !v.done {
+			return false
+		}
+	}
+
+	return true
+}
+
+// commands reads the commands sent after END.  INFO is answered, BYE closes the session.
+func (s *session) commands(r *bufio.Reader) error {
+	for {
+		if err := s.conn.SetReadDeadline(time.Time{}); err != nil {
+			return err
+		}
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(f[0]) {
+		case "INFO":
+			err = s.info(f[1:])
+		case "BYE":
+			return errBye
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write writes b to the client.
+func (s *session) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+
+	_, err := s.conn.Write(b)
+	if err == nil && len(b) == 8+recordLength {
+		metrics.MsgTx()
+	}
+
+	return err
+}
+
+func (s *session) ok() error {
+	return s.write([]byte("OK\r\n"))
+}
+
+// fail logs err and writes ERROR to the client.
+func (s *session) fail(cmd string, err error) error {
+	log.Printf("%s %s: %s", s.conn.RemoteAddr(), cmd, err)
+	return s.write([]byte("ERROR\r\n"))
+}
+
+// window returns d with an open end time replaced, for querying fdsn.record.
+func window(d fdsn.DataSearch) fdsn.DataSearch {
+	if d.End.IsZero() {
+		d.End = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return d
+}
+
+// done returns the reason the session stopped streaming, nil if the client closed it with BYE.
+func done(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	if errors.Is(err, errBye) {
+		return nil
+	}
+	return err
+}
+
+func upper(s []string) []string {
+	u := make([]string, len(s))
+	for i, v := range s {
+		u[i] = strings.ToUpper(v)
+	}
+	return u
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	ms "github.com/GeoNet/kit/seis/ms"
+	"github.com/GeoNet/kit/seis/sl"
+)
+
+// testSource is a dataSource with the archive and fdsn.record in memory.
+type testSource struct {
+	mu       sync.Mutex
+	archived []rawRecord
+	recent   []rawRecord
+	queries  []int // the number of searches in each records query.
+}
+
+func (s *testSource) archive(d fdsn.DataSearch, fn func(rawRecord) error) error {
+	s.mu.Lock()
+	records := append([]rawRecord(nil), s.archived...)
+	s.mu.Unlock()
+
+	for _, r := range records {
+		if matches(d, r) && r.start.Before(d.End) && !r.start.Add(time.Minute).Before(d.Start) {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *testSource) records(searches []fdsn.DataSearch, received time.Time, fn func(rawRecord) error) error {
+	s.mu.Lock()
+	records := append([]rawRecord(nil), s.recent...)
+	s.queries = append(s.queries, len(searches))
+	s.mu.Unlock()
+
+	for _, r := range records {
+		if r.received.Before(received) {
+			continue
+		}
+
+		for _, d := range searches {
+			if matches(d, r) && !r.start.Before(d.Start) && r.start.Before(d.End) {
+				if err := fn(r); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *testSource) streams() ([]streamInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var streams []streamInfo
+	for _, r := range s.recent {
+		streams = append(streams, streamInfo{network: r.network, station: r.station, location: r.location, channel: r.channel, start: r.start, end: r.start})
+	}
+
+	return streams, nil
+}
+
+func (s *testSource) add(r rawRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recent = append(s.recent, r)
+}
+
+func matches(d fdsn.DataSearch, r rawRecord) bool {
+	return regexp.MustCompile(d.Network).MatchString(r.network) &&
+		regexp.MustCompile(d.Station).MatchString(r.station) &&
+		regexp.MustCompile(d.Location).MatchString(r.location) &&
+		regexp.MustCompile(d.Channel).MatchString(r.channel)
+}
+
+// testRecord returns a record with a 512 byte miniSEED record with 60 samples at 1 Hz.
+func testRecord(network, station string, start, received time.Time) rawRecord {
+	hdr := ms.RecordHeader{
+		SequenceNumber:       [6]byte{'0', '0', '0', '0', '0', '1'},
+		DataQualityIndicator: 'D',
+		ReservedByte:         ' ',
+		NumberOfSamples:      60,
+		SampleRateFactor:     1,
+		SampleRateMultiplier: 1,
+		BeginningOfData:      64,
+	}
+	hdr.SetNetwork(network)
+	hdr.SetStation(station)
+	hdr.SetLocation("10")
+	hdr.SetChannel("HHZ")
+	hdr.SetStartTime(start)
+
+	raw := make([]byte, recordLength)
+	copy(raw, ms.EncodeRecordHeader(hdr))
+
+	return rawRecord{network: network, station: station, location: "10", channel: "HHZ", start: start, received: received, raw: raw}
+}
+
+// newTestServer starts a server for source and returns its address.
+func newTestServer(t *testing.T, source dataSource) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataRoutes = archive.DefaultRoutes("fdsn-data.geonet.org.nz", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		dataRoutes = nil
+	})
+
+	s := server{source: source, poll: 10 * time.Millisecond, maxWindow: 24 * time.Hour, maxConnections: 2}
+	go s.serve(ctx, l)
+
+	return l.Addr().String()
+}
+
+// collect returns the stations and start times of the records received.
+func collect(ctx context.Context, t *testing.T, slink *sl.SLink, n int) []string {
+	var received []string
+
+	_ = slink.CollectWithContext(ctx, func(seq string, data []byte) (bool, error) {
+		msr, err := ms.NewRecord(data)
+		if err != nil {
+			t.Errorf("invalid record: %s", err)
+			return true, nil
+		}
+
+		if seq != sequence(msr.StartTime()) {
+			t.Errorf("expected sequence %s got %s", sequence(msr.StartTime()), seq)
+		}
+
+		received = append(received, msr.Station()+" "+msr.StartTime().Format("15:04"))
+
+		return len(received) == n, nil
+	})
+
+	return received
+}
+
+func TestTimeWindow(t *testing.T) {
+	restrictedData = []archive.StreamAccess{{Network: "NZ", Station: "SECRET"}}
+	defer func() { restrictedData = nil }()
+
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	source := &testSource{
+		archived: []rawRecord{
+			testRecord("NZ", "WEL", start.Add(-2*time.Minute), time.Time{}), // before the window.
+			testRecord("NZ", "WEL", start, time.Time{}),
+			testRecord("NZ", "SECRET", start, time.Time{}),
+			testRecord("NZ", "WEL", start.Add(time.Minute), time.Time{}),
+		},
+		recent: []rawRecord{
+			testRecord("NZ", "WEL", start.Add(time.Minute), start.Add(2*time.Minute)), // also in the archive.
+			testRecord("NZ", "WEL", start.Add(2*time.Minute), start.Add(3*time.Minute)),
+			testRecord("NZ", "WEL", start.Add(5*time.Minute), start.Add(6*time.Minute)), // after the window.
+		},
+	}
+
+	addr := newTestServer(t, source)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slink := sl.NewSLink(sl.SetServer(addr), sl.SetStreams("NZ_*"), sl.SetSelectors("10HH?"),
+		sl.SetStart(start), sl.SetEnd(start.Add(3*time.Minute)), sl.SetTimeout(time.Second))
+
+	// the server closes the connection after the time window has been sent.
+	received := collect(ctx, t, slink, 100)
+
+	expected := []string{"WEL 03:00", "WEL 03:01", "WEL 03:02"}
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v got %v", expected, received)
+	}
+
+	if ctx.Err() != nil {
+		t.Error("the connection wasn't closed after the time window")
+	}
+}
+
+func TestRealTime(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	source := &testSource{
+		recent: []rawRecord{
+			testRecord("NZ", "WEL", now.Add(-time.Hour), now.Add(-time.Hour)), // received before connecting.
+		},
+	}
+
+	addr := newTestServer(t, source)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		source.add(testRecord("NZ", "SNZO", now, time.Now().UTC()))
+		source.add(testRecord("NZ", "WEL", now, time.Now().UTC()))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slink := sl.NewSLink(sl.SetServer(addr), sl.SetStreams("NZ_WEL"), sl.SetTimeout(time.Second))
+
+	received := collect(ctx, t, slink, 1)
+
+	expected := []string{"WEL " + now.Format("15:04")}
+	if strings.Join(received, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v got %v", expected, received)
+	}
+}
+
+func TestRealTimeQueries(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	source := &testSource{}
+
+	addr := newTestServer(t, source)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		source.add(testRecord("NZ", "WEL", now, time.Now().UTC()))
+		source.add(testRecord("NZ", "SNZO", now, time.Now().UTC()))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slink := sl.NewSLink(sl.SetServer(addr), sl.SetStreams("NZ_WEL,NZ_SNZO,NZ_TEST"), sl.SetTimeout(time.Second))
+
+	received := collect(ctx, t, slink, 2)
+
+	if len(received) != 2 {
+		t.Errorf("expected 2 records got %v", received)
+	}
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+
+	// each poll is one query for all the stations.
+	for i, v := range source.queries {
+		if v != 3 {
+			t.Errorf("query %d: expected 3 searches got %d", i, v)
+		}
+	}
+}
+
+// fetch sends the commands and returns the stations and start times of the records received before END.
+func fetch(t *testing.T, addr string, commands ...string) []string {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+
+	for _, c := range commands {
+		if _, err := conn.Write([]byte(c + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		if c == "END" {
+			break
+		}
+		if line, err := r.ReadString('\n'); err != nil || strings.TrimSpace(line) != "OK" {
+			t.Fatalf("%s: expected OK got %q %v", c, line, err)
+		}
+	}
+
+	var received []string
+
+	for {
+		p := make([]byte, 3)
+		if _, err := io.ReadFull(r, p); err != nil {
+			t.Fatalf("expected END: %s", err)
+		}
+		if string(p) == "END" {
+			return received
+		}
+
+		p = append(p, make([]byte, 8+recordLength-3)...)
+		if _, err := io.ReadFull(r, p[3:]); err != nil {
+			t.Fatal(err)
+		}
+
+		msr, err := ms.NewRecord(p[8:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		received = append(received, msr.Station()+" "+msr.StartTime().Format("15:04:05"))
+	}
+}
+
+func TestFetch(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// the second archived record starts in the same second as the first received record.
+	source := &testSource{
+		archived: []rawRecord{
+			testRecord("NZ", "WEL", now.Add(-3*time.Minute), time.Time{}),
+			testRecord("NZ", "WEL", now.Add(-2*time.Minute+500*time.Millisecond), time.Time{}),
+		},
+		recent: []rawRecord{
+			testRecord("NZ", "WEL", now.Add(-2*time.Minute), now.Add(-time.Minute)),
+			testRecord("NZ", "WEL", now.Add(-time.Minute), now),
+		},
+	}
+
+	addr := newTestServer(t, source)
+
+	in := []struct {
+		id       string
+		commands []string
+		expected []string
+	}{
+		// FETCH without a sequence number sends END.
+		{id: loc(), commands: []string{"STATION WEL NZ", "FETCH", "END"}},
+		{id: loc(), commands: []string{"STATION WEL NZ", "FETCH " + sequence(now.Add(-4*time.Minute)), "END"},
+			expected: []string{"WEL " + now.Add(-3*time.Minute).Format("15:04:05"), "WEL " + now.Add(-2*time.Minute+500*time.Millisecond).Format("15:04:05"),
+				"WEL " + now.Add(-2*time.Minute).Format("15:04:05"), "WEL " + now.Add(-time.Minute).Format("15:04:05")}},
+		// resumes after the last record the client has, not with it.
+		{id: loc(), commands: []string{"STATION WEL NZ", "FETCH " + sequence(now.Add(-2*time.Minute)), "END"},
+			expected: []string{"WEL " + now.Add(-time.Minute).Format("15:04:05")}},
+		{id: loc(), commands: []string{"STATION WEL NZ", "FETCH " + sequence(now.Add(-time.Minute)), "END"}},
+	}
+
+	for _, v := range in {
+		received := fetch(t, addr, v.commands...)
+		if strings.Join(received, ",") != strings.Join(v.expected, ",") {
+			t.Errorf("%s expected %v got %v", v.id, v.expected, received)
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	now := time.Now().UTC()
+
+	source := &testSource{
+		recent: []rawRecord{
+			testRecord("NZ", "WEL", now, now),
+			testRecord("IU", "SNZO", now, now),
+			testRecord("5P", "TEST", now, now), // not served.
+		},
+	}
+
+	addr := newTestServer(t, source)
+
+	conn, err := sl.NewConn(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	info, err := conn.GetInfo("STREAMS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Station) != 2 || info.Station[0].Network != "NZ" || info.Station[0].Name != "WEL" ||
+		len(info.Station[0].Stream) != 1 || info.Station[0].Stream[0].Seedname != "HHZ" {
+		t.Errorf("unexpected INFO STREAMS %+v", info)
+	}
+
+	// commands are answered with OK or ERROR.
+	r := bufio.NewReader(conn)
+
+	for _, v := range []struct {
+		command, response string
+	}{
+		{command: "DATA", response: "ERROR"}, // uni-station mode.
+		{command: "STATION WEL NZ", response: "OK"},
+		{command: "SELECT !HHZ", response: "ERROR"},
+		{command: "SELECT 10HH?", response: "OK"},
+		{command: "TIME 2024,01,01,00,00,00 2024,01,03,00,00,00", response: "ERROR"}, // longer than the max window.
+		{command: "TIME 2024,01,01,00,00,00 2024,01,01,01,00,00", response: "OK"},
+		{command: "CAT", response: "ERROR"},
+	} {
+		if _, err := conn.Write([]byte(v.command + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(line) != v.response {
+			t.Errorf("%s: expected %s got %s", v.command, v.response, strings.TrimSpace(line))
+		}
+	}
+}
+
+func TestInfoPackets(t *testing.T) {
+	doc := []byte(strings.Repeat("x", 1000))
+
+	p := infoPackets(doc)
+
+	if len(p) != 3 {
+		t.Fatalf("expected 3 packets got %d", len(p))
+	}
+
+	var b strings.Builder
+
+	for i, v := range p {
+		if len(v) != sl.PacketSize {
+			t.Errorf("packet %d: expected %d bytes got %d", i, sl.PacketSize, len(v))
+		}
+
+		more := i < len(p)-1
+		if (v[7] == '*') != more {
+			t.Errorf("packet %d: unexpected sequence %s", i, v[:8])
+		}
+
+		msr, err := ms.NewRecord(v[8:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b.Write(v[8+msr.BeginningOfData : 8+int(msr.BeginningOfData)+msr.SampleCount()])
+	}
+
+	if b.String() != string(doc) {
+		t.Error("the packets don't contain the document")
+	}
+}
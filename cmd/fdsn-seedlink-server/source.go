@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	ms "github.com/GeoNet/kit/seis/ms"
+	"github.com/lib/pq"
+)
+
+// miniSEED record length
+const recordLength = 512
+
+// rawRecord is a miniSEED record to send to a client.
+type rawRecord struct {
+	network, station, location, channel string
+	start                               time.Time
+	received                            time.Time // when the record was received from SeedLink, zero for archived records.
+	raw                                 []byte
+}
+
+// dataSource is where the records for a request come from.
+type dataSource interface {
+	// archive calls fn, in time order for each file, for the records in the miniSEED archive in the time window for d.
+	archive(d fdsn.DataSearch, fn func(rawRecord) error) error
+	// records calls fn, in the order they were received, for the records in fdsn.record in the time window
+	// for any of searches that were received at or after received.
+	records(searches []fdsn.DataSearch, received time.Time, fn func(rawRecord) error) error
+	// streams returns the streams with records in fdsn.record.
+	streams() ([]streamInfo, error)
+}
+
+// dbSource is the miniSEED archive in the dataRoutes storage, found using the holdings, and the records in fdsn.record.
+type dbSource struct {
+	db *sql.DB
+}
+
+func (s dbSource) archive(d fdsn.DataSearch, fn func(rawRecord) error) error {
+	files, err := archive.Search(s.db, d)
+	if err != nil {
+		return err
+	}
+
+	files = dataRoutes.Files(files)
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Start.Before(files[j].Start)
+	})
+
+	for _, f := range files {
+		var b bytes.Buffer
+
+		if err := archive.Fetch(dataRoutes.Key(f.Key), f, d, &b); err != nil {
+			log.Printf("skipping %s: %s", f.Key, err)
+			continue
+		}
+
+		for b.Len() >= recordLength {
+			raw := b.Next(recordLength)
+
+			msr, err := ms.NewRecord(raw)
+			if err != nil {
+				return err
+			}
+
+			if !msr.StartTime().Before(d.End) || !msr.EndTime().After(d.Start) {
+				continue
+			}
+
+			err = fn(rawRecord{
+				network:  msr.Network(),
+				station:  msr.Station(),
+				location: msr.Location(),
+				channel:  msr.Channel(),
+				start:    msr.StartTime(),
+				raw:      append([]byte(nil), raw...),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// records queries fdsn.record once for all of searches, a record matching more than one search is returned once.
+func (s dbSource) records(searches []fdsn.DataSearch, received time.Time, fn func(rawRecord) error) error {
+	if len(searches) == 0 {
+		return nil
+	}
+
+	var network, station, channel, location, start, end pq.StringArray
+
+	for _, d := range searches {
+		network = append(network, d.Network)
+		station = append(station, d.Station)
+		channel = append(channel, d.Channel)
+		location = append(location, d.Location)
+		start = append(start, d.Start.Format(time.RFC3339Nano))
+		end = append(end, d.End.Format(time.RFC3339Nano))
+	}
+
+	rows, err := s.db.Query(`WITH q AS (SELECT * FROM unnest($1::TEXT[], $2::TEXT[], $3::TEXT[], $4::TEXT[], $5::TIMESTAMPTZ[], $6::TIMESTAMPTZ[])
+		AS q(network, station, channel, location, start_time, end_time)),
+	r AS (SELECT DISTINCT ON (s.streampk, r.start_time) s.network, s.station, s.location, s.channel, r.start_time,
+		r.start_time + r.latency_data * interval '1 second' AS received, r.raw
+	FROM fdsn.stream s JOIN fdsn.record r USING (streampk) JOIN q
+	ON s.network ~ q.network
+	AND s.station ~ q.station
+	AND s.channel ~ q.channel
+	AND s.location ~ q.location
+	AND r.start_time >= q.start_time
+	AND r.start_time < q.end_time)
+	SELECT network, station, location, channel, start_time, received, raw FROM r
+	WHERE received >= $7
+	ORDER BY received`,
+		network, station, channel, location, start, end, received)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r rawRecord
+
+		if err = rows.Scan(&r.network, &r.station, &r.location, &r.channel, &r.start, &r.received, &r.raw); err != nil {
+			return err
+		}
+
+		if err = fn(r); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s dbSource) streams() ([]streamInfo, error) {
+	rows, err := s.db.Query(`SELECT network, station, location, channel, min(start_time), max(start_time)
+	FROM fdsn.stream JOIN fdsn.record USING (streampk)
+	GROUP BY network, station, location, channel
+	ORDER BY network, station, location, channel`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var streams []streamInfo
+
+	for rows.Next() {
+		var i streamInfo
+
+		if err = rows.Scan(&i.network, &i.station, &i.location, &i.channel, &i.start, &i.end); err != nil {
+			return nil, err
+		}
+
+		streams = append(streams, i)
+	}
+
+	return streams, rows.Err()
+}
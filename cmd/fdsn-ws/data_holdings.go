@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"time"
 
 	"github.com/GeoNet/fdsn/internal/fdsn"
@@ -50,37 +49,64 @@ func metricsSearch(d fdsn.DataSearch) ([]metric, error) {
 	return h, nil
 }
 
-// holdingsSearch searches for S3 keys matching the query.
-// network, station, channel, and location are matched using POSIX regular expressions.
-// https://www.postgresql.org/docs/9.3/static/functions-matching.html
-// start and end should be set for all queries.  24 hours will be subtracted from the Start time and be added from the End time to include all records
-// in each day long file.
-func holdingsSearch(d fdsn.DataSearch) (keys []string, err error) {
-	var rows *sql.Rows
+// recordCount returns the number of records in fdsn.record that recordSearch would return for the query.
+func recordCount(d fdsn.DataSearch, since time.Time) (int, error) {
+	start := d.Start.Add(-time.Hour)
+	if start.Before(since) {
+		start = since
+	}
+
+	var n int
 
-	rows, err = db.Query(`WITH s AS (SELECT DISTINCT ON (network, station, channel, location) streamPK
+	err := db.QueryRow(`WITH s AS (SELECT DISTINCT ON (network, station, channel, location) streamPK
 	FROM fdsn.stream WHERE network ~ $1
 	AND station ~ $2
 	AND channel ~ $3
 	AND location ~ $4)
-	SELECT DISTINCT ON (key) key FROM s JOIN fdsn.holdings USING (streampk)
+	SELECT count(*) FROM s JOIN fdsn.record USING (streampk)
 	WHERE start_time >= $5
-	AND start_time <= $6
-	AND error_data = false`,
-		d.Network, d.Station, d.Channel, d.Location, d.Start.Add(time.Hour*-24), d.End.Add(time.Hour*24))
-	if err != nil {
-		return
+	AND start_time < $6`,
+		d.Network, d.Station, d.Channel, d.Location, start, d.End).Scan(&n)
+
+	return n, err
+}
+
+// recordSearch searches fdsn.record for the miniSEED records from SeedLink matching the query that start after since,
+// calling fn for each record as it is read.  Records are ordered by stream and start time.  An hour is subtracted from
+// the Start time to include records that start before it.  Stops at the first error from fn.
+func recordSearch(d fdsn.DataSearch, since time.Time, fn func(nrtRecord) error) error {
+	start := d.Start.Add(-time.Hour)
+	if start.Before(since) {
+		start = since
 	}
 
-	var s string
+	rows, err := db.Query(`WITH s AS (SELECT DISTINCT ON (network, station, channel, location) streamPK, network, station, channel, location
+	FROM fdsn.stream WHERE network ~ $1
+	AND station ~ $2
+	AND channel ~ $3
+	AND location ~ $4)
+	SELECT network, station, start_time, raw FROM s JOIN fdsn.record USING (streampk)
+	WHERE start_time >= $5
+	AND start_time < $6
+	ORDER BY network, station, location, channel, start_time`,
+		d.Network, d.Station, d.Channel, d.Location, start, d.End)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
 
 	for rows.Next() {
-		err = rows.Scan(&s)
+		var r nrtRecord
+
+		err = rows.Scan(&r.network, &r.station, &r.start, &r.raw)
 		if err != nil {
-			return
+			return err
+		}
+
+		if err = fn(r); err != nil {
+			return err
 		}
-		keys = append(keys, s)
 	}
 
-	return
+	return rows.Err()
 }
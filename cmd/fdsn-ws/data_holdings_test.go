@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/GeoNet/fdsn/internal/archive"
 	"github.com/GeoNet/fdsn/internal/fdsn"
 	"github.com/GeoNet/fdsn/internal/holdings"
 	"github.com/lib/pq"
@@ -149,13 +150,13 @@ func TestDataHoldingsSearch(t *testing.T) {
 		End:      end,
 	}
 
-	keys, err := holdingsSearch(d)
+	files, err := archive.Search(db, d)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if len(keys) == 0 {
-		t.Error("expected more than 0 keys")
+	if len(files) == 0 {
+		t.Error("expected more than 0 files")
 	}
 }
 
@@ -233,3 +234,74 @@ func (h *holding) delete() error {
 	_, err := db.Exec(`DELETE FROM fdsn.holdings WHERE key = $1`, h.key)
 	return err
 }
+
+func TestRecordSearch(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	h := holding{
+		Holding: holdings.Holding{
+			Network:  "NZ",
+			Station:  "ABAZ",
+			Location: "10",
+			Channel:  "HHZ",
+		},
+	}
+
+	if _, err := h.saveStream(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+
+	_, err := db.Exec(`DELETE FROM fdsn.record WHERE streamPK = (SELECT streamPK FROM fdsn.stream
+	WHERE network = 'NZ' AND station = 'ABAZ' AND location = '10' AND channel = 'HHZ')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		s := start.Add(time.Duration(i) * time.Minute)
+		_, err = db.Exec(`INSERT INTO fdsn.record (streamPK, start_time, latency_data, latency_tx, raw)
+		SELECT streamPK, $1, 0, 0, $2 FROM fdsn.stream
+		WHERE network = 'NZ' AND station = 'ABAZ' AND location = '10' AND channel = 'HHZ'`, s, testRecord("NZ", "ABAZ", s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := fdsn.DataSearch{
+		Network:  "NZ",
+		Station:  "ABAZ",
+		Location: "10",
+		Channel:  "HHZ",
+		Start:    start.Add(time.Minute),
+		End:      start.Add(time.Hour),
+	}
+
+	var records []nrtRecord
+	err = recordSearch(d, start.Add(time.Minute), func(r nrtRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := recordCount(d, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("expected a count of 2 records got %d", n)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records got %d", len(records))
+	}
+
+	if !records[0].start.Equal(start.Add(time.Minute)) || records[0].network != "NZ" || records[0].station != "ABAZ" {
+		t.Errorf("unexpected first record %s.%s %s", records[0].network, records[0].station, records[0].start)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/kit/weft"
+)
+
+// The data holdings are reconciled with the station inventory to find data without metadata,
+// streams with data outside of all channel epochs, and metadata without data, channel epochs
+// with no data in the holdings.  The holdings are day long miniSEED files, the data for a stream
+// is the time ranges covered by consecutive files.  As the end of the data in the last file is not
+// known, differences shorter than a day are not reported.
+
+const holdingsDay = 24 * time.Hour
+
+var reconcileReport = flag.Bool("reconcile", false, "report the differences between the data holdings and the station inventory and exit")
+
+// timeRange is from start until end.  An open end is emptyDateTime.
+type timeRange struct {
+	start, end time.Time
+}
+
+// streamID is the codes for a stream in the holdings or a channel in the inventory.
+type streamID struct {
+	network, station, location, channel string
+}
+
+// reconcileProblem is a difference between the data holdings and the station inventory.
+type reconcileProblem struct {
+	streamID
+	problem    string // nometadata, nodata
+	start, end time.Time
+}
+
+// holdingsRanges returns the time ranges with data for streams with codes matching the regexes,
+// keyed by stream.  Files that start within a day, and an hour for slack, of the previous file are consecutive.
+func holdingsRanges(network, station, location, channel string) (map[streamID][]timeRange, error) {
+	rows, err := db.Query(`WITH s AS (SELECT streamPK, network, station, location, channel
+	FROM fdsn.stream WHERE network ~ $1
+	AND station ~ $2
+	AND location ~ $3
+	AND channel ~ $4),
+	h AS (SELECT streamPK, start_time,
+	CASE WHEN start_time - lag(start_time) OVER (PARTITION BY streamPK ORDER BY start_time) <= interval '25 hours' THEN 0 ELSE 1 END AS island_start
+	FROM fdsn.holdings JOIN s USING (streamPK)
+	WHERE error_data = false),
+	i AS (SELECT streamPK, start_time, sum(island_start) OVER (PARTITION BY streamPK ORDER BY start_time) AS island FROM h)
+	SELECT network, station, location, channel, min(start_time), max(start_time)
+	FROM i JOIN s USING (streamPK)
+	GROUP BY streamPK, network, station, location, channel, island
+	ORDER BY network, station, location, channel, min(start_time)`,
+		network, station, location, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	ranges := make(map[streamID][]timeRange)
+
+	for rows.Next() {
+		var k streamID
+		var start, last time.Time
+
+		if err := rows.Scan(&k.network, &k.station, &k.location, &k.channel, &start, &last); err != nil {
+			return nil, err
+		}
+
+		ranges[k] = append(ranges[k], timeRange{start: start, end: last.Add(holdingsDay)})
+	}
+
+	return ranges, rows.Err()
+}
+
+// reconcileHoldings compares the data time ranges, from holdingsRanges, with the channel epochs in f.
+func reconcileHoldings(f *FDSNStationXML, data map[streamID][]timeRange) []reconcileProblem {
+	var problems []reconcileProblem
+
+	epochs := make(map[streamID][]timeRange)
+
+	for n := range f.Network {
+		net := &f.Network[n]
+		for s := range net.Station {
+			sta := &net.Station[s]
+			for c := range sta.Channel {
+				cha := &sta.Channel[c]
+				k := streamID{network: net.Code, station: sta.Code, location: cha.LocationCode, channel: cha.Code}
+				e := channelRange(cha)
+				epochs[k] = append(epochs[k], e)
+
+				if !overlapsAny(e, data[k]) {
+					problems = append(problems, reconcileProblem{problem: "nodata", streamID: k, start: e.start, end: e.end})
+				}
+			}
+		}
+	}
+
+	for k, ranges := range data {
+		for _, r := range ranges {
+			for _, m := range subtractRanges(r, epochs[k]) {
+				if m.end.Sub(m.start) < holdingsDay {
+					continue
+				}
+				problems = append(problems, reconcileProblem{problem: "nometadata", streamID: k, start: m.start, end: m.end})
+			}
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		pi, pj := problems[i], problems[j]
+		switch {
+		case pi.network != pj.network:
+			return pi.network < pj.network
+		case pi.station != pj.station:
+			return pi.station < pj.station
+		case pi.location != pj.location:
+			return pi.location < pj.location
+		case pi.channel != pj.channel:
+			return pi.channel < pj.channel
+		case !pi.start.Equal(pj.start):
+			return pi.start.Before(pj.start)
+		default:
+			return pi.problem < pj.problem
+		}
+	})
+
+	return problems
+}
+
+func writeReconcileProblems(b *bytes.Buffer, problems []reconcileProblem) {
+	b.WriteString("#Problem | Network | Station | Location | Channel | StartTime | EndTime\n")
+	for _, p := range problems {
+		var end string
+		if p.end.Before(emptyDateTime) {
+			end = p.end.UTC().Format("2006-01-02T15:04:05")
+		}
+		fmt.Fprintf(b, "%s|%s|%s|%s|%s|%s|%s\n", p.problem, p.network, p.station, p.location, p.channel,
+			p.start.UTC().Format("2006-01-02T15:04:05"), end)
+	}
+}
+
+// holdingsReconcileHandler reports the differences between the data holdings and the station inventory.
+// The optional network and station parameters limit the report.
+func holdingsReconcileHandler(r *http.Request, h http.Header, b *bytes.Buffer) error {
+	err := weft.CheckQuery(r, []string{"GET"}, []string{}, []string{"network", "station"})
+	if err != nil {
+		return err
+	}
+
+	v := url.Values{}
+	v.Set("level", "channel")
+	for _, k := range []string{"network", "station"} {
+		if s := r.URL.Query().Get(k); s != "" {
+			v.Set(k, s)
+		}
+	}
+
+	p, err := parseStationV1(v)
+	if err != nil {
+		return weft.StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	problems, err := reconcile([]fdsnStationV1Search{p})
+	if err != nil {
+		return err
+	}
+
+	writeReconcileProblems(b, problems)
+	h.Set("Content-Type", "text/plain")
+
+	return nil
+}
+
+// runReconcile writes the differences between the data holdings and the whole station inventory to stdout.
+func runReconcile() error {
+	if stationDB = os.Getenv("STATION_DB") == "true"; !stationDB {
+		initStationXML()
+	}
+
+	p, err := parseStationV1(url.Values{"level": []string{"channel"}})
+	if err != nil {
+		return err
+	}
+
+	problems, err := reconcile([]fdsnStationV1Search{p})
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	writeReconcileProblems(&b, problems)
+
+	_, err = os.Stdout.Write(b.Bytes())
+
+	return err
+}
+
+// reconcile compares the data holdings with the channels in the station inventory matching params.
+func reconcile(params []fdsnStationV1Search) ([]reconcileProblem, error) {
+	var inventory *FDSNStationXML
+	var err error
+
+	if stationDB {
+		if inventory, _, err = queryStationDB(params); err != nil {
+			return nil, err
+		}
+	} else {
+		if inventory, _, err = stationInventoryAsOf(fdsn.EmptyWsDateTime.Time); err != nil {
+			return nil, err
+		}
+	}
+
+	c := *inventory
+	if !c.doFilter(params) {
+		c.Network = nil
+	}
+
+	data, err := holdingsRanges(anyRegex(regexOrAll(params[0].NetworkReg)), anyRegex(regexOrAll(params[0].StationReg)),
+		REGEX_ANYTHING, REGEX_ANYTHING)
+	if err != nil {
+		return nil, err
+	}
+
+	return reconcileHoldings(&c, data), nil
+}
+
+// matchTimeSeries removes the channels in r without data in the holdings during the channel epoch
+// and the query time window.  Expects r to have been filtered by params, and not trimmed, so the
+// stations and channels are not shared with the inventory.
+func (r *FDSNStationXML) matchTimeSeries(params []fdsnStationV1Search) (bool, error) {
+	var network, station, location, channel []string
+	for _, p := range params {
+		network = append(network, regexOrAll(p.NetworkReg)...)
+		station = append(station, regexOrAll(p.StationReg)...)
+		location = append(location, regexOrAll(p.LocationReg)...)
+		channel = append(channel, regexOrAll(p.ChannelReg)...)
+	}
+
+	data, err := holdingsRanges(anyRegex(network), anyRegex(station), anyRegex(location), anyRegex(channel))
+	if err != nil {
+		return false, err
+	}
+
+	networks := r.Network[:0]
+	for n := range r.Network {
+		net := r.Network[n]
+
+		stations := net.Station[:0]
+		for s := range net.Station {
+			sta := net.Station[s]
+
+			channels := sta.Channel[:0]
+			for c := range sta.Channel {
+				cha := sta.Channel[c]
+				e := channelRange(&cha)
+				for _, p := range params {
+					if overlapsAny(p.timeWindow(e), data[streamID{network: net.Code, station: sta.Code, location: cha.LocationCode, channel: cha.Code}]) {
+						channels = append(channels, cha)
+						break
+					}
+				}
+			}
+
+			if len(channels) > 0 {
+				sta.Channel = channels
+				sta.SelectedNumberChannels = len(channels)
+				stations = append(stations, sta)
+			}
+		}
+
+		if len(stations) > 0 {
+			net.Station = stations
+			net.SelectedNumberStations = CounterType(len(stations))
+			networks = append(networks, net)
+		}
+	}
+	r.Network = networks
+
+	return len(networks) > 0, nil
+}
+
+// timeWindow returns the part of e in the starttime and endtime window for the query.
+func (v fdsnStationV1Search) timeWindow(e timeRange) timeRange {
+	if v.startMode == ONBEFOREEND && v.StartTime.After(e.start) {
+		e.start = v.StartTime.Time
+	}
+	if v.endMode == ONAFTERSTART && v.EndTime.Before(e.end) {
+		e.end = v.EndTime.Time
+	}
+	return e
+}
+
+// channelRange returns the epoch for cha.
+func channelRange(cha *ChannelType) timeRange {
+	e := timeRange{start: time.Time(cha.StartDate), end: time.Time(cha.EndDate)}
+	if e.end.IsZero() {
+		e.end = emptyDateTime
+	}
+	return e
+}
+
+func overlapsAny(e timeRange, ranges []timeRange) bool {
+	for _, r := range ranges {
+		if r.start.Before(e.end) && e.start.Before(r.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// subtractRanges returns the parts of r not covered by any of ranges.
+func subtractRanges(r timeRange, ranges []timeRange) []timeRange {
+	sorted := append([]timeRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start.Before(sorted[j].start) })
+
+	var remaining []timeRange
+	start := r.start
+	for _, v := range sorted {
+		if !v.end.After(start) {
+			continue
+		}
+		if !v.start.Before(r.end) {
+			break
+		}
+		if v.start.After(start) {
+			remaining = append(remaining, timeRange{start: start, end: v.start})
+		}
+		start = v.end
+		if !start.Before(r.end) {
+			return remaining
+		}
+	}
+
+	return append(remaining, timeRange{start: start, end: r.end})
+}
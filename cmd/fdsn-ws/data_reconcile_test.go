@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/holdings"
+)
+
+func TestReconcileHoldings(t *testing.T) {
+	f := validateTestXML(t)
+
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := map[streamID][]timeRange{
+		// covered by the three EHZ epochs, the gaps between epochs are less than a day.
+		{network: "NZ", station: "ARAZ", location: "10", channel: "EHZ"}: {
+			{start: day(2007, time.May, 21), end: day(2012, time.January, 1)},
+		},
+		// before the first EHN epoch.
+		{network: "NZ", station: "ARAZ", location: "10", channel: "EHN"}: {
+			{start: day(2007, time.May, 1), end: day(2012, time.January, 1)},
+		},
+		// no metadata at all.
+		{network: "NZ", station: "ABCD", location: "10", channel: "EHZ"}: {
+			{start: day(2015, time.March, 1), end: day(2015, time.March, 3)},
+		},
+	}
+
+	var b bytes.Buffer
+	writeReconcileProblems(&b, reconcileHoldings(f, data))
+
+	exp := `#Problem | Network | Station | Location | Channel | StartTime | EndTime
+nometadata|NZ|ABCD|10|EHZ|2015-03-01T00:00:00|2015-03-03T00:00:00
+nodata|NZ|ARAZ|10|EHE|2007-05-20T23:00:00|2011-03-06T22:00:00
+nodata|NZ|ARAZ|10|EHE|2011-03-06T22:00:01|2011-06-20T04:00:00
+nodata|NZ|ARAZ|10|EHE|2011-06-20T04:00:01|
+nometadata|NZ|ARAZ|10|EHN|2007-05-01T00:00:00|2007-05-20T23:00:00
+nodata|NZ|ARHZ|10|EHE|2010-03-11T21:16:00|2012-01-19T22:29:01
+nodata|NZ|ARHZ|10|EHE|2012-01-19T22:30:01|
+nodata|NZ|ARHZ|10|EHN|2010-03-11T21:16:00|2012-01-19T22:29:01
+nodata|NZ|ARHZ|10|EHN|2012-01-19T22:30:01|
+nodata|NZ|ARHZ|10|EHZ|2010-03-11T21:16:00|2012-01-19T22:29:01
+nodata|NZ|ARHZ|10|EHZ|2012-01-19T22:30:01|
+`
+	if b.String() != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, b.String())
+	}
+}
+
+func TestSubtractRanges(t *testing.T) {
+	tm := func(h int) time.Time {
+		return time.Date(2020, time.January, 1, h, 0, 0, 0, time.UTC)
+	}
+
+	in := []struct {
+		id       string
+		r        timeRange
+		ranges   []timeRange
+		expected []timeRange
+	}{
+		{id: loc(), r: timeRange{tm(0), tm(10)}, expected: []timeRange{{tm(0), tm(10)}}},
+		{id: loc(), r: timeRange{tm(0), tm(10)}, ranges: []timeRange{{tm(0), tm(10)}}},
+		{id: loc(), r: timeRange{tm(2), tm(8)}, ranges: []timeRange{{tm(0), tm(10)}}},
+		{id: loc(), r: timeRange{tm(0), tm(10)}, ranges: []timeRange{{tm(6), tm(8)}, {tm(2), tm(4)}},
+			expected: []timeRange{{tm(0), tm(2)}, {tm(4), tm(6)}, {tm(8), tm(10)}}},
+		{id: loc(), r: timeRange{tm(0), tm(10)}, ranges: []timeRange{{tm(11), tm(12)}, {tm(0), tm(5)}},
+			expected: []timeRange{{tm(5), tm(10)}}},
+	}
+
+	for _, v := range in {
+		s := subtractRanges(v.r, v.ranges)
+		if len(s) != len(v.expected) {
+			t.Errorf("%s expected %v got %v", v.id, v.expected, s)
+			continue
+		}
+		for i := range s {
+			if !s[i].start.Equal(v.expected[i].start) || !s[i].end.Equal(v.expected[i].end) {
+				t.Errorf("%s expected %v got %v", v.id, v.expected, s)
+			}
+		}
+	}
+}
+
+// TestMatchTimeSeries checks channels are only returned with matchtimeseries when there is data
+// in the holdings during the channel epoch.
+func TestMatchTimeSeries(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	for i := 0; i < 3; i++ {
+		start := time.Date(2012, time.January, 1+i, 0, 0, 0, 0, time.UTC)
+		h := holding{
+			key: fmt.Sprintf("NZ.ARAZ.10.EHZ.D.2012.%03d", 1+i),
+			Holding: holdings.Holding{
+				Network:    "NZ",
+				Station:    "ARAZ",
+				Location:   "10",
+				Channel:    "EHZ",
+				Start:      start,
+				NumSamples: 8640000,
+			},
+		}
+		if err := h.save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := holdingsRanges("^NZ$", "^ARAZ$", REGEX_ANYTHING, REGEX_ANYTHING)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := data[streamID{network: "NZ", station: "ARAZ", location: "10", channel: "EHZ"}]
+	if len(r) != 1 || !r[0].start.Equal(time.Date(2012, time.January, 1, 0, 0, 0, 0, time.UTC)) ||
+		!r[0].end.Equal(time.Date(2012, time.January, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected holdings ranges %v", r)
+	}
+
+	v, err := url.ParseQuery("station=ARAZ&level=channel&matchtimeseries=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseStationV1(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := []fdsnStationV1Search{p}
+
+	c := *validateTestXML(t)
+	if !c.doFilter(params) {
+		t.Fatal("expected a match before matching the holdings")
+	}
+	ok, err := c.matchTimeSeries(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected a match")
+	}
+
+	// only the current EHZ epoch has data.
+	cha := c.Network[0].Station[0].Channel
+	if len(cha) != 1 || cha[0].Code != "EHZ" || time.Time(cha[0].StartDate).Year() != 2011 {
+		t.Errorf("expected the current EHZ epoch got %d channels", len(cha))
+	}
+}
@@ -3,20 +3,22 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
 	"text/template"
 	"time"
 
+	"github.com/GeoNet/fdsn/internal/archive"
 	"github.com/GeoNet/fdsn/internal/fdsn"
-	"github.com/GeoNet/kit/aws/s3"
+	"github.com/GeoNet/fdsn/internal/timeseries"
 	"github.com/GeoNet/kit/metrics"
 	ms "github.com/GeoNet/kit/seis/ms"
 	"github.com/GeoNet/kit/weft"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 const (
@@ -26,17 +28,23 @@ const (
 	MAX_QUERIES int = 60
 	// Limit the number of input files (each file is max ~10 MB).
 	MAX_FILES int = 60
+	// Limit the number of near real time records from fdsn.record, about the size of MAX_FILES.
+	MAX_RECORDS int = 1200000
+	// Limit the number of samples decoded for the formats other than miniseed.
+	MAX_SAMPLES int = 20000000
 )
 
 var (
-	s3Client               *s3.S3
+	s3Client               *awss3.Client
+	dataRoutes             archive.Routes
 	fdsnDataselectWadlFile []byte
 	fdsnDataselectIndex    []byte
 )
 
 type dataSelect struct {
-	d    fdsn.DataSearch
-	keys []string
+	d     fdsn.DataSearch
+	files []archive.File
+	nrt   bool // merge the near real time records from fdsn.record.
 }
 
 func initDataselectTemplate() {
@@ -58,14 +66,20 @@ func initDataselectTemplate() {
 		log.Printf("error reading assets/fdsn-ws-dataselect.html: %s", err.Error())
 	}
 
-	s3c, err := s3.NewWithMaxRetries(3)
-	if err != nil {
+	if s3Client, err = archive.NewS3Client(3); err != nil {
 		log.Fatalf("error creating S3 client: %s", err)
 	}
-	s3Client = &s3c
 
-	if err = s3Client.CheckBucket(S3_BUCKET); err != nil {
-		log.Fatalf("error checking S3_BUCKET %s:  %s", S3_BUCKET, err.Error())
+	if dataRoutes, err = archive.LoadRoutes(os.Getenv("DATASELECT_ROUTES"), S3_BUCKET, s3Client); err != nil {
+		log.Fatalf("error reading the dataselect routes: %s", err)
+	}
+
+	if err = initDataCache(); err != nil {
+		log.Fatalf("error setting up the dataselect cache: %s", err)
+	}
+
+	if err = initNRTWindow(); err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -133,11 +147,17 @@ func fdsnDataMetricsV1Handler(r *http.Request, h http.Header, b *bytes.Buffer) e
 	return nil
 }
 
-// fdsnDataselectV1Handler handles all dataselect queries.  It searches for matching keys in S3 and
-// fetches them, writing matching records to w in the same order they were requested.
+// fdsnDataselectV1Handler handles all dataselect queries.  It searches for matching keys in the holdings and
+// fetches them from storage, writing matching records to w in the same order they were requested.
 // Results are streamed to the client so a 200 can still be followed by errors which will not
 // be reported to the client.  The potentially large response sizes make this the simplest solution.
+// Restricted data is not returned, see fdsnDataselectV1AuthHandler.
 func fdsnDataselectV1Handler(r *http.Request, w http.ResponseWriter) (int64, error) {
+	return dataselect(r, w, nil)
+}
+
+// dataselect runs a dataselect query for user.  user is nil for unauthenticated queries.
+func dataselect(r *http.Request, w http.ResponseWriter, user *dataUser) (int64, error) {
 	var params []fdsn.DataSelect
 
 	tm := time.Now()
@@ -172,10 +192,81 @@ func fdsnDataselectV1Handler(r *http.Request, w http.ResponseWriter) (int64, err
 		log.Printf("About to execute the following query params: %+v\n", params)
 	}
 
-	// search the holdings DB for the files to fetch from S3.
+	// search the holdings DB for the files to fetch from storage.
 	// return an error if this would be to many files.
+	request, files, nrt, err := dataSearches(r, params, tm, user)
+	if err != nil {
+		return 0, err
+	}
+
+	if files == 0 && !nrt {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: params[0].NoData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+	}
+
+	// Fetch the miniSEED files from storage.  Parse them and write
+	// the records inside the time window for the query to the client.
+	// For the other formats the records are decoded and written after all of them have been found.
+	format := params[0].Format
+	if format == "miniseed" {
+		w.Header().Set("Content-Type", "application/vnd.fdsn.mseed")
+	}
+
+	var written int
+	var segments []timeseries.Segment
+	var samples int
+
+	for _, v := range request {
+		var out io.Writer = w
+		var records *bytes.Buffer
+		if format != "miniseed" {
+			records = &bytes.Buffer{}
+			out = records
+		}
+
+		n, err := writeRecords(out, v, tm, user)
+		if err != nil {
+			return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+		written += n
+
+		if records != nil {
+			s, err := decodeSegments(records.Bytes(), v.d)
+			if err != nil {
+				return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+			}
+
+			for _, seg := range s {
+				samples += len(seg.Samples)
+			}
+			if samples > MAX_SAMPLES {
+				return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusRequestEntityTooLarge,
+					Err: fmt.Errorf("number of samples exceeded the limit for format %s: %d, use format=miniseed", format, MAX_SAMPLES)}, url: r.URL.String(), timestamp: tm}
+			}
+
+			segments = append(segments, s...)
+		}
+	}
+	if written == 0 || (format != "miniseed" && len(segments) == 0) {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: params[0].NoData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+	}
+
+	if format != "miniseed" {
+		n, err := writeSegments(w, format, segments)
+		if err != nil {
+			return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+		return n, nil
+	}
+
+	return int64(written), nil
+}
+
+// dataSearches searches the holdings for the files for each query in params that user can access.  Returns
+// the number of files and if any of the queries include near real time records.
+func dataSearches(r *http.Request, params []fdsn.DataSelect, tm time.Time, user *dataUser) ([]dataSelect, int, bool, error) {
 	var request []dataSelect
-	var files int
+	var files, records int
+	var nrt bool
 
 	gtHalfHour := false //tracks whether any requests are for data longer than 30mins
 
@@ -185,103 +276,133 @@ func fdsnDataselectV1Handler(r *http.Request, w http.ResponseWriter) (int64, err
 
 		d, err := v.Regexp()
 		if err != nil {
-			return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+			return nil, 0, false, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
 		}
 		if !d.End.After(d.Start) {
-			return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("endtime must be after starttime")}, url: r.URL.String(), timestamp: tm}
+			return nil, 0, false, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("endtime must be after starttime")}, url: r.URL.String(), timestamp: tm}
 		}
-		// We reject all queries for network not "NZ", except special case IU/SNZO.
-		// Note: IU/SNZO won't matched by wildcard queries.
-		if d.Network == "^IU$" && d.Station == "^SNZO$" {
-			// let it pass
-		} else {
-			if m, err := regexp.MatchString(d.Network, "NZ"); err != nil || !m {
-				continue
-			}
+		// We reject all queries for networks that are not served, see archive.Routes.
+		if !dataRoutes.Search(d.Network, d.Station) {
+			continue
 		}
 		// only run query when the pattern contains only uppercase alphabetic, numbers, wildcard chars
 		// if the pattern string is out of this range, we knew it won't produce results
 		if fdsn.WillBeEmpty(d.Station) || fdsn.WillBeEmpty(d.Location) || fdsn.WillBeEmpty(d.Channel) {
 			continue
 		}
-		keys, err := holdingsSearch(d)
+		f, err := archive.Search(db, d)
 		if err != nil {
-			return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+			return nil, 0, false, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
 		}
+		f = allowedFiles(user, dataRoutes.Files(f))
 
-		files += len(keys)
+		files += len(f)
 
 		if files > MAX_FILES && gtHalfHour {
-			return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusRequestEntityTooLarge,
+			return nil, 0, false, fdsnError{StatusError: weft.StatusError{Code: http.StatusRequestEntityTooLarge,
 				Err: fmt.Errorf("number of queries in the POST request: %d exceeded the limit: %d", len(params), MAX_QUERIES)}, url: r.URL.String(), timestamp: tm}
 		}
 
-		request = append(request, dataSelect{d: d, keys: keys})
-	}
+		since, inWindow := nrtSince(tm, d.End)
+		nrt = nrt || inWindow
 
-	if files == 0 {
-		return 0, fdsnError{StatusError: weft.StatusError{Code: params[0].NoData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+		if inWindow {
+			n, err := recordCount(d, since)
+			if err != nil {
+				return nil, 0, false, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+			}
+
+			records += n
+
+			if records > MAX_RECORDS {
+				return nil, 0, false, fdsnError{StatusError: weft.StatusError{Code: http.StatusRequestEntityTooLarge,
+					Err: fmt.Errorf("number of near real time records: %d exceeded the limit: %d, request a shorter time window", records, MAX_RECORDS)}, url: r.URL.String(), timestamp: tm}
+			}
+		}
+
+		request = append(request, dataSelect{d: d, files: f, nrt: inWindow})
 	}
 
-	// Fetch the miniSEED files from S3.  Parse them and write
-	// the records inside the time window for the query to the client.
-	record := make([]byte, RECORDLEN)
+	return request, files, nrt, nil
+}
 
-	w.Header().Set("Content-Type", "application/vnd.fdsn.mseed")
+// writeRecords fetches the files for v from storage and writes the records inside the time window to out, followed by the
+// near real time records.  tm is the time of the request.  Returns the number of bytes written.
+func writeRecords(out io.Writer, v dataSelect, tm time.Time, user *dataUser) (int, error) {
+	record := make([]byte, RECORDLEN)
 
-	var n int
 	var written int
 
-	for _, v := range request {
-		for _, k := range v.keys {
-			log.Printf("files=%d request_length=%f", len(v.keys), v.d.End.Sub(v.d.Start).Seconds())
-			//check key exists in S3
-			exist, err := s3Client.Exists(S3_BUCKET, k)
-			if err != nil {
-				return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
-			}
-			if !exist {
-				log.Printf("miniSEED file not found, key: %s", k)
-				continue
+	// the archived records in the near real time window, so they aren't also written from fdsn.record.
+	since, _ := nrtSince(tm, v.d.End)
+	var seen map[string]bool
+	if v.nrt {
+		seen = make(map[string]bool)
+	}
+
+	for _, f := range v.files {
+		log.Printf("files=%d request_length=%f", len(v.files), v.d.End.Sub(v.d.Start).Seconds())
+		buf := &bytes.Buffer{}
+		err := archive.Fetch(dataRoutes.Key(f.Key), f, v.d, buf)
+		switch {
+		case errors.Is(err, archive.ErrNotFound):
+			log.Printf("miniSEED file not found, key: %s", f.Key)
+			continue
+		case err != nil:
+			return written, err
+		}
+
+	loop:
+		for {
+			_, err = io.ReadFull(buf, record)
+			switch {
+			case err == io.EOF:
+				break loop
+			case err != nil:
+				return written, err
 			}
 
-			buf := &bytes.Buffer{}
-			err = s3Client.Get(S3_BUCKET, k, "", buf)
+			msr, err := ms.NewRecord(record)
 			if err != nil {
-				return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+				return written, err
 			}
 
-		loop:
-			for {
-				_, err = io.ReadFull(buf, record)
-				switch {
-				case err == io.EOF:
-					break loop
-				case err != nil:
-					return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
-				}
-
-				msr, err := ms.NewRecord(record)
+			if msr.StartTime().Before(v.d.End) && msr.EndTime().After(v.d.Start) {
+				n, err := out.Write(record)
 				if err != nil {
-					return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+					return written, err
 				}
+				metrics.MsgTx()
+				written += n
 
-				if msr.StartTime().Before(v.d.End) && msr.EndTime().After(v.d.Start) {
-					n, err = w.Write(record)
-					if err != nil {
-						return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
-					}
-					metrics.MsgTx()
-					written += n
+				if seen != nil && !msr.StartTime().Before(since) {
+					seen[recordID(msr)] = true
 				}
 			}
 		}
 	}
-	if written == 0 {
-		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusNoContent, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+
+	if v.nrt {
+		err := recordSearch(v.d, since, func(r nrtRecord) error {
+			if !filterRecord(r, v.d, user, seen) {
+				return nil
+			}
+
+			n, err := out.Write(r.raw)
+			if err != nil {
+				return err
+			}
+			metrics.MsgTx()
+			written += n
+
+			return nil
+		})
+		if err != nil {
+			return written, err
+		}
 	}
 
-	return int64(written), nil
+	return written, nil
 }
 
 func fdsnDataselectV1Index(r *http.Request, h http.Header, b *bytes.Buffer) error {
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/kit/weft"
+)
+
+// Restricted data, e.g., embargoed temporary deployments, is listed in FDSN_RESTRICTED as comma separated
+// NET.STA patterns using the FDSN wildcards * and ?.  Restricted data is not returned by dataselect query,
+// only by queryauth to users with access to it.  Station queries with includerestricted=false also leave it out.
+//
+// Users are read from the FDSN_USERS file.  This is an htdigest file, user:realm:MD5(user:realm:password),
+// with a fourth field of comma separated NET.STA patterns for the restricted data the user can access e.g.,
+//
+//	alice:FDSN:939e7578ed9e3c518a452acee763bce9:Z1.*,NZ.TEST
+//
+// Only lines for the FDSN realm are used.  Restricted networks also have to be served, see archive.Routes.
+//
+// Users authenticate to queryauth with HTTP Digest authentication (RFC 7616, MD5 with qop=auth).
+// Nonces are the time they were issued signed with FDSN_DIGEST_KEY, so a nonce from any replica with the
+// same key is valid for digestNonceLifetime.  Each nonce count can only be used once on each replica, so
+// a response can't be replayed to the same replica and replaying it to another is limited to the nonce
+// lifetime.  An expired nonce is stale, the client retries with a new nonce without asking the user again.
+
+const (
+	digestRealm         = "FDSN"
+	digestNonceLifetime = 5 * time.Minute
+)
+
+var (
+	restrictedData []archive.StreamAccess
+	dataUsers      map[string]dataUser
+	digestKey      []byte
+	digestCounts   = digestNonceCounts{nonces: make(map[string]digestNonceUse)}
+)
+
+// digestNonceCounts are the nonce counts that have been used on this replica with each nonce.
+type digestNonceCounts struct {
+	nonces map[string]digestNonceUse
+	sync.Mutex
+}
+
+type digestNonceUse struct {
+	issued time.Time
+	counts map[string]bool
+}
+
+// dataUser is a user that can access restricted data with queryauth.
+type dataUser struct {
+	name   string
+	ha1    string // MD5(name:realm:password) as hex
+	access []archive.StreamAccess
+}
+
+var validHA1 = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// initDataAuth reads the restricted data and users from the environment.
+func initDataAuth() {
+	var err error
+
+	if restrictedData, err = archive.ParseStreamAccess(os.Getenv("FDSN_RESTRICTED")); err != nil {
+		log.Fatalf("error reading FDSN_RESTRICTED: %s", err)
+	}
+
+	if f := os.Getenv("FDSN_USERS"); f != "" {
+		r, err := os.Open(f)
+		if err != nil {
+			log.Fatalf("error opening FDSN_USERS: %s", err)
+		}
+		defer func() { _ = r.Close() }()
+
+		if dataUsers, err = readDataUsers(r); err != nil {
+			log.Fatalf("error reading FDSN_USERS %s: %s", f, err)
+		}
+	}
+
+	if k := os.Getenv("FDSN_DIGEST_KEY"); k != "" {
+		digestKey = []byte(k)
+	} else {
+		digestKey = make([]byte, 32)
+		if _, err = rand.Read(digestKey); err != nil {
+			log.Fatalf("error creating digest nonce key: %s", err)
+		}
+	}
+
+	log.Printf("restricted data patterns: %d, queryauth users: %d", len(restrictedData), len(dataUsers))
+}
+
+// readDataUsers reads users from an htdigest file with an extra field for the user's access.
+func readDataUsers(r io.Reader) (map[string]dataUser, error) {
+	users := make(map[string]dataUser)
+
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		f := strings.Split(l, ":")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("line %d: expected user:realm:ha1:access", line)
+		}
+
+		if f[1] != digestRealm {
+			continue
+		}
+
+		if f[0] == "" {
+			return nil, fmt.Errorf("line %d: empty user", line)
+		}
+
+		if _, ok := users[f[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate user %s", line, f[0])
+		}
+
+		if !validHA1.MatchString(f[2]) {
+			return nil, fmt.Errorf("line %d: invalid ha1 for user %s", line, f[0])
+		}
+
+		access, err := archive.ParseStreamAccess(f[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		users[f[0]] = dataUser{name: f[0], ha1: f[2], access: access}
+	}
+
+	return users, scanner.Err()
+}
+
+// dataAllowed returns true if the data for network and station is not restricted or
+// user has access to it.  user is nil for unauthenticated requests.
+func dataAllowed(user *dataUser, network, station string) bool {
+	if !archive.AnyMatches(restrictedData, network, station) {
+		return true
+	}
+
+	return user != nil && archive.AnyMatches(user.access, network, station)
+}
+
+// dataRestricted returns true if the data for network and station is restricted.
+func dataRestricted(network, station string) bool {
+	return !dataAllowed(nil, network, station)
+}
+
+// allowedFiles returns the files for data user can access.  files is modified.
+func allowedFiles(user *dataUser, files []archive.File) []archive.File {
+	allowed := files[:0]
+
+	for _, f := range files {
+		p := strings.SplitN(f.Key, ".", 3)
+		if len(p) < 3 {
+			continue
+		}
+
+		if dataAllowed(user, p[0], p[1]) {
+			allowed = append(allowed, f)
+		}
+	}
+
+	return allowed
+}
+
+// fdsnDataselectV1AuthHandler handles dataselect queries from users with HTTP Digest authentication.
+// It is the same as fdsnDataselectV1Handler with the addition of the restricted data the user can access.
+func fdsnDataselectV1AuthHandler(r *http.Request, w http.ResponseWriter) (int64, error) {
+	// responses depend on the user and must not be cached.
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Surrogate-Control", "no-store")
+
+	now := time.Now()
+
+	user, stale := digestAuth(r, now)
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", digestChallenge(now, stale))
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusUnauthorized, Err: errors.New("authentication required")}, url: r.URL.String(), timestamp: now}
+	}
+
+	return dataselect(r, w, user)
+}
+
+// digestChallenge returns the WWW-Authenticate header value with a new nonce.
+// stale should be true when the request had a valid response for an expired nonce.
+func digestChallenge(now time.Time, stale bool) string {
+	c := fmt.Sprintf(`Digest realm="%s", qop="auth", algorithm=MD5, nonce="%s"`, digestRealm, digestNonce(now))
+	if stale {
+		c += ", stale=true"
+	}
+	return c
+}
+
+// digestNonce returns a nonce with the issue time signed with digestKey.
+func digestNonce(t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return ts + "-" + digestSign(ts)
+}
+
+func digestSign(ts string) string {
+	m := hmac.New(sha256.New, digestKey)
+	m.Write([]byte("digest-nonce:" + ts))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// checkDigestNonce returns valid if nonce was issued by digestNonce, on any replica with the same
+// digestKey, and stale if it has expired.
+func checkDigestNonce(nonce string, now time.Time) (valid, stale bool) {
+	p := strings.Split(nonce, "-")
+	if len(p) != 2 || !hmac.Equal([]byte(p[1]), []byte(digestSign(p[0]))) {
+		return false, false
+	}
+
+	i, err := strconv.ParseInt(p[0], 10, 64)
+	if err != nil {
+		return false, false
+	}
+
+	issued := time.Unix(i, 0)
+
+	return true, now.Sub(issued) > digestNonceLifetime || issued.After(now.Add(time.Minute))
+}
+
+// use records the nonce count nc for nonce.  Returns false if it has already been used.
+func (d *digestNonceCounts) use(nonce, nc string, now time.Time) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	u, ok := d.nonces[nonce]
+	if !ok {
+		// remove the expired nonces before adding another.
+		for k, v := range d.nonces {
+			if now.Sub(v.issued) > digestNonceLifetime+time.Minute {
+				delete(d.nonces, k)
+			}
+		}
+
+		i, _ := strconv.ParseInt(strings.SplitN(nonce, "-", 2)[0], 10, 64)
+		u = digestNonceUse{issued: time.Unix(i, 0), counts: make(map[string]bool)}
+		d.nonces[nonce] = u
+	}
+
+	if u.counts[nc] {
+		return false
+	}
+	u.counts[nc] = true
+
+	return true
+}
+
+// digestAuth checks the Digest Authorization header in r.  Returns nil if the request is not
+// authenticated.  stale is true if the credentials are correct but the nonce has expired.
+func digestAuth(r *http.Request, now time.Time) (user *dataUser, stale bool) {
+	a := r.Header.Get("Authorization")
+	if len(a) < 7 || !strings.EqualFold(a[:7], "Digest ") {
+		return nil, false
+	}
+
+	p := parseDigestParams(a[7:])
+
+	u, ok := dataUsers[p["username"]]
+	if !ok || p["realm"] != digestRealm || !digestURI(p["uri"], r) {
+		return nil, false
+	}
+
+	if alg := p["algorithm"]; alg != "" && alg != "MD5" {
+		return nil, false
+	}
+
+	// only qop=auth is offered, RFC 2069 responses without a nonce count can be replayed.
+	if p["qop"] != "auth" || p["cnonce"] == "" {
+		return nil, false
+	}
+
+	nc, err := strconv.ParseUint(p["nc"], 16, 32)
+	if err != nil || len(p["nc"]) != 8 || nc == 0 {
+		return nil, false
+	}
+
+	valid, expired := checkDigestNonce(p["nonce"], now)
+	if !valid {
+		return nil, false
+	}
+
+	ha2 := md5Hex(r.Method + ":" + p["uri"])
+	expected := md5Hex(u.ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(p["response"])) != 1 {
+		return nil, false
+	}
+
+	if expired {
+		return nil, true
+	}
+
+	if !digestCounts.use(p["nonce"], p["nc"], now) {
+		return nil, false
+	}
+
+	return &u, false
+}
+
+// digestURI returns true if uri, from the Authorization header, is the path and query of r.  They are
+// compared decoded as a proxy may have encoded the request URI differently to the client.
+func digestURI(uri string, r *http.Request) bool {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return false
+	}
+
+	return u.Path == r.URL.Path && u.Query().Encode() == r.URL.Query().Encode()
+}
+
+// parseDigestParams parses the comma separated key=value or key="value" parameters from a Digest
+// Authorization header.
+func parseDigestParams(s string) map[string]string {
+	p := make(map[string]string)
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return p
+		}
+
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return p
+		}
+		k := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var v string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			j := 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			v = b.String()
+			if j < len(s) {
+				j++
+			}
+			s = s[j:]
+		} else {
+			j := strings.IndexByte(s, ',')
+			if j < 0 {
+				j = len(s)
+			}
+			v = strings.TrimSpace(s[:j])
+			s = s[j:]
+		}
+
+		p[k] = v
+	}
+}
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
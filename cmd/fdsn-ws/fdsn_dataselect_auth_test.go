@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+)
+
+func TestReadDataUsers(t *testing.T) {
+	users, err := readDataUsers(strings.NewReader(`# test users
+alice:FDSN:` + md5Hex("alice:FDSN:secret") + `:Z1.*,NZ.TEST
+
+bob:other:` + md5Hex("bob:other:secret") + `:Z1.*
+carol:FDSN:` + md5Hex("carol:FDSN:secret") + `:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users in the FDSN realm got %d", len(users))
+	}
+
+	if a := users["alice"].access; !reflect.DeepEqual(a, []archive.StreamAccess{{Network: "Z1", Station: "*"}, {Network: "NZ", Station: "TEST"}}) {
+		t.Errorf("unexpected access for alice %v", a)
+	}
+
+	if a := users["carol"].access; len(a) != 0 {
+		t.Errorf("expected no access for carol got %v", a)
+	}
+
+	in := []struct {
+		id   string
+		file string
+	}{
+		{id: loc(), file: "alice:FDSN:" + md5Hex("alice:FDSN:secret")},
+		{id: loc(), file: "alice:FDSN:notahash:Z1.*"},
+		{id: loc(), file: ":FDSN:" + md5Hex(":FDSN:secret") + ":Z1.*"},
+		{id: loc(), file: "alice:FDSN:" + md5Hex("alice:FDSN:secret") + ":Z1"},
+		{id: loc(), file: "alice:FDSN:" + md5Hex("alice:FDSN:secret") + ":Z1.[A-Z]*"},
+		{id: loc(), file: "alice:FDSN:" + md5Hex("alice:FDSN:secret") + ":Z1.*\nalice:FDSN:" + md5Hex("alice:FDSN:secret") + ":Z2.*"},
+	}
+
+	for _, v := range in {
+		if _, err := readDataUsers(strings.NewReader(v.file)); err == nil {
+			t.Errorf("%s expected an error", v.id)
+		}
+	}
+}
+
+func TestAllowedFiles(t *testing.T) {
+	defer func() { restrictedData = nil }()
+
+	restrictedData = []archive.StreamAccess{{Network: "Z1", Station: "*"}, {Network: "NZ", Station: "TEST"}}
+	user := &dataUser{name: "alice", access: []archive.StreamAccess{{Network: "Z1", Station: "AB??"}}}
+
+	files := func() []archive.File {
+		return []archive.File{
+			{Key: "NZ.WEL.10.HHZ.D.2024.001"},
+			{Key: "NZ.TEST.10.HHZ.D.2024.001"},
+			{Key: "Z1.ABCD.10.HHZ.D.2024.001"},
+			{Key: "Z1.XYZ.10.HHZ.D.2024.001"},
+		}
+	}
+
+	if f := allowedFiles(nil, files()); !reflect.DeepEqual(f, []archive.File{{Key: "NZ.WEL.10.HHZ.D.2024.001"}}) {
+		t.Errorf("unexpected files without a user %v", f)
+	}
+
+	if f := allowedFiles(user, files()); !reflect.DeepEqual(f, []archive.File{{Key: "NZ.WEL.10.HHZ.D.2024.001"}, {Key: "Z1.ABCD.10.HHZ.D.2024.001"}}) {
+		t.Errorf("unexpected files for user %v", f)
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	defer func() { dataUsers = nil }()
+
+	digestKey = []byte("test")
+	digestCounts = digestNonceCounts{nonces: make(map[string]digestNonceUse)}
+	dataUsers = map[string]dataUser{
+		"alice": {name: "alice", ha1: md5Hex("alice:" + digestRealm + ":secret")},
+	}
+
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	uri := "/fdsnws/dataselect/1/queryauth?network=Z1&starttime=2024-01-01T00:00:00&endtime=2024-01-01T01:00:00"
+
+	// authorization returns the Authorization header for a client with the nonce issued at issued.
+	authorization := func(user, password, uri, qop, nc string, issued time.Time) string {
+		nonce := digestNonce(issued)
+		ha1 := md5Hex(user + ":" + digestRealm + ":" + password)
+		ha2 := md5Hex("GET:" + uri)
+
+		if qop == "" {
+			return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+				user, digestRealm, nonce, uri, md5Hex(ha1+":"+nonce+":"+ha2))
+		}
+
+		return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=MD5, qop=%s, nc=%s, cnonce="0a4f113b", response="%s"`,
+			user, digestRealm, nonce, uri, qop, nc, md5Hex(ha1+":"+nonce+":"+nc+":0a4f113b:"+qop+":"+ha2))
+	}
+
+	// a nonce signed with another key.
+	digestKey = []byte("other")
+	other := authorization("alice", "secret", uri, "auth", "00000001", now)
+	digestKey = []byte("test")
+
+	in := []struct {
+		id            string
+		authorization string
+		ok, stale     bool
+	}{
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth", "00000001", now), ok: true},
+		// a replayed response.
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth", "00000001", now)},
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth", "00000002", now), ok: true},
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth", "00000001", now.Add(-time.Minute)), ok: true},
+		// RFC 2069 without qop.
+		{id: loc(), authorization: authorization("alice", "secret", uri, "", "", now.Add(-2*time.Minute))},
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth", "1", now.Add(-2*time.Minute))},
+		{id: loc(), authorization: ""},
+		{id: loc(), authorization: "Basic YWxpY2U6c2VjcmV0"},
+		{id: loc(), authorization: authorization("alice", "wrong", uri, "auth", "00000003", now)},
+		{id: loc(), authorization: authorization("bob", "secret", uri, "auth", "00000003", now)},
+		{id: loc(), authorization: authorization("alice", "secret", "/fdsnws/dataselect/1/queryauth?network=NZ", "auth", "00000003", now)},
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth-int", "00000003", now)},
+		{id: loc(), authorization: authorization("alice", "secret", uri, "auth", "00000001", now.Add(-time.Hour)), stale: true},
+		{id: loc(), authorization: other},
+		// the same query encoded differently, e.g., by a proxy.
+		{id: loc(), authorization: authorization("alice", "secret", "/fdsnws/dataselect/1/queryauth?network=Z1&starttime=2024-01-01T00%3A00%3A00&endtime=2024-01-01T01:00:00", "auth", "00000004", now), ok: true},
+		{id: loc(), authorization: authorization("alice", "secret", "/fdsnws/dataselect/1/queryauth?network=Z1&starttime=2024-01-01T00:00:00", "auth", "00000005", now)},
+		{id: loc(), authorization: authorization("alice", "secret", "/fdsnws/dataselect/1/other?network=Z1&starttime=2024-01-01T00:00:00&endtime=2024-01-01T01:00:00", "auth", "00000005", now)},
+		{id: loc(), authorization: strings.Replace(authorization("alice", "secret", uri, "auth", "00000003", now), `nonce="1`, `nonce="2`, 1)},
+	}
+
+	for _, v := range in {
+		r := httptest.NewRequest("GET", uri, nil)
+		if v.authorization != "" {
+			r.Header.Set("Authorization", v.authorization)
+		}
+
+		user, stale := digestAuth(r, now)
+		if (user != nil) != v.ok {
+			t.Errorf("%s expected ok %t got %t", v.id, v.ok, user != nil)
+		}
+		if stale != v.stale {
+			t.Errorf("%s expected stale %t got %t", v.id, v.stale, stale)
+		}
+	}
+}
+
+func TestParseDigestParams(t *testing.T) {
+	p := parseDigestParams(`username="al\"ice", realm="FDSN", nonce="1-ab", uri="/q?a=1,b=2", qop=auth, nc=00000001`)
+
+	expected := map[string]string{
+		"username": `al"ice`,
+		"realm":    "FDSN",
+		"nonce":    "1-ab",
+		"uri":      "/q?a=1,b=2",
+		"qop":      "auth",
+		"nc":       "00000001",
+	}
+
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected %v got %v", expected, p)
+	}
+}
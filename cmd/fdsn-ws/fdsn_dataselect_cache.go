@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/kit/aws/s3"
+	"github.com/GeoNet/kit/aws/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Files from S3 are cached on disk, in dataselect-cache in SCRATCH_DIR, so repeated requests for the same
+// files, e.g., after a large earthquake, are served without fetching them from S3 again.  The cache size is
+// DATASELECT_CACHE_MB, the least recently used files are removed when it is full.  There is no cache when
+// DATASELECT_CACHE_MB is not set.
+//
+// The whole file is cached, ranged reads and the file size are served from the cached file without asking S3.
+// Files are cached with the object ETag from the GET, which is checked with a HEAD request at most once every
+// DATASELECT_CACHE_TTL (default 1m) for each cached file.  With DATASELECT_SQS_QUEUE_URL, a queue receiving S3
+// notifications for the data buckets, cached files are removed when the object is created or removed and are
+// used without checking S3.  A file being fetched when its notification arrives is not cached.
+
+// defaultDataCacheTTL is how often a cached file is checked with S3 when there is no DATASELECT_SQS_QUEUE_URL.
+const defaultDataCacheTTL = time.Minute
+
+// dataCache is a size limited least recently used cache of files on disk.
+type dataCache struct {
+	dir string
+	max int64
+	ttl time.Duration // how often the object tag for a cached file is checked with S3, zero to use cached files without checking.
+
+	mu       sync.Mutex
+	size     int64
+	entries  map[string]*list.Element // of *cacheEntry, by id
+	lru      *list.List               // most recently used at the front
+	inflight map[string]*cacheFill    // files being fetched, by id
+}
+
+// cacheEntry is a cached file.  id is the bucket and key.
+type cacheEntry struct {
+	id, tag, name string
+	size          int64
+	checked       time.Time // when tag was last checked with S3.
+}
+
+// cacheFill is the fetch of a file for the cache.
+type cacheFill struct {
+	done    chan struct{}
+	removed bool // the file was removed from the cache during the fetch, the fetched content may be out of date.
+}
+
+// errCacheRemoved is returned by dataCache.write when the file was removed during the fetch.
+var errCacheRemoved = errors.New("removed from the cache during the fetch")
+
+// cachedStore is an archive.S3Store with a dataCache.
+type cachedStore struct {
+	archive.S3Store
+	cache *dataCache
+}
+
+// newDataCache returns a cache of max bytes in dir.  Cached files are checked with S3 every ttl, zero for never.
+// Files already in dir are removed.
+func newDataCache(dir string, max int64, ttl time.Duration) (*dataCache, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &dataCache{
+		dir:      dir,
+		max:      max,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*cacheFill),
+	}, nil
+}
+
+// initDataCache sets up the cache from the environment and adds it to the S3 storage in dataRoutes.
+func initDataCache() error {
+	s := os.Getenv("DATASELECT_CACHE_MB")
+	if s == "" {
+		return nil
+	}
+
+	mb, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || mb <= 0 {
+		return fmt.Errorf("invalid DATASELECT_CACHE_MB %s", s)
+	}
+
+	dir := os.Getenv("SCRATCH_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	queueURL := os.Getenv("DATASELECT_SQS_QUEUE_URL")
+
+	// with notifications the cached files don't need checking.
+	var ttl time.Duration
+	if queueURL == "" {
+		ttl = defaultDataCacheTTL
+		if s := os.Getenv("DATASELECT_CACHE_TTL"); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid DATASELECT_CACHE_TTL %s", s)
+			}
+		}
+	}
+
+	cache, err := newDataCache(filepath.Join(dir, "dataselect-cache"), mb*1024*1024, ttl)
+	if err != nil {
+		return err
+	}
+
+	for i := range dataRoutes {
+		if s, ok := dataRoutes[i].Store.(archive.S3Store); ok {
+			dataRoutes[i].Store = cachedStore{S3Store: s, cache: cache}
+		}
+	}
+
+	if queueURL != "" {
+		sqsClient, err := sqs.NewWithMaxRetries(100)
+		if err != nil {
+			return fmt.Errorf("error creating SQS client: %w", err)
+		}
+		go receiveNotifications(context.Background(), sqsClient, queueURL, "dataselect cache", &dataCacheEvent{cache: cache})
+	}
+
+	log.Printf("caching dataselect files from S3 in %s, %d MB", cache.dir, mb)
+
+	return nil
+}
+
+func (s cachedStore) Get(key string, b *bytes.Buffer) error {
+	_, err := s.GetRange(key, 0, -1, b)
+	return err
+}
+
+// GetRange reads from the cached file for key, fetching the whole file from S3 into the cache if needed.
+func (s cachedStore) GetRange(key string, from, to int64, b *bytes.Buffer) (int64, error) {
+	name, data, err := s.cache.fill(s.id(key),
+		func() (string, error) { return s.tag(key) },
+		func(f *bytes.Buffer) (string, error) { return s.GetWithETag(key, f) })
+	if err != nil {
+		return 0, err
+	}
+
+	// too large to cache.
+	if data != nil {
+		return int64(len(data)), sliceRange(data, from, to, b)
+	}
+
+	size, err := archive.FileStore{Root: s.cache.dir}.GetRange(name, from, to, b)
+	if errors.Is(err, archive.ErrNotFound) {
+		// removed from the cache since it was filled.
+		b.Reset()
+		return s.S3Store.GetRange(key, from, to, b)
+	}
+
+	return size, err
+}
+
+// Size returns the size of the cached file for key, S3 is only asked if it isn't cached or is due to be checked.
+func (s cachedStore) Size(key string) (int64, error) {
+	if size, ok := s.cache.cachedSize(s.id(key)); ok {
+		return size, nil
+	}
+
+	return s.S3Store.Size(key)
+}
+
+// id is the cache id for key.
+func (s cachedStore) id(key string) string {
+	return s.Bucket + "/" + s.Prefix + key
+}
+
+// tag returns the ETag of the object for key.
+func (s cachedStore) tag(key string) (string, error) {
+	o, err := s.Client.HeadObject(context.TODO(), &awss3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return "", archive.ErrNotFound
+		}
+		return "", err
+	}
+
+	return aws.ToString(o.ETag), nil
+}
+
+// fill returns the name of the cached file for id, calling fetch to add it to the cache, with the tag it
+// returns, if it isn't cached.  A cached file is checked with tag if it hasn't been checked for c.ttl and is
+// fetched again if it has changed.  Concurrent fills for the same id wait for one fetch.  If the file is too
+// large to cache, or was removed from the cache during the fetch, its content is returned instead of a name.
+func (c *dataCache) fill(id string, tag func() (string, error), fetch func(*bytes.Buffer) (string, error)) (string, []byte, error) {
+	for {
+		c.mu.Lock()
+
+		if e, ok := c.entries[id]; ok {
+			entry := e.Value.(*cacheEntry)
+
+			if c.ttl > 0 && time.Since(entry.checked) >= c.ttl {
+				// other requests use the cached file while it is checked.
+				entry.checked = time.Now()
+				c.mu.Unlock()
+
+				t, err := tag()
+				switch {
+				case errors.Is(err, archive.ErrNotFound):
+					c.removeEntry(e)
+					return "", nil, err
+				case err != nil:
+					log.Printf("error checking cached file for %s, using it: %s", id, err)
+				case t != entry.tag:
+					c.removeEntry(e)
+					continue
+				}
+
+				c.mu.Lock()
+				if c.entries[id] != e {
+					// removed while it was checked, look again.
+					c.mu.Unlock()
+					continue
+				}
+			}
+
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return entry.name, nil, nil
+		}
+
+		f, ok := c.inflight[id]
+		if !ok {
+			break
+		}
+
+		// wait for the other fetch and look again.
+		c.mu.Unlock()
+		<-f.done
+	}
+
+	f := &cacheFill{done: make(chan struct{})}
+	c.inflight[id] = f
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, id)
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	var b bytes.Buffer
+	t, err := fetch(&b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if int64(b.Len()) > c.max {
+		return "", b.Bytes(), nil
+	}
+
+	name, err := c.write(id, t, b.Bytes())
+	switch {
+	case errors.Is(err, errCacheRemoved):
+		return "", b.Bytes(), nil
+	case err != nil:
+		log.Printf("error caching %s: %s", id, err)
+		return "", b.Bytes(), nil
+	}
+
+	return name, nil, nil
+}
+
+// cachedSize returns the size of the cached file for id, ok is false if it isn't cached or is due to be checked.
+func (c *dataCache) cachedSize(id string) (size int64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return 0, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Since(entry.checked) >= c.ttl {
+		return 0, false
+	}
+
+	return entry.size, true
+}
+
+// write saves data to the cache for id, removing the least recently used files to make room.
+// Returns errCacheRemoved if id was removed while data was being fetched.
+func (c *dataCache) write(id, tag string, data []byte) (string, error) {
+	h := sha256.Sum256([]byte(id + "\x00" + tag))
+	name := hex.EncodeToString(h[:])
+
+	tmp, err := os.CreateTemp(c.dir, "fill-")
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.inflight[id]; ok && f.removed {
+		_ = os.Remove(tmp.Name())
+		return "", errCacheRemoved
+	}
+
+	if e, ok := c.entries[id]; ok {
+		c.removeElement(e)
+	}
+
+	for c.size+int64(len(data)) > c.max && c.lru.Len() > 0 {
+		c.removeElement(c.lru.Back())
+	}
+
+	if err = os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+
+	c.entries[id] = c.lru.PushFront(&cacheEntry{id: id, tag: tag, name: name, size: int64(len(data)), checked: time.Now()})
+	c.size += int64(len(data))
+
+	return name, nil
+}
+
+// remove removes the cached file for id, if there is one.  A fetch of id in progress is not cached.
+func (c *dataCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[id]; ok {
+		c.removeElement(e)
+	}
+
+	if f, ok := c.inflight[id]; ok {
+		f.removed = true
+	}
+}
+
+// removeEntry removes the cache entry e, if it hasn't already been removed.
+func (c *dataCache) removeEntry(e *list.Element) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[e.Value.(*cacheEntry).id] == e {
+		c.removeElement(e)
+	}
+}
+
+// removeElement removes a cache entry and its file.  c.mu must be held.
+func (c *dataCache) removeElement(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.id)
+	c.size -= entry.size
+
+	if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("error removing cached file for %s: %s", entry.id, err)
+	}
+}
+
+// sliceRange writes the bytes from, inclusive, to, exclusive, of data to b.  to is -1 for the end of data.
+func sliceRange(data []byte, from, to int64, b *bytes.Buffer) error {
+	n := int64(len(data))
+	if from > 0 && from >= n {
+		return fmt.Errorf("range not satisfiable, %d is past the end of the %d byte file", from, n)
+	}
+	if to < 0 || to > n {
+		to = n
+	}
+	_, err := b.Write(data[from:to])
+	return err
+}
+
+// dataCacheEvent is an S3 notification received from SQS.
+type dataCacheEvent struct {
+	s3.Event
+	cache *dataCache
+}
+
+// Process implements metrics.Processor.  Cached files are removed when the object is created or removed.
+func (e *dataCacheEvent) Process(msg []byte) error {
+	e.Records = nil
+
+	if err := json.Unmarshal(msg, e); err != nil {
+		return err
+	}
+
+	for _, v := range e.Records {
+		if !strings.HasPrefix(v.EventName, "ObjectCreated") && !strings.HasPrefix(v.EventName, "ObjectRemoved") {
+			continue
+		}
+
+		// keys in S3 notifications are url encoded.
+		key, err := url.QueryUnescape(v.S3.Object.Key)
+		if err != nil {
+			key = v.S3.Object.Key
+		}
+
+		e.cache.remove(v.S3.Bucket.Name + "/" + key)
+	}
+
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+)
+
+func TestDataCache(t *testing.T) {
+	// cached files are checked on every use.
+	c, err := newDataCache(filepath.Join(t.TempDir(), "cache"), 10, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// objects are the object tags in S3, a missing object isn't found.
+	objects := map[string]string{}
+	tag := func(id string) func() (string, error) {
+		return func() (string, error) {
+			if t, ok := objects[id]; ok {
+				return t, nil
+			}
+			return "", archive.ErrNotFound
+		}
+	}
+
+	var fetches int
+	fetch := func(id, data string) func(*bytes.Buffer) (string, error) {
+		return func(b *bytes.Buffer) (string, error) {
+			fetches++
+			b.WriteString(data)
+			return objects[id], nil
+		}
+	}
+
+	// read returns the cached content for id.
+	read := func(id, data string) string {
+		name, d, err := c.fill(id, tag(id), fetch(id, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != nil {
+			return string(d)
+		}
+
+		var b bytes.Buffer
+		if err := (archive.FileStore{Root: c.dir}).Get(name, &b); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	objects["a"] = "1"
+	if s := read("a", "aaaa"); s != "aaaa" || fetches != 1 {
+		t.Errorf("expected aaaa from 1 fetch got %s from %d", s, fetches)
+	}
+
+	if s := read("a", "xxxx"); s != "aaaa" || fetches != 1 {
+		t.Errorf("expected cached aaaa got %s from %d fetches", s, fetches)
+	}
+
+	// the object has changed.
+	objects["a"] = "2"
+	if s := read("a", "AAAA"); s != "AAAA" || fetches != 2 {
+		t.Errorf("expected AAAA from 2 fetches got %s from %d", s, fetches)
+	}
+
+	objects["b"] = "1"
+	read("b", "bbbb")
+	read("a", "")
+
+	// b is the least recently used and is removed to make room for c.
+	objects["c"] = "1"
+	read("c", "cccc")
+
+	if _, ok := c.entries["b"]; ok {
+		t.Error("expected b to be removed")
+	}
+	if _, ok := c.entries["a"]; !ok {
+		t.Error("expected a to be cached")
+	}
+	if c.size != 8 {
+		t.Errorf("expected 8 bytes cached got %d", c.size)
+	}
+
+	// too large to cache.
+	objects["d"] = "1"
+	if s := read("d", "ddddddddddd"); s != "ddddddddddd" {
+		t.Errorf("expected the content for a large file got %s", s)
+	}
+	if _, ok := c.entries["d"]; ok {
+		t.Error("expected d not to be cached")
+	}
+
+	// the object has been deleted.
+	delete(objects, "c")
+	if _, _, err := c.fill("c", tag("c"), fetch("c", "")); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("expected not found for a deleted object got %v", err)
+	}
+	if _, ok := c.entries["c"]; ok || c.size != 4 {
+		t.Errorf("expected c to be removed, %d bytes cached", c.size)
+	}
+
+	c.remove("a")
+	if _, ok := c.entries["a"]; ok || c.size != 0 {
+		t.Errorf("expected a to be removed, %d bytes cached", c.size)
+	}
+
+	errFetch := errors.New("fetch failed")
+	if _, _, err := c.fill("e", tag("e"), func(*bytes.Buffer) (string, error) { return "", errFetch }); !errors.Is(err, errFetch) {
+		t.Errorf("expected the fetch error got %v", err)
+	}
+	if len(c.inflight) != 0 {
+		t.Error("expected no fetches in flight")
+	}
+}
+
+func TestDataCacheTTL(t *testing.T) {
+	c, err := newDataCache(filepath.Join(t.TempDir(), "cache"), 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tags int
+	tag := func() (string, error) { tags++; return "1", nil }
+
+	if _, _, err := c.fill("a", tag, func(b *bytes.Buffer) (string, error) { b.WriteString("aaaa"); return "1", nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.fill("a", tag, func(*bytes.Buffer) (string, error) { t.Error("unexpected fetch"); return "", nil }); err != nil {
+			t.Fatal(err)
+		}
+		if size, ok := c.cachedSize("a"); !ok || size != 4 {
+			t.Errorf("expected the cached size 4 got %d %t", size, ok)
+		}
+	}
+
+	if tags != 0 {
+		t.Errorf("expected no tag checks within the ttl got %d", tags)
+	}
+
+	// due to be checked.
+	c.entries["a"].Value.(*cacheEntry).checked = time.Now().Add(-time.Hour)
+
+	if _, ok := c.cachedSize("a"); ok {
+		t.Error("expected no cached size for a file due to be checked")
+	}
+
+	if _, _, err := c.fill("a", tag, func(*bytes.Buffer) (string, error) { t.Error("unexpected fetch"); return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.fill("a", tag, func(*bytes.Buffer) (string, error) { t.Error("unexpected fetch"); return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if tags != 1 {
+		t.Errorf("expected 1 tag check got %d", tags)
+	}
+
+	// a file that can't be checked is used.
+	c.entries["a"].Value.(*cacheEntry).checked = time.Now().Add(-time.Hour)
+	if _, _, err := c.fill("a", func() (string, error) { return "", errors.New("check failed") },
+		func(*bytes.Buffer) (string, error) { t.Error("unexpected fetch"); return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataCacheNoValidate(t *testing.T) {
+	c, err := newDataCache(filepath.Join(t.TempDir(), "cache"), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.fill("bucket/a", noTag(t), func(b *bytes.Buffer) (string, error) { b.WriteString("aaaa"); return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := c.fill("bucket/a", noTag(t), func(b *bytes.Buffer) (string, error) { t.Error("unexpected fetch"); return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	e := dataCacheEvent{cache: c}
+	if err := e.Process([]byte(`{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"bucket"},"object":{"key":"a"}}}]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.entries["bucket/a"]; ok {
+		t.Error("expected bucket/a to be removed on notification")
+	}
+}
+
+func TestDataCacheRemovedDuringFetch(t *testing.T) {
+	c, err := newDataCache(filepath.Join(t.TempDir(), "cache"), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the object is replaced while the old version is being fetched.
+	name, d, err := c.fill("bucket/a", noTag(t), func(b *bytes.Buffer) (string, error) {
+		c.remove("bucket/a")
+		b.WriteString("aaaa")
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" || string(d) != "aaaa" {
+		t.Errorf("expected the fetched content without caching got %q %q", name, d)
+	}
+	if _, ok := c.entries["bucket/a"]; ok || c.size != 0 {
+		t.Errorf("expected bucket/a not to be cached, %d bytes cached", c.size)
+	}
+
+	var fetched bool
+	if _, _, err := c.fill("bucket/a", noTag(t), func(b *bytes.Buffer) (string, error) { fetched = true; b.WriteString("AAAA"); return "", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !fetched {
+		t.Error("expected bucket/a to be fetched again")
+	}
+	if _, ok := c.entries["bucket/a"]; !ok {
+		t.Error("expected bucket/a to be cached")
+	}
+}
+
+func TestDataCacheInflight(t *testing.T) {
+	c, err := newDataCache(filepath.Join(t.TempDir(), "cache"), 1024, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches int32
+	fetch := func(b *bytes.Buffer) (string, error) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(50 * time.Millisecond)
+		b.WriteString("miniSEED")
+		return "1", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := c.fill("a", func() (string, error) { return "1", nil }, fetch); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("expected 1 fetch got %d", fetches)
+	}
+}
+
+// noTag is the tag check for a cache that isn't checked with S3.
+func noTag(t *testing.T) func() (string, error) {
+	return func() (string, error) {
+		t.Error("unexpected tag check")
+		return "", nil
+	}
+}
+
+func TestSliceRange(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := sliceRange([]byte("miniSEED"), 4, 7, &b); err != nil || b.String() != "SEE" {
+		t.Errorf("expected SEE got %q %v", b.String(), err)
+	}
+
+	b.Reset()
+	if err := sliceRange([]byte("miniSEED"), 6, -1, &b); err != nil || b.String() != "ED" {
+		t.Errorf("expected ED got %q %v", b.String(), err)
+	}
+
+	if err := sliceRange([]byte("miniSEED"), 8, -1, &b); err == nil {
+		t.Error("expected an error for a range starting after the end of the file")
+	}
+}
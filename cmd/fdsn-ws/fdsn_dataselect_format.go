@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/fdsn/internal/timeseries"
+)
+
+// Dataselect can also return the data decoded from miniSEED, for use without seismology software.
+//
+//	sac           a zip of SAC binary files, one per continuous segment, with the station location and
+//	              channel orientation from the station inventory where available.
+//	geocsv, ascii GeoCSV time, value pairs for each segment.
+//	json          an array of segments with the samples.
+//
+// The segments are trimmed to the time window for each query.
+
+// dataFormatContentType is the content type for each dataselect format other than miniseed.
+var dataFormatContentType = map[string]string{
+	"sac":    "application/zip",
+	"geocsv": "text/csv",
+	"ascii":  "text/csv",
+	"json":   "application/json",
+}
+
+// decodeSegments decodes miniSEED records into segments trimmed to the time window for d.
+func decodeSegments(records []byte, d fdsn.DataSearch) ([]timeseries.Segment, error) {
+	s, err := timeseries.Decode(records, RECORDLEN)
+	if err != nil {
+		return nil, err
+	}
+
+	var trimmed []timeseries.Segment
+
+	for _, v := range s {
+		if t, ok := v.Trim(d.Start, d.End); ok {
+			trimmed = append(trimmed, t)
+		}
+	}
+
+	return trimmed, nil
+}
+
+// writeSegments writes the segments to w in format.  Returns the number of bytes written.
+func writeSegments(w http.ResponseWriter, format string, segments []timeseries.Segment) (int64, error) {
+	w.Header().Set("Content-Type", dataFormatContentType[format])
+
+	c := &countWriter{w: w}
+
+	switch format {
+	case "sac":
+		w.Header().Set("Content-Disposition", `attachment; filename="dataselect.zip"`)
+
+		z := zip.NewWriter(c)
+		for _, s := range segments {
+			f, err := z.Create(timeseries.SACName(s))
+			if err != nil {
+				return c.n, err
+			}
+			site, err := channelSite(s)
+			if err != nil {
+				return c.n, err
+			}
+			if err := timeseries.WriteSAC(f, s, site); err != nil {
+				return c.n, err
+			}
+		}
+		if err := z.Close(); err != nil {
+			return c.n, err
+		}
+	case "json":
+		if err := timeseries.WriteJSON(c, segments); err != nil {
+			return c.n, err
+		}
+	default:
+		if err := timeseries.WriteGeoCSV(c, segments); err != nil {
+			return c.n, err
+		}
+	}
+
+	return c.n, nil
+}
+
+// channelSite returns the location and orientation of the channel for s from the station inventory,
+// nil if the channel is not in the inventory.
+func channelSite(s timeseries.Segment) (*timeseries.Site, error) {
+	cha, ok, err := findChannel(s.Network, s.Station, s.Location, s.Channel, s.Start)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	site := timeseries.Site{
+		Latitude:  cha.Latitude.Value,
+		Longitude: cha.Longitude.Value,
+		Elevation: cha.Elevation.Value,
+		Depth:     cha.Depth.Value,
+		Azimuth:   math.NaN(),
+		Dip:       math.NaN(),
+	}
+
+	if cha.Azimuth != nil {
+		site.Azimuth = cha.Azimuth.Value
+	}
+	if cha.Dip != nil {
+		site.Dip = cha.Dip.Value
+	}
+
+	return &site, nil
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
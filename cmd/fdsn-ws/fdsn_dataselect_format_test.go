@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/timeseries"
+)
+
+func TestWriteSegments(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	segments := []timeseries.Segment{
+		{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: start, SampleRate: 1, Samples: []float64{1, 2, 3}},
+		{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: start.Add(time.Minute), SampleRate: 1, Samples: []float64{4}},
+	}
+
+	in := []struct {
+		id          string
+		format      string
+		contentType string
+		contains    string
+	}{
+		{id: loc(), format: "geocsv", contentType: "text/csv", contains: "2024-01-02T03:05:05.000000Z, 4\n"},
+		{id: loc(), format: "ascii", contentType: "text/csv", contains: "# SID: NZ_WEL_10_HHZ\n"},
+		{id: loc(), format: "json", contentType: "application/json", contains: `"samples":[1,2,3]`},
+	}
+
+	for _, v := range in {
+		w := httptest.NewRecorder()
+
+		n, err := writeSegments(w, v.format, segments)
+		if err != nil {
+			t.Errorf("%s: %s", v.id, err)
+			continue
+		}
+
+		if n != int64(w.Body.Len()) {
+			t.Errorf("%s: expected %d bytes written got %d", v.id, w.Body.Len(), n)
+		}
+
+		if c := w.Header().Get("Content-Type"); c != v.contentType {
+			t.Errorf("%s: expected content type %s got %s", v.id, v.contentType, c)
+		}
+
+		if !strings.Contains(w.Body.String(), v.contains) {
+			t.Errorf("%s: expected %q in %s", v.id, v.contains, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+
+	if _, err := writeSegments(w, "sac", segments); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(z.File) != 2 || z.File[0].Name != "NZ.WEL.10.HHZ.D.2024.002.030405.SAC" || z.File[1].UncompressedSize64 != 632+4 {
+		t.Errorf("unexpected zip files %+v", z.File)
+	}
+}
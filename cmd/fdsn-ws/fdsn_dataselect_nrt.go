@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	ms "github.com/GeoNet/kit/seis/ms"
+)
+
+// Dataselect merges the miniSEED records received from SeedLink, in fdsn.record, with the archived files
+// for queries that end in the last DATASELECT_NRT_WINDOW (default 48h), so data only seconds old is served
+// along with the archive.  Records in both are only written once, the records from fdsn.record with the
+// same stream and start time as an archived record are skipped.  Set DATASELECT_NRT_WINDOW to 0 to only
+// serve the archive.
+
+const defaultNRTWindow = 48 * time.Hour
+
+var nrtWindow = defaultNRTWindow
+
+// nrtRecord is a miniSEED record from fdsn.record.
+type nrtRecord struct {
+	network, station string
+	start            time.Time
+	raw              []byte
+}
+
+// initNRTWindow reads DATASELECT_NRT_WINDOW, a duration e.g., 48h, or 0 to turn off near real time data.
+func initNRTWindow() error {
+	s := os.Getenv("DATASELECT_NRT_WINDOW")
+	if s == "" {
+		return nil
+	}
+
+	if s == "0" {
+		nrtWindow = 0
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid DATASELECT_NRT_WINDOW %s", s)
+	}
+
+	nrtWindow = d
+
+	return nil
+}
+
+// nrtSince returns the start of the near real time window at now, and whether a query ending at end is in it.
+func nrtSince(now, end time.Time) (time.Time, bool) {
+	since := now.Add(-nrtWindow)
+	return since, nrtWindow > 0 && end.After(since)
+}
+
+// recordID identifies a record by its stream and start time, for finding the same record from the
+// archive and fdsn.record.
+func recordID(msr *ms.Record) string {
+	return msr.SrcName(false) + "_" + strconv.FormatInt(msr.StartTime().UnixNano(), 10)
+}
+
+// filterRecord returns true if the record is in the time window for d, user can access it, it is served,
+// and it is not in seen.  Records that pass are added to seen.
+func filterRecord(r nrtRecord, d fdsn.DataSearch, user *dataUser, seen map[string]bool) bool {
+	if !dataAllowed(user, r.network, r.station) || dataRoutes.Stream(r.network, r.station) == nil {
+		return false
+	}
+
+	if len(r.raw) != RECORDLEN {
+		log.Printf("skipping %d byte record in fdsn.record for %s.%s at %s", len(r.raw), r.network, r.station, r.start.Format(time.RFC3339))
+		return false
+	}
+
+	msr, err := ms.NewRecord(r.raw)
+	if err != nil {
+		log.Printf("skipping record in fdsn.record for %s.%s at %s: %s", r.network, r.station, r.start.Format(time.RFC3339), err)
+		return false
+	}
+
+	if !(msr.StartTime().Before(d.End) && msr.EndTime().After(d.Start)) {
+		return false
+	}
+
+	id := recordID(msr)
+	if seen[id] {
+		return false
+	}
+	seen[id] = true
+
+	return true
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	ms "github.com/GeoNet/kit/seis/ms"
+)
+
+// testRecord returns a 512 byte miniSEED record with 60 samples at 1 Hz.
+func testRecord(network, station string, start time.Time) []byte {
+	hdr := ms.RecordHeader{
+		SequenceNumber:       [6]byte{'0', '0', '0', '0', '0', '1'},
+		DataQualityIndicator: 'D',
+		ReservedByte:         ' ',
+		NumberOfSamples:      60,
+		SampleRateFactor:     1,
+		SampleRateMultiplier: 1,
+		BeginningOfData:      64,
+	}
+	hdr.SetNetwork(network)
+	hdr.SetStation(station)
+	hdr.SetLocation("10")
+	hdr.SetChannel("HHZ")
+	hdr.SetStartTime(start)
+
+	record := make([]byte, RECORDLEN)
+	copy(record, ms.EncodeRecordHeader(hdr))
+
+	return record
+}
+
+func TestFilterRecords(t *testing.T) {
+	defer func() { dataRoutes, restrictedData = nil, nil }()
+
+	dataRoutes = archive.DefaultRoutes("fdsn-data.geonet.org.nz", nil)
+	restrictedData = []archive.StreamAccess{{Network: "NZ", Station: "TEST"}}
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	records := []nrtRecord{
+		{network: "NZ", station: "WEL", start: start, raw: testRecord("NZ", "WEL", start)},
+		{network: "NZ", station: "WEL", start: start.Add(time.Minute), raw: testRecord("NZ", "WEL", start.Add(time.Minute))},
+		{network: "NZ", station: "WEL", start: start.Add(2 * time.Minute), raw: testRecord("NZ", "WEL", start.Add(2*time.Minute))},
+		// outside the query window.
+		{network: "NZ", station: "WEL", start: start.Add(time.Hour), raw: testRecord("NZ", "WEL", start.Add(time.Hour))},
+		// restricted.
+		{network: "NZ", station: "TEST", start: start, raw: testRecord("NZ", "TEST", start)},
+		// not served.
+		{network: "5P", station: "TEST", start: start, raw: testRecord("5P", "TEST", start)},
+		// not a record.
+		{network: "NZ", station: "WEL", start: start.Add(3 * time.Minute), raw: make([]byte, RECORDLEN)},
+		{network: "NZ", station: "WEL", start: start.Add(4 * time.Minute), raw: testRecord("NZ", "WEL", start.Add(4*time.Minute))[:100]},
+	}
+
+	// the first record was written from the archive.
+	seen := make(map[string]bool)
+	msr, err := ms.NewRecord(records[0].raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen[recordID(msr)] = true
+
+	d := fdsn.DataSearch{Start: start, End: start.Add(30 * time.Minute)}
+
+	// filter returns the records that pass filterRecord.
+	filter := func(user *dataUser, seen map[string]bool) [][]byte {
+		var raw [][]byte
+		for _, r := range records {
+			if filterRecord(r, d, user, seen) {
+				raw = append(raw, r.raw)
+			}
+		}
+		return raw
+	}
+
+	raw := filter(nil, seen)
+	if len(raw) != 2 {
+		t.Fatalf("expected 2 records got %d", len(raw))
+	}
+
+	for i, r := range raw {
+		msr, err := ms.NewRecord(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !msr.StartTime().Equal(start.Add(time.Duration(i+1) * time.Minute)) {
+			t.Errorf("unexpected record start %s", msr.StartTime())
+		}
+	}
+
+	if len(seen) != 3 {
+		t.Errorf("expected 3 records seen got %d", len(seen))
+	}
+
+	// the records are only written once.
+	if raw := filter(nil, seen); len(raw) != 0 {
+		t.Errorf("expected no records got %d", len(raw))
+	}
+
+	user := &dataUser{name: "alice", access: []archive.StreamAccess{{Network: "NZ", Station: "TEST"}}}
+	if raw := filter(user, make(map[string]bool)); len(raw) != 4 {
+		t.Errorf("expected 4 records for user got %d", len(raw))
+	}
+}
+
+func TestNRTSince(t *testing.T) {
+	defer func() { nrtWindow = defaultNRTWindow }()
+
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	since, ok := nrtSince(now, now.Add(-time.Hour))
+	if !ok || !since.Equal(now.Add(-defaultNRTWindow)) {
+		t.Errorf("expected a query ending an hour ago to be in the window from %s got %t %s", now.Add(-defaultNRTWindow), ok, since)
+	}
+
+	if _, ok := nrtSince(now, now.Add(-72*time.Hour)); ok {
+		t.Error("expected a query ending 72 hours ago not to be in the window")
+	}
+
+	nrtWindow = 0
+	if _, ok := nrtSince(now, now); ok {
+		t.Error("expected no window")
+	}
+}
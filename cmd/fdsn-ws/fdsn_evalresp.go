@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/plot"
+	"github.com/GeoNet/kit/weft"
+)
+
+// evalresp evaluates the full response of a channel from the station xml, from the sensor
+// input units to digital counts, similar to the evalresp program and web service.
+
+const (
+	evalRespDefaultPoints = 200
+	evalRespMaxPoints     = 10000
+	evalRespMinFreq       = 0.001
+)
+
+var errPolynomial = errors.New("polynomial responses can not be evaluated")
+
+type evalRespParams struct {
+	network, station, location, channel string
+	time                                time.Time
+	minFreq, maxFreq                    float64
+	nFreq                               int
+	log                                 bool
+	format                              string
+}
+
+// evalRespResult is the response of one channel, it is also the json output.
+type evalRespResult struct {
+	Network     string    `json:"network"`
+	Station     string    `json:"station"`
+	Location    string    `json:"location"`
+	Channel     string    `json:"channel"`
+	Time        string    `json:"time"`
+	InputUnits  string    `json:"inputUnits"`
+	OutputUnits string    `json:"outputUnits"`
+	Sensitivity float64   `json:"sensitivity"`
+	Frequency   []float64 `json:"frequency"`
+	Amplitude   []float64 `json:"amplitude"`
+	Phase       []float64 `json:"phase"` // degrees
+}
+
+func evalRespHandler(r *http.Request, h http.Header, b *bytes.Buffer) error {
+	err := weft.CheckQuery(r, []string{"GET"}, []string{"network", "station", "channel"},
+		[]string{"location", "time", "minfreq", "maxfreq", "nfreq", "spacing", "format"})
+	if err != nil {
+		return err
+	}
+
+	p, err := parseEvalResp(r.URL.Query())
+	if err != nil {
+		return weft.StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	cha, ok, err := findChannel(p.network, p.station, p.location, p.channel, p.time)
+	if err != nil {
+		return weft.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+	if !ok || cha.Response == nil {
+		return weft.StatusError{Code: http.StatusNotFound, Err: fmt.Errorf("no response found for %s.%s.%s.%s at %s",
+			p.network, p.station, p.location, p.channel, p.time.Format(time.RFC3339))}
+	}
+
+	if p.maxFreq == 0 {
+		p.maxFreq = 50.0
+		if cha.SampleRate != nil && cha.SampleRate.Value > 0 {
+			p.maxFreq = cha.SampleRate.Value / 2.0
+		}
+	}
+	if p.minFreq >= p.maxFreq {
+		return weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("minfreq must be less than maxfreq (%g)", p.maxFreq)}
+	}
+
+	freqs := evalRespFrequencies(p.minFreq, p.maxFreq, p.nFreq, p.log)
+
+	resp, err := evalResponse(cha.Response, freqs)
+	if err != nil {
+		return weft.StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	res := evalRespResult{
+		Network:   p.network,
+		Station:   p.station,
+		Location:  p.location,
+		Channel:   p.channel,
+		Time:      p.time.Format(time.RFC3339),
+		Frequency: freqs,
+	}
+	if s := cha.Response.InstrumentSensitivity; s != nil {
+		res.Sensitivity = s.Value
+		if s.InputUnits != nil {
+			res.InputUnits = s.InputUnits.Name
+		}
+		if s.OutputUnits != nil {
+			res.OutputUnits = s.OutputUnits.Name
+		}
+	}
+	for _, v := range resp {
+		res.Amplitude = append(res.Amplitude, cmplx.Abs(v))
+		res.Phase = append(res.Phase, cmplx.Phase(v)*180.0/math.Pi)
+	}
+
+	switch p.format {
+	case "json":
+		by, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		b.Write(by)
+		h.Set("Content-Type", "application/json")
+	case "png":
+		if err := res.plot().PNG(b); err != nil {
+			return err
+		}
+		h.Set("Content-Type", "image/png")
+	default:
+		res.text(b)
+		h.Set("Content-Type", "text/plain")
+	}
+
+	return nil
+}
+
+func parseEvalResp(v url.Values) (evalRespParams, error) {
+	p := evalRespParams{
+		network:  v.Get("network"),
+		station:  v.Get("station"),
+		location: v.Get("location"),
+		channel:  v.Get("channel"),
+		time:     time.Now().UTC(),
+		minFreq:  evalRespMinFreq,
+		nFreq:    evalRespDefaultPoints,
+		log:      true,
+		format:   "text",
+	}
+
+	// "--" is the FDSN convention for an empty location code.
+	if p.location == "--" {
+		p.location = ""
+	}
+
+	for _, s := range []string{p.network, p.station, p.location, p.channel} {
+		if strings.ContainsAny(s, "*?,") {
+			return p, fmt.Errorf("wildcards and lists are not supported")
+		}
+	}
+
+	var err error
+
+	if s := v.Get("time"); s != "" {
+		if p.time, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			if p.time, err = time.Parse("2006-01-02T15:04:05", s); err != nil {
+				return p, fmt.Errorf("invalid time: %s", s)
+			}
+		}
+	}
+
+	if s := v.Get("minfreq"); s != "" {
+		if p.minFreq, err = strconv.ParseFloat(s, 64); err != nil || p.minFreq <= 0 {
+			return p, fmt.Errorf("invalid minfreq: %s", s)
+		}
+	}
+
+	if s := v.Get("maxfreq"); s != "" {
+		if p.maxFreq, err = strconv.ParseFloat(s, 64); err != nil || p.maxFreq <= 0 {
+			return p, fmt.Errorf("invalid maxfreq: %s", s)
+		}
+	}
+
+	if s := v.Get("nfreq"); s != "" {
+		if p.nFreq, err = strconv.Atoi(s); err != nil || p.nFreq < 2 || p.nFreq > evalRespMaxPoints {
+			return p, fmt.Errorf("invalid nfreq: %s (2 to %d)", s, evalRespMaxPoints)
+		}
+	}
+
+	switch v.Get("spacing") {
+	case "", "log":
+	case "lin":
+		p.log = false
+	default:
+		return p, fmt.Errorf("invalid spacing: %s", v.Get("spacing"))
+	}
+
+	switch f := v.Get("format"); f {
+	case "":
+	case "text", "json", "png":
+		p.format = f
+	default:
+		return p, fmt.Errorf("invalid format: %s", f)
+	}
+
+	return p, nil
+}
+
+// findChannel returns the channel epoch that includes t from the station inventory, or the station tables
+// when STATION_DB is set.
+func findChannel(network, station, location, channel string, t time.Time) (*ChannelType, bool, error) {
+	if stationDB {
+		return findChannelDB(network, station, location, channel, t)
+	}
+
+	fdsnStations.RLock()
+	defer fdsnStations.RUnlock()
+
+	if fdsnStations.fdsn == nil {
+		return nil, false, nil
+	}
+
+	for n := range fdsnStations.fdsn.Network {
+		net := &fdsnStations.fdsn.Network[n]
+		if net.Code != network {
+			continue
+		}
+		for s := range net.Station {
+			sta := &net.Station[s]
+			if sta.Code != station {
+				continue
+			}
+			for c := range sta.Channel {
+				cha := &sta.Channel[c]
+				if cha.Code != channel || strings.TrimSpace(cha.LocationCode) != location {
+					continue
+				}
+				if t.Before(time.Time(cha.StartDate)) {
+					continue
+				}
+				end := time.Time(cha.EndDate)
+				if !end.Equal(zeroDateTime) && !end.Equal(emptyDateTime) && !t.Before(end) {
+					continue
+				}
+				return cha, true, nil
+			}
+		}
+	}
+
+	return nil, false, nil
+}
+
+func evalRespFrequencies(min, max float64, n int, log bool) []float64 {
+	f := make([]float64, n)
+	for i := range f {
+		x := float64(i) / float64(n-1)
+		if log {
+			f[i] = min * math.Pow(max/min, x)
+		} else {
+			f[i] = min + (max-min)*x
+		}
+	}
+	return f
+}
+
+// evalResponse evaluates the product of all the stages in res at each frequency (Hz).
+// The phase includes any delay from digital filters, no delay corrections are applied.
+func evalResponse(res *ResponseType, freqs []float64) ([]complex128, error) {
+	out := make([]complex128, len(freqs))
+	for i := range out {
+		out[i] = 1
+	}
+
+	for i := range res.Stage {
+		stage := &res.Stage[i]
+
+		if stage.Polynomial != nil {
+			return nil, errPolynomial
+		}
+
+		var rate float64
+		if stage.Decimation != nil {
+			rate = stage.Decimation.InputSampleRate.Value
+		}
+
+		for j, f := range freqs {
+			v, err := evalStage(stage, f, rate)
+			if err != nil {
+				return nil, fmt.Errorf("stage %d: %w", i+1, err)
+			}
+			if stage.StageGain != nil {
+				v *= complex(stage.StageGain.Value, 0)
+			}
+			out[j] *= v
+		}
+	}
+
+	return out, nil
+}
+
+// evalStage evaluates the filter for a stage at frequency f (Hz), rate is the input sample
+// rate for digital filters.
+func evalStage(stage *ResponseStageType, f, rate float64) (complex128, error) {
+	// z^-1 for digital filters
+	var zInv complex128
+	if rate > 0 {
+		zInv = cmplx.Exp(complex(0, -2.0*math.Pi*f/rate))
+	}
+
+	digital := func() error {
+		if rate <= 0 {
+			return errors.New("digital filter without an input sample rate")
+		}
+		return nil
+	}
+
+	switch {
+	case stage.PolesZeros != nil:
+		pz := stage.PolesZeros
+
+		a0 := 1.0
+		if pz.NormalizationFactor != nil {
+			a0 = *pz.NormalizationFactor
+		}
+
+		var s complex128
+		tf := "LAPLACE (RADIANS/SECOND)"
+		if pz.PzTransferFunctionType != nil {
+			tf = string(*pz.PzTransferFunctionType)
+		}
+		switch tf {
+		case "LAPLACE (HERTZ)":
+			s = complex(0, f)
+		case "DIGITAL (Z-TRANSFORM)":
+			if err := digital(); err != nil {
+				return 0, err
+			}
+			s = 1 / zInv
+		default:
+			s = complex(0, 2.0*math.Pi*f)
+		}
+
+		v := complex(a0, 0)
+		for _, z := range pz.Zero {
+			v *= s - poleZero(z)
+		}
+		for _, p := range pz.Pole {
+			v /= s - poleZero(p)
+		}
+		return v, nil
+	case stage.Coefficients != nil:
+		cf := stage.Coefficients
+		if len(cf.Numerator) == 0 && len(cf.Denominator) == 0 {
+			return 1, nil
+		}
+
+		var x complex128
+		tf := "DIGITAL"
+		if cf.CfTransferFunctionType != nil {
+			tf = string(*cf.CfTransferFunctionType)
+		}
+		switch tf {
+		case "ANALOG (RADIANS/SECOND)":
+			x = complex(0, 2.0*math.Pi*f)
+		case "ANALOG (HERTZ)":
+			x = complex(0, f)
+		default:
+			if err := digital(); err != nil {
+				return 0, err
+			}
+			x = zInv
+		}
+
+		num, den := complex128(0), complex128(0)
+		for k, c := range cf.Numerator {
+			num += complex(c.Value, 0) * cmplx.Pow(x, complex(float64(k), 0))
+		}
+		if len(cf.Denominator) == 0 {
+			return num, nil
+		}
+		for k, c := range cf.Denominator {
+			den += complex(c.Value, 0) * cmplx.Pow(x, complex(float64(k), 0))
+		}
+		return num / den, nil
+	case stage.FIR != nil:
+		if err := digital(); err != nil {
+			return 0, err
+		}
+
+		c := firCoefficients(stage.FIR)
+		var v complex128
+		zk := complex128(1)
+		for _, h := range c {
+			v += complex(h, 0) * zk
+			zk *= zInv
+		}
+		return v, nil
+	case stage.ResponseList != nil:
+		return evalResponseList(stage.ResponseList.ResponseListElement, f), nil
+	}
+
+	// a gain only stage.
+	return 1, nil
+}
+
+// firCoefficients expands symmetric FIR filters to the full set of coefficients.
+func firCoefficients(fir *FIRType) []float64 {
+	var c []float64
+	for _, n := range fir.NumeratorCoefficient {
+		c = append(c, n.Value)
+	}
+
+	if fir.Symmetry == nil || len(c) == 0 {
+		return c
+	}
+
+	var mirror []float64
+	switch *fir.Symmetry {
+	case SymmetryOdd:
+		mirror = c[:len(c)-1]
+	case SymmetryEven:
+		mirror = c
+	default:
+		return c
+	}
+
+	full := append([]float64{}, c...)
+	for i := len(mirror) - 1; i >= 0; i-- {
+		full = append(full, mirror[i])
+	}
+
+	return full
+}
+
+// evalResponseList linearly interpolates amplitude and phase (degrees) from a response list.
+// Values outside the list are taken from the nearest element.
+func evalResponseList(l []ResponseListElementType, f float64) complex128 {
+	if len(l) == 0 {
+		return 1
+	}
+
+	i := sort.Search(len(l), func(i int) bool { return l[i].Frequency.Value >= f })
+
+	var amp, phase float64
+	switch {
+	case i == 0:
+		amp, phase = l[0].Amplitude.Value, l[0].Phase.Value
+	case i == len(l):
+		amp, phase = l[i-1].Amplitude.Value, l[i-1].Phase.Value
+	default:
+		a, b := l[i-1], l[i]
+		x := (f - a.Frequency.Value) / (b.Frequency.Value - a.Frequency.Value)
+		amp = a.Amplitude.Value + x*(b.Amplitude.Value-a.Amplitude.Value)
+		phase = a.Phase.Value + x*(b.Phase.Value-a.Phase.Value)
+	}
+
+	return cmplx.Rect(amp, phase*math.Pi/180.0)
+}
+
+func (e evalRespResult) id() string {
+	return strings.Join([]string{e.Network, e.Station, e.Location, e.Channel}, ".")
+}
+
+func (e evalRespResult) text(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# %s %s\n", e.id(), e.Time)
+	fmt.Fprintf(b, "# Input units: %s, output units: %s, sensitivity: %e\n", e.InputUnits, e.OutputUnits, e.Sensitivity)
+	b.WriteString("# Frequency (Hz) | Amplitude | Phase (degrees)\n")
+	for i := range e.Frequency {
+		fmt.Fprintf(b, "%e|%e|%e\n", e.Frequency[i], e.Amplitude[i], e.Phase[i])
+	}
+}
+
+func (e evalRespResult) plot() plot.Plot {
+	return plot.Plot{
+		Width:  800,
+		Height: 800,
+		Panels: []plot.Panel{
+			{
+				Title:  e.id() + " " + e.Time,
+				X:      plot.Axis{Label: "Frequency (Hz)", Log: true},
+				Y:      plot.Axis{Label: fmt.Sprintf("Amplitude (%s/%s)", e.OutputUnits, e.InputUnits), Log: true},
+				Series: []plot.Series{{X: e.Frequency, Y: e.Amplitude, Colour: plot.Blue}},
+			},
+			{
+				X:      plot.Axis{Label: "Frequency (Hz)", Log: true},
+				Y:      plot.Axis{Label: "Phase (degrees)", Min: -180, Max: 180},
+				Series: []plot.Series{{X: e.Frequency, Y: e.Phase, Colour: plot.Red}},
+			},
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/cmplx"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// The evaluated response at the sensitivity frequency should match the instrument sensitivity.
+func TestEvalResponse(t *testing.T) {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadStationXML(bytes.NewBuffer(by), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cha := range s.fdsn.Network[0].Station[0].Channel {
+		sens := cha.Response.InstrumentSensitivity
+
+		r, err := evalResponse(cha.Response, []float64{*sens.Frequency})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a := cmplx.Abs(r[0]); math.Abs(a-sens.Value)/sens.Value > 0.02 {
+			t.Errorf("%s: expected amplitude %e at %g Hz got %e", cha.Code, sens.Value, *sens.Frequency, a)
+		}
+	}
+}
+
+func TestFirCoefficients(t *testing.T) {
+	odd, even := SymmetryOdd, SymmetryEven
+
+	in := []struct {
+		symmetry *Symmetry
+		c        []float64
+		expected []float64
+	}{
+		{nil, []float64{1, 2, 3}, []float64{1, 2, 3}},
+		{&odd, []float64{1, 2, 3}, []float64{1, 2, 3, 2, 1}},
+		{&even, []float64{1, 2, 3}, []float64{1, 2, 3, 3, 2, 1}},
+	}
+
+	for _, v := range in {
+		fir := FIRType{Symmetry: v.symmetry}
+		for _, c := range v.c {
+			fir.NumeratorCoefficient = append(fir.NumeratorCoefficient, NumeratorCoefficient{Value: c})
+		}
+
+		c := firCoefficients(&fir)
+		if len(c) != len(v.expected) {
+			t.Errorf("expected %v got %v", v.expected, c)
+			continue
+		}
+		for i := range c {
+			if c[i] != v.expected[i] {
+				t.Errorf("expected %v got %v", v.expected, c)
+				break
+			}
+		}
+	}
+}
+
+func TestParseEvalResp(t *testing.T) {
+	good := []string{
+		"network=NZ&station=ARAZ&location=10&channel=EHZ",
+		"network=NZ&station=ARAZ&location=--&channel=EHZ&time=2010-01-01T00:00:00",
+		"network=NZ&station=ARAZ&channel=EHZ&minfreq=0.1&maxfreq=10&nfreq=50&spacing=lin&format=png",
+	}
+
+	bad := []string{
+		"network=NZ&station=AR*&channel=EHZ",
+		"network=NZ&station=ARAZ&channel=EHZ&time=2010-01-01",
+		"network=NZ&station=ARAZ&channel=EHZ&minfreq=0",
+		"network=NZ&station=ARAZ&channel=EHZ&nfreq=1",
+		"network=NZ&station=ARAZ&channel=EHZ&spacing=exp",
+		"network=NZ&station=ARAZ&channel=EHZ&format=xml",
+	}
+
+	for _, q := range good {
+		v, _ := url.ParseQuery(q)
+		if _, err := parseEvalResp(v); err != nil {
+			t.Errorf("%s: %s", q, err)
+		}
+	}
+
+	for _, q := range bad {
+		v, _ := url.ParseQuery(q)
+		if _, err := parseEvalResp(v); err == nil {
+			t.Errorf("%s: expected an error", q)
+		}
+	}
+}
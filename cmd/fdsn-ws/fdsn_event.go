@@ -58,6 +58,7 @@ type fdsnEventV1 struct {
 	Format         string          `schema:"format"`
 	NoData         int             `schema:"nodata"` // Select status code for “no data”, either ‘204’ (default) or ‘404’.
 	EventType      string          `schema:"eventtype"`
+	Polygon        fdsn.Polygon    `schema:"polygon"` // Non-standard: limit to events inside the polygon, WKT or latitude,longitude pairs.
 	eventTypeSlice []interface{}   // interal use only. holds matched eventtypes
 }
 
@@ -225,7 +226,7 @@ func parseEventV1(v url.Values) (fdsnEventV1, error) {
 		e.EventType = ""
 	}
 
-	if e.Format != "xml" && e.Format != "text" {
+	if e.Format != "xml" && e.Format != "text" && e.Format != "kml" {
 		return e, errors.New("invalid format")
 	}
 
@@ -477,6 +478,17 @@ func (e *fdsnEventV1) filter() (q string, args []interface{}) {
 		i += 3
 	}
 
+	if !e.Polygon.IsZero() {
+		// longitudes are only shifted to 0-360 for polygons that cross the anti-meridian.
+		if e.Polygon.CrossesAntiMeridian() {
+			q = fmt.Sprintf("%s ST_Within(ST_ShiftLongitude(origin_geom::GEOMETRY), ST_ShiftLongitude(ST_GeomFromText($%d, 4326))) AND", q, i)
+		} else {
+			q = fmt.Sprintf("%s ST_Within(origin_geom::GEOMETRY, ST_GeomFromText($%d, 4326)) AND", q, i)
+		}
+		args = append(args, e.Polygon.WKT())
+		i++
+	}
+
 	if e.eventTypeSlice != nil {
 		// creating N SQL placeholders for number of matched eventTypeSlice
 		p := make([]string, 0, len(e.eventTypeSlice))
@@ -547,6 +559,18 @@ func fdsnEventV1Handler(r *http.Request, h http.Header, b *bytes.Buffer) error {
 		b.WriteString(`</eventParameters></q:quakeml>`)
 
 		h.Set("Content-Type", "application/xml")
+	} else if e.Format == "kml" {
+		rows, err := e.queryRaw()
+		if err != nil {
+			return fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+		defer func() { _ = rows.Close() }()
+
+		if err = eventKML(rows, b); err != nil {
+			return fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+
+		h.Set("Content-Type", kmlContentType)
 	} else {
 		rows, err := e.queryRaw()
 		if err != nil {
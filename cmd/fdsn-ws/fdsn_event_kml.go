@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/GeoNet/kit/wgs84"
+)
+
+const eventKMLIcon = "https://maps.google.com/mapfiles/kml/shapes/shaded_dot.png"
+
+// eventKMLScale returns the icon scale for magnitude.
+func eventKMLScale(magnitude float64) float64 {
+	return math.Round(math.Max(0.4, 0.4*magnitude)*100) / 100
+}
+
+// eventKML writes the events in rows from queryRaw as KML placemarks with a time stamp
+// and icons scaled by magnitude.
+func eventKML(rows *sql.Rows, b *bytes.Buffer) error {
+	k := kml{Document: kmlDocument{Name: "FDSN events"}}
+
+	var eventID, magType, eventType string
+	var tm time.Time
+	var latitude, longitude, depth, magnitude float64
+	for rows.Next() {
+		if err := rows.Scan(&eventID, &tm, &latitude, &longitude, &depth, &magType, &magnitude, &eventType); err != nil {
+			return err
+		}
+
+		description := fmt.Sprintf("%s\n%s %.1f\nDepth: %.1f km\nType: %s", tm.UTC().Format(time.RFC3339), magType, magnitude, depth, eventType)
+		if l, err := wgs84.ClosestNZ(latitude, longitude); err == nil {
+			description += "\n" + l.Description()
+		}
+
+		k.Document.Placemark = append(k.Document.Placemark, kmlPlacemark{
+			Name:        eventID,
+			Description: description,
+			Style: &kmlStyle{IconStyle: kmlIconStyle{
+				Color: "ff0000ff",
+				Scale: eventKMLScale(magnitude),
+				Icon:  kmlIcon{Href: eventKMLIcon},
+			}},
+			TimeStamp: &kmlTimeStamp{When: tm.UTC().Format(kmlTimeFormat)},
+			Point: kmlPoint{Coordinates: strconv.FormatFloat(longitude, 'f', -1, 64) + "," +
+				strconv.FormatFloat(latitude, 'f', -1, 64)},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return k.marshal(b)
+}
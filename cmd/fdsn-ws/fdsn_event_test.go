@@ -260,6 +260,44 @@ func TestEventBoundingRadius(t *testing.T) {
 	}
 }
 
+func TestEventPolygon(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	// test against record: (-40.57806609, 176.3257242)
+	for _, q := range []struct {
+		polygon  string
+		expected int
+	}{
+		{"-40,176,-40,177,-41,177,-41,176", 1},
+		{"POLYGON((176 -40, 177 -40, 177 -41, 176 -41, 176 -40))", 1},
+		{"-41,176,-41,177,-42,177,-42,176", 0},
+	} {
+		v := url.Values{}
+		v.Set("polygon", q.polygon)
+
+		e, err := parseEventV1(v)
+		if err != nil {
+			t.Error(err)
+		}
+
+		c, err := e.count()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if c != q.expected {
+			t.Errorf("%s: expected %d record got %d.", q.polygon, q.expected, c)
+		}
+	}
+
+	v := url.Values{}
+	v.Set("polygon", "POLYGON((176 -40, 177 -40))")
+	if _, err := parseEventV1(v); err == nil {
+		t.Error("expected an error for a polygon with two points")
+	}
+}
+
 func TestEventAbbreviations(t *testing.T) {
 	vals := []struct {
 		k string
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/kit/weft"
+)
+
+// eventdata returns the miniSEED for an event from the channels within a radius of the origin, optionally in a
+// zip with the QuakeML for the event and the StationXML for the channels.  The time window for each station is from
+// before the P arrival to after the S arrival, estimated from the hypocentral distance with constant velocities.
+
+const (
+	eventDataDefaultRadius  = 1.0   // degrees
+	eventDataDefaultBefore  = 30.0  // seconds before the P arrival.
+	eventDataDefaultAfter   = 120.0 // seconds after the S arrival.
+	eventDataMaxOffset      = 3600.0
+	eventDataDefaultChannel = "?H?,?N?"
+	eventDataVp             = 6.0 // km/s
+	eventDataVs             = 3.5 // km/s
+	kmPerDegree             = 111.19
+)
+
+var eventIDReg = regexp.MustCompile(`^[\w.-]+$`)
+
+type eventDataParams struct {
+	eventID                             string
+	network, station, location, channel string
+	minRadius, maxRadius                float64
+	before, after                       float64
+	format                              string
+	noData                              int
+}
+
+// eventOrigin is the preferred origin of an event from fdsn.event.
+type eventOrigin struct {
+	time                       time.Time
+	latitude, longitude, depth float64 // depth in km.
+	quakeML                    string  // the QuakeML event fragment.
+}
+
+// eventDataHandler handles event data queries.  Only unrestricted data is returned.
+func eventDataHandler(r *http.Request, w http.ResponseWriter) (int64, error) {
+	tm := time.Now()
+
+	if r.Method != "GET" {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusMethodNotAllowed}, url: r.URL.String(), timestamp: tm}
+	}
+
+	p, err := parseEventData(r.URL.Query())
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	o, err := queryEventOrigin(p.eventID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, fdsnError{StatusError: weft.StatusError{Code: p.noData, Err: fmt.Errorf("event %s not found", p.eventID)}, url: r.URL.String(), timestamp: tm}
+	case err != nil:
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	inventory, err := eventDataInventory(p, o)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+	if inventory == nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: p.noData, Err: fmt.Errorf("%s", "no channels found for the event")}, url: r.URL.String(), timestamp: tm}
+	}
+
+	params := eventDataSelects(inventory, o, p.before, p.after)
+	if len(params) > MAX_QUERIES {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusRequestEntityTooLarge,
+			Err: fmt.Errorf("number of channels: %d exceeded the limit: %d, reduce maxradius or select fewer channels", len(params), MAX_QUERIES)}, url: r.URL.String(), timestamp: tm}
+	}
+
+	request, files, nrt, err := dataSearches(r, params, tm, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if files == 0 && !nrt {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: p.noData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+	}
+
+	if p.format == "miniseed" {
+		w.Header().Set("Content-Type", "application/vnd.fdsn.mseed")
+
+		var written int
+		for _, v := range request {
+			n, err := writeRecords(w, v, tm, nil)
+			written += n
+			if err != nil {
+				return int64(written), fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+			}
+		}
+
+		if written == 0 {
+			return 0, fdsnError{StatusError: weft.StatusError{Code: p.noData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+		}
+
+		return int64(written), nil
+	}
+
+	// the zip is streamed so the miniSEED is written last, after the small files.
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+p.eventID+`.zip"`)
+
+	c := &countWriter{w: w}
+	z := zip.NewWriter(c)
+
+	if err := writeEventDataXML(z, p.eventID, o, inventory); err != nil {
+		return c.n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	f, err := z.Create(p.eventID + ".mseed")
+	if err != nil {
+		return c.n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	for _, v := range request {
+		if _, err := writeRecords(f, v, tm, nil); err != nil {
+			return c.n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+	}
+
+	if err := z.Close(); err != nil {
+		return c.n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	return c.n, nil
+}
+
+func parseEventData(v url.Values) (eventDataParams, error) {
+	p := eventDataParams{
+		eventID:   v.Get("eventid"),
+		network:   v.Get("network"),
+		station:   v.Get("station"),
+		location:  v.Get("location"),
+		channel:   v.Get("channel"),
+		maxRadius: eventDataDefaultRadius,
+		before:    eventDataDefaultBefore,
+		after:     eventDataDefaultAfter,
+		format:    "miniseed",
+		noData:    NO_DATA,
+	}
+
+	if p.eventID == "" {
+		return p, fmt.Errorf("eventid is required")
+	}
+	if !eventIDReg.MatchString(p.eventID) {
+		return p, fmt.Errorf("invalid eventid: %s", p.eventID)
+	}
+
+	if p.channel == "" {
+		p.channel = eventDataDefaultChannel
+	}
+
+	var err error
+
+	if s := v.Get("minradius"); s != "" {
+		if p.minRadius, err = strconv.ParseFloat(s, 64); err != nil || p.minRadius < 0 || p.minRadius > 180 {
+			return p, fmt.Errorf("invalid minradius: %s", s)
+		}
+	}
+
+	if s := v.Get("maxradius"); s != "" {
+		if p.maxRadius, err = strconv.ParseFloat(s, 64); err != nil || p.maxRadius <= 0 || p.maxRadius > 180 {
+			return p, fmt.Errorf("invalid maxradius: %s", s)
+		}
+	}
+
+	if p.minRadius >= p.maxRadius {
+		return p, fmt.Errorf("minradius must be less than maxradius")
+	}
+
+	if s := v.Get("before"); s != "" {
+		if p.before, err = strconv.ParseFloat(s, 64); err != nil || p.before < 0 || p.before > eventDataMaxOffset {
+			return p, fmt.Errorf("invalid before: %s (0 to %g seconds)", s, eventDataMaxOffset)
+		}
+	}
+
+	if s := v.Get("after"); s != "" {
+		if p.after, err = strconv.ParseFloat(s, 64); err != nil || p.after < 0 || p.after > eventDataMaxOffset {
+			return p, fmt.Errorf("invalid after: %s (0 to %g seconds)", s, eventDataMaxOffset)
+		}
+	}
+
+	switch f := v.Get("format"); f {
+	case "":
+	case "miniseed", "zip":
+		p.format = f
+	default:
+		return p, fmt.Errorf("invalid format: %s", f)
+	}
+
+	if s := v.Get("nodata"); s != "" {
+		if p.noData, err = strconv.Atoi(s); err != nil || (p.noData != 204 && p.noData != 404) {
+			return p, errors.New("nodata must be 204 or 404")
+		}
+	}
+
+	for k := range v {
+		switch k {
+		case "eventid", "network", "station", "location", "channel", "minradius", "maxradius", "before", "after", "format", "nodata":
+		default:
+			return p, fmt.Errorf("invalid parameter: %s", k)
+		}
+	}
+
+	return p, nil
+}
+
+// queryEventOrigin returns the origin for the event with publicID.  Returns sql.ErrNoRows if it is not found.
+func queryEventOrigin(publicID string) (eventOrigin, error) {
+	var o eventOrigin
+
+	err := db.QueryRow(`SELECT OriginTime, Latitude, Longitude, Depth, Quakeml12Event FROM fdsn.event WHERE PublicID = $1 AND deleted != true`,
+		publicID).Scan(&o.time, &o.latitude, &o.longitude, &o.depth, &o.quakeML)
+
+	return o, err
+}
+
+// eventDataInventory returns the unrestricted channels, with their responses, within the radius of o selected by p that
+// were operating at the origin time.  Returns nil if there are none.
+func eventDataInventory(p eventDataParams, o eventOrigin) (*FDSNStationXML, error) {
+	v := url.Values{}
+	v.Set("latitude", strconv.FormatFloat(o.latitude, 'f', -1, 64))
+	v.Set("longitude", strconv.FormatFloat(o.longitude, 'f', -1, 64))
+	v.Set("minradius", strconv.FormatFloat(p.minRadius, 'f', -1, 64))
+	v.Set("maxradius", strconv.FormatFloat(p.maxRadius, 'f', -1, 64))
+	v.Set("starttime", o.time.UTC().Format(time.RFC3339Nano))
+	v.Set("endtime", o.time.UTC().Format(time.RFC3339Nano))
+	v.Set("channel", p.channel)
+	v.Set("level", "response")
+	v.Set("includerestricted", "false")
+	for k, s := range map[string]string{"network": p.network, "station": p.station, "location": p.location} {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+
+	s, err := parseStationV1(v)
+	if err != nil {
+		return nil, err
+	}
+	params := []fdsnStationV1Search{s}
+
+	var inventory *FDSNStationXML
+
+	if stationDB {
+		if inventory, _, err = queryStationDB(params); err != nil {
+			return nil, err
+		}
+	} else {
+		fdsnStations.RLock()
+		inventory = fdsnStations.fdsn
+		fdsnStations.RUnlock()
+	}
+
+	if inventory == nil {
+		return nil, errors.New("the station inventory is not loaded")
+	}
+
+	c := *inventory
+	if !c.doFilter(params) {
+		return nil, nil
+	}
+
+	return &c, nil
+}
+
+// eventDataSelects returns a dataselect query for each channel in inventory with the time window from before seconds
+// before the P arrival to after seconds after the S arrival at the station.
+func eventDataSelects(inventory *FDSNStationXML, o eventOrigin, before, after float64) []fdsn.DataSelect {
+	var params []fdsn.DataSelect
+
+	seen := make(map[string]bool)
+
+	for _, n := range inventory.Network {
+		for _, s := range n.Station {
+			start, end := eventDataWindow(o, s.Latitude.Value, s.Longitude.Value, before, after)
+
+			for _, c := range s.Channel {
+				loc := strings.TrimSpace(c.LocationCode)
+				if loc == "" {
+					loc = "--"
+				}
+
+				id := n.Code + "." + s.Code + "." + loc + "." + c.Code
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				params = append(params, fdsn.DataSelect{
+					StartTime: fdsn.WsDateTime{Time: start},
+					EndTime:   fdsn.WsDateTime{Time: end},
+					Network:   []string{n.Code},
+					Station:   []string{s.Code},
+					Location:  []string{loc},
+					Channel:   []string{c.Code},
+					Format:    "miniseed",
+					NoData:    NO_DATA,
+				})
+			}
+		}
+	}
+
+	return params
+}
+
+// eventDataWindow returns the time window for a station at latitude, longitude.  The P and S arrivals are estimated from
+// the hypocentral distance using constant crustal velocities, these are only approximate for distant stations.
+func eventDataWindow(o eventOrigin, latitude, longitude, before, after float64) (time.Time, time.Time) {
+	r := math.Hypot(greatCircleDegrees(o.latitude, o.longitude, latitude, longitude)*kmPerDegree, o.depth)
+
+	seconds := func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second))
+	}
+
+	return o.time.Add(seconds(r/eventDataVp - before)).UTC(), o.time.Add(seconds(r/eventDataVs + after)).UTC()
+}
+
+// writeEventDataXML writes the QuakeML for the event and the StationXML for the inventory to z.
+func writeEventDataXML(z *zip.Writer, eventID string, o eventOrigin, inventory *FDSNStationXML) error {
+	f, err := z.Create(eventID + ".xml")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(f, `<?xml version="1.0" encoding="UTF-8"?>
+<q:quakeml xmlns:q="http://quakeml.org/xmlns/quakeml/1.2" xmlns="http://quakeml.org/xmlns/bed/1.2">
+  <eventParameters publicID="smi:nz.org.geonet/NA">`+o.quakeML+`</eventParameters></q:quakeml>`)
+	if err != nil {
+		return err
+	}
+
+	// inventory has been filtered so this doesn't change the inventory being served.
+	inventory.setSchemaVersion(stationSchemaVersion)
+
+	by, err := xml.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+
+	if f, err = z.Create("stations.xml"); err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(f, `<?xml version="1.0" encoding="UTF-8"?>`); err != nil {
+		return err
+	}
+
+	_, err = f.Write(by)
+	return err
+}
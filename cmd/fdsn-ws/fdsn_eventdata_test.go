@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseEventData(t *testing.T) {
+	in := []struct {
+		id    string
+		query string
+		ok    bool
+		p     eventDataParams
+	}{
+		{id: loc(), query: "", ok: false},
+		{id: loc(), query: "eventid=2016p858000", ok: true, p: eventDataParams{eventID: "2016p858000", channel: eventDataDefaultChannel,
+			maxRadius: eventDataDefaultRadius, before: eventDataDefaultBefore, after: eventDataDefaultAfter, format: "miniseed", noData: NO_DATA}},
+		{id: loc(), query: "eventid=2016p858000&network=NZ&station=WEL&location=10&channel=HHZ&minradius=0.5&maxradius=2&before=10&after=60&format=zip&nodata=404",
+			ok: true, p: eventDataParams{eventID: "2016p858000", network: "NZ", station: "WEL", location: "10", channel: "HHZ",
+				minRadius: 0.5, maxRadius: 2, before: 10, after: 60, format: "zip", noData: 404}},
+		{id: loc(), query: "eventid=2016p858000/../", ok: false},
+		{id: loc(), query: "eventid=2016p858000&maxradius=0", ok: false},
+		{id: loc(), query: "eventid=2016p858000&maxradius=181", ok: false},
+		{id: loc(), query: "eventid=2016p858000&minradius=2&maxradius=1", ok: false},
+		{id: loc(), query: "eventid=2016p858000&minradius=-1", ok: false},
+		{id: loc(), query: "eventid=2016p858000&before=-1", ok: false},
+		{id: loc(), query: "eventid=2016p858000&after=3601", ok: false},
+		{id: loc(), query: "eventid=2016p858000&after=x", ok: false},
+		{id: loc(), query: "eventid=2016p858000&format=sac", ok: false},
+		{id: loc(), query: "eventid=2016p858000&nodata=500", ok: false},
+		{id: loc(), query: "eventid=2016p858000&starttime=2016-11-13T11:00:00", ok: false},
+	}
+
+	for _, v := range in {
+		q, err := url.ParseQuery(v.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := parseEventData(q)
+		if v.ok != (err == nil) {
+			t.Errorf("%s expected ok %t got err %v", v.id, v.ok, err)
+			continue
+		}
+
+		if v.ok && p != v.p {
+			t.Errorf("%s expected %+v got %+v", v.id, v.p, p)
+		}
+	}
+}
+
+func TestEventDataWindow(t *testing.T) {
+	origin := time.Date(2016, 11, 13, 11, 2, 56, 0, time.UTC)
+
+	// a station above a 30 km deep event has a hypocentral distance of 30 km.
+	o := eventOrigin{time: origin, latitude: -42.7, longitude: 173.0, depth: 30}
+
+	start, end := eventDataWindow(o, -42.7, 173.0, 30, 120)
+
+	if !start.Equal(origin.Add(-25 * time.Second)) {
+		t.Errorf("expected start %s got %s", origin.Add(-25*time.Second), start)
+	}
+
+	// 30 / 3.5 = 8.571428571 s
+	if d := end.Sub(origin) - 128571428571*time.Nanosecond; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("expected end %s got %s", origin.Add(128571428571*time.Nanosecond), end)
+	}
+
+	// the window starts later and is longer further from the event.
+	s1, e1 := eventDataWindow(o, -41.3, 174.8, 30, 120)
+	if !s1.After(start) || e1.Sub(s1) <= end.Sub(start) {
+		t.Errorf("expected a later and longer window for a distant station got %s to %s", s1, e1)
+	}
+}
+
+func TestEventDataSelects(t *testing.T) {
+	c := makeTestFDSN("NZ", "WEL", "", "HHZ")
+	c.Network[0].Station[0].Latitude.Value = -41.3
+	c.Network[0].Station[0].Longitude.Value = 174.8
+	// a second epoch of the same channel is only selected once.
+	c.Network[0].Station[0].Channel = append(c.Network[0].Station[0].Channel, makeTestChannel("HHZ", ""), makeTestChannel("HNZ", "20"))
+
+	o := eventOrigin{time: time.Date(2016, 11, 13, 11, 2, 56, 0, time.UTC), latitude: -42.7, longitude: 173.0, depth: 15}
+
+	params := eventDataSelects(&c, o, 30, 120)
+
+	if len(params) != 2 {
+		t.Fatalf("expected 2 queries got %d", len(params))
+	}
+
+	start, end := eventDataWindow(o, -41.3, 174.8, 30, 120)
+
+	for i, l := range []string{"--", "20"} {
+		p := params[i]
+
+		if p.Location[0] != l {
+			t.Errorf("expected location %s got %s", l, p.Location[0])
+		}
+		if p.Network[0] != "NZ" || p.Station[0] != "WEL" {
+			t.Errorf("expected NZ.WEL got %s.%s", p.Network[0], p.Station[0])
+		}
+		if !p.StartTime.Time.Equal(start) || !p.EndTime.Time.Equal(end) {
+			t.Errorf("expected window %s to %s got %s to %s", start, end, p.StartTime.Time, p.EndTime.Time)
+		}
+	}
+}
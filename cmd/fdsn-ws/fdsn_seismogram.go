@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/fdsn/internal/plot"
+	"github.com/GeoNet/fdsn/internal/timeseries"
+	"github.com/GeoNet/kit/weft"
+)
+
+// seismogram plots dataselect data with one panel for each stream, stacked in stream order, and the time axis in UTC.
+// Gaps in the data are shaded.  The timeseries processing parameters can be used e.g., to filter the data.
+
+const (
+	seismogramDefaultWidth  = 1000
+	seismogramDefaultHeight = 150 // for each stream.
+	seismogramMaxWidth      = 4000
+	seismogramMaxHeight     = 1000
+	seismogramMaxStreams    = 30
+)
+
+type seismogramParams struct {
+	width, height int
+	format        string
+}
+
+// seismogramHandler handles seismogram plot queries.  Only GET queries for unrestricted data are supported.
+func seismogramHandler(r *http.Request, w http.ResponseWriter) (int64, error) {
+	tm := time.Now()
+
+	if r.Method != "GET" {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusMethodNotAllowed}, url: r.URL.String(), timestamp: tm}
+	}
+
+	v := r.URL.Query()
+
+	s, err := parseSeismogram(v)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	p, err := parseTimeseries(v)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	d, err := fdsn.ParseDataSelectGet(v)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	segments, err := timeseriesSegments(r, d, p, tm)
+	if err != nil {
+		return 0, err
+	}
+
+	pl, err := seismogramPlot(segments, d.StartTime.Time, d.EndTime.Time, s.width, s.height)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	c := &countWriter{w: w}
+
+	switch s.format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = pl.SVG(c)
+	default:
+		w.Header().Set("Content-Type", "image/png")
+		err = pl.PNG(c)
+	}
+	if err != nil {
+		return c.n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	return c.n, nil
+}
+
+// parseSeismogram parses the plot parameters in v and removes them, leaving the timeseries and dataselect parameters.
+func parseSeismogram(v url.Values) (seismogramParams, error) {
+	p := seismogramParams{
+		width:  seismogramDefaultWidth,
+		height: seismogramDefaultHeight,
+		format: "png",
+	}
+
+	var err error
+
+	if s := v.Get("width"); s != "" {
+		if p.width, err = strconv.Atoi(s); err != nil || p.width < 200 || p.width > seismogramMaxWidth {
+			return p, fmt.Errorf("invalid width: %s (200 to %d)", s, seismogramMaxWidth)
+		}
+	}
+
+	if s := v.Get("height"); s != "" {
+		if p.height, err = strconv.Atoi(s); err != nil || p.height < 100 || p.height > seismogramMaxHeight {
+			return p, fmt.Errorf("invalid height: %s (100 to %d)", s, seismogramMaxHeight)
+		}
+	}
+
+	switch f := v.Get("format"); f {
+	case "":
+	case "png", "svg":
+		p.format = f
+	default:
+		return p, fmt.Errorf("invalid format: %s", f)
+	}
+
+	for _, k := range []string{"width", "height", "format"} {
+		v.Del(k)
+	}
+
+	return p, nil
+}
+
+// seismogramPlot plots the segments, ordered by stream and start time, with one panel of height for each stream.
+// The time axis is from start to end.
+func seismogramPlot(segments []timeseries.Segment, start, end time.Time, width, height int) (plot.Plot, error) {
+	var streams [][]timeseries.Segment
+
+	for _, s := range segments {
+		if n := len(streams); n > 0 && streams[n-1][0].ID() == s.ID() {
+			streams[n-1] = append(streams[n-1], s)
+			continue
+		}
+		streams = append(streams, []timeseries.Segment{s})
+	}
+
+	if len(streams) > seismogramMaxStreams {
+		return plot.Plot{}, fmt.Errorf("number of streams %d exceeded the limit for plotting: %d", len(streams), seismogramMaxStreams)
+	}
+
+	p := plot.Plot{Width: width, Height: height * len(streams)}
+
+	for _, stream := range streams {
+		units := stream[0].Units
+		if units == "" {
+			units = "Counts"
+		}
+
+		panel := plot.Panel{
+			Title: stream[0].ID(),
+			X:     plot.Axis{Label: "Time (UTC)", Time: true, Min: unixSeconds(start), Max: unixSeconds(end)},
+			Y:     plot.Axis{Label: units},
+		}
+
+		var line plot.Series
+
+		// the time of the last sample so far.  Segments are split at gaps so there is a gap before each segment
+		// after the first, and at the start or end of the plot when there is at least one sample missing.
+		last := start
+		period := stream[0].Period()
+
+		for i, s := range stream {
+			if i > 0 || s.Start.Sub(start) > period {
+				panel.Spans = append(panel.Spans, plot.Span{X0: unixSeconds(last), X1: unixSeconds(s.Start)})
+			}
+			if i > 0 {
+				// break the line.
+				line.X = append(line.X, math.NaN())
+				line.Y = append(line.Y, math.NaN())
+			}
+
+			x, y := seismogramPoints(s, start, end, width)
+			line.X = append(line.X, x...)
+			line.Y = append(line.Y, y...)
+
+			last = s.End()
+			period = s.Period()
+		}
+
+		if end.Sub(last) > period {
+			panel.Spans = append(panel.Spans, plot.Span{X0: unixSeconds(last), X1: unixSeconds(end)})
+		}
+
+		panel.Series = []plot.Series{line}
+		p.Panels = append(p.Panels, panel)
+	}
+
+	return p, nil
+}
+
+// seismogramPoints returns the points to plot for s.  When there are more samples than will show at width only the
+// minimum and maximum samples in each column are kept, in time order.
+func seismogramPoints(s timeseries.Segment, start, end time.Time, width int) ([]float64, []float64) {
+	var x, y []float64
+
+	window := end.Sub(start).Seconds()
+
+	if len(s.Samples) <= 2*width || window <= 0 {
+		for i, v := range s.Samples {
+			x = append(x, unixSeconds(s.Time(i)))
+			y = append(y, v)
+		}
+		return x, y
+	}
+
+	column := func(i int) int {
+		return int(s.Time(i).Sub(start).Seconds() / window * float64(width))
+	}
+
+	for i := 0; i < len(s.Samples); {
+		c := column(i)
+
+		lo, hi := i, i
+		j := i
+		for ; j < len(s.Samples) && column(j) == c; j++ {
+			if s.Samples[j] < s.Samples[lo] {
+				lo = j
+			}
+			if s.Samples[j] > s.Samples[hi] {
+				hi = j
+			}
+		}
+
+		for _, k := range []int{min(lo, hi), max(lo, hi)} {
+			x = append(x, unixSeconds(s.Time(k)))
+			y = append(y, s.Samples[k])
+			if lo == hi {
+				break
+			}
+		}
+
+		i = j
+	}
+
+	return x, y
+}
+
+// unixSeconds returns t as seconds since the Unix epoch.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
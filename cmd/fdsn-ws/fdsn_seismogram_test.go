@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/timeseries"
+)
+
+func TestParseSeismogram(t *testing.T) {
+	in := []struct {
+		id       string
+		query    string
+		expected seismogramParams
+		err      bool
+	}{
+		{id: loc(), query: "", expected: seismogramParams{width: 1000, height: 150, format: "png"}},
+		{id: loc(), query: "width=600&height=200&format=svg", expected: seismogramParams{width: 600, height: 200, format: "svg"}},
+		{id: loc(), query: "width=10", err: true},
+		{id: loc(), query: "height=5000", err: true},
+		{id: loc(), query: "format=miniseed", err: true},
+	}
+
+	for _, v := range in {
+		q, err := url.ParseQuery(v.query + "&station=WEL")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := parseSeismogram(q)
+		switch {
+		case v.err && err == nil:
+			t.Errorf("%s: expected an error", v.id)
+		case !v.err && err != nil:
+			t.Errorf("%s: unexpected error %s", v.id, err)
+		case !v.err && p != v.expected:
+			t.Errorf("%s: expected %+v got %+v", v.id, v.expected, p)
+		}
+
+		if !v.err && (len(q) != 1 || q.Get("station") != "WEL") {
+			t.Errorf("%s: unexpected parameters left %v", v.id, q)
+		}
+	}
+}
+
+func TestSeismogramPlot(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+
+	samples := func(n int) []float64 {
+		s := make([]float64, n)
+		for i := range s {
+			s[i] = float64(i % 7)
+		}
+		return s
+	}
+
+	segments := []timeseries.Segment{
+		{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHE", Start: start, SampleRate: 100, Samples: samples(6001)},
+		{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: start.Add(10 * time.Second), SampleRate: 100, Samples: samples(1000)},
+		{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: start.Add(30 * time.Second), SampleRate: 100, Samples: samples(1000), Units: "m/s"},
+	}
+
+	p, err := seismogramPlot(segments, start, end, 500, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Panels) != 2 || p.Width != 500 || p.Height != 240 {
+		t.Fatalf("unexpected plot %d panels %dx%d", len(p.Panels), p.Width, p.Height)
+	}
+
+	e, z := p.Panels[0], p.Panels[1]
+
+	if e.Title != "NZ.WEL.10.HHE" || len(e.Spans) != 0 || e.Y.Label != "Counts" || !e.X.Time {
+		t.Errorf("unexpected panel %s spans %v label %s", e.Title, e.Spans, e.Y.Label)
+	}
+
+	// the samples are reduced to the minimum and maximum for each column.
+	if n := len(e.Series[0].X); n > 2*500+2 || n < 500 {
+		t.Errorf("expected about 1000 points got %d", n)
+	}
+
+	// gaps at the start, between the segments and at the end.
+	if len(z.Spans) != 3 {
+		t.Fatalf("expected 3 gaps got %v", z.Spans)
+	}
+
+	gaps := [][2]time.Time{
+		{start, start.Add(10 * time.Second)},
+		{start.Add(19990 * time.Millisecond), start.Add(30 * time.Second)},
+		{start.Add(39990 * time.Millisecond), end},
+	}
+
+	for i, g := range gaps {
+		if math.Abs(z.Spans[i].X0-unixSeconds(g[0])) > 1e-3 || math.Abs(z.Spans[i].X1-unixSeconds(g[1])) > 1e-3 {
+			t.Errorf("gap %d expected %s to %s got %v", i, g[0], g[1], z.Spans[i])
+		}
+	}
+
+	// the line is broken between the segments.
+	var breaks int
+	for _, v := range z.Series[0].Y {
+		if math.IsNaN(v) {
+			breaks++
+		}
+	}
+	if breaks != 1 || len(z.Series[0].X) != 2001 {
+		t.Errorf("expected 2000 points and one break got %d points %d breaks", len(z.Series[0].X), breaks)
+	}
+
+	if _, err := seismogramPlot(make([]timeseries.Segment, 0), start, end, 500, 120); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,8 +23,8 @@ import (
 
 	"github.com/GeoNet/fdsn/internal/fdsn"
 	"github.com/GeoNet/kit/aws/s3"
+	"github.com/GeoNet/kit/aws/sqs"
 	"github.com/GeoNet/kit/weft"
-	"github.com/GeoNet/kit/wgs84"
 )
 
 const (
@@ -31,7 +33,6 @@ const (
 	STATION_LEVEL_CHANNEL   = 2
 	STATION_LEVEL_RESPONSE  = 3
 	DEFAULT_RELOAD_INTERVAL = 300
-	NZ_KM_DEGREE            = 111.0
 	NO_DATA                 = 204
 
 	BEFORE       = -1
@@ -70,7 +71,7 @@ type fdsnStationV1Parm struct {
 	MinLongitude        float64         `schema:"minlongitude"` // Limit to stations with a longitude larger than or equal to the specified minimum.
 	MaxLongitude        float64         `schema:"maxlongitude"` // Limit to stations with a longitude smaller than or equal to the specified maximum.
 	Level               string          `schema:"level"`        // Specify the level of detail for the results.
-	Format              string          `schema:"format"`       // Format of result. Either "xml" or "text".
+	Format              string          `schema:"format"`       // Format of result. Either "xml", "text", "extendedtext", "kml", "resp" or "sacpz".
 	IncludeAvailability bool            `schema:"includeavailability"`
 	IncludeRestricted   bool            `schema:"includerestricted"`
 	MatchTimeSeries     bool            `schema:"matchtimeseries"`
@@ -82,7 +83,10 @@ type fdsnStationV1Parm struct {
 	StartAfter          fdsn.WsDateTime `schema:"startafter"`
 	EndBefore           fdsn.WsDateTime `schema:"endbefore"`
 	EndAfter            fdsn.WsDateTime `schema:"endafter"`
-	NoData              int             `schema:"nodata"` // Select status code for “no data”, either ‘204’ (default) or ‘404’.
+	NoData              int             `schema:"nodata"`        // Select status code for “no data”, either ‘204’ (default) or ‘404’.
+	SchemaVersion       string          `schema:"schemaversion"` // Non-standard: StationXML schema version of the xml output, "1.0", "1.1" or "1.2" (default).
+	AsOf                fdsn.WsDateTime `schema:"asof"`          // Non-standard: query the inventory that was being served at this time.
+	Polygon             fdsn.Polygon    `schema:"polygon"`       // Non-standard: limit to stations inside the polygon, WKT or latitude,longitude pairs.
 	startMode           int             // BEFORE, ONBEFOREEND, AFTER
 	endMode             int             // BEFORE, ONAFTERSTART, AFTER
 }
@@ -109,7 +113,10 @@ var (
 	emptyDateTime       = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
 	errNotModified      = fmt.Errorf("not modified")
 	stationXMLBucket    string
-	stationXMLKey       string
+	stationXMLKeys      []string   // in order of precedence when the sources are merged
+	stationXMLSnapshot  string     // optional path for a binary snapshot of the parsed station xml
+	stationXMLUpdate    sync.Mutex // serialises updates of fdsnStations from the source xml
+	stationXMLS3        *s3.S3     // created on first use and reused, calls to download the station xml are serialised
 )
 
 func initStationTemplate() {
@@ -133,49 +140,100 @@ func initStationTemplate() {
 }
 
 func initStationXML() {
-	var err error
 	stationXMLBucket = os.Getenv("STATION_XML_BUCKET")
-	stationXMLKey = os.Getenv("STATION_XML_META_KEY")
+	stationXMLKeys = stationXMLSources(os.Getenv("STATION_XML_META_KEY"))
+	stationXMLSnapshot = os.Getenv("STATION_XML_SNAPSHOT")
+	stationXMLHistory = os.Getenv("STATION_XML_HISTORY")
+	if stationXMLHistory != "" {
+		if err := os.MkdirAll(stationXMLHistory, 0750); err != nil {
+			log.Fatalf("Error creating station history directory: %s\n", err)
+		}
+		initStationHistoryVersions()
+	}
+	initStationXMLValidation()
+
+	// Decoding the snapshot is much faster than unmarshaling the xml.
+	// Serve from it and then check the xml for updates in the background.
+	var stale fdsnStationObj
+	if stationXMLSnapshot != "" {
+		f, modified, sources, err := loadStationSnapshot(stationXMLSnapshot)
+		// the snapshot is stale if it was merged from different sources, its modification
+		// time would stop the current sources from being loaded.  It is only served if the
+		// xml fails validation.
+		if err == nil && !slices.Equal(sources, stationXMLKeys) {
+			stale = fdsnStationObj{fdsn: f, modified: modified}
+			err = fmt.Errorf("snapshot sources %v do not match STATION_XML_META_KEY %v", sources, stationXMLKeys)
+		}
+		if err == nil {
+			log.Printf("Loaded station snapshot %s, source modified %s\n", stationXMLSnapshot, modified.Format(time.RFC3339))
+			fdsnStations.set(f, modified)
+			stationXMLStatus.set(modified, nil)
+			go func() {
+				saveStationHistory(f, modified)
+				updateStationXML()
+			}()
+			return
+		}
+		log.Printf("Unable to load station snapshot %s, loading xml instead: %s\n", stationXMLSnapshot, err)
+	}
 
-	// Prepare the data source for station.
-	// If there's no local file available then we'll have to download first.
-	by := bytes.NewBuffer(nil)
+	// Prepare the data sources for station.
+	// If there's no local file available for a source then we'll have to download it first.
+	var sources []*FDSNStationXML
 	modified := zeroDateTime
-	var s os.FileInfo
-	if s, err = os.Stat("etc/" + stationXMLKey); err == nil {
-		log.Println("Loading fdsn station xml file ", "etc/"+stationXMLKey)
-		var f *os.File
-		if f, err = os.Open("etc/" + stationXMLKey); err == nil { // nolint:gosec
-			if _, err = io.Copy(by, f); err != nil {
-				log.Println("Error copying station xml file", err)
+	for _, key := range stationXMLKeys {
+		by, m, err := readStationXMLFile("etc/" + key)
+		if err == nil {
+			log.Println("Loading fdsn station xml file ", "etc/"+key)
+		} else {
+			// Local file not exist, or got error while reading it.
+			// Read from S3 instead.
+			if m, err = stationXMLModified(key); err == nil {
+				by, err = downloadStationXML(key)
 			}
-			if err = f.Close(); err != nil {
-				log.Println("Error closing station xml file", err)
+			if err != nil {
+				log.Fatalf("Download from S3 error: %s\n", err.Error())
 			}
-			modified = s.ModTime()
 		}
-	}
 
-	// Local file not exist, or got error while reading it.
-	// Read from S3 instead.
-	if err != nil {
-		by, modified, err = downloadStationXML(zeroDateTime)
+		source, err := loadStationXML(by, m)
 		if err != nil {
-			// errNotModified wouldn't happen here
-			log.Fatalf("Download from S3 error: %s\n", err.Error())
+			log.Fatalf("Error loading xml %s: %s\n", key, err)
+		}
+		sources = append(sources, source.fdsn)
+		if m.After(modified) {
+			modified = m
 		}
 	}
 
-	fdsnStations, err = loadStationXML(by, modified)
-	if err != nil {
-		log.Fatalf("Error loading xml: %s\n", err)
+	newStations := fdsnStationObj{fdsn: mergeStationXML(stationXMLKeys, sources), modified: modified}
+	if err := validateStationXML(newStations.fdsn, nil); err != nil {
+		// There's no previous inventory to fall back to.
+		if stale.fdsn == nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Serving the station snapshot %s: %s\n", stationXMLSnapshot, err)
+		fdsnStations.set(stale.fdsn, stale.modified)
+		stationXMLStatus.set(newStations.modified, err)
+		return
 	}
+	fdsnStations.set(newStations.fdsn, newStations.modified)
+	stationXMLStatus.set(newStations.modified, nil)
+
+	go func() {
+		if stationXMLSnapshot != "" {
+			writeStationSnapshot(newStations.fdsn, newStations.modified)
+		}
+		saveStationHistory(newStations.fdsn, newStations.modified)
+	}()
 }
 
 func parseStationV1Post(body string) ([]fdsnStationV1Search, error) {
 	ret := []fdsnStationV1Search{}
 	level := "station"
 	format := "xml"
+	schemaVersion := stationSchemaVersion
+	var asof, polygon, matchTimeSeries string
 
 	scanner := bufio.NewScanner(strings.NewReader(body))
 	for scanner.Scan() {
@@ -192,9 +250,14 @@ func parseStationV1Post(body string) ([]fdsnStationV1Search, error) {
 				}
 			case "format":
 				format = strings.TrimSpace(tokens[1])
-				if format != "xml" && format != "text" {
-					return ret, errors.New("invalid format")
-				}
+			case "schemaversion":
+				schemaVersion = strings.TrimSpace(tokens[1])
+			case "asof":
+				asof = strings.TrimSpace(tokens[1])
+			case "polygon":
+				polygon = strings.TrimSpace(tokens[1])
+			case "matchtimeseries":
+				matchTimeSeries = strings.TrimSpace(tokens[1])
 			}
 		} else if tokens := strings.Fields(line); len(tokens) == 6 {
 			// NET STA LOC CHA STARTTIME ENDTIME
@@ -213,6 +276,16 @@ func parseStationV1Post(body string) ([]fdsnStationV1Search, error) {
 			}
 			v.Add("Level", level)
 			v.Add("format", format)
+			v.Add("schemaversion", schemaVersion)
+			if asof != "" {
+				v.Add("asof", asof)
+			}
+			if polygon != "" {
+				v.Add("polygon", polygon)
+			}
+			if matchTimeSeries != "" {
+				v.Add("matchtimeseries", matchTimeSeries)
+			}
 
 			p, err := parseStationV1(v)
 			if err != nil {
@@ -224,13 +297,37 @@ func parseStationV1Post(body string) ([]fdsnStationV1Search, error) {
 		}
 	}
 
-	if level == "response" && format == "text" {
-		return []fdsnStationV1Search{}, fmt.Errorf("text formats are only supported when level is net|sta|cha")
+	if err := validStationFormat(format, level); err != nil {
+		return []fdsnStationV1Search{}, err
 	}
 
 	return ret, nil
 }
 
+// validStationFormat checks the format is supported at the requested level.
+// xml and text are supported at every level, extendedtext only at channel, kml only at station and resp and sacpz only at response.
+func validStationFormat(format, level string) error {
+	switch format {
+	case "xml", "text":
+	case "extendedtext":
+		if level != "channel" {
+			return fmt.Errorf("extendedtext format is only supported when level is channel")
+		}
+	case "kml":
+		if level != "station" {
+			return fmt.Errorf("kml format is only supported when level is station")
+		}
+	case "resp", "sacpz":
+		if level != "response" {
+			return fmt.Errorf("%s format is only supported when level is response", format)
+		}
+	default:
+		return fmt.Errorf("invalid format")
+	}
+
+	return nil
+}
+
 func parseStationV1(v url.Values) (fdsnStationV1Search, error) {
 	// All query parameters are optional and float zero values overlap
 	// with possible request ranges so the default is set to the max float val.
@@ -253,6 +350,8 @@ func parseStationV1(v url.Values) (fdsnStationV1Search, error) {
 		MinRadius:         0.0,
 		MaxRadius:         180.0,
 		NoData:            NO_DATA,
+		SchemaVersion:     stationSchemaVersion,
+		AsOf:              fdsn.EmptyWsDateTime, // the current inventory
 	}
 
 	for abbrev, expanded := range stationAbbreviations {
@@ -278,13 +377,8 @@ func parseStationV1(v url.Values) (fdsnStationV1Search, error) {
 		return fdsnStationV1Search{}, err
 	}
 
-	// Only xml and text is allowed.
-	if p.Format != "xml" && p.Format != "text" {
-		return fdsnStationV1Search{}, fmt.Errorf("invalid format")
-	}
-
-	if p.Level == "response" && p.Format == "text" {
-		return fdsnStationV1Search{}, fmt.Errorf("text formats are only supported when level is net|sta|cha")
+	if err := validStationFormat(p.Format, p.Level); err != nil {
+		return fdsnStationV1Search{}, err
 	}
 
 	count := 0
@@ -332,18 +426,14 @@ func parseStationV1(v url.Values) (fdsnStationV1Search, error) {
 		return fdsnStationV1Search{}, errors.New("include availability is not supported")
 	}
 
-	if !p.IncludeRestricted {
-		return fdsnStationV1Search{}, errors.New("exclude restricted is not supported")
-	}
-
-	if p.MatchTimeSeries {
-		return fdsnStationV1Search{}, errors.New("match time series is not supported")
-	}
-
 	if p.NoData != 204 && p.NoData != 404 {
 		return fdsnStationV1Search{}, errors.New("nodata must be 204 or 404")
 	}
 
+	if _, ok := stationSchemaVersions[p.SchemaVersion]; !ok {
+		return fdsnStationV1Search{}, fmt.Errorf("invalid schemaversion, must be one of 1.0, 1.1 or 1.2")
+	}
+
 	ne, err := fdsn.GenRegex(p.Network, false, false)
 	if err != nil {
 		return fdsnStationV1Search{}, err
@@ -496,17 +586,50 @@ func fdsnStationV1Handler(r *http.Request, h http.Header, b *bytes.Buffer) error
 		return fdsnError{StatusError: weft.StatusError{Code: http.StatusMethodNotAllowed}, timestamp: tm, url: r.URL.String()}
 	}
 
-	fdsnStations.RLock()
-	c := *fdsnStations.fdsn // NOTE: FDSNStationXML is a pointer in struct
-	fdsnStations.RUnlock()
+	var inventory *FDSNStationXML
+	var totals stationDBTotals
+	var err error
+
+	switch {
+	case stationDB && params[0].AsOf != fdsn.EmptyWsDateTime:
+		return fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("asof is not supported: %w", errNoHistory)}, timestamp: tm, url: r.URL.String()}
+	case stationDB:
+		if inventory, totals, err = queryStationDB(params); err != nil {
+			return err
+		}
+	default:
+		inventory, _, err = stationInventoryAsOf(params[0].AsOf.Time)
+		switch err {
+		case nil:
+		case errNoHistory:
+			return fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("asof is not supported: %w", err)}, timestamp: tm, url: r.URL.String()}
+		case errNoVersion:
+			return fdsnError{StatusError: weft.StatusError{Code: params[0].NoData}, timestamp: tm, url: r.URL.String()}
+		default:
+			return err
+		}
+	}
+	c := *inventory
 
 	hasContent := c.doFilter(params)
+	if totals != nil {
+		totals.setTotals(&c)
+	}
+
+	if hasContent && params[0].MatchTimeSeries {
+		if hasContent, err = c.matchTimeSeries(params); err != nil {
+			return err
+		}
+		c.trimLevel(params[0].LevelValue)
+	}
 
 	if !hasContent {
 		return fdsnError{StatusError: weft.StatusError{Code: params[0].NoData}, timestamp: tm, url: r.URL.String()}
 	}
 
-	if params[0].Format == "xml" {
+	switch params[0].Format {
+	case "xml":
+		c.setSchemaVersion(params[0].SchemaVersion)
 		by, err := xml.Marshal(c)
 		if err != nil {
 			return err
@@ -514,7 +637,26 @@ func fdsnStationV1Handler(r *http.Request, h http.Header, b *bytes.Buffer) error
 		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
 		b.Write(by)
 		h.Set("Content-Type", "application/xml")
-	} else {
+	case "resp":
+		bb := c.marshalResp()
+		b.Write(bb.Bytes())
+		h.Set("Content-Type", "text/plain")
+	case "sacpz":
+		bb := c.marshalSacPZ(tm)
+		b.Write(bb.Bytes())
+		h.Set("Content-Type", "text/plain")
+	case "kml":
+		bb, err := c.marshalKML()
+		if err != nil {
+			return err
+		}
+		b.Write(bb.Bytes())
+		h.Set("Content-Type", kmlContentType)
+	case "extendedtext":
+		bb := c.marshalExtendedText()
+		b.Write(bb.Bytes())
+		h.Set("Content-Type", "text/plain")
+	default:
 		bb := c.marshalText(params[0].LevelValue)
 		b.Write(bb.Bytes())
 		h.Set("Content-Type", "text/plain")
@@ -565,8 +707,9 @@ func (r *FDSNStationXML) marshalText(levelVal int) *bytes.Buffer {
 	case STATION_LEVEL_STATION:
 		by.WriteString("#Network | Station | Latitude | Longitude | Elevation | SiteName | StartTime | EndTime\n")
 	case STATION_LEVEL_CHANNEL:
-		by.WriteString("#Network | Station | Location | Channel | Latitude | Longitude | Elevation | Depth | Azimuth | Dip | SensorDescription | Scale | ScaleFreq | ScaleUnits | SampleRate | StartTime | EndTime\n")
-		// RESPONSE is not supported
+		by.WriteString(channelTextHeader + "\n")
+	case STATION_LEVEL_RESPONSE:
+		return r.marshalResponseText()
 	}
 
 	for n := 0; n < len(r.Network); n++ {
@@ -594,34 +737,7 @@ func (r *FDSNStationXML) marshalText(levelVal int) *bytes.Buffer {
 						fmt.Fprintf(by, "%s|%s|||||||||||||||\n", net.Code, sta.Code)
 					}
 					for c := 0; c < len(sta.Channel); c++ {
-						cha := &sta.Channel[c]
-						var frequency string
-						var value string
-						var unitsName string
-
-						if cha.Response != nil {
-							if s := cha.Response.InstrumentSensitivity; s != nil {
-								if s.Frequency != nil {
-									frequency = fmt.Sprintf("%f", *s.Frequency)
-								}
-								value = fmt.Sprintf("%f", s.Value)
-								if s.InputUnits != nil {
-									unitsName = s.InputUnits.Name
-								}
-							}
-						}
-
-						fmt.Fprintf(by, "%s|%s|%s|%s|%f|%f|%f|%f|%f|%f|%s|%s|%s|%s|%f|%s|%s\n",
-							net.Code, sta.Code, cha.LocationCode, cha.Code,
-							cha.Latitude.Value, cha.Longitude.Value, cha.Elevation.Value,
-							cha.Depth.Value, cha.Azimuth.Value, cha.Dip.Value,
-							cha.Sensor.Type,
-							value,
-							frequency,
-							unitsName,
-							cha.SampleRate.Value,
-							cha.StartDate.MarshalFormatText(), cha.EndDate.MarshalFormatText())
-
+						by.WriteString(channelText(net.Code, sta.Code, &sta.Channel[c]) + "\n")
 					}
 				}
 			}
@@ -630,6 +746,36 @@ func (r *FDSNStationXML) marshalText(levelVal int) *bytes.Buffer {
 	return by
 }
 
+// channelText returns the text line, without a new line, for cha.
+func channelText(network, station string, cha *ChannelType) string {
+	var frequency string
+	var value string
+	var unitsName string
+
+	if cha.Response != nil {
+		if s := cha.Response.InstrumentSensitivity; s != nil {
+			if s.Frequency != nil {
+				frequency = fmt.Sprintf("%f", *s.Frequency)
+			}
+			value = fmt.Sprintf("%f", s.Value)
+			if s.InputUnits != nil {
+				unitsName = s.InputUnits.Name
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s|%s|%s|%s|%f|%f|%f|%f|%f|%f|%s|%s|%s|%s|%f|%s|%s",
+		network, station, cha.LocationCode, cha.Code,
+		cha.Latitude.Value, cha.Longitude.Value, cha.Elevation.Value,
+		cha.Depth.Value, cha.Azimuth.Value, cha.Dip.Value,
+		cha.Sensor.Type,
+		value,
+		frequency,
+		unitsName,
+		cha.SampleRate.Value,
+		cha.StartDate.MarshalFormatText(), cha.EndDate.MarshalFormatText())
+}
+
 func (r *FDSNStationXML) doFilter(params []fdsnStationV1Search) bool {
 	resultNetworks := make([]NetworkType, 0)
 	for _, n := range r.Network {
@@ -646,7 +792,10 @@ func (r *FDSNStationXML) doFilter(params []fdsnStationV1Search) bool {
 
 	// Then trim the tree to the level specified in parameter before marshaling.
 	// (Note: all params have the same level so I'm taking the first param's level.)
-	r.trimLevel(params[0].LevelValue)
+	// matchtimeseries needs the channels so the tree is trimmed after matching the data holdings.
+	if !params[0].MatchTimeSeries {
+		r.trimLevel(params[0].LevelValue)
+	}
 
 	return true
 }
@@ -666,6 +815,9 @@ func (n *NetworkType) doFilter(params []fdsnStationV1Search) bool {
 		if p.NetworkReg != nil && !matchAnyRegex(n.Code, p.NetworkReg) {
 			continue
 		}
+		if !p.validRestricted(n.RestrictedStatus) {
+			continue
+		}
 		matchedParams = append(matchedParams, p)
 	}
 
@@ -693,7 +845,7 @@ func (n *NetworkType) doFilter(params []fdsnStationV1Search) bool {
 	}
 
 	for _, s := range n.Station {
-		if s.doFilter(matchedParams) {
+		if s.doFilter(n.Code, matchedParams) {
 			resultStations = append(resultStations, s)
 		}
 	}
@@ -705,7 +857,7 @@ func (n *NetworkType) doFilter(params []fdsnStationV1Search) bool {
 	return n.SelectedNumberStations > 0
 }
 
-func (s *StationType) doFilter(params []fdsnStationV1Search) bool {
+func (s *StationType) doFilter(network string, params []fdsnStationV1Search) bool {
 	s.TotalNumberChannels = CounterType(len(s.Channel))
 	resultChannels := make([]ChannelType, 0)
 
@@ -724,6 +876,12 @@ func (s *StationType) doFilter(params []fdsnStationV1Search) bool {
 		if !p.validBounding(s.Latitude, s.Longitude) {
 			continue
 		}
+		if !p.validPolygon(s.Latitude, s.Longitude) {
+			continue
+		}
+		if !p.validRestricted(s.RestrictedStatus) || (!p.IncludeRestricted && dataRestricted(network, s.Code)) {
+			continue
+		}
 		matchedParams = append(matchedParams, p)
 	}
 
@@ -777,6 +935,12 @@ func (c *ChannelType) doFilter(params []fdsnStationV1Search) bool {
 		if !p.validBounding(c.Latitude, c.Longitude) {
 			continue
 		}
+		if !p.validPolygon(c.Latitude, c.Longitude) {
+			continue
+		}
+		if !p.validRestricted(c.RestrictedStatus) {
+			continue
+		}
 
 		return true
 	}
@@ -834,6 +998,11 @@ func (v fdsnStationV1Search) validStartEnd(start, end time.Time, level int) bool
 	return true
 }
 
+// validRestricted is false for closed nodes when restricted nodes are not included.
+func (v fdsnStationV1Search) validRestricted(status *RestrictedStatusType) bool {
+	return v.IncludeRestricted || status == nil || *status != RestrictedStatusClosed
+}
+
 func (v fdsnStationV1Search) validLatLng(latitude LatitudeType, longitude LongitudeType) bool {
 	if v.MinLatitude != math.MaxFloat64 && latitude.Value < v.MinLatitude {
 		return false
@@ -859,12 +1028,8 @@ func (v fdsnStationV1Search) validBounding(latitude LatitudeType, longitude Long
 		// not using bounding circle
 		return true
 	}
-	d, _, err := wgs84.DistanceBearing(v.Latitude, v.Longitude, latitude.Value, longitude.Value)
-	if err != nil {
-		log.Printf("Error checking bounding:%s\n", err.Error())
-		return false
-	}
-	d = d / NZ_KM_DEGREE
+
+	d := greatCircleDegrees(v.Latitude, v.Longitude, latitude.Value, longitude.Value)
 
 	if d < v.MinRadius {
 		return false
@@ -876,59 +1041,146 @@ func (v fdsnStationV1Search) validBounding(latitude LatitudeType, longitude Long
 	return true
 }
 
-// Download station XML from S3
-func downloadStationXML(since time.Time) (by *bytes.Buffer, modified time.Time, err error) {
-	var tp time.Time
-	by = bytes.NewBuffer(nil)
+func (v fdsnStationV1Search) validPolygon(latitude LatitudeType, longitude LongitudeType) bool {
+	if v.Polygon.IsZero() {
+		return true
+	}
 
-	if stationXMLBucket != "" {
-		var s3Client s3.S3
-		s3Client, err = s3.NewWithMaxRetries(100)
-		if err != nil {
+	return v.Polygon.Contains(latitude.Value, longitude.Value)
+}
+
+// greatCircleDegrees returns the great circle distance in degrees between two points on a sphere.
+func greatCircleDegrees(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180.0, lat2*math.Pi/180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+
+	// the Vincenty formula is accurate for small and antipodal distances.
+	y := math.Hypot(math.Cos(lat2r)*math.Sin(dLon), math.Cos(lat1r)*math.Sin(lat2r)-math.Sin(lat1r)*math.Cos(lat2r)*math.Cos(dLon))
+	x := math.Sin(lat1r)*math.Sin(lat2r) + math.Cos(lat1r)*math.Cos(lat2r)*math.Cos(dLon)
+
+	return math.Atan2(y, x) * 180.0 / math.Pi
+}
+
+// stationXMLSources returns the source keys from a comma separated list.
+func stationXMLSources(keys string) []string {
+	var k []string
+	for _, v := range strings.Split(keys, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			k = append(k, v)
+		}
+	}
+	return k
+}
+
+// downloadStationSources downloads, loads, and merges the source station xml
+// if any source has been modified since.
+func downloadStationSources(since time.Time) (stationObj fdsnStationObj, err error) {
+	var modified time.Time
+	for _, key := range stationXMLKeys {
+		var m time.Time
+		if m, err = stationXMLModified(key); err != nil {
 			return
 		}
+		if m.After(modified) {
+			modified = m
+		}
+	}
 
-		tp, err = s3Client.LastModified(stationXMLBucket, stationXMLKey, "")
-		if err != nil {
+	if !modified.After(since) {
+		err = errNotModified
+		return
+	}
+
+	sources := make([]*FDSNStationXML, len(stationXMLKeys))
+	for i, key := range stationXMLKeys {
+		var by *bytes.Buffer
+		if by, err = downloadStationXML(key); err != nil {
 			return
 		}
 
-		if !tp.After(since) {
-			return nil, time.Time(zeroDateTime), errNotModified
+		var source fdsnStationObj
+		if source, err = loadStationXML(by, modified); err != nil {
+			err = fmt.Errorf("%s: %w", key, err)
+			return
 		}
+		sources[i] = source.fdsn
+	}
 
-		log.Println("Downloading fdsn station xml file from S3: ", stationXMLBucket+"/"+stationXMLKey)
+	stationObj.fdsn = mergeStationXML(stationXMLKeys, sources)
+	stationObj.modified = modified
 
-		err = s3Client.Get(stationXMLBucket, stationXMLKey, "", by)
+	return
+}
+
+// stationXMLModified returns the modification time of the source station xml.
+func stationXMLModified(key string) (time.Time, error) {
+	if stationXMLBucket == "" {
+		// local files are reloaded when they are modified.
+		s, err := os.Stat(key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return s.ModTime(), nil
+	}
+
+	if stationXMLS3 == nil {
+		s3Client, err := s3.NewWithMaxRetries(100)
 		if err != nil {
+			return time.Time{}, err
+		}
+		stationXMLS3 = &s3Client
+	}
+
+	return stationXMLS3.LastModified(stationXMLBucket, key, "")
+}
+
+// Download station XML from S3.  stationXMLModified must have been called first.
+func downloadStationXML(key string) (by *bytes.Buffer, err error) {
+	by = bytes.NewBuffer(nil)
+
+	if stationXMLBucket != "" {
+		log.Println("Downloading fdsn station xml file from S3: ", stationXMLBucket+"/"+key)
+
+		if err = stationXMLS3.Get(stationXMLBucket, key, "", by); err != nil {
 			return
 		}
 	} else {
 		// load from local to make debugging easier.
-		// s3Meta be the path to station xml
-		var f *os.File
-		f, err = os.Open(stationXMLKey) // nolint:gosec
-		if err != nil {
+		// the key is the path to station xml
+		if by, _, err = readStationXMLFile(key); err != nil {
 			return
 		}
-		defer func() { _ = f.Close() }()
-		_, err = by.ReadFrom(f)
-		tp = time.Now()
 	}
-	modified = tp
 	log.Println("Download complete.")
 	return
 }
 
+// readStationXMLFile reads the station xml file at path.
+func readStationXMLFile(path string) (*bytes.Buffer, time.Time, error) {
+	s, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	by, err := os.ReadFile(path) // nolint:gosec
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return bytes.NewBuffer(by), s.ModTime(), nil
+}
+
 func loadStationXML(by *bytes.Buffer, modified time.Time) (stationObj fdsnStationObj, err error) {
 	var f FDSNStationXML
 	if err = xml.Unmarshal(by.Bytes(), &f); err != nil {
 		return
 	}
 
-	// Precondition: There's at least 1 network in the source XML.
-	// Else program will crash here.
-	log.Printf("Done loading %d or more stations.\n", len(f.Network[0].Station))
+	var n int
+	for _, net := range f.Network {
+		n += len(net.Station)
+	}
+	log.Printf("Done loading %d networks and %d stations.\n", len(f.Network), n)
 
 	stationObj.modified = modified
 	stationObj.fdsn = &f
@@ -936,9 +1188,100 @@ func loadStationXML(by *bytes.Buffer, modified time.Time) (stationObj fdsnStatio
 	return
 }
 
-// Periodically update data source
+// set replaces the station inventory being served.
+func (s *fdsnStationObj) set(f *FDSNStationXML, modified time.Time) {
+	s.Lock()
+	s.fdsn = f
+	s.modified = modified
+	s.Unlock()
+}
+
+// lastModified returns the source modification time of the station inventory being served.
+func (s *fdsnStationObj) lastModified() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+	return s.modified
+}
+
+// updateStationXML downloads and loads the source station xml if it has been
+// modified since the inventory being served was loaded.
+func updateStationXML() {
+	switch err := reloadStationXML(false); err {
+	case nil, errNotModified:
+	default:
+		log.Println("ERROR: updating station xml:", err)
+	}
+}
+
+// reloadStationXML downloads, validates, and loads the source station xml.  Unless force is true
+// errNotModified is returned if the xml has not been modified since it was last loaded or rejected.
+// If the xml can't be loaded the previous inventory continues to be served.
+func reloadStationXML(force bool) error {
+	stationXMLUpdate.Lock()
+	defer stationXMLUpdate.Unlock()
+
+	since := fdsnStations.lastModified()
+	if rejected, ok := stationXMLStatus.rejected(); ok && rejected.After(since) {
+		since = rejected
+	}
+	if force {
+		since = zeroDateTime
+	}
+
+	newStations, err := downloadStationSources(since)
+	switch err {
+	case nil:
+	case errNotModified:
+		return err
+	default:
+		stationXMLStatus.set(since, err)
+		return err
+	}
+
+	fdsnStations.RLock()
+	err = validateStationXML(newStations.fdsn, fdsnStations.fdsn)
+	fdsnStations.RUnlock()
+	stationXMLStatus.set(newStations.modified, err)
+	if err != nil {
+		return err
+	}
+	fdsnStations.set(newStations.fdsn, newStations.modified)
+	log.Println("Data source updated.")
+
+	if stationXMLSnapshot != "" {
+		writeStationSnapshot(newStations.fdsn, newStations.modified)
+	}
+	saveStationHistory(newStations.fdsn, newStations.modified)
+
+	return nil
+}
+
+// writeStationSnapshot saves the station snapshot, logging any errors.
+func writeStationSnapshot(f *FDSNStationXML, modified time.Time) {
+	if err := saveStationSnapshot(stationXMLSnapshot, f, modified, stationXMLKeys); err != nil {
+		log.Printf("Error saving station snapshot %s: %s\n", stationXMLSnapshot, err)
+		return
+	}
+	log.Println("Station snapshot saved to", stationXMLSnapshot)
+}
+
+// Periodically update data source.  When reloads are driven by notifications (STATION_XML_SQS_QUEUE_URL)
+// polling is only used if STATION_RELOAD_INTERVAL is also set.
 func setupStationXMLUpdater() {
 	s := os.Getenv("STATION_RELOAD_INTERVAL")
+
+	if queueURL := os.Getenv("STATION_XML_SQS_QUEUE_URL"); queueURL != "" {
+		sqsClient, err := sqs.NewWithMaxRetries(100)
+		if err != nil {
+			log.Fatalf("error creating SQS client: %s", err)
+		}
+		go receiveNotifications(context.Background(), sqsClient, queueURL, "station xml", &stationXMLEvent{})
+
+		if s == "" {
+			return
+		}
+	}
+
 	reloadInterval, err := strconv.Atoi(s)
 	if err != nil {
 		log.Printf("Warning: invalid STATION_RELOAD_INTERVAL env variable, use default value %d instead.\n", DEFAULT_RELOAD_INTERVAL)
@@ -947,27 +1290,7 @@ func setupStationXMLUpdater() {
 	ticker := time.NewTicker(time.Duration(reloadInterval) * time.Second)
 	go func() {
 		for range ticker.C {
-			by, s3Modified, err := downloadStationXML(fdsnStations.modified)
-			switch err {
-			case errNotModified:
-			// Do nothing
-			case nil:
-				newStations, err := loadStationXML(by, s3Modified)
-				if err != nil {
-					// errNotModified will be silent
-					if err != errNotModified {
-						log.Println("Error updating data source:", err)
-					}
-				} else {
-					fdsnStations.Lock()
-					fdsnStations.fdsn = newStations.fdsn
-					fdsnStations.modified = newStations.modified
-					fdsnStations.Unlock()
-					log.Println("Data source updated.")
-				}
-			default:
-				log.Println("ERROR: Download XML from S3:", err)
-			}
+			updateStationXML()
 		}
 	}()
 }
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// The station inventory can be stored in the fdsn station tables (network, station, channel, and inventory)
+// instead of each replica loading the station xml.  Each node is stored as StationXML without its
+// children, along with the codes and times for searching.
+//
+// fdsn-ws -load-stations loads the station xml into the tables, replacing the previous inventory, and exits.
+// With STATION_DB=true station queries are made against the tables instead of loading the station xml.
+// The tables are searched with the network, station, location, and channel codes and the results are filtered
+// in the same way as the station xml.
+
+var (
+	stationDB    bool // station queries use the station tables.
+	loadStations = flag.Bool("load-stations", false, "load the station xml into the DB and exit")
+)
+
+// stationDBTotals holds the total numbers of stations in each network and channels in each station,
+// keyed by code and start time.  Queries only read the stations and channels that could match.
+type stationDBTotals map[string]CounterType
+
+// runStationLoader loads the station xml into the DB if it has been modified since it was last loaded.
+func runStationLoader() error {
+	stationXMLBucket = os.Getenv("STATION_XML_BUCKET")
+	stationXMLKeys = stationXMLSources(os.Getenv("STATION_XML_META_KEY"))
+
+	since, err := stationDBModified()
+	if err != nil {
+		return err
+	}
+
+	newStations, err := downloadStationSources(since)
+	switch err {
+	case nil:
+	case errNotModified:
+		log.Println("station xml not modified since", since.Format(time.RFC3339))
+		return nil
+	default:
+		return err
+	}
+
+	if err := validateStationXML(newStations.fdsn, nil); err != nil {
+		return err
+	}
+
+	if err := saveStationDB(newStations.fdsn, newStations.modified); err != nil {
+		return err
+	}
+
+	log.Println("station xml loaded into the DB, modified", newStations.modified.Format(time.RFC3339))
+
+	return nil
+}
+
+// stationDBModified returns the modification time of the station xml in the DB.
+func stationDBModified() (time.Time, error) {
+	var modified time.Time
+
+	err := db.QueryRow(`SELECT modified FROM fdsn.inventory`).Scan(&modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return zeroDateTime, nil
+	}
+
+	return modified, err
+}
+
+// saveStationDB replaces the inventory in the DB with f.  The inventory is replaced in
+// one transaction so queries don't see a partial inventory.
+func saveStationDB(f *FDSNStationXML, modified time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the station and channel rows are deleted by cascade.
+	if _, err = tx.Exec(`DELETE FROM fdsn.network`); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM fdsn.inventory`); err != nil {
+		return err
+	}
+
+	header := *f
+	header.Network = nil
+	by, err := xml.Marshal(header)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO fdsn.inventory (modified, xml) VALUES ($1, $2)`, modified, string(by)); err != nil {
+		return err
+	}
+
+	insertNetwork, err := tx.Prepare(`INSERT INTO fdsn.network (code, start_time, end_time, stations, xml)
+	VALUES ($1, $2, $3, $4, $5) RETURNING networkPK`)
+	if err != nil {
+		return err
+	}
+	insertStation, err := tx.Prepare(`INSERT INTO fdsn.station (networkPK, code, start_time, end_time, latitude, longitude, channels, xml)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING stationPK`)
+	if err != nil {
+		return err
+	}
+	insertChannel, err := tx.Prepare(`INSERT INTO fdsn.channel (stationPK, location, code, start_time, end_time, latitude, longitude, xml, response)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	if err != nil {
+		return err
+	}
+
+	for _, net := range f.Network {
+		n := net
+		n.Station = nil
+		if by, err = xml.Marshal(n); err != nil {
+			return err
+		}
+
+		var networkPK int
+		err = insertNetwork.QueryRow(net.Code, time.Time(net.StartDate), nullTime(net.EndDate), len(net.Station), string(by)).Scan(&networkPK)
+		if err != nil {
+			return fmt.Errorf("network %s: %w", net.Code, err)
+		}
+
+		for _, sta := range net.Station {
+			s := sta
+			s.Channel = nil
+			if by, err = xml.Marshal(s); err != nil {
+				return err
+			}
+
+			var stationPK int
+			err = insertStation.QueryRow(networkPK, sta.Code, time.Time(sta.StartDate), nullTime(sta.EndDate),
+				sta.Latitude.Value, sta.Longitude.Value, len(sta.Channel), string(by)).Scan(&stationPK)
+			if err != nil {
+				return fmt.Errorf("station %s.%s: %w", net.Code, sta.Code, err)
+			}
+
+			for _, cha := range sta.Channel {
+				var response []byte
+				if cha.Response != nil {
+					if response, err = xml.Marshal(cha.Response); err != nil {
+						return err
+					}
+				}
+
+				// the channel xml has the response without the stages, enough for levels below response.
+				c := cha
+				c.Response = withoutStages(cha.Response)
+				if by, err = xml.Marshal(c); err != nil {
+					return err
+				}
+
+				_, err = insertChannel.Exec(stationPK, cha.LocationCode, cha.Code, time.Time(cha.StartDate), nullTime(cha.EndDate),
+					cha.Latitude.Value, cha.Longitude.Value, string(by), string(response))
+				if err != nil {
+					return fmt.Errorf("channel %s.%s.%s.%s: %w", net.Code, sta.Code, cha.LocationCode, cha.Code, err)
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// queryStationDB reads the nodes from the DB that could match params.  The result needs to be filtered.
+// Stations and channels below the requested level are still needed to filter their parents but only
+// the columns and attributes used by the filter are read for them.
+func queryStationDB(params []fdsnStationV1Search) (*FDSNStationXML, stationDBTotals, error) {
+	var f FDSNStationXML
+	var header string
+
+	err := db.QueryRow(`SELECT xml FROM fdsn.inventory`).Scan(&header)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &f, nil, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	if err := xml.Unmarshal([]byte(header), &f); err != nil {
+		return nil, nil, err
+	}
+
+	query, args, level := stationDBQuery(params)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	totals := make(stationDBTotals)
+	var lastNetwork, lastStation int
+
+	for rows.Next() {
+		var networkPK, stations int
+		var networkXML string
+		var stationPK, channels sql.NullInt64
+		var sta, cha stationDBNode
+		var responseXML sql.NullString
+
+		if err := rows.Scan(&networkPK, &stations, &networkXML,
+			&stationPK, &channels, &sta.code, &sta.start, &sta.end, &sta.latitude, &sta.longitude, &sta.xml,
+			&cha.location, &cha.code, &cha.start, &cha.end, &cha.latitude, &cha.longitude, &cha.xml, &responseXML); err != nil {
+			return nil, nil, err
+		}
+
+		if networkPK != lastNetwork {
+			var n NetworkType
+			if err := xml.Unmarshal([]byte(networkXML), &n); err != nil {
+				return nil, nil, err
+			}
+			f.Network = append(f.Network, n)
+			totals[epochKey(n.Code, n.StartDate)] = CounterType(stations)
+			lastNetwork = networkPK
+		}
+		net := &f.Network[len(f.Network)-1]
+
+		if !stationPK.Valid {
+			continue
+		}
+
+		if int(stationPK.Int64) != lastStation {
+			var s StationType
+			switch {
+			case level >= STATION_LEVEL_STATION:
+				if err := xml.Unmarshal([]byte(sta.xml.String), &s); err != nil {
+					return nil, nil, err
+				}
+			default:
+				if err := sta.stub(&s.BaseNodeType); err != nil {
+					return nil, nil, err
+				}
+				s.Latitude.Value, s.Longitude.Value = sta.latitude.Float64, sta.longitude.Float64
+			}
+			net.Station = append(net.Station, s)
+			totals[epochKey(net.Code+"."+s.Code, s.StartDate)] = CounterType(channels.Int64)
+			lastStation = int(stationPK.Int64)
+		}
+		s := &net.Station[len(net.Station)-1]
+
+		if !cha.xml.Valid {
+			continue
+		}
+
+		var c ChannelType
+		switch {
+		case level >= STATION_LEVEL_CHANNEL:
+			if err := xml.Unmarshal([]byte(cha.xml.String), &c); err != nil {
+				return nil, nil, err
+			}
+		default:
+			if err := cha.stub(&c.BaseNodeType); err != nil {
+				return nil, nil, err
+			}
+			c.LocationCode = cha.location.String
+			c.Latitude.Value, c.Longitude.Value = cha.latitude.Float64, cha.longitude.Float64
+		}
+		if responseXML.String != "" {
+			var r ResponseType
+			if err := xml.Unmarshal([]byte(responseXML.String), &r); err != nil {
+				return nil, nil, err
+			}
+			c.Response = &r
+		}
+		s.Channel = append(s.Channel, c)
+	}
+
+	return &f, totals, rows.Err()
+}
+
+// stationDBQuery returns the query, and its args, for the nodes that could match params and the
+// deepest level requested.  The codes requested are always args, only the columns depend on params.
+func stationDBQuery(params []fdsnStationV1Search) (string, []interface{}, int) {
+	var network, station, location, channel []string
+	level := STATION_LEVEL_NETWORK
+	for _, p := range params {
+		network = append(network, regexOrAll(p.NetworkReg)...)
+		station = append(station, regexOrAll(p.StationReg)...)
+		location = append(location, regexOrAll(p.LocationReg)...)
+		channel = append(channel, regexOrAll(p.ChannelReg)...)
+
+		l := p.LevelValue
+		// matchtimeseries is applied to the channels before the tree is trimmed.
+		if p.MatchTimeSeries && l < STATION_LEVEL_CHANNEL {
+			l = STATION_LEVEL_CHANNEL
+		}
+		level = max(level, l)
+	}
+
+	// the xml is only read for the levels that are returned, the response only when it is needed.
+	stationColumn, channelColumn, responseColumn := startTag("s.xml"), startTag("c.xml"), `''`
+	if level >= STATION_LEVEL_STATION {
+		stationColumn = `s.xml`
+	}
+	if level >= STATION_LEVEL_CHANNEL {
+		channelColumn = `c.xml`
+	}
+	if level == STATION_LEVEL_RESPONSE {
+		responseColumn = `c.response`
+	}
+
+	query := `SELECT n.networkPK, n.stations, n.xml,
+	s.stationPK, s.channels, s.code, s.start_time, s.end_time, s.latitude, s.longitude, ` + stationColumn + `,
+	c.location, c.code, c.start_time, c.end_time, c.latitude, c.longitude, ` + channelColumn + `, ` + responseColumn + `
+	FROM fdsn.network n
+	LEFT JOIN fdsn.station s ON s.networkPK = n.networkPK AND s.code ~ $2
+	LEFT JOIN fdsn.channel c ON c.stationPK = s.stationPK AND c.location ~ $3 AND c.code ~ $4
+	WHERE n.code ~ $1
+	ORDER BY n.networkPK, s.stationPK, c.channelPK`
+
+	return query, []interface{}{anyRegex(network), anyRegex(station), anyRegex(location), anyRegex(channel)}, level
+}
+
+// stationDBNode is a station or channel row from the DB.  xml is only the start tag when the
+// node is below the requested level.
+type stationDBNode struct {
+	code, location      sql.NullString
+	start, end          sql.NullTime
+	latitude, longitude sql.NullFloat64
+	xml                 sql.NullString
+}
+
+// stub sets the codes, times, and restricted status used to filter a node without reading all of its xml.
+func (n stationDBNode) stub(b *BaseNodeType) error {
+	b.Code = n.code.String
+	b.StartDate = xsdDateTime(n.start.Time.UTC())
+	if n.end.Valid {
+		b.EndDate = xsdDateTime(n.end.Time.UTC())
+	}
+
+	t, err := xml.NewDecoder(strings.NewReader(n.xml.String)).Token()
+	if err != nil {
+		return err
+	}
+	if e, ok := t.(xml.StartElement); ok {
+		for _, a := range e.Attr {
+			if a.Name.Local == "restrictedStatus" {
+				r := RestrictedStatusType(a.Value)
+				b.RestrictedStatus = &r
+			}
+		}
+	}
+
+	return nil
+}
+
+// startTag returns SQL for the start tag, with the attributes, of the xml in column.
+func startTag(column string) string {
+	return `substring(` + column + ` from '^<[^>]*>')`
+}
+
+// findChannelDB returns the channel epoch, with the response, that includes t from the station tables.
+func findChannelDB(network, station, location, channel string, t time.Time) (*ChannelType, bool, error) {
+	var channelXML, responseXML string
+
+	err := db.QueryRow(`SELECT c.xml, c.response
+	FROM fdsn.channel c
+	JOIN fdsn.station s ON s.stationPK = c.stationPK
+	JOIN fdsn.network n ON n.networkPK = s.networkPK
+	WHERE n.code = $1 AND s.code = $2 AND trim(c.location) = $3 AND c.code = $4
+	AND c.start_time <= $5 AND (c.end_time IS NULL OR c.end_time > $5)
+	ORDER BY c.start_time DESC LIMIT 1`, network, station, location, channel, t).Scan(&channelXML, &responseXML)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	}
+
+	var c ChannelType
+	if err := xml.Unmarshal([]byte(channelXML), &c); err != nil {
+		return nil, false, err
+	}
+	if responseXML != "" {
+		var r ResponseType
+		if err := xml.Unmarshal([]byte(responseXML), &r); err != nil {
+			return nil, false, err
+		}
+		c.Response = &r
+	}
+
+	return &c, true, nil
+}
+
+// setTotals sets the total numbers of stations and channels in the filtered inventory r.
+func (t stationDBTotals) setTotals(r *FDSNStationXML) {
+	for n := range r.Network {
+		net := &r.Network[n]
+		if v, ok := t[epochKey(net.Code, net.StartDate)]; ok {
+			net.TotalNumberStations = v
+		}
+		for s := range net.Station {
+			sta := &net.Station[s]
+			if v, ok := t[epochKey(net.Code+"."+sta.Code, sta.StartDate)]; ok {
+				sta.TotalNumberChannels = v
+			}
+		}
+	}
+}
+
+// withoutStages returns a copy of r without the response stages.
+func withoutStages(r *ResponseType) *ResponseType {
+	if r == nil {
+		return nil
+	}
+
+	res := *r
+	res.Stage = nil
+
+	return &res
+}
+
+func nullTime(t xsdDateTime) sql.NullTime {
+	if time.Time(t).IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Time(t), Valid: true}
+}
+
+// regexOrAll returns r or a regex that matches any code if r is nil.
+func regexOrAll(r []string) []string {
+	if r == nil {
+		return []string{REGEX_ANYTHING}
+	}
+	return r
+}
+
+// anyRegex combines r into one regex that matches any of them.
+func anyRegex(r []string) string {
+	for _, v := range r {
+		if v == REGEX_ANYTHING {
+			return REGEX_ANYTHING
+		}
+	}
+
+	return "(" + strings.Join(r, ")|(") + ")"
+}
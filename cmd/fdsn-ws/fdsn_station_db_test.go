@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStationDB checks queries against the station tables give the same results as the station xml.
+func TestStationDB(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	defer func() { stationDB = false }()
+
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := saveStationDB(validateTestXML(t), modified); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := stationDBModified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Equal(modified) {
+		t.Errorf("expected modified %s got %s", modified, m)
+	}
+
+	for _, q := range []string{
+		"level=network",
+		"station=ARHZ&level=network",
+		"channel=EHN&starttime=2010-01-01T00:00:00&level=network",
+		"minlatitude=-38.63&maxlatitude=-38.62&level=network",
+		"includerestricted=false&level=station",
+		"station=ARAZ&level=station",
+		"station=AR*&channel=EHZ&level=channel",
+		"station=ARHZ&location=10&channel=EH?&level=response",
+		"minlatitude=-38.63&maxlatitude=-38.62&level=channel",
+	} {
+		v, err := url.ParseQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := parseStationV1(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := []fdsnStationV1Search{p}
+
+		expected := *validateTestXML(t)
+		expected.doFilter(params)
+
+		f, totals, err := queryStationDB(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := *f
+		c.doFilter(params)
+		totals.setTotals(&c)
+
+		a, err := xml.Marshal(expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := xml.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: the DB query result is different to the station xml", q)
+		}
+	}
+}
+
+func TestFindChannelDB(t *testing.T) {
+	setup(t)
+	defer teardown()
+
+	defer func() { stationDB = false }()
+
+	if err := saveStationDB(validateTestXML(t), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	stationDB = true
+
+	when := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c, ok, err := findChannel("NZ", "ARAZ", "10", "EHZ", when)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || c.Response == nil || len(c.Response.Stage) == 0 {
+		t.Fatal("expected NZ.ARAZ.10.EHZ with the response stages")
+	}
+
+	if _, ok, err = findChannel("NZ", "ARAZ", "10", "EHZ", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil || ok {
+		t.Errorf("expected no channel before the epoch got %t %v", ok, err)
+	}
+}
+
+func TestStationDBNodeStub(t *testing.T) {
+	start := time.Date(2007, 5, 20, 23, 0, 0, 0, time.UTC)
+
+	n := stationDBNode{
+		code:  sql.NullString{String: "ARAZ", Valid: true},
+		start: sql.NullTime{Time: start, Valid: true},
+		xml:   sql.NullString{String: `<StationType code="ARAZ" restrictedStatus="closed">`, Valid: true},
+	}
+
+	var b BaseNodeType
+	if err := n.stub(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Code != "ARAZ" || !time.Time(b.StartDate).Equal(start) || !time.Time(b.EndDate).IsZero() {
+		t.Errorf("unexpected node %+v", b)
+	}
+	if b.RestrictedStatus == nil || *b.RestrictedStatus != RestrictedStatusClosed {
+		t.Errorf("expected restricted status closed got %v", b.RestrictedStatus)
+	}
+}
+
+func TestAnyRegex(t *testing.T) {
+	if r := anyRegex([]string{"^NZ$", "^AU$"}); r != "(^NZ$)|(^AU$)" {
+		t.Errorf("unexpected regex %s", r)
+	}
+	if r := anyRegex(regexOrAll(nil)); r != REGEX_ANYTHING {
+		t.Errorf("unexpected regex %s", r)
+	}
+}
+
+// TestStationDBQueryArgs checks the codes requested are only passed to the DB as args.
+func TestStationDBQueryArgs(t *testing.T) {
+	injection := `'); DROP TABLE fdsn.network; --`
+
+	for _, level := range []int{STATION_LEVEL_NETWORK, STATION_LEVEL_STATION, STATION_LEVEL_CHANNEL, STATION_LEVEL_RESPONSE} {
+		v, err := url.ParseQuery("network=NZ,IU&station=AR*&location=10&channel=EH?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := parseStationV1(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.LevelValue = level
+
+		q := p
+		q.NetworkReg, q.StationReg, q.LocationReg, q.ChannelReg = []string{injection}, []string{injection}, []string{injection}, []string{injection}
+
+		query, args, l := stationDBQuery([]fdsnStationV1Search{p})
+		if l != level {
+			t.Errorf("level %d: got level %d", level, l)
+		}
+
+		// the query only depends on the level.
+		if other, _, _ := stationDBQuery([]fdsnStationV1Search{q}); other != query {
+			t.Errorf("level %d: the query changed with the codes requested", level)
+		}
+		if all, _, _ := stationDBQuery([]fdsnStationV1Search{{LevelValue: level}}); all != query {
+			t.Errorf("level %d: the query changed with no codes requested", level)
+		}
+
+		if strings.Contains(query, "DROP") || strings.Contains(query, "NZ") || strings.Contains(query, "AR") {
+			t.Errorf("level %d: the codes requested are in the query %s", level, query)
+		}
+
+		if len(args) != 4 {
+			t.Fatalf("level %d: expected 4 args got %d", level, len(args))
+		}
+
+		for i, r := range [][]string{p.NetworkReg, p.StationReg, p.LocationReg, p.ChannelReg} {
+			if args[i] != anyRegex(r) {
+				t.Errorf("level %d: expected arg %d %s got %v", level, i+1, anyRegex(r), args[i])
+			}
+		}
+
+		if _, a, _ := stationDBQuery([]fdsnStationV1Search{q}); a[0] != "("+injection+")" {
+			t.Errorf("level %d: expected the network arg %s got %v", level, injection, a[0])
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// stationChange is a network, station, channel, or channel response that was added, removed,
+// or changed between two versions of the inventory.  Epochs are matched by their codes and start time.
+type stationChange struct {
+	change                              string // added, removed, changed
+	level                               string // network, station, channel, response
+	network, station, location, channel string
+	start                               time.Time
+}
+
+// diffStationXML returns the changes from a to z.  Added or removed networks and stations
+// are listed without their stations or channels.
+func diffStationXML(a, z *FDSNStationXML) []stationChange {
+	var changes []stationChange
+
+	nets := make(map[string]*NetworkType)
+	for i := range a.Network {
+		nets[epochKey(a.Network[i].Code, a.Network[i].StartDate)] = &a.Network[i]
+	}
+
+	for i := range z.Network {
+		zn := &z.Network[i]
+		k := epochKey(zn.Code, zn.StartDate)
+		an, ok := nets[k]
+		if !ok {
+			changes = append(changes, stationChange{change: "added", level: "network", network: zn.Code, start: time.Time(zn.StartDate)})
+			continue
+		}
+		delete(nets, k)
+
+		if !reflect.DeepEqual(networkNode(an), networkNode(zn)) {
+			changes = append(changes, stationChange{change: "changed", level: "network", network: zn.Code, start: time.Time(zn.StartDate)})
+		}
+
+		changes = append(changes, diffStations(zn.Code, an.Station, zn.Station)...)
+	}
+
+	for _, an := range nets {
+		changes = append(changes, stationChange{change: "removed", level: "network", network: an.Code, start: time.Time(an.StartDate)})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		ci, cj := changes[i], changes[j]
+		switch {
+		case ci.network != cj.network:
+			return ci.network < cj.network
+		case ci.station != cj.station:
+			return ci.station < cj.station
+		case ci.location != cj.location:
+			return ci.location < cj.location
+		case ci.channel != cj.channel:
+			return ci.channel < cj.channel
+		default:
+			return ci.start.Before(cj.start)
+		}
+	})
+
+	return changes
+}
+
+func diffStations(network string, a, z []StationType) []stationChange {
+	var changes []stationChange
+
+	stations := make(map[string]*StationType)
+	for i := range a {
+		stations[epochKey(a[i].Code, a[i].StartDate)] = &a[i]
+	}
+
+	for i := range z {
+		zs := &z[i]
+		k := epochKey(zs.Code, zs.StartDate)
+		as, ok := stations[k]
+		if !ok {
+			changes = append(changes, stationChange{change: "added", level: "station", network: network, station: zs.Code, start: time.Time(zs.StartDate)})
+			continue
+		}
+		delete(stations, k)
+
+		if !reflect.DeepEqual(stationNode(as), stationNode(zs)) {
+			changes = append(changes, stationChange{change: "changed", level: "station", network: network, station: zs.Code, start: time.Time(zs.StartDate)})
+		}
+
+		changes = append(changes, diffChannels(network, zs.Code, as.Channel, zs.Channel)...)
+	}
+
+	for _, as := range stations {
+		changes = append(changes, stationChange{change: "removed", level: "station", network: network, station: as.Code, start: time.Time(as.StartDate)})
+	}
+
+	return changes
+}
+
+func diffChannels(network, station string, a, z []ChannelType) []stationChange {
+	var changes []stationChange
+
+	channels := make(map[string]*ChannelType)
+	for i := range a {
+		channels[epochKey(a[i].LocationCode+"."+a[i].Code, a[i].StartDate)] = &a[i]
+	}
+
+	for i := range z {
+		zc := &z[i]
+		c := stationChange{network: network, station: station, location: zc.LocationCode, channel: zc.Code, start: time.Time(zc.StartDate)}
+
+		k := epochKey(zc.LocationCode+"."+zc.Code, zc.StartDate)
+		ac, ok := channels[k]
+		if !ok {
+			c.change, c.level = "added", "channel"
+			changes = append(changes, c)
+			continue
+		}
+		delete(channels, k)
+
+		ra, rz := ac.Response, zc.Response
+		an, zn := *ac, *zc
+		an.Response, zn.Response = nil, nil
+
+		if !reflect.DeepEqual(an, zn) {
+			c.change, c.level = "changed", "channel"
+			changes = append(changes, c)
+		}
+		if !reflect.DeepEqual(ra, rz) {
+			c.change, c.level = "changed", "response"
+			changes = append(changes, c)
+		}
+	}
+
+	for _, ac := range channels {
+		changes = append(changes, stationChange{change: "removed", level: "channel", network: network, station: station,
+			location: ac.LocationCode, channel: ac.Code, start: time.Time(ac.StartDate)})
+	}
+
+	return changes
+}
+
+func epochKey(code string, start xsdDateTime) string {
+	return code + "|" + time.Time(start).UTC().Format(time.RFC3339Nano)
+}
+
+// networkNode returns a copy of n without the stations and selected counts.
+func networkNode(n *NetworkType) NetworkType {
+	c := *n
+	c.Station = nil
+	c.SelectedNumberStations = 0
+	return c
+}
+
+// stationNode returns a copy of s without the channels and selected counts.
+func stationNode(s *StationType) StationType {
+	c := *s
+	c.Channel = nil
+	c.SelectedNumberChannels = 0
+	return c
+}
+
+// writeStationChanges writes the changes in the same pipe separated style as the station text format.
+func writeStationChanges(b *bytes.Buffer, changes []stationChange) {
+	b.WriteString("#Change | Level | Network | Station | Location | Channel | StartTime\n")
+	for _, c := range changes {
+		fmt.Fprintf(b, "%s|%s|%s|%s|%s|%s|%s\n", c.change, c.level, c.network, c.station, c.location, c.channel,
+			c.start.UTC().Format("2006-01-02T15:04:05"))
+	}
+}
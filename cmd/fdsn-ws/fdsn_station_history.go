@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/kit/weft"
+)
+
+// Previous versions of the station inventory are kept as snapshots in STATION_XML_HISTORY, one file per
+// version named for the modification time of the source xml.  The (non-standard) asof parameter queries
+// the inventory that was being served at a time and the diff endpoint lists the changes between versions.
+// A version is only saved if its content differs from the latest version and the oldest versions are
+// removed to keep at most STATION_XML_HISTORY_VERSIONS.
+
+const (
+	stationHistoryFormat = "20060102T150405.000000000Z"
+	// DEFAULT_HISTORY_VERSIONS is the default number of versions kept in the history.
+	DEFAULT_HISTORY_VERSIONS = 30
+)
+
+var (
+	stationXMLHistory         string // optional directory for previous versions of the station inventory.
+	stationXMLHistoryVersions = DEFAULT_HISTORY_VERSIONS
+	stationHistory            stationHistoryCache
+	stationHistoryLatest      stationHistoryHash
+	errNoHistory              = errors.New("station inventory history is not available")
+	errNoVersion              = errors.New("no station inventory version")
+)
+
+// stationHistoryHash is the content hash of the latest version saved to the history.
+type stationHistoryHash struct {
+	modified time.Time
+	hash     uint64
+	sync.Mutex
+}
+
+// initStationHistoryVersions reads the number of versions to keep from the environment.
+func initStationHistoryVersions() {
+	s := os.Getenv("STATION_XML_HISTORY_VERSIONS")
+	if s == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		log.Printf("Warning: invalid STATION_XML_HISTORY_VERSIONS env variable, use default value %d instead.\n", DEFAULT_HISTORY_VERSIONS)
+		return
+	}
+	stationXMLHistoryVersions = n
+}
+
+// stationHistoryCache holds the last version loaded from the history.
+type stationHistoryCache struct {
+	fdsn     *FDSNStationXML
+	modified time.Time
+	sync.Mutex
+}
+
+// stationHistoryPath returns the history file name for the inventory modified at modified.
+func stationHistoryPath(modified time.Time) string {
+	return filepath.Join(stationXMLHistory, modified.UTC().Format(stationHistoryFormat)+".snapshot")
+}
+
+// saveStationHistory adds the inventory to the history if it differs from the latest version, logging any errors.
+func saveStationHistory(f *FDSNStationXML, modified time.Time) {
+	if stationXMLHistory == "" {
+		return
+	}
+
+	path := stationHistoryPath(modified)
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+
+	hash, err := hashStationInventory(f)
+	if err != nil {
+		log.Printf("Error saving station history %s: %s\n", path, err)
+		return
+	}
+
+	stationHistoryLatest.Lock()
+	defer stationHistoryLatest.Unlock()
+
+	if stationHistoryLatest.modified.IsZero() {
+		// after a restart hash the latest version in the history.
+		if versions, err := stationHistoryFiles(); err == nil && len(versions) > 0 {
+			latest := versions[len(versions)-1]
+			if v, _, _, err := loadStationSnapshot(stationHistoryPath(latest)); err == nil {
+				if h, err := hashStationInventory(v); err == nil {
+					stationHistoryLatest.modified, stationHistoryLatest.hash = latest, h
+				}
+			}
+		}
+	}
+
+	if !stationHistoryLatest.modified.IsZero() && stationHistoryLatest.hash == hash {
+		log.Printf("Station inventory modified %s is unchanged from the version modified %s, not adding it to the history\n",
+			modified.UTC().Format(time.RFC3339), stationHistoryLatest.modified.Format(time.RFC3339))
+		return
+	}
+
+	if err := saveStationSnapshot(path, f, modified, stationXMLKeys); err != nil {
+		log.Printf("Error saving station history %s: %s\n", path, err)
+		return
+	}
+	stationHistoryLatest.modified, stationHistoryLatest.hash = modified.UTC(), hash
+
+	pruneStationHistory()
+}
+
+// pruneStationHistory removes the oldest versions to keep stationXMLHistoryVersions, logging any errors.
+func pruneStationHistory() {
+	versions, err := stationHistoryFiles()
+	if err != nil {
+		log.Printf("Error reading station history %s: %s\n", stationXMLHistory, err)
+		return
+	}
+
+	for i := 0; i < len(versions)-stationXMLHistoryVersions; i++ {
+		if err := os.Remove(stationHistoryPath(versions[i])); err != nil {
+			log.Printf("Error removing station history version: %s\n", err)
+		}
+	}
+}
+
+// stationHistoryFiles returns the modification times of the inventory versions in the history, oldest first.
+func stationHistoryFiles() ([]time.Time, error) {
+	files, err := os.ReadDir(stationXMLHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []time.Time
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".snapshot") {
+			continue
+		}
+		t, err := time.Parse(stationHistoryFormat, strings.TrimSuffix(name, ".snapshot"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, t)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Before(versions[j]) })
+
+	return versions, nil
+}
+
+// stationVersions returns the modification times of the inventory versions in the history
+// and the version being served, oldest first.
+func stationVersions() ([]time.Time, error) {
+	current := fdsnStations.lastModified().UTC()
+
+	if stationXMLHistory == "" {
+		return []time.Time{current}, nil
+	}
+
+	files, err := stationHistoryFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []time.Time
+	for _, t := range files {
+		if !t.Equal(current) {
+			versions = append(versions, t)
+		}
+	}
+
+	versions = append(versions, current)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Before(versions[j]) })
+
+	return versions, nil
+}
+
+// stationInventoryAsOf returns the inventory that was being served at asof, the latest version
+// modified at or before asof.
+func stationInventoryAsOf(asof time.Time) (*FDSNStationXML, time.Time, error) {
+	fdsnStations.RLock()
+	current, modified := fdsnStations.fdsn, fdsnStations.modified
+	fdsnStations.RUnlock()
+
+	if !asof.Before(modified) {
+		return current, modified, nil
+	}
+
+	if stationXMLHistory == "" {
+		return nil, time.Time{}, errNoHistory
+	}
+
+	versions, err := stationVersions()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].After(asof) })
+	if i == 0 {
+		return nil, time.Time{}, errNoVersion
+	}
+	version := versions[i-1]
+
+	stationHistory.Lock()
+	defer stationHistory.Unlock()
+
+	if stationHistory.fdsn == nil || !stationHistory.modified.Equal(version) {
+		f, m, _, err := loadStationSnapshot(stationHistoryPath(version))
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		stationHistory.fdsn, stationHistory.modified = f, m
+	}
+
+	return stationHistory.fdsn, stationHistory.modified, nil
+}
+
+// stationVersionsHandler lists the station inventory versions, one modification time per line.
+func stationVersionsHandler(r *http.Request, h http.Header, b *bytes.Buffer) error {
+	err := weft.CheckQuery(r, []string{"GET"}, []string{}, []string{})
+	if err != nil {
+		return err
+	}
+
+	versions, err := stationVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		b.WriteString(v.Format(time.RFC3339Nano) + "\n")
+	}
+	h.Set("Content-Type", "text/plain")
+
+	return nil
+}
+
+// stationDiffHandler lists the changes between the inventory that was served at from and
+// the inventory served at to (defaults to now).
+func stationDiffHandler(r *http.Request, h http.Header, b *bytes.Buffer) error {
+	err := weft.CheckQuery(r, []string{"GET"}, []string{"from"}, []string{"to"})
+	if err != nil {
+		return err
+	}
+
+	v := r.URL.Query()
+
+	var from, to fdsn.WsDateTime
+	if err := from.UnmarshalText([]byte(v.Get("from"))); err != nil {
+		return weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("invalid from: %s", v.Get("from"))}
+	}
+	to.Time = time.Now().UTC()
+	if s := v.Get("to"); s != "" {
+		if err := to.UnmarshalText([]byte(s)); err != nil {
+			return weft.StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf("invalid to: %s", s)}
+		}
+	}
+
+	// Loading another version replaces the cached version but doesn't change it so a can still be used.
+	a, aModified, err := stationInventoryAsOf(from.Time)
+	if err != nil {
+		return stationHistoryError(err, from.Time)
+	}
+	z, zModified, err := stationInventoryAsOf(to.Time)
+	if err != nil {
+		return stationHistoryError(err, to.Time)
+	}
+
+	fmt.Fprintf(b, "#From %s to %s\n", aModified.UTC().Format(time.RFC3339Nano), zModified.UTC().Format(time.RFC3339Nano))
+	writeStationChanges(b, diffStationXML(a, z))
+
+	h.Set("Content-Type", "text/plain")
+
+	return nil
+}
+
+// stationHistoryError returns the http error for err from stationInventoryAsOf.
+func stationHistoryError(err error, asof time.Time) error {
+	switch err {
+	case errNoHistory:
+		return weft.StatusError{Code: http.StatusBadRequest, Err: err}
+	case errNoVersion:
+		return weft.StatusError{Code: http.StatusNotFound, Err: fmt.Errorf("%w as of %s", err, asof.Format(time.RFC3339))}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffStationXML(t *testing.T) {
+	a := validateTestXML(t)
+	z := validateTestXML(t)
+
+	z.Network = append(z.Network, z.Network[0])
+	z.Network[1].Code = "XX"
+	z.Network[1].Station = nil
+
+	nz := &z.Network[0]
+	nz.Station = nz.Station[:1]
+	nz.Station[0].Channel[0].Azimuth.Value = 90
+	nz.Station[0].Channel[1].Response.InstrumentSensitivity.Value *= 2
+
+	var b bytes.Buffer
+	writeStationChanges(&b, diffStationXML(a, z))
+
+	expected := `#Change | Level | Network | Station | Location | Channel | StartTime
+changed|response|NZ|ARAZ|10|EHN|2007-05-20T23:00:00
+changed|channel|NZ|ARAZ|10|EHZ|2007-05-20T23:00:00
+removed|station|NZ|ARHZ|||2010-03-11T00:00:00
+added|network|XX||||1884-02-01T00:00:00
+`
+	if b.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+
+	if c := diffStationXML(a, a); len(c) != 0 {
+		t.Errorf("expected no changes got %d", len(c))
+	}
+}
+
+func TestStationHistory(t *testing.T) {
+	fdsnStations.RLock()
+	history, previous, previousModified := stationXMLHistory, fdsnStations.fdsn, fdsnStations.modified
+	fdsnStations.RUnlock()
+	defer func() {
+		stationXMLHistory = history
+		fdsnStations.set(previous, previousModified)
+	}()
+	stationXMLHistory = t.TempDir()
+	stationHistoryLatest.modified = time.Time{}
+
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	v1 := validateTestXML(t)
+	saveStationHistory(v1, t1)
+
+	v2 := validateTestXML(t)
+	v2.Network[0].Station = v2.Network[0].Station[:1]
+	fdsnStations.set(v2, t2)
+	saveStationHistory(v2, t2)
+
+	versions, err := stationVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || !versions[0].Equal(t1) || !versions[1].Equal(t2) {
+		t.Errorf("unexpected versions %v", versions)
+	}
+
+	f, modified, err := stationInventoryAsOf(t1.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !modified.Equal(t1) || len(f.Network[0].Station) != 2 {
+		t.Errorf("expected the first version got %s with %d stations", modified, len(f.Network[0].Station))
+	}
+
+	if _, modified, _ = stationInventoryAsOf(t2.Add(time.Hour)); !modified.Equal(t2) {
+		t.Errorf("expected the current version got %s", modified)
+	}
+
+	if _, _, err = stationInventoryAsOf(t1.Add(-time.Hour)); err != errNoVersion {
+		t.Errorf("expected errNoVersion got %v", err)
+	}
+
+	b := new(bytes.Buffer)
+	r := httptest.NewRequest("GET", "/stationhistory/1/diff?from=2024-01-02T00:00:00", nil)
+	if err := stationDiffHandler(r, http.Header{}, b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "removed|station|NZ|ARHZ|") {
+		t.Errorf("expected ARHZ to be removed got:\n%s", b.String())
+	}
+
+	b.Reset()
+	r = httptest.NewRequest("GET", "/fdsnws/station/1/query?station=ARHZ&asof=2024-01-02T00:00:00&format=text", nil)
+	if err := fdsnStationV1Handler(r, http.Header{}, b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "NZ|ARHZ|") {
+		t.Errorf("expected ARHZ as of the first version got:\n%s", b.String())
+	}
+
+	r = httptest.NewRequest("GET", "/fdsnws/station/1/query?station=ARHZ&format=text", nil)
+	if err := fdsnStationV1Handler(r, http.Header{}, b); err == nil {
+		t.Error("expected no data for ARHZ in the current version")
+	}
+}
+
+func TestStationHistoryRetention(t *testing.T) {
+	history, keep := stationXMLHistory, stationXMLHistoryVersions
+	defer func() {
+		stationXMLHistory, stationXMLHistoryVersions = history, keep
+		stationHistoryLatest.modified = time.Time{}
+	}()
+	stationXMLHistory = t.TempDir()
+	stationXMLHistoryVersions = 2
+	stationHistoryLatest.modified = time.Time{}
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	f := validateTestXML(t)
+	saveStationHistory(f, t0)
+
+	// an unchanged inventory with a new modification time is not saved.
+	saveStationHistory(validateTestXML(t), t0.Add(time.Hour))
+
+	versions, err := stationHistoryFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || !versions[0].Equal(t0) {
+		t.Fatalf("expected only the first version got %v", versions)
+	}
+
+	// or after a restart.
+	stationHistoryLatest.modified = time.Time{}
+	saveStationHistory(validateTestXML(t), t0.Add(2*time.Hour))
+
+	if versions, _ = stationHistoryFiles(); len(versions) != 1 {
+		t.Fatalf("expected only the first version after a restart got %v", versions)
+	}
+
+	// the oldest versions are removed.
+	for i := 1; i <= 3; i++ {
+		f.Network[0].Station[0].Site.Name = fmt.Sprintf("site %d", i)
+		saveStationHistory(f, t0.Add(time.Duration(i)*24*time.Hour))
+	}
+
+	if versions, _ = stationHistoryFiles(); len(versions) != 2 || !versions[0].Equal(t0.Add(48*time.Hour)) {
+		t.Errorf("expected the two latest versions got %v", versions)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const stationKMLIcon = "https://maps.google.com/mapfiles/kml/shapes/triangle.png"
+
+// stationKMLColours are the icon colours (aabbggrr) for each network, in turn.
+var stationKMLColours = []string{
+	"ff0000ff", // red
+	"ffff0000", // blue
+	"ff00aa00", // green
+	"ff00aaff", // orange
+	"ffaa00aa", // purple
+	"ffaaaa00", // teal
+}
+
+// marshalKML writes the stations in r as KML.  Each network is a folder with its own style and
+// each station epoch is a placemark with a time span.
+func (r *FDSNStationXML) marshalKML() (*bytes.Buffer, error) {
+	k := kml{Document: kmlDocument{Name: "FDSN stations"}}
+
+	for i, net := range r.Network {
+		style := "network-" + net.Code
+		k.Document.Style = append(k.Document.Style, kmlStyle{
+			ID: style,
+			IconStyle: kmlIconStyle{
+				Color: stationKMLColours[i%len(stationKMLColours)],
+				Icon:  kmlIcon{Href: stationKMLIcon},
+			},
+		})
+
+		folder := kmlFolder{Name: net.Code}
+		if net.Description != "" {
+			folder.Name = net.Code + " " + net.Description
+		}
+
+		for _, sta := range net.Station {
+			p := kmlPlacemark{
+				Name:        sta.Code,
+				Description: fmt.Sprintf("%s\nNetwork: %s\nElevation: %gm", sta.Site.Name, net.Code, sta.Elevation.Value),
+				StyleURL:    "#" + style,
+				TimeSpan:    &kmlTimeSpan{Begin: time.Time(sta.StartDate).UTC().Format(kmlTimeFormat)},
+				Point: kmlPoint{Coordinates: strconv.FormatFloat(sta.Longitude.Value, 'f', -1, 64) + "," +
+					strconv.FormatFloat(sta.Latitude.Value, 'f', -1, 64)},
+			}
+			if end := time.Time(sta.EndDate); !end.IsZero() && end.Before(emptyDateTime) {
+				p.TimeSpan.End = end.UTC().Format(kmlTimeFormat)
+			}
+
+			folder.Placemark = append(folder.Placemark, p)
+		}
+
+		k.Document.Folder = append(k.Document.Folder, folder)
+	}
+
+	var b bytes.Buffer
+	if err := k.marshal(&b); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMarshalKML(t *testing.T) {
+	v, err := url.ParseQuery("level=station")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseStationV1(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := *validateTestXML(t)
+	c.doFilter([]fdsnStationV1Search{p})
+
+	b, err := c.marshalKML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var k kml
+	if err := xml.Unmarshal(b.Bytes(), &k); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(k.Document.Style) != 1 || k.Document.Style[0].ID != "network-NZ" {
+		t.Errorf("expected a style for network NZ got %+v", k.Document.Style)
+	}
+	if len(k.Document.Folder) != 1 || len(k.Document.Folder[0].Placemark) != 2 {
+		t.Fatalf("expected 1 folder with 2 placemarks got %+v", k.Document.Folder)
+	}
+
+	pm := k.Document.Folder[0].Placemark[0]
+	if pm.Name != "ARAZ" || pm.StyleURL != "#network-NZ" || pm.Point.Coordinates != "176.12006,-38.62769" {
+		t.Errorf("unexpected placemark %+v", pm)
+	}
+	if pm.TimeSpan == nil || pm.TimeSpan.Begin != "2007-05-20T23:00:00Z" || pm.TimeSpan.End != "" {
+		t.Errorf("unexpected time span %+v", pm.TimeSpan)
+	}
+	if !strings.Contains(pm.Description, "Aratiatia Landcorp Farm") {
+		t.Errorf("expected the site name in the description got %q", pm.Description)
+	}
+}
+
+func TestEventKMLScale(t *testing.T) {
+	for _, v := range []struct{ magnitude, scale float64 }{{0.5, 0.4}, {2.5, 1}, {6, 2.4}} {
+		if s := eventKMLScale(v.magnitude); s != v.scale {
+			t.Errorf("magnitude %g expected scale %g got %g", v.magnitude, v.scale, s)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// STATION_XML_META_KEY can be a comma separated list of sources, e.g., one per network or partner agency.
+// The sources are merged into one inventory.  Sources earlier in the list take precedence:
+//
+//   - the Source, Sender, Module, and ModuleURI are from the first source, Created is the latest.
+//   - networks with the same code and overlapping epochs are merged, the network's attributes are from
+//     the first source to have it.
+//   - a station in a merged network with the same code and an overlapping epoch as a station from an earlier
+//     source is skipped, along with its channels.
+
+// mergeStationXML merges sources, named by keys, into one inventory.  The sources are changed.
+func mergeStationXML(keys []string, sources []*FDSNStationXML) *FDSNStationXML {
+	if len(sources) == 0 {
+		return &FDSNStationXML{}
+	}
+
+	m := sources[0]
+
+	for i, f := range sources[1:] {
+		key := keys[i+1]
+
+		if time.Time(f.Created).After(time.Time(m.Created)) {
+			m.Created = f.Created
+		}
+
+		for _, net := range f.Network {
+			n := findNetworkEpoch(m.Network, net)
+			if n < 0 {
+				m.Network = append(m.Network, net)
+				continue
+			}
+
+			existing := &m.Network[n]
+			for _, sta := range net.Station {
+				if findStationEpoch(existing.Station, sta) {
+					log.Printf("station xml %s: station %s.%s starting %s overlaps an earlier source, skipping it.\n",
+						key, net.Code, sta.Code, time.Time(sta.StartDate).Format(time.RFC3339))
+					continue
+				}
+				existing.Station = append(existing.Station, sta)
+				existing.TotalNumberStations++
+			}
+		}
+	}
+
+	return m
+}
+
+// findNetworkEpoch returns the index of the network in n with the same code as net and an
+// overlapping epoch, or -1 if there isn't one.
+func findNetworkEpoch(n []NetworkType, net NetworkType) int {
+	e := newEpoch(net.Code, net.BaseNodeType)
+	for i := range n {
+		if e.overlaps(newEpoch(n[i].Code, n[i].BaseNodeType)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findStationEpoch returns true if s has a station with the same code as sta and an overlapping epoch.
+func findStationEpoch(s []StationType, sta StationType) bool {
+	e := newEpoch(sta.Code, sta.BaseNodeType)
+	for i := range s {
+		if e.overlaps(newEpoch(s[i].Code, s[i].BaseNodeType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps returns true if e and o have the same id and their time spans overlap.
+func (e epoch) overlaps(o epoch) bool {
+	return e.id == o.id && e.start.Before(o.end) && o.start.Before(e.end)
+}
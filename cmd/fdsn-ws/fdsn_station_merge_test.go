@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeStationXML(t *testing.T) {
+	primary := validateTestXML(t)
+
+	// a partner network.
+	partner := validateTestXML(t)
+	partner.Network[0].Code = "XX"
+	partner.Created = xsdDateTime(time.Time(primary.Created).Add(time.Hour))
+
+	// the same network with one station that overlaps and one that doesn't.
+	same := validateTestXML(t)
+	same.Network[0].Station[1].Code = "MRGZ"
+	same.Network[0].Station[0].Site.Name = "from the later source"
+
+	m := mergeStationXML([]string{"a", "b", "c"}, []*FDSNStationXML{primary, partner, same})
+
+	if len(m.Network) != 2 {
+		t.Fatalf("expected 2 networks got %d", len(m.Network))
+	}
+	if m.Network[0].Code != "NZ" || m.Network[1].Code != "XX" {
+		t.Errorf("expected networks NZ and XX got %s and %s", m.Network[0].Code, m.Network[1].Code)
+	}
+	if !time.Time(m.Created).Equal(time.Time(partner.Created)) {
+		t.Errorf("expected the latest created time got %s", time.Time(m.Created))
+	}
+
+	var codes []string
+	for _, s := range m.Network[0].Station {
+		codes = append(codes, s.Code)
+	}
+	if strings.Join(codes, ",") != "ARAZ,ARHZ,MRGZ" {
+		t.Errorf("expected stations ARAZ,ARHZ,MRGZ got %s", strings.Join(codes, ","))
+	}
+	if m.Network[0].Station[0].Site.Name == "from the later source" {
+		t.Error("expected the earlier source to take precedence")
+	}
+
+	if err := validateStationXML(m, nil); err != nil {
+		t.Errorf("expected the merged station xml to be valid: %s", err)
+	}
+}
+
+func TestReloadStationXMLSources(t *testing.T) {
+	defer reloadTestSetup(t)()
+
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "partner.xml")
+	if err := os.WriteFile(path, []byte(strings.Replace(string(by), `<Network code="NZ"`, `<Network code="XX"`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stationXMLKeys = append(stationXMLKeys, path)
+
+	if err := reloadStationXML(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fdsnStations.fdsn.Network) != 2 {
+		t.Errorf("expected 2 networks from the merged sources got %d", len(fdsnStations.fdsn.Network))
+	}
+}
+
+func TestStationXMLSources(t *testing.T) {
+	k := stationXMLSources(" fdsn-station.xml, partner/xx.xml,,")
+	if strings.Join(k, "|") != "fdsn-station.xml|partner/xx.xml" {
+		t.Errorf("unexpected sources %q", k)
+	}
+}
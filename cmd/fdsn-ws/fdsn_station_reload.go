@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GeoNet/kit/aws/s3"
+	"github.com/GeoNet/kit/weft"
+)
+
+// Reloads of the station xml can be driven by S3 object created notifications received from SQS
+// instead of polling, or forced with an authenticated request to the admin endpoint.
+//
+// An SQS message is only received by one consumer so each replica needs its own queue
+// e.g., queues subscribed (with raw message delivery) to an SNS topic for the bucket notifications.
+
+// stationXMLEvent is an S3 notification received from SQS.
+type stationXMLEvent struct {
+	s3.Event
+}
+
+// Process implements metrics.Processor.  The station xml is reloaded if the notification is for the
+// creation of the station xml.  Notifications for other objects are ignored.
+func (e *stationXMLEvent) Process(msg []byte) error {
+	e.Records = nil
+
+	if err := json.Unmarshal(msg, e); err != nil {
+		return err
+	}
+
+	var reload bool
+	for _, v := range e.Records {
+		if !strings.HasPrefix(v.EventName, "ObjectCreated") || v.S3.Bucket.Name != stationXMLBucket {
+			continue
+		}
+
+		// keys in S3 notifications are url encoded.
+		key, err := url.QueryUnescape(v.S3.Object.Key)
+		if err != nil {
+			key = v.S3.Object.Key
+		}
+
+		for _, k := range stationXMLKeys {
+			if key == k {
+				reload = true
+			}
+		}
+	}
+
+	if !reload {
+		return nil
+	}
+
+	err := reloadStationXML(false)
+	if _, ok := err.(stationXMLProblems); ok {
+		// Redelivery won't help, the file has to be fixed.
+		log.Println("ERROR: rejected station xml:", err)
+		return nil
+	}
+
+	switch err {
+	case nil, errNotModified:
+		return nil
+	default:
+		return fmt.Errorf("error reloading station xml: %w", err)
+	}
+}
+
+// stationReloadHandler forces a reload of the station xml.  Requests must use basic auth with FDSN_KEY as the password.
+// Only the replica that receives the request is reloaded.  Reloads are rejected when station queries use the DB.
+func stationReloadHandler(r *http.Request, h http.Header, b *bytes.Buffer) error {
+	err := weft.CheckQuery(r, []string{"POST"}, []string{}, []string{})
+	if err != nil {
+		return err
+	}
+
+	if !adminAuth(r) {
+		h.Set("WWW-Authenticate", `Basic realm="fdsn-ws admin"`)
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		b.WriteString("unauthorized")
+		return weft.StatusError{Code: http.StatusUnauthorized}
+	}
+
+	if stationDB {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		b.WriteString("station queries use the DB, load the station xml with fdsn-ws -load-stations")
+		return weft.StatusError{Code: http.StatusConflict}
+	}
+
+	if err := reloadStationXML(true); err != nil {
+		if _, ok := err.(stationXMLProblems); ok {
+			h.Set("Content-Type", "text/plain; charset=utf-8")
+			b.WriteString(err.Error())
+			return weft.StatusError{Code: http.StatusUnprocessableEntity, Err: err}
+		}
+		return weft.StatusError{Code: http.StatusInternalServerError, Err: err}
+	}
+
+	h.Set("Content-Type", "text/plain")
+	fmt.Fprintf(b, "station xml reloaded, modified %s\n", fdsnStations.lastModified().Format(time.RFC3339))
+
+	return nil
+}
+
+// adminAuth checks the basic auth password in r matches FDSN_KEY.  Always false if FDSN_KEY is not set.
+func adminAuth(r *http.Request) bool {
+	key := os.Getenv("FDSN_KEY")
+	if key == "" {
+		return false
+	}
+
+	_, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(password), []byte(key)) == 1
+}
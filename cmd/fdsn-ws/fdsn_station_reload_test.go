@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/kit/weft"
+)
+
+// reloadTestSetup uses a local copy of the test station xml as the source xml.
+func reloadTestSetup(t *testing.T) func() {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "fdsn station.xml")
+	if err := os.WriteFile(path, by, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bucket, keys, snapshot := stationXMLBucket, stationXMLKeys, stationXMLSnapshot
+	stationXMLBucket, stationXMLKeys, stationXMLSnapshot = "", []string{path}, ""
+
+	fdsnStations.set(&FDSNStationXML{}, zeroDateTime)
+	stationXMLStatus.set(zeroDateTime, nil)
+
+	return func() {
+		stationXMLBucket, stationXMLKeys, stationXMLSnapshot = bucket, keys, snapshot
+	}
+}
+
+func TestStationXMLEvent(t *testing.T) {
+	defer reloadTestSetup(t)()
+
+	notification := func(name, key string) []byte {
+		return []byte(`{"Records":[{"eventName":"` + name + `","s3":{"bucket":{"name":""},"object":{"key":"` + key + `"}}}]}`)
+	}
+
+	var e stationXMLEvent
+
+	if err := e.Process(notification("ObjectCreated:Put", url.QueryEscape(stationXMLKeys[0]+".old"))); err != nil {
+		t.Fatal(err)
+	}
+	if !fdsnStations.lastModified().Equal(zeroDateTime) {
+		t.Error("expected no reload for a different key")
+	}
+
+	if err := e.Process(notification("ObjectRemoved:Delete", url.QueryEscape(stationXMLKeys[0]))); err != nil {
+		t.Fatal(err)
+	}
+	if !fdsnStations.lastModified().Equal(zeroDateTime) {
+		t.Error("expected no reload for a removed object")
+	}
+
+	if err := e.Process(notification("ObjectCreated:Put", url.QueryEscape(stationXMLKeys[0]))); err != nil {
+		t.Fatal(err)
+	}
+	if fdsnStations.lastModified().Equal(zeroDateTime) {
+		t.Error("expected the station xml to be reloaded")
+	}
+
+	if err := e.Process([]byte(`not json`)); err == nil {
+		t.Error("expected an error for an invalid notification")
+	}
+}
+
+func TestStationReloadHandler(t *testing.T) {
+	defer reloadTestSetup(t)()
+
+	key := os.Getenv("FDSN_KEY")
+	defer func() { _ = os.Setenv("FDSN_KEY", key) }()
+	if err := os.Setenv("FDSN_KEY", "test-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	in := []struct {
+		method, password string
+		code             int
+	}{
+		{http.MethodGet, "test-key", http.StatusMethodNotAllowed},
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "test-key", http.StatusOK},
+	}
+
+	for _, v := range in {
+		r := httptest.NewRequest(v.method, "/admin/station/reload", nil)
+		if v.password != "" {
+			r.SetBasicAuth("admin", v.password)
+		}
+
+		h := http.Header{}
+		err := stationReloadHandler(r, h, &bytes.Buffer{})
+
+		if c := weft.Status(err); c != v.code {
+			t.Errorf("%s %q: expected status %d got %d", v.method, v.password, v.code, c)
+		}
+
+		if v.code == http.StatusUnauthorized && h.Get("WWW-Authenticate") == "" {
+			t.Error("expected a WWW-Authenticate header")
+		}
+	}
+
+	if !fdsnStations.lastModified().After(time.Now().Add(-time.Minute)) {
+		t.Error("expected the station xml to be reloaded")
+	}
+
+	// station queries use the DB, the station xml isn't loaded.
+	stationDB = true
+	defer func() { stationDB = false }()
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/station/reload", nil)
+	r.SetBasicAuth("admin", "test-key")
+
+	if c := weft.Status(stationReloadHandler(r, http.Header{}, &bytes.Buffer{})); c != http.StatusConflict {
+		t.Errorf("expected status %d with STATION_DB got %d", http.StatusConflict, c)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RESP output follows the SEED response blockette layout used by rdseed and read by evalresp:
+// channel identification (blockettes 50 and 52) followed by one block for each response stage,
+// poles and zeros (53), coefficients (54), decimation (57), gain (58) and FIR (61), and the
+// channel sensitivity as stage 0.
+
+const respNoEndTime = "No Ending Time"
+
+// marshalResp writes the response for each channel in r as RESP.
+// Expects r to have been filtered at level=response.
+func (r *FDSNStationXML) marshalResp() *bytes.Buffer {
+	by := bytes.NewBuffer(nil)
+
+	for n := 0; n < len(r.Network); n++ {
+		net := &r.Network[n]
+		for s := 0; s < len(net.Station); s++ {
+			sta := &net.Station[s]
+			for c := 0; c < len(sta.Channel); c++ {
+				cha := &sta.Channel[c]
+				if cha.Response == nil {
+					continue
+				}
+				writeResp(by, net.Code, sta.Code, cha)
+			}
+		}
+	}
+
+	return by
+}
+
+func writeResp(by *bytes.Buffer, network, station string, cha *ChannelType) {
+	h := respHeading{
+		network:  network,
+		station:  station,
+		location: cha.LocationCode,
+		channel:  cha.Code,
+		start:    time.Time(cha.StartDate),
+		end:      time.Time(cha.EndDate),
+	}
+
+	by.WriteString("#\n###################################################################################\n#\n")
+	fmt.Fprintf(by, "B050F03     Station:     %s\n", station)
+	fmt.Fprintf(by, "B050F16     Network:     %s\n", network)
+	fmt.Fprintf(by, "B052F03     Location:    %s\n", respLocation(cha.LocationCode))
+	fmt.Fprintf(by, "B052F04     Channel:     %s\n", cha.Code)
+	fmt.Fprintf(by, "B052F22     Start date:  %s\n", respDate(h.start))
+	fmt.Fprintf(by, "B052F23     End date:    %s\n", respDate(h.end))
+
+	for i := range cha.Response.Stage {
+		stage := &cha.Response.Stage[i]
+		number := i + 1
+		if stage.Number != nil {
+			number = *stage.Number
+		}
+
+		switch {
+		case stage.PolesZeros != nil:
+			h.write(by, "Response (Poles and Zeros)")
+			writeRespPolesZeros(by, number, stage.PolesZeros)
+		case stage.Coefficients != nil:
+			h.write(by, "Response (Coefficients)")
+			writeRespCoefficients(by, number, stage.Coefficients)
+		case stage.FIR != nil:
+			h.write(by, "FIR Response")
+			writeRespFIR(by, number, stage.FIR)
+		case stage.ResponseList != nil || stage.Polynomial != nil:
+			fmt.Fprintf(by, "#\n#  Stage %d: response lists and polynomials are not supported in RESP output\n", number)
+		}
+
+		if d := stage.Decimation; d != nil {
+			h.write(by, "Decimation")
+			fmt.Fprintf(by, "B057F03     Stage sequence number:                 %d\n", number)
+			fmt.Fprintf(by, "B057F04     Input sample rate (HZ):                %s\n", respFloat(d.InputSampleRate.Value))
+			fmt.Fprintf(by, "B057F05     Decimation factor:                     %05d\n", d.Factor)
+			fmt.Fprintf(by, "B057F06     Decimation offset:                     %05d\n", d.Offset)
+			fmt.Fprintf(by, "B057F07     Estimated delay (seconds):             %s\n", respFloat(d.Delay.Value))
+			fmt.Fprintf(by, "B057F08     Correction applied (seconds):          %s\n", respFloat(d.Correction.Value))
+		}
+
+		if g := stage.StageGain; g != nil {
+			h.write(by, "Channel Gain")
+			writeRespGain(by, number, g.Value, g.Frequency)
+		}
+	}
+
+	if s := cha.Response.InstrumentSensitivity; s != nil {
+		h.write(by, "Channel Sensitivity/Gain")
+		writeRespGain(by, 0, s.Value, s.Frequency)
+	}
+}
+
+func writeRespPolesZeros(by *bytes.Buffer, number int, pz *PolesZerosType) {
+	var a0, f0 float64
+	if pz.NormalizationFactor != nil {
+		a0 = *pz.NormalizationFactor
+	}
+	if pz.NormalizationFrequency != nil {
+		f0 = pz.NormalizationFrequency.Value
+	}
+
+	tf := "A"
+	if pz.PzTransferFunctionType != nil {
+		switch *pz.PzTransferFunctionType {
+		case "LAPLACE (HERTZ)":
+			tf = "B"
+		case "DIGITAL (Z-TRANSFORM)":
+			tf = "D"
+		}
+	}
+
+	fmt.Fprintf(by, "B053F03     Transfer function type:                %s\n", tf)
+	fmt.Fprintf(by, "B053F04     Stage sequence number:                 %d\n", number)
+	fmt.Fprintf(by, "B053F05     Response in units lookup:              %s\n", respUnits(pz.InputUnits))
+	fmt.Fprintf(by, "B053F06     Response out units lookup:             %s\n", respUnits(pz.OutputUnits))
+	fmt.Fprintf(by, "B053F07     A0 normalization factor:               %s\n", respFloat(a0))
+	fmt.Fprintf(by, "B053F08     Normalization frequency:               %s\n", respFloat(f0))
+	fmt.Fprintf(by, "B053F09     Number of zeroes:                      %d\n", len(pz.Zero))
+	fmt.Fprintf(by, "B053F14     Number of poles:                       %d\n", len(pz.Pole))
+
+	if len(pz.Zero) > 0 {
+		by.WriteString("#              Complex zeroes:\n")
+		by.WriteString("#              i  real          imag          real_error    imag_error\n")
+		for i, z := range pz.Zero {
+			fmt.Fprintf(by, "B053F10-13 %4d  %s\n", i, respComplex(z))
+		}
+	}
+
+	if len(pz.Pole) > 0 {
+		by.WriteString("#              Complex poles:\n")
+		by.WriteString("#              i  real          imag          real_error    imag_error\n")
+		for i, p := range pz.Pole {
+			fmt.Fprintf(by, "B053F15-18 %4d  %s\n", i, respComplex(p))
+		}
+	}
+}
+
+func writeRespCoefficients(by *bytes.Buffer, number int, cf *CoefficientsType) {
+	tf := "D"
+	if cf.CfTransferFunctionType != nil {
+		switch *cf.CfTransferFunctionType {
+		case "ANALOG (RADIANS/SECOND)":
+			tf = "A"
+		case "ANALOG (HERTZ)":
+			tf = "B"
+		}
+	}
+
+	fmt.Fprintf(by, "B054F03     Transfer function type:                %s\n", tf)
+	fmt.Fprintf(by, "B054F04     Stage sequence number:                 %d\n", number)
+	fmt.Fprintf(by, "B054F05     Response in units lookup:              %s\n", respUnits(cf.InputUnits))
+	fmt.Fprintf(by, "B054F06     Response out units lookup:             %s\n", respUnits(cf.OutputUnits))
+	fmt.Fprintf(by, "B054F07     Number of numerators:                  %d\n", len(cf.Numerator))
+	fmt.Fprintf(by, "B054F10     Number of denominators:                %d\n", len(cf.Denominator))
+
+	if len(cf.Numerator) > 0 {
+		by.WriteString("#              Numerator coefficients:\n")
+		by.WriteString("#              i, coefficient,  error\n")
+		for i, v := range cf.Numerator {
+			fmt.Fprintf(by, "B054F08-09 %4d  %s  %s\n", i, respFloat(v.Value), respError(v.PlusError))
+		}
+	}
+
+	if len(cf.Denominator) > 0 {
+		by.WriteString("#              Denominator coefficients:\n")
+		by.WriteString("#              i, coefficient,  error\n")
+		for i, v := range cf.Denominator {
+			fmt.Fprintf(by, "B054F11-12 %4d  %s  %s\n", i, respFloat(v.Value), respError(v.PlusError))
+		}
+	}
+}
+
+func writeRespFIR(by *bytes.Buffer, number int, fir *FIRType) {
+	symmetry := "A"
+	if fir.Symmetry != nil {
+		switch *fir.Symmetry {
+		case SymmetryOdd:
+			symmetry = "B"
+		case SymmetryEven:
+			symmetry = "C"
+		}
+	}
+
+	fmt.Fprintf(by, "B061F03     Stage sequence number:                 %d\n", number)
+	fmt.Fprintf(by, "B061F04     Response Name:                         %s\n", fir.Name)
+	fmt.Fprintf(by, "B061F05     Symmetry Code:                         %s\n", symmetry)
+	fmt.Fprintf(by, "B061F06     Response in units lookup:              %s\n", respUnits(fir.InputUnits))
+	fmt.Fprintf(by, "B061F07     Response out units lookup:             %s\n", respUnits(fir.OutputUnits))
+	fmt.Fprintf(by, "B061F08     Number of Coefficients:                %d\n", len(fir.NumeratorCoefficient))
+
+	if len(fir.NumeratorCoefficient) > 0 {
+		by.WriteString("#              i, coefficient\n")
+		for i, v := range fir.NumeratorCoefficient {
+			fmt.Fprintf(by, "B061F09    %4d  %s\n", i, respFloat(v.Value))
+		}
+	}
+}
+
+func writeRespGain(by *bytes.Buffer, number int, value float64, frequency *float64) {
+	var f float64
+	if frequency != nil {
+		f = *frequency
+	}
+
+	fmt.Fprintf(by, "B058F03     Stage sequence number:                 %d\n", number)
+	fmt.Fprintf(by, "B058F04     Sensitivity:                           %s\n", respFloat(value))
+	fmt.Fprintf(by, "B058F05     Frequency of sensitivity:              %s\n", respFloat(f))
+	by.WriteString("B058F06     Number of calibrations:                0\n")
+}
+
+// respHeading is the boxed comment written before each blockette.
+type respHeading struct {
+	network, station, location, channel string
+	start, end                          time.Time
+}
+
+func (h respHeading) write(by *bytes.Buffer, title string) {
+	end := respNoEndTime
+	if !h.end.Equal(zeroDateTime) && !h.end.Equal(emptyDateTime) {
+		end = h.end.Format("01/02/2006")
+	}
+
+	by.WriteString("#\n")
+	by.WriteString("#                  +-----------------------------------+\n")
+	fmt.Fprintf(by, "#                  |%s|\n", respCentre(title, 35))
+	fmt.Fprintf(by, "#                  |%s|\n", respCentre(fmt.Sprintf("%-3s %-5s %-2s %-3s", h.network, h.station, h.location, h.channel), 35))
+	fmt.Fprintf(by, "#                  |%s|\n", respCentre(h.start.Format("01/02/2006")+" to "+end, 35))
+	by.WriteString("#                  +-----------------------------------+\n")
+	by.WriteString("#\n")
+}
+
+func respCentre(s string, width int) string {
+	if len(s) >= width {
+		return s[:width]
+	}
+	left := (width - len(s)) / 2
+	return strings.Repeat(" ", left) + s + strings.Repeat(" ", width-len(s)-left)
+}
+
+// respDate formats t as a SEED time "YYYY,DDD,HH:MM:SS".
+func respDate(t time.Time) string {
+	if t.Equal(zeroDateTime) || t.Equal(emptyDateTime) {
+		return respNoEndTime
+	}
+	t = t.UTC()
+	return fmt.Sprintf("%04d,%03d,%s", t.Year(), t.YearDay(), t.Format("15:04:05"))
+}
+
+func respLocation(l string) string {
+	if strings.TrimSpace(l) == "" {
+		return "??"
+	}
+	return l
+}
+
+// respUnits formats units for the unit lookup fields.  evalresp identifies units by the
+// upper case name before the " - " separator.
+func respUnits(u *UnitsType) string {
+	if u == nil {
+		return "UNKNOWN - "
+	}
+	name := strings.ToUpper(u.Name)
+	if name == "COUNT" {
+		name = "COUNTS"
+	}
+	return name + " - " + u.Description
+}
+
+func respFloat(f float64) string {
+	return fmt.Sprintf("%+E", f)
+}
+
+func respError(e *float64) string {
+	if e == nil {
+		return respFloat(0)
+	}
+	return respFloat(*e)
+}
+
+func respComplex(pz PoleZeroType) string {
+	var re, im, reErr, imErr float64
+	if pz.Real != nil {
+		re = pz.Real.Value
+		if pz.Real.PlusError != nil {
+			reErr = *pz.Real.PlusError
+		}
+	}
+	if pz.Imaginary != nil {
+		im = pz.Imaginary.Value
+		if pz.Imaginary.PlusError != nil {
+			imErr = *pz.Imaginary.PlusError
+		}
+	}
+	return fmt.Sprintf("%s  %s  %s  %s", respFloat(re), respFloat(im), respFloat(reErr), respFloat(imErr))
+}
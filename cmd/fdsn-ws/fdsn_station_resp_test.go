@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalResp(t *testing.T) {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadStationXML(bytes.NewBuffer(by), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.fdsn.marshalResp().String()
+
+	for _, exp := range []string{
+		"B050F03     Station:     ARAZ\n",
+		"B050F16     Network:     NZ\n",
+		"B052F04     Channel:     EHZ\n",
+		"B052F22     Start date:  2007,140,23:00:00\n",
+		"B053F03     Transfer function type:                A\n",
+		"B053F05     Response in units lookup:              M/S - \n",
+		"B053F07     A0 normalization factor:               +9.995555E-01\n",
+		"B053F14     Number of poles:                       2\n",
+		"B053F15-18    0  -4.209700E+00  +4.664400E+00  +0.000000E+00  +0.000000E+00\n",
+		"B054F06     Response out units lookup:             COUNTS - \n",
+		"B057F05     Decimation factor:                     00001\n",
+		"B061F08     Number of Coefficients:                65\n",
+		"B061F09       0  +1.315493E-11\n",
+		"B058F03     Stage sequence number:                 0\n",
+	} {
+		if !strings.Contains(resp, exp) {
+			t.Errorf("expected RESP to contain %q", exp)
+		}
+	}
+}
+
+func TestValidStationFormat(t *testing.T) {
+	in := []struct {
+		format, level string
+		valid         bool
+	}{
+		{"xml", "response", true},
+		{"text", "channel", true},
+		{"text", "response", true},
+		{"extendedtext", "channel", true},
+		{"extendedtext", "station", false},
+		{"resp", "response", true},
+		{"resp", "channel", false},
+		{"sacpz", "response", true},
+		{"sacpz", "station", false},
+		{"kml", "station", true},
+		{"kml", "channel", false},
+		{"y", "station", false},
+	}
+
+	for _, v := range in {
+		if err := validStationFormat(v.format, v.level); (err == nil) != v.valid {
+			t.Errorf("format %s level %s: expected valid %t got error %v", v.format, v.level, v.valid, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// SAC PZ output gives the response to displacement in meters, in radians per second,
+// from the first poles and zeros stage and the instrument sensitivity of each channel.
+// Zeros are added at the origin to convert velocity or acceleration sensors to displacement
+// and the constant is A0 × sensitivity.
+
+// marshalSacPZ writes SAC pole-zero files for each channel in r.
+// Expects r to have been filtered at level=response.  Channels without a poles and zeros stage
+// or an instrument sensitivity are skipped.
+func (r *FDSNStationXML) marshalSacPZ(created time.Time) *bytes.Buffer {
+	by := bytes.NewBuffer(nil)
+
+	for n := 0; n < len(r.Network); n++ {
+		net := &r.Network[n]
+		for s := 0; s < len(net.Station); s++ {
+			sta := &net.Station[s]
+			for c := 0; c < len(sta.Channel); c++ {
+				writeSacPZ(by, net.Code, sta, &sta.Channel[c], created)
+			}
+		}
+	}
+
+	return by
+}
+
+// sacPZ is a response to displacement in radians per second.
+type sacPZ struct {
+	zeros, poles []complex128
+	a0           float64
+	constant     float64
+}
+
+// newSacPZ returns the SAC PZ for the response or false if the response can't be converted.
+func newSacPZ(res *ResponseType) (sacPZ, bool) {
+	var p sacPZ
+
+	if res == nil || res.InstrumentSensitivity == nil {
+		return p, false
+	}
+
+	var pz *PolesZerosType
+	for i := range res.Stage {
+		if res.Stage[i].PolesZeros != nil {
+			pz = res.Stage[i].PolesZeros
+			break
+		}
+	}
+	if pz == nil {
+		return p, false
+	}
+
+	scale := 1.0
+	if pz.PzTransferFunctionType != nil {
+		switch *pz.PzTransferFunctionType {
+		case "LAPLACE (RADIANS/SECOND)":
+		case "LAPLACE (HERTZ)":
+			scale = 2.0 * math.Pi
+		default:
+			return p, false
+		}
+	}
+
+	p.a0 = 1.0
+	if pz.NormalizationFactor != nil {
+		p.a0 = *pz.NormalizationFactor
+	}
+
+	for _, z := range pz.Zero {
+		p.zeros = append(p.zeros, complex(scale, 0)*poleZero(z))
+	}
+	for _, v := range pz.Pole {
+		p.poles = append(p.poles, complex(scale, 0)*poleZero(v))
+	}
+
+	// scaling s by 2π for each pole and zero changes the normalization by 2π^(poles-zeros).
+	p.a0 *= math.Pow(scale, float64(len(p.poles)-len(p.zeros)))
+
+	// each integration from the sensor input units to displacement adds a zero at the origin.
+	for i := 0; i < sacPZZeros(res.InstrumentSensitivity.InputUnits); i++ {
+		p.zeros = append(p.zeros, 0)
+	}
+
+	p.constant = p.a0 * res.InstrumentSensitivity.Value
+
+	return p, true
+}
+
+// sacPZZeros returns the number of zeros needed to convert units to displacement.
+func sacPZZeros(u *UnitsType) int {
+	if u == nil {
+		return 0
+	}
+
+	switch strings.ToLower(strings.ReplaceAll(u.Name, " ", "")) {
+	case "m/s":
+		return 1
+	case "m/s**2", "m/s2", "m/s/s", "m/(s**2)":
+		return 2
+	}
+
+	return 0
+}
+
+func poleZero(pz PoleZeroType) complex128 {
+	var re, im float64
+	if pz.Real != nil {
+		re = pz.Real.Value
+	}
+	if pz.Imaginary != nil {
+		im = pz.Imaginary.Value
+	}
+	return complex(re, im)
+}
+
+func writeSacPZ(by *bytes.Buffer, network string, sta *StationType, cha *ChannelType, created time.Time) {
+	p, ok := newSacPZ(cha.Response)
+	if !ok {
+		return
+	}
+
+	sens := cha.Response.InstrumentSensitivity
+
+	var inputUnits, outputUnits, instType, sampleRate, dip, azimuth string
+	if sens.InputUnits != nil {
+		inputUnits = sens.InputUnits.Name
+	}
+	if sens.OutputUnits != nil {
+		outputUnits = sens.OutputUnits.Name
+	}
+	if cha.Sensor != nil {
+		instType = cha.Sensor.Type
+	}
+	if cha.SampleRate != nil {
+		sampleRate = fmt.Sprintf("%g", cha.SampleRate.Value)
+	}
+	if cha.Dip != nil {
+		// SAC measures inclination from vertical (up).
+		dip = fmt.Sprintf("%.1f", cha.Dip.Value+90.0)
+	}
+	if cha.Azimuth != nil {
+		azimuth = fmt.Sprintf("%.1f", cha.Azimuth.Value)
+	}
+
+	end := time.Time(cha.EndDate)
+	if end.Equal(zeroDateTime) || end.Equal(emptyDateTime) {
+		end = time.Date(2599, 12, 31, 23, 59, 59, 0, time.UTC)
+	}
+
+	by.WriteString("* **********************************\n")
+	fmt.Fprintf(by, "* NETWORK   (KNETWK): %s\n", network)
+	fmt.Fprintf(by, "* STATION    (KSTNM): %s\n", sta.Code)
+	fmt.Fprintf(by, "* LOCATION   (KHOLE): %s\n", cha.LocationCode)
+	fmt.Fprintf(by, "* CHANNEL   (KCMPNM): %s\n", cha.Code)
+	fmt.Fprintf(by, "* CREATED           : %s\n", created.UTC().Format(sacPZTimeFormat))
+	fmt.Fprintf(by, "* START             : %s\n", time.Time(cha.StartDate).UTC().Format(sacPZTimeFormat))
+	fmt.Fprintf(by, "* END               : %s\n", end.UTC().Format(sacPZTimeFormat))
+	fmt.Fprintf(by, "* DESCRIPTION       : %s\n", sta.Site.Name)
+	fmt.Fprintf(by, "* LATITUDE          : %.6f\n", cha.Latitude.Value)
+	fmt.Fprintf(by, "* LONGITUDE         : %.6f\n", cha.Longitude.Value)
+	fmt.Fprintf(by, "* ELEVATION         : %.1f\n", cha.Elevation.Value)
+	fmt.Fprintf(by, "* DEPTH             : %.1f\n", cha.Depth.Value)
+	fmt.Fprintf(by, "* DIP               : %s\n", dip)
+	fmt.Fprintf(by, "* AZIMUTH           : %s\n", azimuth)
+	fmt.Fprintf(by, "* SAMPLE RATE       : %s\n", sampleRate)
+	by.WriteString("* INPUT UNIT        : M\n")
+	fmt.Fprintf(by, "* OUTPUT UNIT       : %s\n", outputUnits)
+	fmt.Fprintf(by, "* INSTTYPE          : %s\n", instType)
+	fmt.Fprintf(by, "* SENSITIVITY       : %e (%s)\n", sens.Value, inputUnits)
+	fmt.Fprintf(by, "* A0                : %e\n", p.a0)
+	by.WriteString("* **********************************\n")
+
+	fmt.Fprintf(by, "ZEROS\t%d\n", len(p.zeros))
+	for _, z := range p.zeros {
+		fmt.Fprintf(by, "\t%+e\t%+e\n", real(z), imag(z))
+	}
+	fmt.Fprintf(by, "POLES\t%d\n", len(p.poles))
+	for _, v := range p.poles {
+		fmt.Fprintf(by, "\t%+e\t%+e\n", real(v), imag(v))
+	}
+	fmt.Fprintf(by, "CONSTANT\t%e\n", p.constant)
+	by.WriteString("\n")
+}
+
+const sacPZTimeFormat = "2006-01-02T15:04:05"
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"math/cmplx"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalSacPZ(t *testing.T) {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadStationXML(bytes.NewBuffer(by), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pz := s.fdsn.marshalSacPZ(time.Date(2017, 9, 26, 2, 37, 17, 0, time.UTC)).String()
+
+	for _, exp := range []string{
+		"* STATION    (KSTNM): ARAZ\n",
+		"* CHANNEL   (KCMPNM): EHZ\n",
+		"* CREATED           : 2017-09-26T02:37:17\n",
+		"* INPUT UNIT        : M\n",
+		"* SENSITIVITY       : 7.457473e+07 (m/s)\n",
+		"ZEROS\t3\n",
+		"POLES\t2\n\t-4.209700e+00\t+4.664400e+00\n\t-4.209700e+00\t-4.664400e+00\n",
+		"CONSTANT\t7.454158e+07\n",
+	} {
+		if !strings.Contains(pz, exp) {
+			t.Errorf("expected SAC PZ to contain %q", exp)
+		}
+	}
+}
+
+// The SAC PZ response to displacement at the sensitivity frequency should be the
+// sensitivity to velocity × 2πf.
+func TestSacPZResponse(t *testing.T) {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadStationXML(bytes.NewBuffer(by), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := s.fdsn.Network[0].Station[0].Channel[0].Response
+
+	p, ok := newSacPZ(res)
+	if !ok {
+		t.Fatal("expected a SAC PZ for the channel response")
+	}
+
+	f := *res.InstrumentSensitivity.Frequency
+
+	h := complex(p.constant, 0)
+	w := complex(0, 2.0*math.Pi*f)
+	for _, z := range p.zeros {
+		h *= w - z
+	}
+	for _, v := range p.poles {
+		h /= w - v
+	}
+
+	exp := res.InstrumentSensitivity.Value * 2.0 * math.Pi * f
+	if math.Abs(cmplx.Abs(h)-exp)/exp > 0.01 {
+		t.Errorf("expected displacement response %e at %g Hz got %e", exp, f, cmplx.Abs(h))
+	}
+}
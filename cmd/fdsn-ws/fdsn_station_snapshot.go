@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// The station snapshot is a compact binary copy of the parsed FDSNStationXML tree.
+// Decoding it is much faster than unmarshaling the source xml so new containers can start
+// serving from the snapshot while the xml is checked for updates in the background.
+//
+// gob is not used as it drops pointers to zero values (e.g. number="0" on a pole) which
+// would change the xml served from the snapshot.
+//
+// File layout: magic, format version, a hash of the station type layout, S3 modification time of
+// the source xml, the source keys that were merged, then the tree encoded field by field in struct
+// order.  Pointers are prefixed by a presence byte and slices and strings by their length.
+const (
+	snapshotMagic   = "FDSNSNAP"
+	snapshotVersion = 3 // increment when the encoding changes.
+)
+
+var (
+	errSnapshotFormat = errors.New("unrecognised station snapshot format")
+	dateTimeType      = reflect.TypeOf(xsdDateTime{})
+	// snapshotLayout changes whenever the station types do so a snapshot written
+	// by a version with different types is never decoded.
+	snapshotLayout = typeLayoutHash(reflect.TypeOf(FDSNStationXML{}))
+)
+
+// typeLayoutHash returns a hash of the names, kinds, and fields of t and the types it contains.
+func typeLayoutHash(t reflect.Type) uint64 {
+	h := fnv.New64a()
+	seen := make(map[reflect.Type]bool)
+
+	var layout func(t reflect.Type)
+	layout = func(t reflect.Type) {
+		_, _ = fmt.Fprintf(h, "%s %s", t.Kind(), t.String())
+
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice:
+			_, _ = io.WriteString(h, "{")
+			layout(t.Elem())
+			_, _ = io.WriteString(h, "}")
+		case reflect.Struct:
+			if seen[t] {
+				return
+			}
+			seen[t] = true
+
+			_, _ = io.WriteString(h, "{")
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				_, _ = fmt.Fprintf(h, "%s:", f.Name)
+				layout(f.Type)
+				_, _ = io.WriteString(h, ";")
+			}
+			_, _ = io.WriteString(h, "}")
+		}
+	}
+	layout(t)
+
+	return h.Sum64()
+}
+
+// saveStationSnapshot writes f, merged from the source keys, to path.  The file is written to a
+// temporary file and renamed so that readers never see a partial snapshot.
+func saveStationSnapshot(path string, f *FDSNStationXML, modified time.Time, sources []string) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriterSize(tmp, 1<<20)
+	e := snapshotEncoder{w: w}
+
+	e.bytes([]byte(snapshotMagic))
+	e.uvarint(snapshotVersion)
+	e.uint64(snapshotLayout)
+	e.time(modified)
+	e.value(reflect.ValueOf(sources))
+	e.value(reflect.ValueOf(f).Elem())
+
+	if e.err != nil {
+		return e.err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadStationSnapshot reads a snapshot written by saveStationSnapshot.  It returns the inventory,
+// the source modification time, and the source keys.
+func loadStationSnapshot(path string) (*FDSNStationXML, time.Time, []string, error) {
+	file, err := os.Open(path) // nolint:gosec
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	d := snapshotDecoder{r: bufio.NewReaderSize(file, 1<<20)}
+
+	magic := make([]byte, len(snapshotMagic))
+	d.read(magic)
+	if d.err == nil && string(magic) != snapshotMagic {
+		return nil, time.Time{}, nil, errSnapshotFormat
+	}
+	if v := d.uvarint(); d.err == nil && v != snapshotVersion {
+		return nil, time.Time{}, nil, fmt.Errorf("station snapshot version %d, expected %d", v, snapshotVersion)
+	}
+	if l := d.uint64(); d.err == nil && l != snapshotLayout {
+		return nil, time.Time{}, nil, errors.New("station snapshot was written with different station types")
+	}
+	modified := d.time()
+
+	var sources []string
+	d.value(reflect.ValueOf(&sources).Elem())
+
+	var f FDSNStationXML
+	d.value(reflect.ValueOf(&f).Elem())
+
+	if d.err != nil {
+		return nil, time.Time{}, nil, d.err
+	}
+
+	return &f, modified, sources, nil
+}
+
+// hashStationInventory returns a hash of the content of f.
+func hashStationInventory(f *FDSNStationXML) (uint64, error) {
+	h := fnv.New64a()
+	w := bufio.NewWriterSize(h, 1<<16)
+	e := snapshotEncoder{w: w}
+
+	e.value(reflect.ValueOf(f).Elem())
+
+	if e.err != nil {
+		return 0, e.err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+
+	return h.Sum64(), nil
+}
+
+type snapshotEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *snapshotEncoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *snapshotEncoder) uvarint(u uint64) {
+	e.bytes(e.buf[:binary.PutUvarint(e.buf[:], u)])
+}
+
+func (e *snapshotEncoder) uint64(u uint64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], u)
+	e.bytes(e.buf[:8])
+}
+
+func (e *snapshotEncoder) varint(i int64) {
+	e.bytes(e.buf[:binary.PutVarint(e.buf[:], i)])
+}
+
+func (e *snapshotEncoder) time(t time.Time) {
+	e.varint(t.Unix())
+	e.uvarint(uint64(t.Nanosecond()))
+}
+
+func (e *snapshotEncoder) value(v reflect.Value) {
+	if e.err != nil {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == dateTimeType {
+			e.time(time.Time(v.Interface().(xsdDateTime)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			e.value(v.Field(i))
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.bytes([]byte{0})
+			return
+		}
+		e.bytes([]byte{1})
+		e.value(v.Elem())
+	case reflect.Slice:
+		e.uvarint(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			e.value(v.Index(i))
+		}
+	case reflect.String:
+		e.uvarint(uint64(v.Len()))
+		e.bytes([]byte(v.String()))
+	case reflect.Float64:
+		e.uint64(math.Float64bits(v.Float()))
+	case reflect.Int:
+		e.varint(v.Int())
+	case reflect.Bool:
+		if v.Bool() {
+			e.bytes([]byte{1})
+		} else {
+			e.bytes([]byte{0})
+		}
+	default:
+		e.err = fmt.Errorf("station snapshot: unsupported type %s", v.Type())
+	}
+}
+
+type snapshotDecoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *snapshotDecoder) read(b []byte) {
+	if d.err == nil {
+		_, d.err = io.ReadFull(d.r, b)
+	}
+}
+
+func (d *snapshotDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	var b byte
+	b, d.err = d.r.ReadByte()
+	return b
+}
+
+func (d *snapshotDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var u uint64
+	u, d.err = binary.ReadUvarint(d.r)
+	return u
+}
+
+func (d *snapshotDecoder) uint64() uint64 {
+	var b [8]byte
+	d.read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+func (d *snapshotDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var i int64
+	i, d.err = binary.ReadVarint(d.r)
+	return i
+}
+
+func (d *snapshotDecoder) time() time.Time {
+	s := d.varint()
+	n := d.uvarint()
+	return time.Unix(s, int64(n)).UTC()
+}
+
+// length reads a slice or string length, guarding against allocating from a corrupt file.
+func (d *snapshotDecoder) length() int {
+	n := d.uvarint()
+	if d.err == nil && n > math.MaxInt32 {
+		d.err = errSnapshotFormat
+	}
+	return int(n)
+}
+
+func (d *snapshotDecoder) value(v reflect.Value) {
+	if d.err != nil {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == dateTimeType {
+			v.Set(reflect.ValueOf(xsdDateTime(d.time())))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			d.value(v.Field(i))
+		}
+	case reflect.Ptr:
+		switch d.byte() {
+		case 0:
+		case 1:
+			p := reflect.New(v.Type().Elem())
+			d.value(p.Elem())
+			v.Set(p)
+		default:
+			if d.err == nil {
+				d.err = errSnapshotFormat
+			}
+		}
+	case reflect.Slice:
+		n := d.length()
+		if n == 0 || d.err != nil {
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			d.value(s.Index(i))
+		}
+		v.Set(s)
+	case reflect.String:
+		n := d.length()
+		if n == 0 || d.err != nil {
+			return
+		}
+		b := make([]byte, n)
+		d.read(b)
+		v.SetString(string(b))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(d.uint64()))
+	case reflect.Int:
+		v.SetInt(d.varint())
+	case reflect.Bool:
+		v.SetBool(d.byte() == 1)
+	default:
+		d.err = fmt.Errorf("station snapshot: unsupported type %s", v.Type())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStationSnapshot(t *testing.T) {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := time.Date(2017, 9, 26, 2, 37, 17, 0, time.UTC)
+
+	s, err := loadStationXML(bytes.NewBuffer(by), modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "fdsn-station.snap")
+
+	sources := []string{"fdsn-station-test.xml", "partner.xml"}
+
+	if err := saveStationSnapshot(path, s.fdsn, modified, sources); err != nil {
+		t.Fatal(err)
+	}
+
+	f, m, k, err := loadStationSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(k, sources) {
+		t.Errorf("expected sources %v got %v", sources, k)
+	}
+
+	if !m.Equal(modified) {
+		t.Errorf("expected modified %s got %s", modified, m)
+	}
+
+	if !reflect.DeepEqual(s.fdsn, f) {
+		t.Error("station snapshot does not match the source xml")
+	}
+
+	// the served xml must be identical, including pointers to zero values e.g., <Pole number="0">
+	expected, err := xml.Marshal(s.fdsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := xml.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(expected, got) {
+		t.Error("xml marshaled from the station snapshot does not match the source xml")
+	}
+
+	if !bytes.Contains(got, []byte(`<Pole number="0">`)) {
+		t.Error("expected pole number 0 to survive the station snapshot")
+	}
+}
+
+func TestStationSnapshotInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fdsn-station.snap")
+
+	if err := os.WriteFile(path, []byte(`<?xml version="1.0" encoding="UTF-8"?>`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := loadStationSnapshot(path); err == nil {
+		t.Error("expected an error loading an invalid station snapshot")
+	}
+
+	if _, _, _, err := loadStationSnapshot(filepath.Join(t.TempDir(), "missing.snap")); err == nil {
+		t.Error("expected an error loading a missing station snapshot")
+	}
+}
+
+func TestStationSnapshotLayout(t *testing.T) {
+	if typeLayoutHash(reflect.TypeOf(FDSNStationXML{})) != snapshotLayout {
+		t.Error("expected the same layout hash for the same types")
+	}
+
+	type before struct {
+		Code string
+		Pole []PoleZeroType
+	}
+	type after struct {
+		Code   string
+		Pole   []PoleZeroType
+		Number *int
+	}
+
+	if typeLayoutHash(reflect.TypeOf(before{})) == typeLayoutHash(reflect.TypeOf(after{})) {
+		t.Error("expected a different layout hash when a field is added")
+	}
+
+	// a snapshot written with different types is not loaded.
+	path := filepath.Join(t.TempDir(), "fdsn-station.snap")
+
+	if err := saveStationSnapshot(path, &FDSNStationXML{}, time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	by, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the layout hash follows the magic and the one byte version.
+	by[len(snapshotMagic)+1] ^= 0xff
+
+	if err := os.WriteFile(path, by, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err := loadStationSnapshot(path); err == nil {
+		t.Error("expected an error loading a snapshot written with different station types")
+	}
+}
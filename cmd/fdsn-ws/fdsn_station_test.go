@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/xml"
+	"math"
 	"net/url"
 	"strings"
 	"testing"
 
+	"github.com/GeoNet/fdsn/internal/archive"
 	_ "github.com/GeoNet/fdsn/internal/fdsn"
 	wt "github.com/GeoNet/kit/weft/wefttest"
 )
@@ -807,3 +809,110 @@ func makeTestChannel(code, locationCode string) ChannelType {
 		LocationCode: locationCode,
 	}
 }
+
+func TestStationPolygon(t *testing.T) {
+	// a rough outline around Taupo, ARAZ is inside and ARHZ is outside.
+	for _, q := range []string{
+		"polygon=-37.5,175.8,-37.5,177.2,-39.3,176.0,-39.3,175.4&level=channel",
+		"polygon=POLYGON((175.8 -37.5, 177.2 -37.5, 176.0 -39.3, 175.4 -39.3, 175.8 -37.5))&level=channel",
+	} {
+		v, err := url.ParseQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := parseStationV1(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := *validateTestXML(t)
+		c.doFilter([]fdsnStationV1Search{e})
+
+		if len(c.Network) != 1 || len(c.Network[0].Station) != 1 || c.Network[0].Station[0].Code != "ARAZ" {
+			t.Errorf("%s: expected station ARAZ only", q)
+		}
+	}
+
+	vs, err := parseStationV1Post(`polygon=-39.0,176.5,-39.0,177.5,-39.5,177.5,-39.5,176.5
+		NZ * * * * *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := *validateTestXML(t)
+	c.doFilter(vs)
+
+	if len(c.Network) != 1 || len(c.Network[0].Station) != 1 || c.Network[0].Station[0].Code != "ARHZ" {
+		t.Error("POST: expected station ARHZ only")
+	}
+
+	v := url.Values{}
+	v.Set("polygon", "-38,176,-38,177")
+	if _, err := parseStationV1(v); err == nil {
+		t.Error("expected an error for a polygon with two points")
+	}
+}
+
+func TestIncludeRestricted(t *testing.T) {
+	defer func() { restrictedData = nil }()
+
+	stations := func(q string) []string {
+		v, err := url.ParseQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := parseStationV1(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := *validateTestXML(t)
+		c.doFilter([]fdsnStationV1Search{e})
+
+		var s []string
+		for _, n := range c.Network {
+			for _, st := range n.Station {
+				s = append(s, st.Code)
+			}
+		}
+		return s
+	}
+
+	// ARAZ is closed.
+	if s := stations("level=channel"); len(s) != 2 {
+		t.Errorf("expected both stations got %v", s)
+	}
+	if s := stations("level=channel&includerestricted=false"); len(s) != 1 || s[0] != "ARHZ" {
+		t.Errorf("expected ARHZ only got %v", s)
+	}
+
+	restrictedData = []archive.StreamAccess{{Network: "NZ", Station: "AR?Z"}}
+
+	if s := stations("level=station"); len(s) != 2 {
+		t.Errorf("expected both stations got %v", s)
+	}
+	if s := stations("level=station&includerestricted=false"); len(s) != 0 {
+		t.Errorf("expected no stations got %v", s)
+	}
+}
+
+func TestGreatCircleDegrees(t *testing.T) {
+	in := []struct {
+		id                     string
+		lat1, lon1, lat2, lon2 float64
+		expected               float64
+	}{
+		{id: loc(), lat1: -38.6, lon1: 176.1, lat2: -38.6, lon2: 176.1, expected: 0.0},
+		{id: loc(), lat1: 0.0, lon1: 0.0, lat2: 0.0, lon2: 90.0, expected: 90.0},
+		{id: loc(), lat1: 0.0, lon1: 179.0, lat2: 0.0, lon2: -179.0, expected: 2.0},
+		{id: loc(), lat1: -90.0, lon1: 0.0, lat2: 90.0, lon2: 0.0, expected: 180.0},
+		{id: loc(), lat1: 38.6, lon1: -3.9, lat2: -38.6, lon2: 176.1, expected: 180.0},
+		{id: loc(), lat1: -41.0, lon1: 175.0, lat2: -42.0, lon2: 175.0, expected: 1.0},
+	}
+
+	for _, v := range in {
+		if d := greatCircleDegrees(v.lat1, v.lon1, v.lat2, v.lon2); math.Abs(d-v.expected) > 1e-9 {
+			t.Errorf("%s expected %f got %f", v.id, v.expected, d)
+		}
+	}
+}
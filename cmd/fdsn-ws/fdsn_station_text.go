@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Non-standard text formats.  At level=response the text is a summary of each response stage,
+// one line per stage with the channel sensitivity as stage 0, the same as RESP.  format=extendedtext
+// at level=channel adds the sensor and datalogger models and serial numbers to the channel text.
+
+const (
+	channelTextHeader  = "#Network | Station | Location | Channel | Latitude | Longitude | Elevation | Depth | Azimuth | Dip | SensorDescription | Scale | ScaleFreq | ScaleUnits | SampleRate | StartTime | EndTime"
+	extendedTextHeader = channelTextHeader + " | SensorModel | SensorSerialNumber | DataloggerModel | DataloggerSerialNumber"
+	responseTextHeader = "#Network | Station | Location | Channel | StartTime | EndTime | Stage | StageType | InputUnits | OutputUnits | Gain | GainFrequency | DecimationInputSampleRate | DecimationFactor"
+)
+
+// marshalResponseText writes a summary of the response stages for each channel in r.
+// Expects r to have been filtered at level=response.
+func (r *FDSNStationXML) marshalResponseText() *bytes.Buffer {
+	by := bytes.NewBuffer(nil)
+	by.WriteString(responseTextHeader + "\n")
+
+	for n := 0; n < len(r.Network); n++ {
+		net := &r.Network[n]
+		for s := 0; s < len(net.Station); s++ {
+			sta := &net.Station[s]
+			for c := 0; c < len(sta.Channel); c++ {
+				cha := &sta.Channel[c]
+				prefix := fmt.Sprintf("%s|%s|%s|%s|%s|%s", net.Code, sta.Code, cha.LocationCode, cha.Code,
+					cha.StartDate.MarshalFormatText(), cha.EndDate.MarshalFormatText())
+
+				if cha.Response == nil {
+					fmt.Fprintf(by, "%s||||||||\n", prefix)
+					continue
+				}
+
+				if s := cha.Response.InstrumentSensitivity; s != nil {
+					fmt.Fprintf(by, "%s|0|Sensitivity|%s|%s|%s|%s||\n", prefix,
+						unitsName(s.InputUnits), unitsName(s.OutputUnits), textFloat(s.Value), textFrequency(s.Frequency))
+				}
+
+				for i := range cha.Response.Stage {
+					stage := &cha.Response.Stage[i]
+					number := i + 1
+					if stage.Number != nil {
+						number = *stage.Number
+					}
+
+					kind, filter := stageFilter(stage)
+
+					var gain, frequency string
+					if g := stage.StageGain; g != nil {
+						gain, frequency = textFloat(g.Value), textFrequency(g.Frequency)
+					}
+
+					var rate, factor string
+					if d := stage.Decimation; d != nil {
+						rate, factor = textFloat(d.InputSampleRate.Value), fmt.Sprintf("%d", d.Factor)
+					}
+
+					var input, output string
+					if filter != nil {
+						input, output = unitsName(filter.InputUnits), unitsName(filter.OutputUnits)
+					}
+
+					fmt.Fprintf(by, "%s|%d|%s|%s|%s|%s|%s|%s|%s\n", prefix, number, kind, input, output, gain, frequency, rate, factor)
+				}
+			}
+		}
+	}
+
+	return by
+}
+
+// marshalExtendedText writes the channel text with the sensor and datalogger equipment for each channel in r.
+// Expects r to have been filtered at level=channel.
+func (r *FDSNStationXML) marshalExtendedText() *bytes.Buffer {
+	by := bytes.NewBuffer(nil)
+	by.WriteString(extendedTextHeader + "\n")
+
+	for n := 0; n < len(r.Network); n++ {
+		net := &r.Network[n]
+		for s := 0; s < len(net.Station); s++ {
+			sta := &net.Station[s]
+			if len(sta.Channel) == 0 {
+				// Write Station name only
+				fmt.Fprintf(by, "%s|%s|||||||||||||||||||\n", net.Code, sta.Code)
+			}
+			for c := 0; c < len(sta.Channel); c++ {
+				cha := &sta.Channel[c]
+				fmt.Fprintf(by, "%s|%s|%s\n", channelText(net.Code, sta.Code, cha), equipmentText(cha.Sensor), equipmentText(cha.DataLogger))
+			}
+		}
+	}
+
+	return by
+}
+
+// stageFilter returns the type and the filter for a response stage.  The filter is nil for gain only stages.
+func stageFilter(stage *ResponseStageType) (string, *BaseFilterType) {
+	switch {
+	case stage.PolesZeros != nil:
+		return "PolesZeros", &stage.PolesZeros.BaseFilterType
+	case stage.Coefficients != nil:
+		return "Coefficients", &stage.Coefficients.BaseFilterType
+	case stage.FIR != nil:
+		return "FIR", &stage.FIR.BaseFilterType
+	case stage.ResponseList != nil:
+		return "ResponseList", &stage.ResponseList.BaseFilterType
+	case stage.Polynomial != nil:
+		return "Polynomial", &stage.Polynomial.BaseFilterType
+	default:
+		return "Gain", nil
+	}
+}
+
+func equipmentText(e *EquipmentType) string {
+	if e == nil {
+		return "|"
+	}
+	return e.Model + "|" + e.SerialNumber
+}
+
+func unitsName(u *UnitsType) string {
+	if u == nil {
+		return ""
+	}
+	return u.Name
+}
+
+func textFloat(f float64) string {
+	return fmt.Sprintf("%g", f)
+}
+
+func textFrequency(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return textFloat(*f)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResponseText(t *testing.T) {
+	c := stationTextTestXML(t, "station=ARAZ&location=10&channel=EHZ&starttime=2011-06-21T00:00:00&level=response&format=text")
+
+	exp := `#Network | Station | Location | Channel | StartTime | EndTime | Stage | StageType | InputUnits | OutputUnits | Gain | GainFrequency | DecimationInputSampleRate | DecimationFactor
+NZ|ARAZ|10|EHZ|2011-06-20T04:00:01||0|Sensitivity|m/s|count|7.457472512e+07|15||
+NZ|ARAZ|10|EHZ|2011-06-20T04:00:01||1|PolesZeros|m/s|V|177.8|15||
+NZ|ARAZ|10|EHZ|2011-06-20T04:00:01||2|Coefficients|V|count|419430.4|15|100|1
+NZ|ARAZ|10|EHZ|2011-06-20T04:00:01||3|FIR|count|count|1|15|100|1
+`
+	if s := c.marshalText(STATION_LEVEL_RESPONSE).String(); s != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, s)
+	}
+}
+
+func TestExtendedText(t *testing.T) {
+	c := stationTextTestXML(t, "station=ARAZ&location=10&channel=EHZ&endtime=2011-01-01T00:00:00&level=channel&format=extendedtext")
+
+	exp := `#Network | Station | Location | Channel | Latitude | Longitude | Elevation | Depth | Azimuth | Dip | SensorDescription | Scale | ScaleFreq | ScaleUnits | SampleRate | StartTime | EndTime | SensorModel | SensorSerialNumber | DataloggerModel | DataloggerSerialNumber
+NZ|ARAZ|10|EHZ|-38.627690|176.120060|420.000000|0.000000|0.000000|-90.000000|Short Period Seismometer|74574725.120000|15.000000|m/s|100.000000|2007-05-20T23:00:00|2011-03-06T22:00:00|L4C-3D|2989|Q330/3|541
+`
+	if s := c.marshalExtendedText().String(); s != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, s)
+	}
+
+	// the extended columns follow the standard channel text.
+	std := strings.Split(c.marshalText(STATION_LEVEL_CHANNEL).String(), "\n")
+	ext := strings.Split(c.marshalExtendedText().String(), "\n")
+	for i := range std {
+		if !strings.HasPrefix(ext[i], std[i]) {
+			t.Errorf("line %d: expected prefix %s got %s", i, std[i], ext[i])
+		}
+	}
+}
+
+func stationTextTestXML(t *testing.T, query string) FDSNStationXML {
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseStationV1(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := *validateTestXML(t)
+	if !c.doFilter([]fdsnStationV1Search{p}) {
+		t.Fatalf("%s: no match", query)
+	}
+
+	return c
+}
@@ -130,6 +130,7 @@ type ChannelType struct {
 	Type              []Type                  `xml:"Type,omitempty"`
 	SampleRate        *SampleRateType         `xml:"SampleRate,omitempty"`
 	SampleRateRatio   *SampleRateRatioType    `xml:"SampleRateRatio,omitempty"`
+	StorageFormat     storageFormat           `xml:"StorageFormat,omitempty"`
 	ClockDrift        *FloatType              `xml:"ClockDrift,omitempty"`
 	CalibrationUnits  *UnitsType              `xml:"CalibrationUnits,omitempty"`
 	Sensor            *EquipmentType          `xml:"Sensor,omitempty"`
@@ -151,8 +152,19 @@ type Coefficient struct {
 type CoefficientsType struct {
 	BaseFilterType
 	CfTransferFunctionType *CfTransferFunctionType `xml:"CfTransferFunctionType,omitempty"`
-	Numerator              []FloatType             `xml:"Numerator,omitempty"`
-	Denominator            []FloatType             `xml:"Denominator,omitempty"`
+	Numerator              []CoefficientValueType  `xml:"Numerator,omitempty"`
+	Denominator            []CoefficientValueType  `xml:"Denominator,omitempty"`
+}
+
+// Numerator and denominator coefficients.  The number attribute was added in StationXML 1.1,
+// unit is from 1.0 where coefficients were a FloatType.
+type CoefficientValueType struct {
+	Value             float64  `xml:",chardata"`
+	Number            *int     `xml:"number,attr,omitempty"`
+	Unit              string   `xml:"unit,attr,omitempty"`
+	PlusError         *float64 `xml:"plusError,attr,omitempty"`
+	MinusError        *float64 `xml:"minusError,attr,omitempty"`
+	MeasurementMethod string   `xml:"measurementMethod,attr,omitempty"`
 }
 
 type CommentType struct {
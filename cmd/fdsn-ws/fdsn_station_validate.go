@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A station xml that fails validation is not loaded and the previous inventory continues to be served.
+// The result of the last load is reported in /soh.
+
+const (
+	// DEFAULT_MAX_CHANNEL_DROP is the default percentage of channels that can be removed by a reload.
+	DEFAULT_MAX_CHANNEL_DROP = 10
+	// sensitivityTolerance is the allowed relative difference between the instrument sensitivity
+	// and the product of the stage gains when they are given at the same frequency.
+	sensitivityTolerance = 0.05
+	// frequencyTolerance is the relative difference for stage gain and sensitivity frequencies to be the same.
+	frequencyTolerance = 0.001
+	// maxValidationProblems is the number of problems included in the validation error.
+	maxValidationProblems = 10
+)
+
+var (
+	stationXMLMaxDrop = DEFAULT_MAX_CHANNEL_DROP
+	stationXMLStatus  stationLoadStatus
+)
+
+// stationLoadStatus is the result of the last attempt to load the station xml.
+type stationLoadStatus struct {
+	checked  time.Time // when the station xml was last loaded or rejected.
+	modified time.Time // source modification time of the station xml that was checked.
+	err      error     // nil if the station xml was loaded.
+	sync.Mutex
+}
+
+// initStationXMLValidation reads the validation config from the environment.
+func initStationXMLValidation() {
+	s := os.Getenv("STATION_XML_MAX_DROP")
+	if s == "" {
+		return
+	}
+
+	d, err := strconv.Atoi(s)
+	if err != nil || d < 0 || d > 100 {
+		log.Printf("Warning: invalid STATION_XML_MAX_DROP env variable, use default value %d instead.\n", DEFAULT_MAX_CHANNEL_DROP)
+		return
+	}
+	stationXMLMaxDrop = d
+}
+
+func (s *stationLoadStatus) set(modified time.Time, err error) {
+	s.Lock()
+	s.checked = time.Now().UTC()
+	s.modified = modified
+	s.err = err
+	s.Unlock()
+}
+
+// rejected returns the source modification time of the station xml if it failed validation.
+func (s *stationLoadStatus) rejected() (time.Time, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.err.(stationXMLProblems); ok {
+		return s.modified, true
+	}
+	return time.Time{}, false
+}
+
+// html returns the status for /soh.
+func (s *stationLoadStatus) html() string {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.checked.IsZero() {
+		return ""
+	}
+
+	if s.err == nil {
+		return fmt.Sprintf("<p>station xml: loaded at %s, modified %s</p>",
+			s.checked.Format(time.RFC3339), s.modified.UTC().Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("<p>station xml: load failed at %s, serving the previous inventory modified %s: %s</p>",
+		s.checked.Format(time.RFC3339), fdsnStations.lastModified().UTC().Format(time.RFC3339), html.EscapeString(s.err.Error()))
+}
+
+// stationXMLProblems are the reasons a station xml failed validation.
+type stationXMLProblems []string
+
+func (p stationXMLProblems) Error() string {
+	if len(p) > maxValidationProblems {
+		return fmt.Sprintf("station xml failed validation: %s; and %d more problems",
+			strings.Join(p[:maxValidationProblems], "; "), len(p)-maxValidationProblems)
+	}
+
+	return "station xml failed validation: " + strings.Join(p, "; ")
+}
+
+func (p *stationXMLProblems) add(format string, a ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, a...))
+}
+
+// validateStationXML checks f before it replaces previous (which may be nil).  It checks that
+// the elements and values required by the schema are present, that there are networks, that
+// it does not remove too many channels from previous, that epochs do not overlap, and that
+// the instrument sensitivities are consistent with the stage gains.
+func validateStationXML(f, previous *FDSNStationXML) error {
+	var p stationXMLProblems
+
+	if f.Source == "" {
+		p.add("missing Source")
+	}
+	if time.Time(f.Created).IsZero() {
+		p.add("missing Created")
+	}
+	if len(f.Network) == 0 {
+		p.add("no networks")
+	}
+
+	p.checkEpochs("network", "", networkEpochs(f.Network))
+
+	for _, net := range f.Network {
+		if net.Code == "" {
+			p.add("network with no code")
+		}
+		p.checkEpochs("station", net.Code+".", stationEpochs(net.Station))
+
+		for _, sta := range net.Station {
+			id := net.Code + "." + sta.Code
+			if sta.Code == "" {
+				p.add("station with no code in network %s", net.Code)
+			}
+			if sta.Site.Name == "" {
+				p.add("%s: missing Site Name", id)
+			}
+			p.checkLocation(id, sta.Latitude.Value, sta.Longitude.Value)
+			p.checkEpochs("channel", id+".", channelEpochs(sta.Channel))
+
+			for _, cha := range sta.Channel {
+				p.checkChannel(id+"."+cha.LocationCode+"."+cha.Code, cha)
+			}
+		}
+	}
+
+	if previous != nil && stationXMLMaxDrop < 100 {
+		before, after := countChannels(previous), countChannels(f)
+		if before > 0 && after < before && (before-after)*100 > before*stationXMLMaxDrop {
+			p.add("channel count dropped from %d to %d, more than %d%%", before, after, stationXMLMaxDrop)
+		}
+	}
+
+	if len(p) > 0 {
+		return p
+	}
+
+	return nil
+}
+
+func (p *stationXMLProblems) checkLocation(id string, lat, lon float64) {
+	if lat < -90 || lat > 90 {
+		p.add("%s: latitude %g out of range", id, lat)
+	}
+	if lon < -180 || lon > 180 {
+		p.add("%s: longitude %g out of range", id, lon)
+	}
+}
+
+func (p *stationXMLProblems) checkChannel(id string, cha ChannelType) {
+	if cha.Code == "" {
+		p.add("%s: channel with no code", id)
+	}
+	p.checkLocation(id, cha.Latitude.Value, cha.Longitude.Value)
+
+	if cha.Azimuth != nil && (cha.Azimuth.Value < 0 || cha.Azimuth.Value > 360) {
+		p.add("%s: azimuth %g out of range", id, cha.Azimuth.Value)
+	}
+	if cha.Dip != nil && (cha.Dip.Value < -90 || cha.Dip.Value > 90) {
+		p.add("%s: dip %g out of range", id, cha.Dip.Value)
+	}
+	if cha.SampleRate != nil && cha.SampleRate.Value < 0 {
+		p.add("%s: negative sample rate", id)
+	}
+
+	res := cha.Response
+	if res == nil {
+		return
+	}
+
+	for i, s := range res.Stage {
+		if s.Number != nil && *s.Number != i+1 {
+			p.add("%s: stage %d is numbered %d", id, i+1, *s.Number)
+		}
+	}
+
+	if res.InstrumentSensitivity == nil || res.InstrumentSensitivity.Value == 0 || len(res.Stage) == 0 {
+		return
+	}
+
+	freq := res.InstrumentSensitivity.Frequency
+	if freq == nil {
+		return
+	}
+
+	gain := 1.0
+	for _, s := range res.Stage {
+		// Stages without a gain, e.g., polynomials, can't be compared.
+		if s.StageGain == nil || s.StageGain.Value == 0 {
+			return
+		}
+		// The gain of a stage is only the same at the sensitivity frequency if it is given there
+		// e.g., a sensor gain given at 1 Hz differs from its gain at a 15 Hz sensitivity frequency.
+		if s.StageGain.Frequency == nil || math.Abs(*s.StageGain.Frequency-*freq) > frequencyTolerance*math.Abs(*freq) {
+			return
+		}
+		gain *= s.StageGain.Value
+	}
+
+	sens := res.InstrumentSensitivity.Value
+	if math.Abs(gain-sens) > sensitivityTolerance*math.Abs(sens) {
+		p.add("%s: sensitivity %g does not match the product of the stage gains %g", id, sens, gain)
+	}
+}
+
+// epoch is the time span of a network, station or channel.
+type epoch struct {
+	id         string
+	start, end time.Time
+}
+
+func newEpoch(id string, b BaseNodeType) epoch {
+	e := epoch{id: id, start: time.Time(b.StartDate), end: time.Time(b.EndDate)}
+	if e.end.IsZero() {
+		e.end = emptyDateTime
+	}
+	return e
+}
+
+func networkEpochs(n []NetworkType) []epoch {
+	e := make([]epoch, len(n))
+	for i := range n {
+		e[i] = newEpoch(n[i].Code, n[i].BaseNodeType)
+	}
+	return e
+}
+
+func stationEpochs(s []StationType) []epoch {
+	e := make([]epoch, len(s))
+	for i := range s {
+		e[i] = newEpoch(s[i].Code, s[i].BaseNodeType)
+	}
+	return e
+}
+
+func channelEpochs(c []ChannelType) []epoch {
+	e := make([]epoch, len(c))
+	for i := range c {
+		e[i] = newEpoch(c[i].LocationCode+"."+c[i].Code, c[i].BaseNodeType)
+	}
+	return e
+}
+
+// checkEpochs checks that epochs end after they start and that epochs with the same id don't overlap.
+func (p *stationXMLProblems) checkEpochs(kind, prefix string, e []epoch) {
+	for _, v := range e {
+		if v.end.Before(v.start) {
+			p.add("%s %s%s ends before it starts", kind, prefix, v.id)
+		}
+	}
+
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].id != e[j].id {
+			return e[i].id < e[j].id
+		}
+		return e[i].start.Before(e[j].start)
+	})
+
+	for i := 1; i < len(e); i++ {
+		if e[i].id == e[i-1].id && e[i].start.Before(e[i-1].end) {
+			p.add("%s %s%s has overlapping epochs starting %s and %s", kind, prefix, e[i].id,
+				e[i-1].start.Format(time.RFC3339), e[i].start.Format(time.RFC3339))
+		}
+	}
+}
+
+func countChannels(f *FDSNStationXML) (n int) {
+	for _, net := range f.Network {
+		for _, sta := range net.Station {
+			n += len(sta.Channel)
+		}
+	}
+	return
+}
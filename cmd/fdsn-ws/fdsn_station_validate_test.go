@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validateTestXML(t *testing.T) *FDSNStationXML {
+	by, err := os.ReadFile("etc/fdsn-station-test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := loadStationXML(bytes.NewBuffer(by), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s.fdsn
+}
+
+func TestValidateStationXML(t *testing.T) {
+	if err := validateStationXML(validateTestXML(t), nil); err != nil {
+		t.Fatalf("expected the test station xml to be valid: %s", err)
+	}
+
+	in := []struct {
+		id       string
+		change   func(f *FDSNStationXML)
+		previous bool
+		expected string
+	}{
+		{id: loc(), expected: "no networks", change: func(f *FDSNStationXML) {
+			f.Network = nil
+		}},
+		{id: loc(), expected: "missing Source", change: func(f *FDSNStationXML) {
+			f.Source = ""
+		}},
+		{id: loc(), expected: "NZ.ARAZ: latitude -138.6 out of range", change: func(f *FDSNStationXML) {
+			f.Network[0].Station[0].Latitude.Value = -138.6
+		}},
+		{id: loc(), expected: "NZ.ARAZ: missing Site Name", change: func(f *FDSNStationXML) {
+			f.Network[0].Station[0].Site.Name = ""
+		}},
+		{id: loc(), expected: "station NZ.ARAZ has overlapping epochs", change: func(f *FDSNStationXML) {
+			f.Network[0].Station = append(f.Network[0].Station, f.Network[0].Station[0])
+		}},
+		{id: loc(), expected: "channel NZ.ARAZ.10.EHZ ends before it starts", change: func(f *FDSNStationXML) {
+			cha := &f.Network[0].Station[0].Channel[0]
+			cha.EndDate = xsdDateTime(time.Time(cha.StartDate).Add(-time.Hour))
+		}},
+		{id: loc(), expected: "does not match the product of the stage gains", change: func(f *FDSNStationXML) {
+			f.Network[0].Station[0].Channel[0].Response.InstrumentSensitivity.Value *= 2
+		}},
+		{id: loc(), expected: "NZ.ARAZ.10.EHZ: stage 1 is numbered 3", change: func(f *FDSNStationXML) {
+			n := 3
+			f.Network[0].Station[0].Channel[0].Response.Stage[0].Number = &n
+		}},
+		{id: loc(), previous: true, expected: "channel count dropped", change: func(f *FDSNStationXML) {
+			f.Network[0].Station = f.Network[0].Station[1:]
+		}},
+	}
+
+	for _, v := range in {
+		f := validateTestXML(t)
+		v.change(f)
+
+		var previous *FDSNStationXML
+		if v.previous {
+			previous = validateTestXML(t)
+		}
+
+		err := validateStationXML(f, previous)
+		if err == nil {
+			t.Errorf("%s expected a validation error", v.id)
+			continue
+		}
+		if _, ok := err.(stationXMLProblems); !ok {
+			t.Errorf("%s expected stationXMLProblems got %T", v.id, err)
+		}
+		if !strings.Contains(err.Error(), v.expected) {
+			t.Errorf("%s expected error containing %q got %q", v.id, v.expected, err.Error())
+		}
+	}
+}
+
+func TestValidateSensitivityFrequency(t *testing.T) {
+	f := validateTestXML(t)
+
+	// the stage gains are given at 15 Hz, a sensitivity at another frequency can't be compared to them.
+	res := f.Network[0].Station[0].Channel[0].Response
+	freq := 1.0
+	res.InstrumentSensitivity.Value *= 2
+	res.InstrumentSensitivity.Frequency = &freq
+
+	if err := validateStationXML(f, nil); err != nil {
+		t.Errorf("expected no error for a sensitivity at a different frequency to the stage gains got %s", err)
+	}
+
+	res.InstrumentSensitivity.Frequency = nil
+	res.Stage[0].StageGain.Frequency = &freq
+
+	if err := validateStationXML(f, nil); err != nil {
+		t.Errorf("expected no error for a stage gain at a different frequency got %s", err)
+	}
+}
+
+func TestStationXMLProblemsError(t *testing.T) {
+	var p stationXMLProblems
+	for i := 0; i < maxValidationProblems+2; i++ {
+		p.add("problem %d", i)
+	}
+
+	if !strings.HasSuffix(p.Error(), "problem 9; and 2 more problems") {
+		t.Errorf("unexpected error: %s", p.Error())
+	}
+}
+
+func TestReloadStationXMLRejected(t *testing.T) {
+	defer reloadTestSetup(t)()
+
+	if err := reloadStationXML(true); err != nil {
+		t.Fatal(err)
+	}
+	modified := fdsnStations.lastModified()
+
+	if err := os.WriteFile(stationXMLKeys[0], []byte(`<FDSNStationXML schemaVersion="1.2"><Source>GeoNet</Source>`+
+		`<Created>2024-01-01T00:00:00Z</Created></FDSNStationXML>`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := reloadStationXML(true)
+	if _, ok := err.(stationXMLProblems); !ok {
+		t.Fatalf("expected the station xml to be rejected got %v", err)
+	}
+
+	if !fdsnStations.lastModified().Equal(modified) {
+		t.Error("expected the previous inventory to still be served")
+	}
+	if len(fdsnStations.fdsn.Network) != 1 {
+		t.Errorf("expected the previous inventory with 1 network got %d", len(fdsnStations.fdsn.Network))
+	}
+
+	if s := stationXMLStatus.html(); !strings.Contains(s, "load failed") || !strings.Contains(s, "no networks") {
+		t.Errorf("expected the failure in the status got %q", s)
+	}
+}
+
+func loc() string {
+	_, _, l, _ := runtime.Caller(1)
+	return "L" + strconv.Itoa(l)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// The station types hold StationXML 1.2 and also read 1.0 and 1.1.  xml output is 1.2 unless
+// an older schema version is requested with the (non-standard) schemaversion parameter.
+//
+// For 1.1 the sourceID attribute and WaterLevel elements added in 1.2 are removed.  For 1.0 the
+// elements and attributes added in 1.1 are also removed and the elements 1.0 requires that are
+// no longer held are filled in.  The filtered tree shares nested slices and pointers with
+// fdsnStations so they are copied before being changed, never changed in place.
+
+const (
+	stationSchemaVersion = "1.2"
+
+	// storageFormatV10 is the StorageFormat for channels in 1.0 xml, the data is served as miniSEED.
+	storageFormatV10 = "miniSEED"
+
+	stationXMLNamespace = "http://www.fdsn.org/xml/station/1"
+)
+
+// storageFormat is the StorageFormat element required in StationXML 1.0 and removed in 1.1.
+// It is only set for 1.0 output, the value in 1.0 xml that is loaded is ignored.
+type storageFormat string
+
+func (f *storageFormat) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return d.Skip()
+}
+
+// stationSchemaVersions maps the schemaversion parameter to the value of the schemaVersion attribute.
+var stationSchemaVersions = map[string]float64{
+	"1.0": 1.0,
+	"1.1": 1.1,
+	"1.2": 1.2,
+}
+
+// setSchemaVersion sets the schema version for r and removes any elements that are not
+// in that version.
+func (r *FDSNStationXML) setSchemaVersion(version string) {
+	v, ok := stationSchemaVersions[version]
+	if !ok {
+		v = stationSchemaVersions[stationSchemaVersion]
+	}
+
+	r.SchemaVersion = v
+	r.Xmlns = stationXMLNamespace
+
+	if v < 1.2 {
+		r.downgradeV11()
+	}
+
+	if v < 1.1 {
+		r.downgradeV10()
+	}
+}
+
+// downgradeV11 removes the attributes and elements added in StationXML 1.2.
+// r must have been filtered (the Network, Station and Channel slices are copies).
+func (r *FDSNStationXML) downgradeV11() {
+	for n := range r.Network {
+		net := &r.Network[n]
+		net.SourceID = ""
+
+		for s := range net.Station {
+			sta := &net.Station[s]
+			sta.SourceID = ""
+			sta.WaterLevel = nil
+
+			for c := range sta.Channel {
+				cha := &sta.Channel[c]
+				cha.SourceID = ""
+				cha.WaterLevel = nil
+			}
+		}
+	}
+}
+
+// downgradeV10 removes the elements and attributes added in StationXML 1.1 and sets the station
+// CreationDate and channel StorageFormat required by 1.0.  r must have been downgraded to 1.1.
+func (r *FDSNStationXML) downgradeV10() {
+	for n := range r.Network {
+		net := &r.Network[n]
+		net.BaseNodeType = net.BaseNodeType.downgradeV10()
+		net.Operator = nil
+
+		for s := range net.Station {
+			sta := &net.Station[s]
+			sta.BaseNodeType = sta.BaseNodeType.downgradeV10()
+			if time.Time(sta.CreationDate).Equal(zeroDateTime) {
+				sta.CreationDate = sta.StartDate
+			}
+			sta.Latitude.MeasurementMethod = ""
+			sta.Longitude.MeasurementMethod = ""
+			sta.Elevation.MeasurementMethod = ""
+
+			for c := range sta.Channel {
+				cha := &sta.Channel[c]
+				cha.BaseNodeType = cha.BaseNodeType.downgradeV10()
+				cha.StorageFormat = storageFormatV10
+				cha.Latitude.MeasurementMethod = ""
+				cha.Longitude.MeasurementMethod = ""
+				cha.Elevation.MeasurementMethod = ""
+				cha.Depth.MeasurementMethod = ""
+
+				// 1.0 allows a single Equipment element.
+				if len(cha.Equipment) > 1 {
+					cha.Equipment = cha.Equipment[:1:1]
+				}
+
+				cha.Response = cha.Response.downgradeV10()
+			}
+		}
+	}
+}
+
+// downgradeV10 returns a copy of b without the 1.1 attributes and elements.
+func (b BaseNodeType) downgradeV10() BaseNodeType {
+	b.Identifier = nil
+	b.DataAvailability = nil
+
+	for i := range b.Comment {
+		if b.Comment[i].Subject == "" {
+			continue
+		}
+
+		comments := make([]CommentType, len(b.Comment))
+		copy(comments, b.Comment)
+		for j := range comments {
+			comments[j].Subject = ""
+		}
+		b.Comment = comments
+
+		break
+	}
+
+	return b
+}
+
+// downgradeV10 returns r without the coefficient numbers added in 1.1.  r is copied if it is changed.
+func (r *ResponseType) downgradeV10() *ResponseType {
+	if r == nil {
+		return nil
+	}
+
+	var numbered bool
+	for _, s := range r.Stage {
+		if s.Coefficients == nil {
+			continue
+		}
+		for _, c := range s.Coefficients.Numerator {
+			numbered = numbered || c.Number != nil
+		}
+		for _, c := range s.Coefficients.Denominator {
+			numbered = numbered || c.Number != nil
+		}
+	}
+
+	if !numbered {
+		return r
+	}
+
+	res := *r
+	res.Stage = make([]ResponseStageType, len(r.Stage))
+	copy(res.Stage, r.Stage)
+
+	for i := range res.Stage {
+		if res.Stage[i].Coefficients == nil {
+			continue
+		}
+
+		cf := *res.Stage[i].Coefficients
+		cf.Numerator = withoutNumbers(cf.Numerator)
+		cf.Denominator = withoutNumbers(cf.Denominator)
+		res.Stage[i].Coefficients = &cf
+	}
+
+	return &res
+}
+
+func withoutNumbers(c []CoefficientValueType) []CoefficientValueType {
+	if c == nil {
+		return nil
+	}
+
+	out := make([]CoefficientValueType, len(c))
+	copy(out, c)
+	for i := range out {
+		out[i].Number = nil
+	}
+
+	return out
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const stationXMLV12 = `<?xml version="1.0" encoding="UTF-8"?>
+<FDSNStationXML xmlns="http://www.fdsn.org/xml/station/1" schemaVersion="1.2">
+<Source>GeoNet</Source>
+<Created>2023-01-01T00:00:00Z</Created>
+<Network code="NZ" startDate="1884-02-01T00:00:00Z" sourceID="FDSN:NZ">
+<Identifier type="DOI">10.21420/G19Y-9D40</Identifier>
+<Operator><Agency>GNS Science</Agency></Operator>
+<Station code="WEL" startDate="2000-01-01T00:00:00Z" sourceID="FDSN:NZ_WEL">
+<Comment subject="site"><Value>test</Value></Comment>
+<Latitude>-41.28</Latitude><Longitude>174.77</Longitude><Elevation>138</Elevation>
+<Site><Name>Wellington</Name></Site>
+<WaterLevel>0</WaterLevel>
+<Channel code="HHZ" locationCode="10" startDate="2000-01-01T00:00:00Z" sourceID="FDSN:NZ_WEL_10_H_H_Z">
+<Latitude>-41.28</Latitude><Longitude>174.77</Longitude><Elevation>138</Elevation><Depth>0</Depth>
+<Equipment><Type>Sensor</Type></Equipment>
+<Equipment><Type>Datalogger</Type></Equipment>
+<Response>
+<Stage number="1">
+<Coefficients><InputUnits><Name>V</Name></InputUnits><OutputUnits><Name>count</Name></OutputUnits>
+<CfTransferFunctionType>DIGITAL</CfTransferFunctionType>
+<Numerator number="0">1</Numerator>
+</Coefficients>
+</Stage>
+</Response>
+</Channel>
+</Station>
+</Network>
+</FDSNStationXML>`
+
+func TestStationSchemaVersion(t *testing.T) {
+	s, err := loadStationXML(bytes.NewBufferString(stationXMLV12), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshal := func(version string) string {
+		v := url.Values{}
+		v.Set("level", "response")
+		v.Set("schemaversion", version)
+
+		p, err := parseStationV1(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := *s.fdsn
+		if !c.doFilter([]fdsnStationV1Search{p}) {
+			t.Fatal("expected content")
+		}
+		c.setSchemaVersion(p.SchemaVersion)
+
+		by, err := xml.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(by)
+	}
+
+	v11 := []string{
+		`sourceID="FDSN:NZ_WEL"`,
+		`<Identifier type="DOI">10.21420/G19Y-9D40</Identifier>`,
+		`<Operator><Agency>GNS Science</Agency></Operator>`,
+		`subject="site"`,
+		`<WaterLevel>0</WaterLevel>`,
+		`<Type>Datalogger</Type>`,
+		`<Numerator number="0">1</Numerator>`,
+	}
+
+	v12 := marshal("1.2")
+	if !strings.Contains(v12, `schemaVersion="1.2"`) {
+		t.Error("expected schemaVersion 1.2")
+	}
+	for _, e := range v11 {
+		if !strings.Contains(v12, e) {
+			t.Errorf("expected 1.2 xml to contain %s", e)
+		}
+	}
+
+	// the 1.2 additions are removed for 1.1.
+	v12Only := []string{`sourceID=`, `<WaterLevel>`}
+
+	v11x := marshal("1.1")
+	if !strings.Contains(v11x, `schemaVersion="1.1"`) {
+		t.Error("expected schemaVersion 1.1")
+	}
+	for _, e := range v12Only {
+		if strings.Contains(v11x, e) {
+			t.Errorf("expected 1.1 xml not to contain %s", e)
+		}
+	}
+	for _, e := range v11[1:4] {
+		if !strings.Contains(v11x, e) {
+			t.Errorf("expected 1.1 xml to contain %s", e)
+		}
+	}
+	if strings.Contains(v11x, `<StorageFormat>`) || strings.Contains(v12, `<StorageFormat>`) {
+		t.Error("expected StorageFormat only in 1.0 xml")
+	}
+
+	v10 := marshal("1.0")
+	if !strings.Contains(v10, `schemaVersion="1"`) {
+		t.Error("expected schemaVersion 1.0")
+	}
+	for _, e := range v11 {
+		if strings.Contains(v10, e) {
+			t.Errorf("expected 1.0 xml not to contain %s", e)
+		}
+	}
+	if !strings.Contains(v10, `<Type>Sensor</Type>`) || !strings.Contains(v10, `<Numerator>1</Numerator>`) {
+		t.Error("expected 1.0 xml to keep the first equipment and the coefficients")
+	}
+	for _, e := range v12Only {
+		if strings.Contains(v10, e) {
+			t.Errorf("expected 1.0 xml not to contain %s", e)
+		}
+	}
+
+	// elements required in 1.0.
+	for _, e := range []string{
+		`<CreationDate>2000-01-01T00:00:00Z</CreationDate>`,
+		`</Depth><StorageFormat>miniSEED</StorageFormat><Equipment>`,
+	} {
+		if !strings.Contains(v10, e) {
+			t.Errorf("expected 1.0 xml to contain %s", e)
+		}
+	}
+
+	// downgrading must not change the inventory being served.
+	if again := marshal("1.2"); again != v12 {
+		t.Error("1.2 xml changed after a 1.0 request")
+	}
+}
+
+func TestStationSchemaVersionParam(t *testing.T) {
+	for _, v := range []string{"1.0", "1.1", "1.2"} {
+		if _, err := parseStationV1(url.Values{"schemaversion": []string{v}}); err != nil {
+			t.Errorf("schemaversion %s: %s", v, err)
+		}
+	}
+
+	if _, err := parseStationV1(url.Values{"schemaversion": []string{"2.0"}}); err == nil {
+		t.Error("expected an error for schemaversion 2.0")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/fdsn/internal/timeseries"
+	"github.com/GeoNet/kit/weft"
+)
+
+// timeseries fetches data in the same way as dataselect and processes it before it is returned, similar to the
+// IRIS timeseries web service.  The processing is applied to each continuous segment in the order:
+//
+//	demean     remove the mean.
+//	taper      apply a Hann taper to a fraction of each end.
+//	correct    remove the instrument response, or scale to divide by the instrument sensitivity.
+//	bp, lp, hp Butterworth bandpass, lowpass or highpass filters.
+//	decimate   reduce the sample rate.
+
+const (
+	// the maximum number of samples that will be processed for a query.
+	timeseriesMaxSamples        = 2000000
+	timeseriesDefaultPoles      = 4
+	timeseriesDefaultWaterLevel = 60.0
+)
+
+type timeseriesParams struct {
+	demean     bool
+	taper      float64
+	correct    bool
+	scale      bool
+	waterLevel float64 // dB
+	filter     timeseries.Filter
+	decimate   float64 // the new sample rate, zero for no decimation.
+}
+
+// timeseriesHandler handles timeseries queries.  Only GET queries for unrestricted data are supported.
+func timeseriesHandler(r *http.Request, w http.ResponseWriter) (int64, error) {
+	tm := time.Now()
+
+	if r.Method != "GET" {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusMethodNotAllowed}, url: r.URL.String(), timestamp: tm}
+	}
+
+	v := r.URL.Query()
+
+	p, err := parseTimeseries(v)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	d, err := fdsn.ParseDataSelectGet(v)
+	if err != nil {
+		return 0, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	segments, err := timeseriesSegments(r, d, p, tm)
+	if err != nil {
+		return 0, err
+	}
+
+	if d.Format == "miniseed" {
+		w.Header().Set("Content-Type", "application/vnd.fdsn.mseed")
+
+		c := &countWriter{w: w}
+		if err := timeseries.WriteMiniSEED(c, segments); err != nil {
+			return c.n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+		return c.n, nil
+	}
+
+	n, err := writeSegments(w, d.Format, segments)
+	if err != nil {
+		return n, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+	}
+
+	return n, nil
+}
+
+// timeseriesSegments runs the dataselect query d and processes the segments with p.  tm is the time of the request.
+func timeseriesSegments(r *http.Request, d fdsn.DataSelect, p timeseriesParams, tm time.Time) ([]timeseries.Segment, error) {
+	request, files, nrt, err := dataSearches(r, []fdsn.DataSelect{d}, tm, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if files == 0 && !nrt {
+		return nil, fdsnError{StatusError: weft.StatusError{Code: d.NoData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+	}
+
+	var segments []timeseries.Segment
+	var samples int
+
+	for _, v := range request {
+		var records bytes.Buffer
+
+		if _, err := writeRecords(&records, v, tm, nil); err != nil {
+			return nil, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+
+		s, err := decodeSegments(records.Bytes(), v.d)
+		if err != nil {
+			return nil, fdsnError{StatusError: weft.StatusError{Code: http.StatusInternalServerError, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+
+		for _, seg := range s {
+			samples += len(seg.Samples)
+		}
+		if samples > timeseriesMaxSamples {
+			return nil, fdsnError{StatusError: weft.StatusError{Code: http.StatusRequestEntityTooLarge,
+				Err: fmt.Errorf("number of samples exceeded the limit for processing: %d", timeseriesMaxSamples)}, url: r.URL.String(), timestamp: tm}
+		}
+
+		segments = append(segments, s...)
+	}
+
+	if len(segments) == 0 {
+		return nil, fdsnError{StatusError: weft.StatusError{Code: d.NoData, Err: fmt.Errorf("%s", "no results for specified query")}, url: r.URL.String(), timestamp: tm}
+	}
+
+	for i := range segments {
+		if segments[i], err = p.process(segments[i]); err != nil {
+			return nil, fdsnError{StatusError: weft.StatusError{Code: http.StatusBadRequest, Err: err}, url: r.URL.String(), timestamp: tm}
+		}
+	}
+
+	return segments, nil
+}
+
+// parseTimeseries parses the processing parameters in v and removes them, leaving the dataselect parameters.
+func parseTimeseries(v url.Values) (timeseriesParams, error) {
+	p := timeseriesParams{
+		waterLevel: timeseriesDefaultWaterLevel,
+		filter:     timeseries.Filter{Poles: timeseriesDefaultPoles},
+	}
+
+	get := func(key string) string {
+		s := v.Get(key)
+		v.Del(key)
+		return s
+	}
+
+	var err error
+
+	if s := get("demean"); s != "" {
+		if p.demean, err = strconv.ParseBool(s); err != nil {
+			return p, fmt.Errorf("invalid demean: %s", s)
+		}
+	}
+
+	if s := get("taper"); s != "" {
+		if p.taper, err = strconv.ParseFloat(s, 64); err != nil || p.taper < 0 || p.taper > 0.5 {
+			return p, fmt.Errorf("invalid taper: %s (0 to 0.5)", s)
+		}
+	}
+
+	if s := get("correct"); s != "" {
+		if p.correct, err = strconv.ParseBool(s); err != nil {
+			return p, fmt.Errorf("invalid correct: %s", s)
+		}
+	}
+
+	switch s := get("scale"); strings.ToLower(s) {
+	case "":
+	case "auto":
+		p.scale = true
+	default:
+		return p, fmt.Errorf("invalid scale: %s (only auto is supported)", s)
+	}
+
+	if p.correct && p.scale {
+		return p, fmt.Errorf("correct and scale can not be used together")
+	}
+
+	if s := get("waterlevel"); s != "" {
+		if p.waterLevel, err = strconv.ParseFloat(s, 64); err != nil || p.waterLevel <= 0 {
+			return p, fmt.Errorf("invalid waterlevel: %s", s)
+		}
+	}
+
+	bp, lp, hp := get("bp"), get("lp"), get("hp")
+
+	if bp != "" {
+		if lp != "" || hp != "" {
+			return p, fmt.Errorf("bp can not be used with lp or hp")
+		}
+
+		f := strings.Split(bp, "-")
+		if len(f) != 2 {
+			return p, fmt.Errorf("invalid bp: %s (low-high)", bp)
+		}
+		lp, hp = f[1], f[0]
+	}
+
+	if lp != "" {
+		if p.filter.High, err = strconv.ParseFloat(lp, 64); err != nil || p.filter.High <= 0 {
+			return p, fmt.Errorf("invalid lowpass corner: %s", lp)
+		}
+	}
+
+	if hp != "" {
+		if p.filter.Low, err = strconv.ParseFloat(hp, 64); err != nil || p.filter.Low <= 0 {
+			return p, fmt.Errorf("invalid highpass corner: %s", hp)
+		}
+	}
+
+	if p.filter.Low > 0 && p.filter.High > 0 && p.filter.Low >= p.filter.High {
+		return p, fmt.Errorf("the highpass corner must be less than the lowpass corner")
+	}
+
+	if s := get("poles"); s != "" {
+		if p.filter.Poles, err = strconv.Atoi(s); err != nil || p.filter.Poles < 1 || p.filter.Poles > 8 {
+			return p, fmt.Errorf("invalid poles: %s (1 to 8)", s)
+		}
+	}
+
+	if s := get("zerophase"); s != "" {
+		if p.filter.ZeroPhase, err = strconv.ParseBool(s); err != nil {
+			return p, fmt.Errorf("invalid zerophase: %s", s)
+		}
+	}
+
+	if s := get("decimate"); s != "" {
+		if p.decimate, err = strconv.ParseFloat(s, 64); err != nil || p.decimate <= 0 {
+			return p, fmt.Errorf("invalid decimate: %s", s)
+		}
+	}
+
+	return p, nil
+}
+
+// process applies the processing in p to s.
+func (p timeseriesParams) process(s timeseries.Segment) (timeseries.Segment, error) {
+	if p.demean {
+		s = timeseries.Demean(s)
+	}
+
+	if p.taper > 0 {
+		s = timeseries.Taper(s, p.taper)
+	}
+
+	if p.correct || p.scale {
+		cha, ok, err := findChannel(s.Network, s.Station, s.Location, s.Channel, s.Start)
+		if err != nil {
+			return s, err
+		}
+		if !ok || cha.Response == nil || cha.Response.InstrumentSensitivity == nil {
+			return s, fmt.Errorf("no response found for %s at %s", s.ID(), s.Start.Format(time.RFC3339))
+		}
+
+		sens := cha.Response.InstrumentSensitivity
+
+		var units string
+		if sens.InputUnits != nil {
+			units = sens.InputUnits.Name
+		}
+
+		switch {
+		case p.correct:
+			response := func(freqs []float64) ([]complex128, error) {
+				return evalResponse(cha.Response, freqs)
+			}
+
+			var err error
+			if s, err = timeseries.RemoveResponse(s, response, p.waterLevel, units); err != nil {
+				return s, fmt.Errorf("%s: %w", s.ID(), err)
+			}
+		default:
+			if sens.Value == 0 {
+				return s, fmt.Errorf("%s: the instrument sensitivity is zero", s.ID())
+			}
+			s = timeseries.Scale(s, 1/sens.Value, units)
+		}
+	}
+
+	if p.filter.Low > 0 || p.filter.High > 0 {
+		var err error
+		if s, err = p.filter.Apply(s); err != nil {
+			return s, err
+		}
+	}
+
+	if p.decimate > 0 {
+		factor := s.SampleRate / p.decimate
+		if math.Abs(factor-math.Round(factor)) > 1e-6 || math.Round(factor) < 1 {
+			return s, fmt.Errorf("%s: the sample rate %g Hz is not a multiple of the decimated rate %g Hz", s.ID(), s.SampleRate, p.decimate)
+		}
+
+		var err error
+		if s, err = timeseries.Decimate(s, int(math.Round(factor))); err != nil {
+			return s, fmt.Errorf("%s: %w", s.ID(), err)
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/GeoNet/fdsn/internal/timeseries"
+)
+
+func TestParseTimeseries(t *testing.T) {
+	in := []struct {
+		id       string
+		query    string
+		expected timeseriesParams
+		err      bool
+	}{
+		{id: loc(), query: "", expected: timeseriesParams{waterLevel: 60, filter: timeseries.Filter{Poles: 4}}},
+		{id: loc(), query: "demean=true&taper=0.05&correct=true&waterlevel=40",
+			expected: timeseriesParams{demean: true, taper: 0.05, correct: true, waterLevel: 40, filter: timeseries.Filter{Poles: 4}}},
+		{id: loc(), query: "scale=AUTO&bp=0.1-2&poles=2&zerophase=true&decimate=10",
+			expected: timeseriesParams{scale: true, waterLevel: 60, decimate: 10, filter: timeseries.Filter{Low: 0.1, High: 2, Poles: 2, ZeroPhase: true}}},
+		{id: loc(), query: "lp=1", expected: timeseriesParams{waterLevel: 60, filter: timeseries.Filter{High: 1, Poles: 4}}},
+		{id: loc(), query: "hp=1", expected: timeseriesParams{waterLevel: 60, filter: timeseries.Filter{Low: 1, Poles: 4}}},
+		{id: loc(), query: "lp=10&hp=1", expected: timeseriesParams{waterLevel: 60, filter: timeseries.Filter{Low: 1, High: 10, Poles: 4}}},
+		{id: loc(), query: "demean=maybe", err: true},
+		{id: loc(), query: "taper=0.6", err: true},
+		{id: loc(), query: "correct=true&scale=auto", err: true},
+		{id: loc(), query: "scale=2", err: true},
+		{id: loc(), query: "bp=1", err: true},
+		{id: loc(), query: "bp=2-1", err: true},
+		{id: loc(), query: "bp=1-2&lp=3", err: true},
+		{id: loc(), query: "lp=-1", err: true},
+		{id: loc(), query: "poles=9", err: true},
+		{id: loc(), query: "decimate=0", err: true},
+	}
+
+	for _, v := range in {
+		q, err := url.ParseQuery(v.query + "&station=WEL")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := parseTimeseries(q)
+		switch {
+		case v.err && err == nil:
+			t.Errorf("%s: expected an error", v.id)
+		case !v.err && err != nil:
+			t.Errorf("%s: unexpected error %s", v.id, err)
+		case !v.err && p != v.expected:
+			t.Errorf("%s: expected %+v got %+v", v.id, v.expected, p)
+		}
+
+		// only the dataselect parameters are left.
+		if !v.err && (len(q) != 1 || q.Get("station") != "WEL") {
+			t.Errorf("%s: unexpected parameters left %v", v.id, q)
+		}
+	}
+}
+
+func TestTimeseriesProcess(t *testing.T) {
+	s := timeseries.Segment{Network: "NZ", Station: "WEL", Channel: "HHZ", SampleRate: 100}
+	for i := 0; i < 1000; i++ {
+		s.Samples = append(s.Samples, float64(i%10))
+	}
+
+	p := timeseriesParams{demean: true, filter: timeseries.Filter{High: 1, Poles: 4}, decimate: 20}
+
+	r, err := p.process(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.SampleRate != 20 || len(r.Samples) != 200 {
+		t.Errorf("unexpected processed segment rate %g samples %d", r.SampleRate, len(r.Samples))
+	}
+
+	if _, err := (timeseriesParams{decimate: 30}).process(s); err == nil {
+		t.Error("expected an error for a decimated rate that isn't a factor of the sample rate")
+	}
+
+	if _, err := (timeseriesParams{scale: true}).process(s); err == nil {
+		t.Error("expected an error for a channel with no response")
+	}
+}
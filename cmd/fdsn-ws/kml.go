@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+)
+
+// KML output for loading station and event query results into Google Earth.
+// Only the KML 2.2 elements that are used are defined.
+
+const (
+	kmlContentType = "application/vnd.google-earth.kml+xml"
+	kmlNamespace   = "http://www.opengis.net/kml/2.2"
+	kmlTimeFormat  = "2006-01-02T15:04:05Z"
+)
+
+type kml struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name      string         `xml:"name"`
+	Style     []kmlStyle     `xml:"Style,omitempty"`
+	Folder    []kmlFolder    `xml:"Folder,omitempty"`
+	Placemark []kmlPlacemark `xml:"Placemark,omitempty"`
+}
+
+type kmlStyle struct {
+	ID        string       `xml:"id,attr,omitempty"`
+	IconStyle kmlIconStyle `xml:"IconStyle"`
+}
+
+type kmlIconStyle struct {
+	Color string  `xml:"color,omitempty"` // aabbggrr
+	Scale float64 `xml:"scale,omitempty"`
+	Icon  kmlIcon `xml:"Icon"`
+}
+
+type kmlIcon struct {
+	Href string `xml:"href"`
+}
+
+type kmlFolder struct {
+	Name      string         `xml:"name"`
+	Placemark []kmlPlacemark `xml:"Placemark,omitempty"`
+}
+
+type kmlPlacemark struct {
+	Name        string        `xml:"name"`
+	Description string        `xml:"description,omitempty"`
+	StyleURL    string        `xml:"styleUrl,omitempty"`
+	Style       *kmlStyle     `xml:"Style,omitempty"`
+	TimeSpan    *kmlTimeSpan  `xml:"TimeSpan,omitempty"`
+	TimeStamp   *kmlTimeStamp `xml:"TimeStamp,omitempty"`
+	Point       kmlPoint      `xml:"Point"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"` // longitude,latitude[,altitude]
+}
+
+// marshal writes k to b as a KML document.
+func (k kml) marshal(b *bytes.Buffer) error {
+	k.Xmlns = kmlNamespace
+
+	by, err := xml.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	b.WriteString(xml.Header)
+	b.Write(by)
+
+	return nil
+}
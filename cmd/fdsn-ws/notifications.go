@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/GeoNet/kit/aws/sqs"
+	"github.com/GeoNet/kit/metrics"
+)
+
+// receiveNotifications receives messages from queueURL until ctx is cancelled.  p processes each message,
+// which is deleted from the queue unless p returns an error so that it is redelivered.
+// name is the kind of notification in the logs.
+func receiveNotifications(ctx context.Context, sqsClient sqs.SQS, queueURL, name string, p metrics.Processor) {
+	log.Printf("listening for %s notifications", name)
+
+	for {
+		r, err := sqsClient.ReceiveWithContext(ctx, queueURL, 600)
+		if err != nil {
+			switch {
+			case sqs.IsNoMessagesError(err):
+				continue
+			case sqs.Cancelled(err):
+				log.Printf("stopped listening for %s notifications", name)
+				return
+			default:
+				log.Printf("problem receiving %s notification, backing off: %s", name, err)
+				time.Sleep(time.Second * 20)
+			}
+			continue
+		}
+
+		err = metrics.DoProcess(p, []byte(r.Body))
+		if err != nil {
+			log.Printf("problem processing %s notification, skipping deletion for redelivery: %s", name, err)
+			continue
+		}
+
+		err = sqsClient.Delete(queueURL, r.ReceiptHandle)
+		if err != nil {
+			log.Printf("problem deleting %s notification, continuing: %s", name, err)
+		}
+	}
+}
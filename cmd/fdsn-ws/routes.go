@@ -37,13 +37,36 @@ func initRoutes() {
 	// This service implements the dataselect spec from http://www.fdsn.org/webservices/FDSN-WS-Specifications-1.1.pdf.
 	mux.HandleFunc("/fdsnws/dataselect/1/", weft.MakeHandler(fdsnDataselectV1Index, weft.TextError))
 	mux.HandleFunc("/fdsnws/dataselect/1/query", weft.MakeDirectHandler(fdsnDataselectV1Handler, fdsnErrorHandler))
+	mux.HandleFunc("/fdsnws/dataselect/1/queryauth", weft.MakeDirectHandler(fdsnDataselectV1AuthHandler, fdsnErrorHandler))
 	mux.HandleFunc("/fdsnws/dataselect/1/version", weft.MakeHandler(fdsnDataselectVersion, weft.TextError))
 	mux.HandleFunc("/fdsnws/dataselect/1/application.wadl", weft.MakeHandler(fdsnDataselectWadl, weft.TextError))
 
 	mux.HandleFunc("/metrics/fdsnws/dataselect/1/query", weft.MakeHandler(fdsnDataMetricsV1Handler, weft.TextError))
 
+	// differences between the data holdings and the station inventory.
+	mux.HandleFunc("/holdings/1/reconcile", weft.MakeHandler(holdingsReconcileHandler, weft.TextError))
+
 	mux.HandleFunc("/sc3ml", weft.MakeHandler(s3ml, weft.TextError))
 
+	// force a reload of the station xml.
+	mux.HandleFunc("/admin/station/reload", weft.MakeHandler(stationReloadHandler, weft.TextError))
+
+	// evaluate channel responses from the station xml.
+	mux.HandleFunc("/evalresp/1/query", weft.MakeHandler(evalRespHandler, weft.TextError))
+
+	// dataselect data with processing applied.
+	mux.HandleFunc("/timeseries/1/query", weft.MakeDirectHandler(timeseriesHandler, fdsnErrorHandler))
+
+	// plots of dataselect data.
+	mux.HandleFunc("/seismogram/1/query", weft.MakeDirectHandler(seismogramHandler, fdsnErrorHandler))
+
+	// the data, and optionally the metadata, for an event.
+	mux.HandleFunc("/eventdata/1/query", weft.MakeDirectHandler(eventDataHandler, fdsnErrorHandler))
+
+	// previous versions of the station inventory.
+	mux.HandleFunc("/stationhistory/1/versions", weft.MakeHandler(stationVersionsHandler, weft.TextError))
+	mux.HandleFunc("/stationhistory/1/diff", weft.MakeHandler(stationDiffHandler, weft.TextError))
+
 	// handle robots
 	mux.HandleFunc("/robots.txt", weft.MakeHandler(robots, weft.TextError))
 }
@@ -61,7 +84,8 @@ func soh(r *http.Request, h http.Header, b *bytes.Buffer) error {
 		return err
 	}
 
-	b.WriteString("<html><head></head><body>ok</body></html>")
+	// Station xml load failures are reported but don't fail the check, the previous inventory is still served.
+	b.WriteString("<html><head></head><body>ok" + stationXMLStatus.html() + "</body></html>")
 
 	return nil
 }
@@ -13,11 +13,22 @@ import (
 // setup() adds event 2015p768477 to the DB.
 var routes = wt.Requests{
 	{ID: wt.L(), URL: "/sc3ml?eventid=2015p768477", Content: "application/xml"},
+	{ID: wt.L(), URL: "/evalresp/1/query?network=NZ&station=ARAZ&location=10&channel=EHZ&time=2010-01-01T00:00:00", Content: "text/plain"},
+	{ID: wt.L(), URL: "/evalresp/1/query?network=NZ&station=ARAZ&location=10&channel=EHZ&time=2010-01-01T00:00:00&format=json", Content: "application/json"},
+	{ID: wt.L(), URL: "/evalresp/1/query?network=NZ&station=ARAZ&location=10&channel=EHZ&time=2010-01-01T00:00:00&format=png", Content: "image/png"},
+	{ID: wt.L(), URL: "/evalresp/1/query?network=NZ&station=ARAZ&location=10&channel=EHZ&time=1990-01-01T00:00:00", Content: "text/plain; charset=utf-8", Status: http.StatusNotFound},
+	{ID: wt.L(), URL: "/evalresp/1/query?network=NZ&station=ARAZ&location=10&channel=EHZ&format=xml", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/stationhistory/1/versions", Content: "text/plain"},
+	{ID: wt.L(), URL: "/stationhistory/1/diff?from=9000-01-01T00:00:00", Content: "text/plain"},
+	{ID: wt.L(), URL: "/stationhistory/1/diff", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/holdings/1/reconcile?network=NZ&station=ARAZ", Content: "text/plain"},
 
 	// fdsn-ws-event
 	{ID: wt.L(), URL: "/fdsnws/event/1", Content: "text/html"},
 	{ID: wt.L(), URL: "/fdsnws/event/1/", Content: "text/html"},
 	{ID: wt.L(), URL: "/fdsnws/event/1/query?eventid=2015p768477", Content: "application/xml"},
+	{ID: wt.L(), URL: "/fdsnws/event/1/query?eventid=2015p768477&format=kml", Content: "application/vnd.google-earth.kml+xml"},
+	{ID: wt.L(), URL: "/fdsnws/event/1/query?polygon=-40,176,-40,177,-41,177,-41,176", Content: "application/xml"},
 	{ID: wt.L(), URL: "/fdsnws/event/1/version", Content: "text/plain"},
 	{ID: wt.L(), URL: "/fdsnws/event/1/catalogs", Content: "application/xml"},
 	{ID: wt.L(), URL: "/fdsnws/event/1/contributors", Content: "application/xml"},
@@ -39,7 +50,15 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/fdsnws/dataselect/1/query?starttime=1900-01-09T00:00:00&endtime=1900-01-09T01:00:00&network=NZ&station=CHST&location=01&channel=LOG",
 		Content: "text/plain; charset=utf-8",
 		Status:  http.StatusNoContent},
+	// in the near real time window with no records written, nodata is used.
+	{ID: wt.L(), URL: fmt.Sprintf("/fdsnws/dataselect/1/query?starttime=%s&endtime=%s&network=NZ&station=CHST&location=01&channel=LOG&nodata=404",
+		time.Now().UTC().Add(-time.Hour).Format("2006-01-02T15:04:05"), time.Now().UTC().Format("2006-01-02T15:04:05")),
+		Content: "text/plain; charset=utf-8",
+		Status:  http.StatusNotFound},
 	//{ID: wt.L(), URL: "/fdsnws/dataselect/1/query", Content: "text/plain", Status: http.StatusRequestEntityTooLarge},
+	{ID: wt.L(), URL: "/fdsnws/dataselect/1/queryauth?starttime=2016-01-09T00:00:00&endtime=2016-01-09T23:00:00&network=NZ&station=CHST&location=01&channel=LOG",
+		Content: "text/plain; charset=utf-8",
+		Status:  http.StatusUnauthorized},
 	{ID: wt.L(), URL: "/fdsnws/dataselect/1/application.wadl", Content: "application/xml"},
 
 	// fdsn-ws-station
@@ -60,11 +79,22 @@ var routes = wt.Requests{
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=channel&starttime=1900-01-0", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?minlat=-41&maxlon=177", Content: "application/xml"},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=channel&starttime=1900-01-01T00:00:00&format=text", Content: "text/plain"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=response&format=text", Content: "text/plain"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=channel&format=extendedtext", Content: "text/plain"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=station&format=extendedtext", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?format=y", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?station=ARAZ&level=response&format=resp", Content: "text/plain"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?station=ARAZ&level=channel&format=resp", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?station=ARAZ&level=response&format=sacpz", Content: "text/plain"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?station=ARAZ&level=station&format=sacpz", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=station&format=kml", Content: "application/vnd.google-earth.kml+xml"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?level=channel&format=kml", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?net=*&level=network&format=xml", Content: "application/xml"},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?lat=-38.6&lon=176.1", Content: "application/xml"},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?lat=-38.6&lon=176.1&maxradius=1.0", Content: "application/xml"},
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?lat=-38.6&lon=176.1&maxradius=1.0&minradius=0.1", Content: "application/xml"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?polygon=-37.5,175.8,-37.5,177.2,-39.3,176.0,-39.3,175.4", Content: "application/xml"},
+	{ID: wt.L(), URL: "/fdsnws/station/1/query?polygon=-37.5,175.8", Content: "text/plain; charset=utf-8", Status: http.StatusBadRequest},
 	// supporting the includeavailability parameter is optional.  Some clients send the value `false` which is the default.
 	// allow for this by ignoring includeavailability=false
 	{ID: wt.L(), URL: "/fdsnws/station/1/query?net=*&level=network&format=xml&includeavailability=false", Content: "application/xml"},
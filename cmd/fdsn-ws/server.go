@@ -48,7 +48,8 @@ func main() {
 
 	//run as normal service
 	var err error
-	if S3_BUCKET = os.Getenv("S3_BUCKET"); S3_BUCKET == "" {
+	// S3_BUCKET is the default dataselect storage when there are no DATASELECT_ROUTES.
+	if S3_BUCKET = os.Getenv("S3_BUCKET"); S3_BUCKET == "" && os.Getenv("DATASELECT_ROUTES") == "" && !*loadStations && !*reconcileReport {
 		log.Fatal("ERROR: S3_BUCKET environment variable is not set")
 	}
 
@@ -78,13 +79,40 @@ func main() {
 		log.Println("ERROR: problem pinging DB - is it up and contactable? 500s will be served")
 	}
 
+	// load the station xml into the DB and exit.
+	// cmd: ./fdsn-ws -load-stations
+	if *loadStations {
+		if err = runStationLoader(); err != nil {
+			log.Fatalf("error loading the station xml into the DB: %s", err)
+		}
+		return
+	}
+
+	// report the differences between the data holdings and the station inventory and exit.
+	// cmd: ./fdsn-ws -reconcile
+	if *reconcileReport {
+		if err = runReconcile(); err != nil {
+			log.Fatalf("error reconciling the data holdings and the station inventory: %s", err)
+		}
+		return
+	}
+
 	initDataselectTemplate()
+	initDataAuth()
 	initEventTemplate()
 	initStationTemplate()
-	initStationXML()
+
+	// station queries use the DB instead of loading the station xml.
+	if stationDB = os.Getenv("STATION_DB") == "true"; stationDB {
+		fdsnStations.set(&FDSNStationXML{}, zeroDateTime)
+	} else {
+		initStationXML()
+	}
 	initRoutes()
 
-	setupStationXMLUpdater()
+	if !stationDB {
+		setupStationXMLUpdater()
+	}
 
 	log.Println("starting server")
 	server := &http.Server{
@@ -8,6 +8,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/GeoNet/fdsn/internal/archive"
 	"github.com/joho/godotenv"
 )
 
@@ -25,6 +26,7 @@ func setup(t *testing.T) {
 	initRoutes()
 
 	S3_BUCKET = os.Getenv("S3_BUCKET")
+	dataRoutes = archive.DefaultRoutes(S3_BUCKET, s3Client)
 
 	// need a db write user for adding test data.
 	// should use a db r/o user in prod.
@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// StreamAccess matches a network and station with the FDSN wildcards * and ?.
+type StreamAccess struct {
+	Network, Station string
+}
+
+// ParseStreamAccess parses comma separated NET.STA patterns.  An empty string is no patterns.
+func ParseStreamAccess(s string) ([]StreamAccess, error) {
+	var access []StreamAccess
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		p := strings.Split(v, ".")
+		if len(p) != 2 || p[0] == "" || p[1] == "" {
+			return nil, fmt.Errorf("invalid pattern %q, expected NET.STA", v)
+		}
+		for _, c := range p {
+			if _, err := path.Match(c, ""); err != nil || strings.ContainsAny(c, `[]\`) {
+				return nil, fmt.Errorf("invalid pattern %q, only the wildcards * and ? are allowed", v)
+			}
+		}
+
+		access = append(access, StreamAccess{Network: p[0], Station: p[1]})
+	}
+
+	return access, nil
+}
+
+// Matches returns true if the pattern matches network and station.
+func (a StreamAccess) Matches(network, station string) bool {
+	n, _ := path.Match(a.Network, network)
+	s, _ := path.Match(a.Station, station)
+	return n && s
+}
+
+// AnyMatches returns true if any of the patterns in access match network and station.
+func AnyMatches(access []StreamAccess, network, station string) bool {
+	for _, a := range access {
+		if a.Matches(network, station) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// archive is for reading the miniSEED archive served by dataselect and the SeedLink server: which data
+// is served and where its files are stored, finding the files with the holdings, and reading the records
+// in a time window from them.
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/fdsn/internal/holdings"
+)
+
+// File is a miniSEED file in the holdings.
+type File struct {
+	Key   string         // the holdings key, NET.STA.LOC.CHA.D.YYYY.DOY.
+	Start time.Time      // the start of the first record.
+	Index holdings.Index // the record index, nil if there isn't one.
+	Size  int64          // the size of the file the Index was made from.
+}
+
+// Search searches the holdings for the files matching the query, in key order.
+// network, station, channel, and location are matched using POSIX regular expressions.
+// https://www.postgresql.org/docs/9.3/static/functions-matching.html
+// start and end should be set for all queries.  24 hours will be subtracted from the Start time and be added from the End time to include all records
+// in each day long file.
+func Search(db *sql.DB, d fdsn.DataSearch) ([]File, error) {
+	rows, err := db.Query(`WITH s AS (SELECT DISTINCT ON (network, station, channel, location) streamPK
+	FROM fdsn.stream WHERE network ~ $1
+	AND station ~ $2
+	AND channel ~ $3
+	AND location ~ $4)
+	SELECT DISTINCT ON (key) key, start_time, record_index, record_size FROM s JOIN fdsn.holdings USING (streampk)
+	WHERE start_time >= $5
+	AND start_time <= $6
+	AND error_data = false
+	ORDER BY key`,
+		d.Network, d.Station, d.Channel, d.Location, d.Start.Add(time.Hour*-24), d.End.Add(time.Hour*24))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []File
+
+	for rows.Next() {
+		var f File
+		var b []byte
+		var size sql.NullInt64
+
+		if err = rows.Scan(&f.Key, &f.Start, &b, &size); err != nil {
+			return nil, err
+		}
+
+		// an index without the file size can't be checked before it is used.
+		if b != nil && size.Valid {
+			if e := f.Index.UnmarshalBinary(b); e != nil {
+				log.Printf("ignoring the record index for %s: %s", f.Key, e)
+				f.Index = nil
+			} else {
+				f.Size = size.Int64
+			}
+		}
+
+		files = append(files, f)
+	}
+
+	return files, rows.Err()
+}
+
+// Fetch writes the file f from s to b.  When there is a record index only the records that could be in
+// the time window for d are read, the size of the file is read with them.  The whole file is read if the
+// file is not the size the index was made for, or the ranged read fails, e.g., the file has been rewritten.
+func Fetch(s Store, f File, d fdsn.DataSearch, b *bytes.Buffer) error {
+	from, to, ok := f.Index.Range(d.Start, d.End)
+	if !ok {
+		return s.Get(f.Key, b)
+	}
+
+	var size int64
+	var err error
+
+	if from == to {
+		// no records in the time window, as long as the file hasn't changed.
+		size, err = s.Size(f.Key)
+	} else {
+		size, err = s.GetRange(f.Key, from, to, b)
+	}
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return err
+	case err != nil:
+		log.Printf("ranged read failed for %s, reading the whole file: %s", f.Key, err)
+	case size != f.Size:
+		log.Printf("the record index for %s is for %d bytes, the file is %d bytes, reading the whole file", f.Key, f.Size, size)
+	default:
+		return nil
+	}
+
+	b.Reset()
+
+	return s.Get(f.Key, b)
+}
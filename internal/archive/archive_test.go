@@ -0,0 +1,73 @@
+package archive_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+	"github.com/GeoNet/fdsn/internal/fdsn"
+	"github.com/GeoNet/fdsn/internal/holdings"
+)
+
+const recordLen = 512
+
+func TestFetch(t *testing.T) {
+	dir := t.TempDir()
+	key := "NZ.WEL.10.HHZ.D.2024.001"
+
+	// four "records", each filled with its number.
+	var f []byte
+	for i := 0; i < 4; i++ {
+		f = append(f, bytes.Repeat([]byte{byte('0' + i)}, recordLen)...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, key), f, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	index := holdings.Index{
+		{Offset: 0, Start: start},
+		{Offset: 2 * recordLen, Start: start.Add(time.Hour)},
+	}
+
+	in := []struct {
+		id         string
+		index      holdings.Index
+		size       int64
+		start, end time.Duration
+		expected   string
+	}{
+		{id: loc(), start: 0, end: time.Minute, expected: "0123"},
+		{id: loc(), index: index, size: int64(len(f)), start: 0, end: time.Minute, expected: "01"},
+		{id: loc(), index: index, size: int64(len(f)), start: 2 * time.Hour, end: 3 * time.Hour, expected: "23"},
+		{id: loc(), index: index, size: int64(len(f)), start: 30 * time.Minute, end: 90 * time.Minute, expected: "0123"},
+		{id: loc(), index: index, size: int64(len(f)), start: -2 * time.Hour, end: -time.Hour, expected: ""},
+		// the index is out of date, the whole file is read.
+		{id: loc(), index: holdings.Index{{Offset: 0, Start: start}, {Offset: 10 * recordLen, Start: start.Add(time.Hour)}}, size: int64(len(f)),
+			start: 2 * time.Hour, end: 3 * time.Hour, expected: "0123"},
+		// the file has been rewritten since it was indexed, the whole file is read.
+		{id: loc(), index: index, size: 8 * recordLen, start: 2 * time.Hour, end: 3 * time.Hour, expected: "0123"},
+		{id: loc(), index: index, size: 8 * recordLen, start: -2 * time.Hour, end: -time.Hour, expected: "0123"},
+	}
+
+	for _, v := range in {
+		var b bytes.Buffer
+		d := fdsn.DataSearch{Start: start.Add(v.start), End: start.Add(v.end)}
+		if err := archive.Fetch(archive.FileStore{Root: dir}, archive.File{Key: key, Index: v.index, Size: v.size}, d, &b); err != nil {
+			t.Errorf("%s %s", v.id, err)
+			continue
+		}
+
+		var got string
+		for i := 0; i < b.Len(); i += recordLen {
+			got += string(b.Bytes()[i])
+		}
+
+		if got != v.expected {
+			t.Errorf("%s expected records %q got %q", v.id, v.expected, got)
+		}
+	}
+}
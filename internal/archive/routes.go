@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// The networks and stations served, and the storage that holds their miniSEED files, are listed in the
+// DATASELECT_ROUTES file.  Each line is a NET.STA pattern, using the FDSN wildcards * and ?, and the storage,
+// the first matching line is used e.g.,
+//
+//	NZ.*     s3://fdsn-data.geonet.org.nz
+//	IU.SNZO  s3://fdsn-data.geonet.org.nz
+//	2D.*     s3://geonet-temporary/2D
+//	5P.*     /data/5P
+//
+// Storage is an S3 bucket with an optional key prefix, or a directory.  The files are named by the
+// holdings key.  Without DATASELECT_ROUTES the NZ network and IU.SNZO are served from S3_BUCKET, IU.SNZO
+// only when it is requested by name (network=IU&station=SNZO) as before there were routes.
+
+// Route is the storage for the data matching a NET.STA pattern.
+type Route struct {
+	StreamAccess
+	Store Store
+	Named bool // only searched for requests for the network and station by name, without wildcards.
+}
+
+// Routes are the data that is served, the first Route matching a network and station is used.
+type Routes []Route
+
+// LoadRoutes reads the routes from file, or uses the default routes for bucket if file is empty,
+// and checks the storage can be used.  client is used for the S3 storage.
+func LoadRoutes(file, bucket string, client *s3.Client) (Routes, error) {
+	var routes Routes
+	var err error
+
+	if file != "" {
+		r, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = r.Close() }()
+
+		if routes, err = ReadRoutes(r, client); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	} else {
+		if bucket == "" {
+			return nil, errors.New("S3_BUCKET or DATASELECT_ROUTES must be set")
+		}
+		routes = DefaultRoutes(bucket, client)
+	}
+
+	checked := make(map[string]bool)
+	for _, v := range routes {
+		if checked[v.Store.String()] {
+			continue
+		}
+		if err = v.Store.Check(); err != nil {
+			return nil, fmt.Errorf("error checking storage %s: %w", v.Store, err)
+		}
+		checked[v.Store.String()] = true
+	}
+
+	return routes, nil
+}
+
+// DefaultRoutes are the NZ network and IU.SNZO from bucket.
+func DefaultRoutes(bucket string, client *s3.Client) Routes {
+	s := S3Store{Client: client, Bucket: bucket}
+	return Routes{
+		{StreamAccess: StreamAccess{Network: "NZ", Station: "*"}, Store: s},
+		{StreamAccess: StreamAccess{Network: "IU", Station: "SNZO"}, Store: s, Named: true},
+	}
+}
+
+// ReadRoutes reads the NET.STA patterns and storage, one route per line.
+func ReadRoutes(r io.Reader, client *s3.Client) (Routes, error) {
+	var routes Routes
+
+	scanner := bufio.NewScanner(r)
+	var line int
+	for scanner.Scan() {
+		line++
+
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: expected NET.STA storage", line)
+		}
+
+		a, err := ParseStreamAccess(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(a) != 1 {
+			return nil, fmt.Errorf("line %d: expected one NET.STA pattern", line)
+		}
+
+		s, err := NewStore(f[1], client)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		routes = append(routes, Route{StreamAccess: a[0], Store: s})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(routes) == 0 {
+		return nil, errors.New("no routes")
+	}
+
+	return routes, nil
+}
+
+// NewStore returns the storage for s3://bucket/prefix or an absolute directory path.
+func NewStore(s string, client *s3.Client) (Store, error) {
+	if b, ok := strings.CutPrefix(s, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(b, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("no bucket in %s", s)
+		}
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return S3Store{Client: client, Bucket: bucket, Prefix: prefix}, nil
+	}
+
+	if !filepath.IsAbs(s) {
+		return nil, fmt.Errorf("storage must be s3://bucket or an absolute path: %s", s)
+	}
+
+	return FileStore{Root: filepath.Clean(s)}, nil
+}
+
+// Stream returns the storage for the data for network and station, or nil if the data is not served.
+func (r Routes) Stream(network, station string) Store {
+	for _, v := range r {
+		if v.Matches(network, station) {
+			return v.Store
+		}
+	}
+
+	return nil
+}
+
+// Key returns the storage for a holdings key, NET.STA.LOC.CHA.D.YYYY.DOY, or nil if the data is not served.
+func (r Routes) Key(key string) Store {
+	p := strings.SplitN(key, ".", 3)
+	if len(p) < 3 {
+		return nil
+	}
+
+	return r.Stream(p[0], p[1])
+}
+
+// Files returns the files that are served.  files is modified.
+func (r Routes) Files(files []File) []File {
+	routed := files[:0]
+	for _, f := range files {
+		if r.Key(f.Key) != nil {
+			routed = append(routed, f)
+		}
+	}
+	return routed
+}
+
+// Search returns true if the network and station regexes, from fdsn.DataSelect.Regexp, could match served data.
+// Routes with wildcards in the network always could, Named routes only match the regexes for their network and station.
+func (r Routes) Search(network, station string) bool {
+	re, err := regexp.Compile(network)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range r {
+		switch {
+		case v.Named:
+			if network == "^"+v.Network+"$" && station == "^"+v.Station+"$" {
+				return true
+			}
+		case strings.ContainsAny(v.Network, "*?") || re.MatchString(v.Network):
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,166 @@
+package archive_test
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+)
+
+func TestReadRoutes(t *testing.T) {
+	routes, err := archive.ReadRoutes(strings.NewReader(`# served data
+NZ.*     s3://fdsn-data.geonet.org.nz
+IU.SNZO  s3://fdsn-data.geonet.org.nz
+
+2D.*     s3://geonet-temporary/2D
+5P.*     /data/5P/
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := archive.Routes{
+		{StreamAccess: archive.StreamAccess{Network: "NZ", Station: "*"}, Store: archive.S3Store{Bucket: "fdsn-data.geonet.org.nz"}},
+		{StreamAccess: archive.StreamAccess{Network: "IU", Station: "SNZO"}, Store: archive.S3Store{Bucket: "fdsn-data.geonet.org.nz"}},
+		{StreamAccess: archive.StreamAccess{Network: "2D", Station: "*"}, Store: archive.S3Store{Bucket: "geonet-temporary", Prefix: "2D/"}},
+		{StreamAccess: archive.StreamAccess{Network: "5P", Station: "*"}, Store: archive.FileStore{Root: "/data/5P"}},
+	}
+
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("expected %v got %v", expected, routes)
+	}
+
+	in := []struct {
+		id     string
+		routes string
+	}{
+		{id: loc(), routes: ""},
+		{id: loc(), routes: "NZ.* s3://fdsn-data.geonet.org.nz extra"},
+		{id: loc(), routes: "NZ s3://fdsn-data.geonet.org.nz"},
+		{id: loc(), routes: "NZ.*,IU.SNZO s3://fdsn-data.geonet.org.nz"},
+		{id: loc(), routes: "NZ.* s3://"},
+		{id: loc(), routes: "NZ.* data/NZ"},
+	}
+
+	for _, v := range in {
+		if _, err := archive.ReadRoutes(strings.NewReader(v.routes), nil); err == nil {
+			t.Errorf("%s expected an error", v.id)
+		}
+	}
+}
+
+func TestRoutesKey(t *testing.T) {
+	temporary := archive.FileStore{Root: "/data/2D"}
+	routes := append(archive.Routes{{StreamAccess: archive.StreamAccess{Network: "2D", Station: "*"}, Store: temporary}},
+		archive.DefaultRoutes("fdsn-data.geonet.org.nz", nil)...)
+
+	in := []struct {
+		id       string
+		key      string
+		expected archive.Store
+	}{
+		{id: loc(), key: "NZ.WEL.10.HHZ.D.2024.001", expected: archive.S3Store{Bucket: "fdsn-data.geonet.org.nz"}},
+		{id: loc(), key: "IU.SNZO.10.BHZ.D.2024.001", expected: archive.S3Store{Bucket: "fdsn-data.geonet.org.nz"}},
+		{id: loc(), key: "2D.TEST.10.HHZ.D.2024.001", expected: temporary},
+		{id: loc(), key: "IU.CTAO.10.BHZ.D.2024.001"},
+		{id: loc(), key: "5P.TEST.10.HHZ.D.2024.001"},
+		{id: loc(), key: "NZ"},
+	}
+
+	for _, v := range in {
+		if s := routes.Key(v.key); s != v.expected {
+			t.Errorf("%s expected %v got %v", v.id, v.expected, s)
+		}
+	}
+
+	f := routes.Files([]archive.File{{Key: "5P.TEST.10.HHZ.D.2024.001"}, {Key: "NZ.WEL.10.HHZ.D.2024.001"}})
+	if !reflect.DeepEqual(f, []archive.File{{Key: "NZ.WEL.10.HHZ.D.2024.001"}}) {
+		t.Errorf("unexpected routed files %v", f)
+	}
+
+	// the default IU.SNZO route is only searched by name.
+	for network, expected := range map[string]bool{"^NZ$": true, "^.*$": true, "^2.$": true, "^IU$": false, "^5P$": false, "^NZ|5P$": true} {
+		if routes.Search(network, "^.*$") != expected {
+			t.Errorf("%s expected %t", network, expected)
+		}
+	}
+}
+
+func TestDefaultRoutes(t *testing.T) {
+	routes := archive.DefaultRoutes("fdsn-data.geonet.org.nz", nil)
+
+	// IU.SNZO is only searched when it is requested by name.
+	in := []struct {
+		id               string
+		network, station string
+		expected         bool
+	}{
+		{id: loc(), network: "^NZ$", station: "^.*$", expected: true},
+		{id: loc(), network: "^.*$", station: "^.*$", expected: true},
+		{id: loc(), network: "^IU$", station: "^SNZO$", expected: true},
+		{id: loc(), network: "^IU$", station: "^.*$"},
+		{id: loc(), network: "^I.$", station: "^SNZO$"},
+		{id: loc(), network: "^IU$", station: "^SNZ.$"},
+		{id: loc(), network: "^5P$", station: "^.*$"},
+	}
+
+	for _, v := range in {
+		if routes.Search(v.network, v.station) != v.expected {
+			t.Errorf("%s %s %s expected %t", v.id, v.network, v.station, v.expected)
+		}
+	}
+
+	if routes.Key("IU.SNZO.10.BHZ.D.2024.001") == nil {
+		t.Error("expected IU.SNZO files to be served")
+	}
+}
+
+func TestParseStreamAccess(t *testing.T) {
+	a, err := archive.ParseStreamAccess(" Z1.*, NZ.TEST,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(a, []archive.StreamAccess{{Network: "Z1", Station: "*"}, {Network: "NZ", Station: "TEST"}}) {
+		t.Errorf("unexpected access %v", a)
+	}
+
+	if !archive.AnyMatches(a, "Z1", "ABCD") || !archive.AnyMatches(a, "NZ", "TEST") || archive.AnyMatches(a, "NZ", "WEL") {
+		t.Error("unexpected matches")
+	}
+
+	for _, s := range []string{"Z1", "Z1.*.10", ".WEL", "Z1.[A-Z]*", `Z1.\*`} {
+		if _, err := archive.ParseStreamAccess(s); err == nil {
+			t.Errorf("%s expected an error", s)
+		}
+	}
+}
+
+func TestByteRange(t *testing.T) {
+	if r := archive.ByteRange(512, 1024); r != "bytes=512-1023" {
+		t.Errorf("unexpected range %s", r)
+	}
+	if r := archive.ByteRange(512, -1); r != "bytes=512-" {
+		t.Errorf("unexpected range %s", r)
+	}
+}
+
+func TestContentRangeSize(t *testing.T) {
+	if n, err := archive.ContentRangeSize("bytes 512-1023/4096"); err != nil || n != 4096 {
+		t.Errorf("expected 4096 got %d %v", n, err)
+	}
+
+	for _, r := range []string{"", "bytes 512-1023/*", "512-1023/4096", "bytes 512-1023"} {
+		if _, err := archive.ContentRangeSize(r); err == nil {
+			t.Errorf("%q expected an error", r)
+		}
+	}
+}
+
+func loc() string {
+	_, _, l, _ := runtime.Caller(1)
+	return "L" + strconv.Itoa(l)
+}
@@ -0,0 +1,256 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrNotFound is returned by a Store when there is no file for a key.
+var ErrNotFound = errors.New("miniSEED file not found")
+
+// Store is where the miniSEED files for the holdings keys are stored.
+type Store interface {
+	// Get writes the file for key to b.  Returns ErrNotFound if there is no file.
+	Get(key string, b *bytes.Buffer) error
+	// GetRange writes the bytes from, inclusive, to, exclusive, of the file for key to b and returns the
+	// size of the whole file.  to is -1 for the end of the file.  Returns ErrNotFound if there is no file.
+	GetRange(key string, from, to int64, b *bytes.Buffer) (int64, error)
+	// Size returns the length of the file for key.  Returns ErrNotFound if there is no file.
+	Size(key string) (int64, error)
+	// Check returns an error if the storage can't be used.
+	Check() error
+	String() string
+}
+
+// NewS3Client returns an S3 client, configured from the environment the same way as the kit S3 client,
+// with up to maxAttempts attempts for each request.  The kit client doesn't return the object size,
+// range, or ETag from a get.
+func NewS3Client(maxAttempts int) (*s3.Client, error) {
+	if os.Getenv("AWS_REGION") == "" {
+		return nil, errors.New("AWS_REGION is not set")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.Retryer = retry.AddWithMaxAttempts(o.Retryer, maxAttempts)
+		if e := os.Getenv("AWS_ENDPOINT_URL"); e != "" {
+			o.BaseEndpoint = aws.String(e)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// S3Store is an S3 bucket with an optional prefix for the keys.
+type S3Store struct {
+	Client         *s3.Client
+	Bucket, Prefix string
+}
+
+func (s S3Store) Get(key string, b *bytes.Buffer) error {
+	_, err := s.GetWithETag(key, b)
+	return err
+}
+
+// GetWithETag is Get that also returns the ETag of the object.
+func (s S3Store) GetWithETag(key string, b *bytes.Buffer) (string, error) {
+	o, err := s.Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+	})
+	if err != nil {
+		return "", notFound(err)
+	}
+	defer func() { _ = o.Body.Close() }()
+
+	_, err = b.ReadFrom(o.Body)
+
+	return aws.ToString(o.ETag), err
+}
+
+// GetRange reads the range and the size of the file in one request, the size is from the Content-Range.
+func (s S3Store) GetRange(key string, from, to int64, b *bytes.Buffer) (int64, error) {
+	o, err := s.Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+		Range:  aws.String(ByteRange(from, to)),
+	})
+	if err != nil {
+		return 0, notFound(err)
+	}
+	defer func() { _ = o.Body.Close() }()
+
+	size, err := ContentRangeSize(aws.ToString(o.ContentRange))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = b.ReadFrom(o.Body)
+
+	return size, err
+}
+
+func (s S3Store) Size(key string) (int64, error) {
+	o, err := s.Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Prefix + key),
+	})
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	return aws.ToInt64(o.ContentLength), nil
+}
+
+func (s S3Store) Check() error {
+	_, err := s.Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{Bucket: aws.String(s.Bucket)})
+	return err
+}
+
+func (s S3Store) String() string {
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+// notFound returns ErrNotFound for the S3 errors for a key that doesn't exist.
+func notFound(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var nf *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &nf) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ByteRange returns the HTTP Range header value for the bytes from, inclusive, to, exclusive.
+// to is -1 for the end of the file.
+func ByteRange(from, to int64) string {
+	if to < 0 {
+		return fmt.Sprintf("bytes=%d-", from)
+	}
+	return fmt.Sprintf("bytes=%d-%d", from, to-1)
+}
+
+// ContentRangeSize returns the complete length from an HTTP Content-Range header value e.g., bytes 0-511/4096.
+func ContentRangeSize(r string) (int64, error) {
+	_, size, ok := strings.Cut(r, "/")
+	if !ok || !strings.HasPrefix(r, "bytes ") {
+		return 0, fmt.Errorf("invalid Content-Range %q", r)
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid Content-Range %q", r)
+	}
+
+	return n, nil
+}
+
+// FileStore is a directory.
+type FileStore struct {
+	Root string
+}
+
+func (s FileStore) Get(key string, b *bytes.Buffer) error {
+	_, err := s.GetRange(key, 0, -1, b)
+	return err
+}
+
+// name returns the path of the file for key.
+func (s FileStore) name(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+
+	return filepath.Join(s.Root, key), nil
+}
+
+func (s FileStore) GetRange(key string, from, to int64, b *bytes.Buffer) (int64, error) {
+	name, err := s.name(key)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// the same as an S3 ranged get.
+	if from > 0 && from >= fi.Size() {
+		return 0, fmt.Errorf("range not satisfiable, %d is past the end of the %d byte file", from, fi.Size())
+	}
+
+	if _, err = f.Seek(from, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if to < 0 {
+		_, err = b.ReadFrom(f)
+		return fi.Size(), err
+	}
+
+	_, err = io.CopyN(b, f, to-from)
+	if errors.Is(err, io.EOF) {
+		// to is past the end of the file.
+		err = nil
+	}
+
+	return fi.Size(), err
+}
+
+func (s FileStore) Size(key string) (int64, error) {
+	name, err := s.name(key)
+	if err != nil {
+		return 0, err
+	}
+
+	fi, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+func (s FileStore) Check() error {
+	fi, err := os.Stat(s.Root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.Root)
+	}
+	return nil
+}
+
+func (s FileStore) String() string {
+	return s.Root
+}
@@ -0,0 +1,72 @@
+package archive_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GeoNet/fdsn/internal/archive"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "NZ.WEL.10.HHZ.D.2024.001"), []byte("miniSEED"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := archive.FileStore{Root: dir}
+
+	if err := s.Check(); err != nil {
+		t.Error(err)
+	}
+
+	var b bytes.Buffer
+	if err := s.Get("NZ.WEL.10.HHZ.D.2024.001", &b); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "miniSEED" {
+		t.Errorf("unexpected file content %q", b.String())
+	}
+
+	if err := s.Get("NZ.WEL.10.HHZ.D.2024.002", &b); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("expected ErrNotFound got %v", err)
+	}
+
+	if err := s.Get("../NZ.WEL.10.HHZ.D.2024.001", &b); err == nil || errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("expected an error for a key outside the root got %v", err)
+	}
+
+	b.Reset()
+	if n, err := s.GetRange("NZ.WEL.10.HHZ.D.2024.001", 4, 7, &b); err != nil || b.String() != "SEE" || n != 8 {
+		t.Errorf("expected SEE and size 8 got %q %d %v", b.String(), n, err)
+	}
+
+	b.Reset()
+	if n, err := s.GetRange("NZ.WEL.10.HHZ.D.2024.001", 6, -1, &b); err != nil || b.String() != "ED" || n != 8 {
+		t.Errorf("expected ED and size 8 got %q %d %v", b.String(), n, err)
+	}
+
+	b.Reset()
+	if _, err := s.GetRange("NZ.WEL.10.HHZ.D.2024.001", 6, 100, &b); err != nil || b.String() != "ED" {
+		t.Errorf("expected ED for a range past the end got %q %v", b.String(), err)
+	}
+
+	if _, err := s.GetRange("NZ.WEL.10.HHZ.D.2024.001", 8, -1, &b); err == nil {
+		t.Error("expected an error for a range starting after the end of the file")
+	}
+
+	if n, err := s.Size("NZ.WEL.10.HHZ.D.2024.001"); err != nil || n != 8 {
+		t.Errorf("expected size 8 got %d %v", n, err)
+	}
+
+	if _, err := s.Size("NZ.WEL.10.HHZ.D.2024.002"); !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("expected ErrNotFound got %v", err)
+	}
+
+	if err := (archive.FileStore{Root: filepath.Join(dir, "missing")}).Check(); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
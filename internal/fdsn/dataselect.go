@@ -28,6 +28,15 @@ var abbreviations = map[string]string{
 	"end":   "endtime",
 }
 
+// DataSelectFormats are the supported dataselect formats.  ascii is the same as geocsv.
+var DataSelectFormats = map[string]bool{
+	"miniseed": true,
+	"sac":      true,
+	"geocsv":   true,
+	"ascii":    true,
+	"json":     true,
+}
+
 var dataSelectNotSupported = map[string]bool{
 	"quality":        true,
 	"minuimumlength": true,
@@ -70,6 +79,7 @@ func init() {
 func ParseDataSelectPost(r io.Reader, d *[]DataSelect) error {
 	scanner := bufio.NewScanner(r)
 	noData := 204
+	format := "miniseed"
 
 	for scanner.Scan() {
 
@@ -91,6 +101,11 @@ func ParseDataSelectPost(r io.Reader, d *[]DataSelect) error {
 					if noData != 204 && noData != 404 {
 						return errors.New("nodata must be 204 or 404")
 					}
+				case "format":
+					format = strings.TrimSpace(tokens[1])
+					if !DataSelectFormats[format] {
+						return fmt.Errorf("unsupported format %q", format)
+					}
 				}
 			}
 			continue
@@ -118,7 +133,7 @@ func ParseDataSelectPost(r io.Reader, d *[]DataSelect) error {
 				Station:   []string{fields[1]},
 				Location:  []string{fields[2]},
 				Channel:   []string{fields[3]},
-				Format:    "miniseed",
+				Format:    format,
 				NoData:    noData,
 			})
 	}
@@ -165,8 +180,8 @@ func ParseDataSelectGet(v url.Values) (DataSelect, error) {
 		return DataSelect{}, err
 	}
 
-	if e.Format != "miniseed" {
-		return DataSelect{}, fmt.Errorf("only \"miniseed\" format is supported")
+	if !DataSelectFormats[e.Format] {
+		return DataSelect{}, fmt.Errorf("unsupported format %q", e.Format)
 	}
 
 	if e.LongestOnly {
@@ -102,6 +102,45 @@ func TestParseGet(t *testing.T) {
 
 }
 
+func TestParseFormat(t *testing.T) {
+	u := url.Values{
+		"station": []string{"WEL"},
+		"start":   []string{"2020-01-01T00:00:00"},
+		"end":     []string{"2020-01-01T01:00:00"},
+	}
+
+	for _, f := range []string{"miniseed", "sac", "geocsv", "ascii", "json"} {
+		u.Set("format", f)
+
+		d, err := fdsn.ParseDataSelectGet(u)
+		if err != nil {
+			t.Errorf("%s: %s", f, err)
+			continue
+		}
+		if d.Format != f {
+			t.Errorf("expected format %s got %s", f, d.Format)
+		}
+	}
+
+	u.Set("format", "xml")
+	if _, err := fdsn.ParseDataSelectGet(u); err == nil {
+		t.Error("expected an error for format xml")
+	}
+
+	var dsq []fdsn.DataSelect
+
+	if err := fdsn.ParseDataSelectPost(bytes.NewReader([]byte("format=sac\nNZ WEL 10 HHZ 2020-01-01T00:00:00 2020-01-01T01:00:00\n")), &dsq); err != nil {
+		t.Fatal(err)
+	}
+	if len(dsq) != 1 || dsq[0].Format != "sac" {
+		t.Errorf("expected format sac got %+v", dsq)
+	}
+
+	if err := fdsn.ParseDataSelectPost(bytes.NewReader([]byte("format=xml\nNZ WEL 10 HHZ 2020-01-01T00:00:00 2020-01-01T01:00:00\n")), &dsq); err == nil {
+		t.Error("expected an error for format xml")
+	}
+}
+
 func TestGenRegex(t *testing.T) {
 	// normal case
 	r, err := fdsn.GenRegex([]string{"ABA0"}, false, false)
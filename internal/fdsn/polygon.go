@@ -0,0 +1,179 @@
+package fdsn
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Polygon is a region outline for the non-standard polygon query parameter.
+// It is either WKT, e.g., "POLYGON((176 -38, 177 -38, 177 -39, 176 -38))" with longitude latitude
+// pairs, or a comma separated list of latitude,longitude pairs, e.g., "-38,176,-38,177,-39,177".
+// The polygon is closed if the last point is not the same as the first.
+type Polygon struct {
+	Points []Point
+}
+
+// Point is a polygon vertex in decimal degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (p *Polygon) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+
+	var points []Point
+	var err error
+
+	if strings.HasPrefix(strings.ToUpper(s), "POLYGON") {
+		points, err = parseWKTPolygon(s)
+	} else {
+		points, err = parsePointList(s)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, v := range points {
+		if v.Latitude < -90.0 || v.Latitude > 90.0 {
+			return fmt.Errorf("invalid polygon latitude value: %f", v.Latitude)
+		}
+		if v.Longitude < -180.0 || v.Longitude > 180.0 {
+			return fmt.Errorf("invalid polygon longitude value: %f", v.Longitude)
+		}
+	}
+
+	if len(points) > 0 && points[0] != points[len(points)-1] {
+		points = append(points, points[0])
+	}
+
+	// a closed triangle has four points.
+	if len(points) < 4 {
+		return fmt.Errorf("polygon must have at least three points")
+	}
+
+	p.Points = points
+
+	return nil
+}
+
+// IsZero returns true if p has no points, i.e., no polygon was given.
+func (p Polygon) IsZero() bool {
+	return len(p.Points) == 0
+}
+
+// WKT returns p as well-known text with longitude latitude pairs.
+func (p Polygon) WKT() string {
+	s := make([]string, len(p.Points))
+	for i, v := range p.Points {
+		s[i] = strconv.FormatFloat(v.Longitude, 'f', -1, 64) + " " + strconv.FormatFloat(v.Latitude, 'f', -1, 64)
+	}
+
+	return "POLYGON((" + strings.Join(s, ",") + "))"
+}
+
+// Contains returns true if the point at latitude, longitude is inside p.
+// When p crosses the anti-meridian, e.g., around New Zealand, longitudes are shifted
+// to 0-360, the same as PostGIS ST_ShiftLongitude.  Other polygons, including those
+// crossing the prime meridian, are used as they are.
+func (p Polygon) Contains(latitude, longitude float64) bool {
+	shift := func(longitude float64) float64 { return longitude }
+	if p.CrossesAntiMeridian() {
+		shift = shiftLongitude
+	}
+
+	x := shift(longitude)
+
+	// ray casting, count the edges crossed by a ray from the point.
+	var inside bool
+	for i, j := 0, len(p.Points)-1; i < len(p.Points); j, i = i, i+1 {
+		xi, yi := shift(p.Points[i].Longitude), p.Points[i].Latitude
+		xj, yj := shift(p.Points[j].Longitude), p.Points[j].Latitude
+
+		if (yi > latitude) != (yj > latitude) && x < (xj-xi)*(latitude-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// CrossesAntiMeridian returns true if an edge of p crosses ±180 longitude.  Edges are the shortest
+// way between their points so an edge spanning more than 180 degrees of longitude crosses it.
+func (p Polygon) CrossesAntiMeridian() bool {
+	for i := 1; i < len(p.Points); i++ {
+		if math.Abs(p.Points[i].Longitude-p.Points[i-1].Longitude) > 180.0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func shiftLongitude(longitude float64) float64 {
+	if longitude < 0.0 {
+		return longitude + 360.0
+	}
+	return longitude
+}
+
+// parseWKTPolygon parses a WKT polygon without holes.
+func parseWKTPolygon(s string) ([]Point, error) {
+	start := strings.Index(s, "((")
+	end := strings.LastIndex(s, "))")
+	if start == -1 || end < start || strings.TrimSpace(s[end+2:]) != "" {
+		return nil, fmt.Errorf("invalid polygon WKT: %s", s)
+	}
+
+	ring := s[start+2 : end]
+	if strings.ContainsAny(ring, "()") {
+		return nil, fmt.Errorf("polygons with holes are not supported")
+	}
+
+	var points []Point
+	for _, v := range strings.Split(ring, ",") {
+		f := strings.Fields(v)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("invalid polygon point: %s", strings.TrimSpace(v))
+		}
+
+		lon, err := strconv.ParseFloat(f[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon longitude: %s", f[0])
+		}
+		lat, err := strconv.ParseFloat(f[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon latitude: %s", f[1])
+		}
+
+		points = append(points, Point{Latitude: lat, Longitude: lon})
+	}
+
+	return points, nil
+}
+
+// parsePointList parses comma separated latitude,longitude pairs.
+func parsePointList(s string) ([]Point, error) {
+	f := strings.Split(s, ",")
+	if len(f)%2 != 0 {
+		return nil, fmt.Errorf("polygon must be latitude,longitude pairs")
+	}
+
+	var points []Point
+	for i := 0; i < len(f); i += 2 {
+		lat, err := strconv.ParseFloat(strings.TrimSpace(f[i]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon latitude: %s", f[i])
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(f[i+1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid polygon longitude: %s", f[i+1])
+		}
+
+		points = append(points, Point{Latitude: lat, Longitude: lon})
+	}
+
+	return points, nil
+}
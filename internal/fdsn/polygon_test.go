@@ -0,0 +1,97 @@
+package fdsn_test
+
+import (
+	"testing"
+
+	"github.com/GeoNet/fdsn/internal/fdsn"
+)
+
+func TestPolygonParse(t *testing.T) {
+	var w, l fdsn.Polygon
+
+	if err := w.UnmarshalText([]byte("POLYGON((176 -38, 177 -38, 177 -39, 176 -38))")); err != nil {
+		t.Error(err)
+	}
+
+	// the list is closed.
+	if err := l.UnmarshalText([]byte("-38,176,-38,177,-39,177")); err != nil {
+		t.Error(err)
+	}
+
+	if w.WKT() != "POLYGON((176 -38,177 -38,177 -39,176 -38))" {
+		t.Errorf("unexpected WKT %s", w.WKT())
+	}
+	if l.WKT() != w.WKT() {
+		t.Errorf("expected %s got %s", w.WKT(), l.WKT())
+	}
+
+	for _, s := range []string{
+		"-38,176,-38,177",
+		"-38,176,-38,177,-39",
+		"-38,176,-38,177,-39,x",
+		"-38,176,-38,177,-91,177",
+		"-38,176,-38,177,-39,181",
+		"POLYGON((176 -38, 177 -38))",
+		"POLYGON((176 -38 177 -38, 177 -39, 176 -38))",
+		"POLYGON((176 -38, 177 -38, 177 -39, 176 -38),(176.5 -38.5, 176.6 -38.5, 176.6 -38.6, 176.5 -38.5))",
+		"POLYGON(176 -38, 177 -38, 177 -39, 176 -38)",
+	} {
+		var p fdsn.Polygon
+		if err := p.UnmarshalText([]byte(s)); err == nil {
+			t.Errorf("expected an error for %s", s)
+		}
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	var p fdsn.Polygon
+
+	// crosses the anti-meridian.
+	if err := p.UnmarshalText([]byte("-30,178,-30,-178,-34,-178,-34,178")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.CrossesAntiMeridian() {
+		t.Error("expected the polygon to cross the anti-meridian")
+	}
+
+	in := []fdsn.Point{{Latitude: -32, Longitude: 179}, {Latitude: -32, Longitude: -179}, {Latitude: -33.9, Longitude: 180}}
+	for _, v := range in {
+		if !p.Contains(v.Latitude, v.Longitude) {
+			t.Errorf("expected %+v inside", v)
+		}
+	}
+
+	out := []fdsn.Point{{Latitude: -32, Longitude: 177}, {Latitude: -32, Longitude: -177}, {Latitude: -35, Longitude: 179}, {Latitude: -29, Longitude: 179}}
+	for _, v := range out {
+		if p.Contains(v.Latitude, v.Longitude) {
+			t.Errorf("expected %+v outside", v)
+		}
+	}
+}
+
+func TestPolygonContainsPrimeMeridian(t *testing.T) {
+	var p fdsn.Polygon
+
+	if err := p.UnmarshalText([]byte("POLYGON((-10 50, 10 50, 10 40, -10 40, -10 50))")); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.CrossesAntiMeridian() {
+		t.Error("expected the polygon not to cross the anti-meridian")
+	}
+
+	in := []fdsn.Point{{Latitude: 45, Longitude: 0}, {Latitude: 45, Longitude: -9}, {Latitude: 45, Longitude: 9}}
+	for _, v := range in {
+		if !p.Contains(v.Latitude, v.Longitude) {
+			t.Errorf("expected %+v inside", v)
+		}
+	}
+
+	out := []fdsn.Point{{Latitude: 45, Longitude: 20}, {Latitude: 45, Longitude: -20}, {Latitude: 45, Longitude: 180}, {Latitude: 55, Longitude: 0}}
+	for _, v := range out {
+		if p.Contains(v.Latitude, v.Longitude) {
+			t.Errorf("expected %+v outside", v)
+		}
+	}
+}
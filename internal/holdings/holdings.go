@@ -2,7 +2,10 @@
 package holdings
 
 import (
+	"encoding/binary"
+	"errors"
 	"io"
+	"sort"
 	"time"
 
 	ms "github.com/GeoNet/kit/seis/ms"
@@ -11,12 +14,30 @@ import (
 // the record length of the miniSEED records.  Constant for all GNS miniSEED files.
 const recordLength int = 512
 
+// IndexInterval is the number of records between entries in the record Index.
+const IndexInterval = 64
+
+// the length of a binary Index entry.
+const indexEntryLength = 16
+
 type Holding struct {
 	Network, Station, Channel, Location string
 	Start                               time.Time
 	NumSamples                          int
+	Index                               Index // nil if the records are not in time order.
+	Size                                int64 // the length of the miniSEED read, the Index is only valid for this length.
+}
+
+// IndexEntry is the byte offset and start time of a record.
+type IndexEntry struct {
+	Offset int64
+	Start  time.Time
 }
 
+// Index is a sparse index of the records in a miniSEED file with an entry for
+// every IndexInterval records.  The entries are in time and file order.
+type Index []IndexEntry
+
 // SingleStream reads miniSEED from r in 512 byte records and returns a summary.
 // Expects a single stream (not multiplexed miniSEED) in r.
 func SingleStream(r io.Reader) (Holding, error) {
@@ -45,10 +66,15 @@ func SingleStream(r io.Reader) (Holding, error) {
 		Location:   msr.Location(),
 		Start:      msr.StartTime(),
 		NumSamples: int(msr.NumberOfSamples),
+		Index:      Index{{Offset: 0, Start: msr.StartTime()}},
+		Size:       int64(recordLength),
 	}
 
+	ordered := true
+	previous := msr.StartTime()
+
 loop:
-	for {
+	for n := 1; ; n++ {
 		_, err = io.ReadFull(r, record)
 		switch {
 		case err == io.EOF:
@@ -63,7 +89,72 @@ loop:
 		}
 
 		h.NumSamples += int(msr.NumberOfSamples)
+		h.Size += int64(recordLength)
+
+		if msr.StartTime().Before(previous) {
+			ordered = false
+		}
+		previous = msr.StartTime()
+
+		if n%IndexInterval == 0 {
+			h.Index = append(h.Index, IndexEntry{Offset: int64(n * recordLength), Start: msr.StartTime()})
+		}
+	}
+
+	// the index can't be searched by time.
+	if !ordered {
+		h.Index = nil
 	}
 
 	return h, nil
 }
+
+// Range returns the byte range, from inclusive to exclusive, of the records that could have data
+// between start and end.  to is -1 for the end of the file.  from and to are equal when there are no
+// records in the range.  ok is false if the index is empty.
+func (x Index) Range(start, end time.Time) (from, to int64, ok bool) {
+	if len(x) == 0 {
+		return 0, 0, false
+	}
+
+	// the last entry starting at or before start.  Records before it end before start.
+	i := sort.Search(len(x), func(i int) bool { return x[i].Start.After(start) }) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	// the first entry starting at or after end.  It and the following records start after end.
+	j := sort.Search(len(x), func(j int) bool { return !x[j].Start.Before(end) })
+	if j == len(x) {
+		return x[i].Offset, -1, true
+	}
+
+	return x[i].Offset, x[j].Offset, true
+}
+
+// MarshalBinary encodes the index as the offset and start time, in Unix nanoseconds, of each entry.
+func (x Index) MarshalBinary() ([]byte, error) {
+	b := make([]byte, len(x)*indexEntryLength)
+	for i, e := range x {
+		binary.BigEndian.PutUint64(b[i*indexEntryLength:], uint64(e.Offset))
+		binary.BigEndian.PutUint64(b[i*indexEntryLength+8:], uint64(e.Start.UnixNano()))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes an index encoded by MarshalBinary.
+func (x *Index) UnmarshalBinary(b []byte) error {
+	if len(b)%indexEntryLength != 0 {
+		return errors.New("invalid record index length")
+	}
+
+	*x = nil
+	for i := 0; i < len(b); i += indexEntryLength {
+		*x = append(*x, IndexEntry{
+			Offset: int64(binary.BigEndian.Uint64(b[i:])),
+			Start:  time.Unix(0, int64(binary.BigEndian.Uint64(b[i+8:]))).UTC(),
+		})
+	}
+
+	return nil
+}
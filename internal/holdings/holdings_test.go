@@ -1,12 +1,14 @@
 package holdings_test
 
 import (
+	"bytes"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/GeoNet/fdsn/internal/holdings"
+	ms "github.com/GeoNet/kit/seis/ms"
 )
 
 type result struct {
@@ -46,8 +48,120 @@ func TestHoldings(t *testing.T) {
 			t.Errorf("%s %s", e.file, err)
 		}
 
+		if len(h.Index) == 0 || h.Index[0].Offset != 0 || !h.Index[0].Start.Equal(h.Start) {
+			t.Errorf("%s expected the first index entry for the first record got %v", e.file, h.Index)
+		}
+		h.Index = nil
+
+		fi, err := os.Stat(e.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Size != fi.Size() {
+			t.Errorf("%s expected size %d got %d", e.file, fi.Size(), h.Size)
+		}
+		h.Size = 0
+
 		if !reflect.DeepEqual(e.h, h) {
 			t.Errorf("%s holdings results not equal expected %+v got %+v", e.file, e.h, h)
 		}
 	}
 }
+
+// stream returns a file of n records, copies of the first record in the LOG file, with start times
+// a minute apart from start.
+func stream(t *testing.T, start time.Time, n int) []byte {
+	b, err := os.ReadFile("etc/NZ.ABAZ..LOG.D.2016.186")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := b[:512]
+
+	var f bytes.Buffer
+	for i := 0; i < n; i++ {
+		hdr := ms.DecodeRecordHeader(record)
+		hdr.SetStartTime(start.Add(time.Duration(i) * time.Minute))
+		f.Write(ms.EncodeRecordHeader(hdr))
+		f.Write(record[len(ms.EncodeRecordHeader(hdr)):])
+	}
+
+	return f.Bytes()
+}
+
+func TestIndex(t *testing.T) {
+	start := time.Date(2016, time.July, 4, 0, 0, 0, 0, time.UTC)
+
+	h, err := holdings.SingleStream(bytes.NewReader(stream(t, start, 200)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := holdings.Index{
+		{Offset: 0, Start: start},
+		{Offset: 64 * 512, Start: start.Add(64 * time.Minute)},
+		{Offset: 128 * 512, Start: start.Add(128 * time.Minute)},
+		{Offset: 192 * 512, Start: start.Add(192 * time.Minute)},
+	}
+
+	if !reflect.DeepEqual(h.Index, expected) {
+		t.Errorf("expected index %v got %v", expected, h.Index)
+	}
+
+	if h.Size != 200*512 {
+		t.Errorf("expected size %d got %d", 200*512, h.Size)
+	}
+
+	b, err := h.Index.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var x holdings.Index
+	if err := x.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("expected unmarshalled index %v got %v", expected, x)
+	}
+
+	if err := x.UnmarshalBinary(b[1:]); err == nil {
+		t.Error("expected an error for a short index")
+	}
+
+	in := []struct {
+		start, end time.Duration // minutes from start
+		from, to   int64
+	}{
+		{start: 10 * time.Minute, end: 20 * time.Minute, from: 0, to: 64 * 512},
+		{start: 64 * time.Minute, end: 65 * time.Minute, from: 64 * 512, to: 128 * 512},
+		{start: 70 * time.Minute, end: 128 * time.Minute, from: 64 * 512, to: 128 * 512},
+		{start: 70 * time.Minute, end: 129 * time.Minute, from: 64 * 512, to: 192 * 512},
+		{start: 190 * time.Minute, end: 300 * time.Minute, from: 128 * 512, to: -1},
+		{start: -time.Hour, end: -time.Minute, from: 0, to: 0},
+		{start: 10 * time.Hour, end: 11 * time.Hour, from: 192 * 512, to: -1},
+	}
+
+	for _, v := range in {
+		from, to, ok := x.Range(start.Add(v.start), start.Add(v.end))
+		if !ok || from != v.from || to != v.to {
+			t.Errorf("%s to %s expected %d-%d got %d-%d", v.start, v.end, v.from, v.to, from, to)
+		}
+	}
+
+	if _, _, ok := holdings.Index(nil).Range(start, start.Add(time.Hour)); ok {
+		t.Error("expected no range for an empty index")
+	}
+
+	// records out of time order can't be indexed.
+	f := stream(t, start, 100)
+	copy(f[512:1024], stream(t, start.Add(-time.Hour), 1))
+
+	h, err = holdings.SingleStream(bytes.NewReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Index != nil {
+		t.Errorf("expected no index for records out of order got %v", h.Index)
+	}
+}
@@ -0,0 +1,91 @@
+package plot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// canvas draws on img inside clip.
+type canvas struct {
+	img  *image.RGBA
+	clip image.Rectangle
+}
+
+func (c canvas) clipped(r image.Rectangle) surface {
+	return canvas{img: c.img, clip: r.Intersect(c.img.Bounds())}
+}
+
+func (c canvas) set(x, y int, col color.Color) {
+	if image.Pt(x, y).In(c.clip) {
+		c.img.Set(x, y, col)
+	}
+}
+
+// line draws from x0, y0 to x1, y1 using Bresenham's algorithm.
+func (c canvas) line(x0, y0, x1, y1 int, col color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+	for {
+		c.set(x0, y0, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func (c canvas) polyline(pts []image.Point, col color.Color) {
+	if len(pts) == 1 {
+		c.set(pts[0].X, pts[0].Y, col)
+	}
+	for i := 1; i < len(pts); i++ {
+		c.line(pts[i-1].X, pts[i-1].Y, pts[i].X, pts[i].Y, col)
+	}
+}
+
+func (c canvas) fill(r image.Rectangle, col color.Color) {
+	draw.Draw(c.img, r.Canon().Intersect(c.clip), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func (c canvas) text(x, y int, s string, col color.Color) {
+	for _, r := range s {
+		g := glyph(r)
+		for i, bits := range g {
+			for j := 0; j < glyphHeight; j++ {
+				if bits&(1<<j) != 0 {
+					c.set(x+i, y+j, col)
+				}
+			}
+		}
+		x += glyphWidth
+	}
+}
+
+func (c canvas) textUp(x, y int, s string, col color.Color) {
+	for _, r := range s {
+		g := glyph(r)
+		for i, bits := range g {
+			for j := 0; j < glyphHeight; j++ {
+				if bits&(1<<j) != 0 {
+					c.set(x+j, y-i, col)
+				}
+			}
+		}
+		y -= glyphWidth
+	}
+}
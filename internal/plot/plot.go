@@ -0,0 +1,341 @@
+// Package plot draws simple line plots as PNG or SVG images using only the standard library.
+package plot
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+)
+
+var (
+	Black = color.RGBA{A: 0xff}
+	Blue  = color.RGBA{B: 0xcc, A: 0xff}
+	Red   = color.RGBA{R: 0xcc, A: 0xff}
+	Pink  = color.RGBA{R: 0xff, G: 0xdd, B: 0xdd, A: 0xff}
+	grey  = color.RGBA{R: 0xdd, G: 0xdd, B: 0xdd, A: 0xff}
+)
+
+// margins around the data area of each panel.
+const (
+	marginLeft   = 80
+	marginRight  = 20
+	marginTop    = 24
+	marginBottom = 40
+)
+
+// Axis describes one axis of a panel.
+type Axis struct {
+	Label    string
+	Log      bool    // log10 scale, values <= 0 are not drawn.
+	Time     bool    // values are Unix seconds, labelled as UTC times.  Not used with Log.
+	Min, Max float64 // the range is found from the data when Min == Max.
+}
+
+// Series is a line through the points X, Y.  Points that are NaN or Inf break the line.
+type Series struct {
+	X, Y   []float64
+	Colour color.Color
+}
+
+// Span is a shaded range of X values e.g., a gap in the data.
+type Span struct {
+	X0, X1 float64
+	Colour color.Color
+}
+
+// Panel is a single set of axes.
+type Panel struct {
+	Title  string
+	X, Y   Axis
+	Series []Series
+	Spans  []Span
+}
+
+// Plot is one or more panels stacked vertically.
+type Plot struct {
+	Width, Height int
+	Panels        []Panel
+}
+
+// PNG draws p to w.
+func (p Plot) PNG(w io.Writer) error {
+	img, err := p.Image()
+	if err != nil {
+		return err
+	}
+
+	return png.Encode(w, img)
+}
+
+// Image draws p.
+func (p Plot) Image() (*image.RGBA, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, p.Width, p.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	p.draw(canvas{img: img, clip: img.Bounds()})
+
+	return img, nil
+}
+
+// SVG draws p to w as an SVG image.
+func (p Plot) SVG(w io.Writer) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+
+	s := newSVG(p.Width, p.Height)
+	p.draw(s.clipped(image.Rect(0, 0, p.Width, p.Height)))
+
+	return s.write(w)
+}
+
+func (p Plot) check() error {
+	if len(p.Panels) == 0 {
+		return errors.New("plot has no panels")
+	}
+
+	if p.Width < marginLeft+marginRight+10 || p.Height/len(p.Panels) < marginTop+marginBottom+10 {
+		return errors.New("plot is too small")
+	}
+
+	return nil
+}
+
+func (p Plot) draw(s surface) {
+	ph := p.Height / len(p.Panels)
+
+	for i, panel := range p.Panels {
+		panel.draw(s, image.Rect(0, i*ph, p.Width, (i+1)*ph))
+	}
+}
+
+// scale maps data values to pixels along one axis.
+type scale struct {
+	Axis
+	min, max float64 // data range, log10 for log axes.
+	p0, p1   int     // pixel range.
+}
+
+func (s scale) pixel(v float64) (int, bool) {
+	if s.Log {
+		if v <= 0 {
+			return 0, false
+		}
+		v = math.Log10(v)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return s.p0 + int(math.Round((v-s.min)/(s.max-s.min)*float64(s.p1-s.p0))), true
+}
+
+// tick is a labelled value along an axis.
+type tick struct {
+	value float64
+	label string
+	major bool
+}
+
+func (s scale) ticks() []tick {
+	var t []tick
+
+	if s.Log {
+		for d := math.Floor(s.min); d <= math.Ceil(s.max); d++ {
+			for m := 1; m < 10; m++ {
+				v := float64(m) * math.Pow(10, d)
+				lv := math.Log10(v)
+				if lv < s.min-1e-9 || lv > s.max+1e-9 {
+					continue
+				}
+				if m == 1 {
+					t = append(t, tick{value: v, label: "1e" + strconv.Itoa(int(d)), major: true})
+				} else {
+					t = append(t, tick{value: v})
+				}
+			}
+		}
+		return t
+	}
+
+	if s.Time {
+		return timeTicks(s.min, s.max)
+	}
+
+	step := niceStep((s.max - s.min) / 5)
+	for v := math.Ceil(s.min/step) * step; v <= s.max+step*1e-9; v += step {
+		// avoid labels like -0 and 1.0000000002
+		v = math.Round(v/step) * step
+		t = append(t, tick{value: v, label: strconv.FormatFloat(v, 'g', 4, 64), major: true})
+	}
+
+	return t
+}
+
+// niceStep rounds step to 1, 2 or 5 times a power of ten.
+func niceStep(step float64) float64 {
+	if step <= 0 || math.IsNaN(step) || math.IsInf(step, 0) {
+		return 1
+	}
+
+	m := math.Pow(10, math.Floor(math.Log10(step)))
+	switch f := step / m; {
+	case f < 1.5:
+		return m
+	case f < 3.5:
+		return 2 * m
+	case f < 7.5:
+		return 5 * m
+	default:
+		return 10 * m
+	}
+}
+
+// dataRange finds the range for a from the values in v.
+func dataRange(a Axis, v [][]float64) (float64, float64) {
+	min, max := a.Min, a.Max
+	if min == max {
+		min, max = math.Inf(1), math.Inf(-1)
+		for _, s := range v {
+			for _, x := range s {
+				if math.IsNaN(x) || math.IsInf(x, 0) || (a.Log && x <= 0) {
+					continue
+				}
+				min = math.Min(min, x)
+				max = math.Max(max, x)
+			}
+		}
+	}
+
+	if math.IsInf(min, 0) || math.IsInf(max, 0) {
+		min, max = 0, 1
+		if a.Log {
+			min, max = 1, 10
+		}
+	}
+
+	if a.Log {
+		min, max = math.Log10(min), math.Log10(max)
+		if a.Min == a.Max {
+			min, max = math.Floor(min), math.Ceil(max)
+		}
+	}
+
+	if min == max {
+		min, max = min-1, max+1
+	}
+
+	return min, max
+}
+
+func (p Panel) draw(s surface, r image.Rectangle) {
+	area := image.Rect(r.Min.X+marginLeft, r.Min.Y+marginTop, r.Max.X-marginRight, r.Max.Y-marginBottom)
+
+	var xs, ys [][]float64
+	for _, s := range p.Series {
+		xs = append(xs, s.X)
+		ys = append(ys, s.Y)
+	}
+
+	x := scale{Axis: p.X, p0: area.Min.X, p1: area.Max.X - 1}
+	x.min, x.max = dataRange(p.X, xs)
+	y := scale{Axis: p.Y, p0: area.Max.Y - 1, p1: area.Min.Y}
+	y.min, y.max = dataRange(p.Y, ys)
+
+	c := s.clipped(area)
+	t := s.clipped(r)
+
+	for _, sp := range p.Spans {
+		col := sp.Colour
+		if col == nil {
+			col = Pink
+		}
+
+		x0, ok0 := x.pixel(sp.X0)
+		x1, ok1 := x.pixel(sp.X1)
+		if ok0 && ok1 {
+			c.fill(image.Rect(x0, area.Min.Y, x1+1, area.Max.Y), col)
+		}
+	}
+
+	for _, tk := range x.ticks() {
+		px, _ := x.pixel(tk.value)
+		if tk.major {
+			c.line(px, area.Min.Y, px, area.Max.Y-1, grey)
+			t.text(px-textWidth(tk.label)/2, area.Max.Y+6, tk.label, Black)
+		}
+		c.line(px, area.Max.Y-1, px, area.Max.Y-5, Black)
+	}
+
+	for _, tk := range y.ticks() {
+		py, _ := y.pixel(tk.value)
+		if tk.major {
+			c.line(area.Min.X, py, area.Max.X-1, py, grey)
+			t.text(area.Min.X-6-textWidth(tk.label), py-glyphHeight/2, tk.label, Black)
+		}
+		c.line(area.Min.X, py, area.Min.X+4, py, Black)
+	}
+
+	for _, sr := range p.Series {
+		col := sr.Colour
+		if col == nil {
+			col = Blue
+		}
+
+		// the points for each unbroken part of the line.
+		var pts []image.Point
+		for i := 0; i < len(sr.X) && i < len(sr.Y); i++ {
+			px, xok := x.pixel(sr.X[i])
+			py, yok := y.pixel(sr.Y[i])
+			if !xok || !yok {
+				c.polyline(pts, col)
+				pts = pts[:0]
+				continue
+			}
+			pts = append(pts, image.Pt(px, py))
+		}
+		c.polyline(pts, col)
+	}
+
+	rect(c, area, Black)
+
+	t.text(area.Min.X+(area.Dx()-textWidth(p.Title))/2, r.Min.Y+(marginTop-glyphHeight)/2, p.Title, Black)
+	t.text(area.Min.X+(area.Dx()-textWidth(p.X.Label))/2, area.Max.Y+6+glyphHeight+6, p.X.Label, Black)
+	t.textUp(r.Min.X+6, area.Min.Y+(area.Dy()+textWidth(p.Y.Label))/2, p.Y.Label, Black)
+}
+
+// surface is drawn on by the panels, an image or the elements of an SVG.
+type surface interface {
+	// clipped returns a surface that only draws inside r.
+	clipped(r image.Rectangle) surface
+	line(x0, y0, x1, y1 int, col color.Color)
+	// polyline draws a line through the points, a single point is drawn as a dot.
+	polyline(pts []image.Point, col color.Color)
+	fill(r image.Rectangle, col color.Color)
+	// text draws s with its top left corner at x, y.
+	text(x, y int, s string, col color.Color)
+	// textUp draws s rotated to read upwards with its bottom left corner at x, y.
+	textUp(x, y int, s string, col color.Color)
+}
+
+func rect(s surface, r image.Rectangle, col color.Color) {
+	s.line(r.Min.X, r.Min.Y, r.Max.X-1, r.Min.Y, col)
+	s.line(r.Max.X-1, r.Min.Y, r.Max.X-1, r.Max.Y-1, col)
+	s.line(r.Max.X-1, r.Max.Y-1, r.Min.X, r.Max.Y-1, col)
+	s.line(r.Min.X, r.Max.Y-1, r.Min.X, r.Min.Y, col)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
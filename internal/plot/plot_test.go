@@ -0,0 +1,132 @@
+package plot_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/plot"
+)
+
+func TestPNG(t *testing.T) {
+	var x, y []float64
+	for i := 0; i <= 100; i++ {
+		f := math.Pow(10, -2+float64(i)*0.04)
+		x = append(x, f)
+		y = append(y, 1/(1+f*f))
+	}
+
+	p := plot.Plot{
+		Width:  600,
+		Height: 400,
+		Panels: []plot.Panel{{
+			Title:  "NZ.ARAZ.10.EHZ",
+			X:      plot.Axis{Label: "Frequency (Hz)", Log: true},
+			Y:      plot.Axis{Label: "Amplitude", Log: true},
+			Series: []plot.Series{{X: x, Y: y, Colour: plot.Red}},
+		}},
+	}
+
+	var b bytes.Buffer
+	if err := p.PNG(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Bounds().Dx() != 600 || img.Bounds().Dy() != 400 {
+		t.Errorf("expected a 600x400 image got %s", img.Bounds())
+	}
+
+	var red int
+	for i := img.Bounds().Min.X; i < img.Bounds().Max.X; i++ {
+		for j := img.Bounds().Min.Y; j < img.Bounds().Max.Y; j++ {
+			if r, g, b, _ := img.At(i, j).RGBA(); r > 0 && g == 0 && b == 0 {
+				red++
+			}
+		}
+	}
+
+	// the series crosses most of the width of the data area.
+	if red < 400 {
+		t.Errorf("expected the series to be drawn, found %d pixels", red)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	start := float64(time.Date(2024, 1, 1, 23, 58, 0, 0, time.UTC).Unix())
+
+	var x, y []float64
+	for i := 0; i <= 240; i++ {
+		x = append(x, start+float64(i))
+		y = append(y, math.Sin(float64(i)/10))
+	}
+	// a gap in the line.
+	y[100] = math.NaN()
+
+	p := plot.Plot{
+		Width:  800,
+		Height: 200,
+		Panels: []plot.Panel{{
+			Title:  "NZ.WEL.10.HHZ",
+			X:      plot.Axis{Label: "Time (UTC)", Time: true},
+			Y:      plot.Axis{Label: "COUNTS"},
+			Series: []plot.Series{{X: x, Y: y}},
+			Spans:  []plot.Span{{X0: start + 100, X1: start + 101}},
+		}},
+	}
+
+	var b bytes.Buffer
+	if err := p.SVG(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	// check the SVG is well formed.
+	d := xml.NewDecoder(bytes.NewReader(b.Bytes()))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %s", err)
+		}
+	}
+
+	svg := b.String()
+
+	for _, s := range []string{"<svg ", ">NZ.WEL.10.HHZ</text>", ">Time (UTC)</text>", ">2024-01-02</text>", ">23:59</text>", ">00:01</text>", `fill="#ffdddd"`} {
+		if !strings.Contains(svg, s) {
+			t.Errorf("expected %q in the SVG", s)
+		}
+	}
+
+	// the line is broken at the gap.
+	if n := strings.Count(svg, "<polyline "); n != 2 {
+		t.Errorf("expected 2 polylines got %d", n)
+	}
+}
+
+func TestPNGErrors(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := (plot.Plot{Width: 600, Height: 400}).PNG(&b); err == nil {
+		t.Error("expected an error for a plot with no panels")
+	}
+
+	if err := (plot.Plot{Width: 10, Height: 10, Panels: []plot.Panel{{}}}).PNG(&b); err == nil {
+		t.Error("expected an error for a plot that is too small")
+	}
+
+	if err := (plot.Plot{Width: 10, Height: 10, Panels: []plot.Panel{{}}}).SVG(&b); err == nil {
+		t.Error("expected an error for an SVG that is too small")
+	}
+}
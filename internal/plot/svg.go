@@ -0,0 +1,123 @@
+package plot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// svgFontSize is the size of a monospace font that is close to the bitmap font, text is
+// stretched to the width of the bitmap font so the layout is the same as for images.
+const svgFontSize = 10
+
+// svg collects the elements of an SVG image.
+type svg struct {
+	b      *bytes.Buffer
+	clips  map[image.Rectangle]string
+	width  int
+	height int
+}
+
+func newSVG(width, height int) *svg {
+	return &svg{b: new(bytes.Buffer), clips: make(map[image.Rectangle]string), width: width, height: height}
+}
+
+// write writes the SVG document to w.
+func (s *svg) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", s.width, s.height, s.width, s.height); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", s.width, s.height); err != nil {
+		return err
+	}
+	if _, err := s.b.WriteTo(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</svg>\n")
+	return err
+}
+
+// svgClip is a surface that draws in the clip path for a rectangle.
+type svgClip struct {
+	s  *svg
+	id string
+}
+
+func (s *svg) clipped(r image.Rectangle) surface {
+	id, ok := s.clips[r]
+	if !ok {
+		id = "c" + strconv.Itoa(len(s.clips))
+		s.clips[r] = id
+		fmt.Fprintf(s.b, `<clipPath id="%s"><rect x="%d" y="%d" width="%d" height="%d"/></clipPath>`+"\n", id, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	}
+
+	return svgClip{s: s, id: id}
+}
+
+func (c svgClip) clipped(r image.Rectangle) surface {
+	return c.s.clipped(r)
+}
+
+// the element coordinates are offset by half a pixel so that lines are centred on the image pixels.
+
+func (c svgClip) line(x0, y0, x1, y1 int, col color.Color) {
+	fmt.Fprintf(c.s.b, `<line x1="%d.5" y1="%d.5" x2="%d.5" y2="%d.5" stroke="%s" clip-path="url(#%s)"/>`+"\n", x0, y0, x1, y1, svgColour(col), c.id)
+}
+
+func (c svgClip) polyline(pts []image.Point, col color.Color) {
+	switch len(pts) {
+	case 0:
+		return
+	case 1:
+		c.fill(image.Rect(pts[0].X, pts[0].Y, pts[0].X+1, pts[0].Y+1), col)
+		return
+	}
+
+	_, _ = c.s.b.WriteString(`<polyline fill="none" stroke="` + svgColour(col) + `" clip-path="url(#` + c.id + `)" points="`)
+	for i, p := range pts {
+		if i > 0 {
+			_ = c.s.b.WriteByte(' ')
+		}
+		_, _ = c.s.b.WriteString(strconv.Itoa(p.X) + ".5," + strconv.Itoa(p.Y) + ".5")
+	}
+	_, _ = c.s.b.WriteString(`"/>` + "\n")
+}
+
+func (c svgClip) fill(r image.Rectangle, col color.Color) {
+	r = r.Canon()
+	fmt.Fprintf(c.s.b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" clip-path="url(#%s)"/>`+"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgColour(col), c.id)
+}
+
+func (c svgClip) text(x, y int, s string, col color.Color) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(c.s.b, `<text x="%d" y="%d" %s fill="%s">%s</text>`+"\n", x, y+glyphHeight-1, svgTextAttrs(s), svgColour(col), svgEscape(s))
+}
+
+func (c svgClip) textUp(x, y int, s string, col color.Color) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(c.s.b, `<text transform="translate(%d,%d) rotate(-90)" %s fill="%s">%s</text>`+"\n", x+glyphHeight-1, y, svgTextAttrs(s), svgColour(col), svgEscape(s))
+}
+
+func svgTextAttrs(s string) string {
+	return fmt.Sprintf(`font-family="monospace" font-size="%d" textLength="%d" lengthAdjust="spacingAndGlyphs"`, svgFontSize, textWidth(s)-1)
+}
+
+func svgColour(col color.Color) string {
+	c := color.RGBAModel.Convert(col).(color.RGBA)
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func svgEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package plot
+
+import (
+	"math"
+	"time"
+)
+
+// timeSteps are the tick spacings for time axes, in seconds.
+var timeSteps = []float64{
+	0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5,
+	1, 2, 5, 10, 15, 30,
+	60, 120, 300, 600, 900, 1800,
+	3600, 7200, 10800, 21600, 43200,
+	86400, 2 * 86400, 7 * 86400, 14 * 86400, 28 * 86400,
+}
+
+// timeTicks returns the ticks for a time axis from min to max Unix seconds, labelled in UTC.
+// Ticks at midnight are labelled with the date.
+func timeTicks(min, max float64) []tick {
+	step := timeSteps[len(timeSteps)-1]
+	for _, s := range timeSteps {
+		if s >= (max-min)/6 {
+			step = s
+			break
+		}
+	}
+
+	var layout string
+	switch {
+	case step < 1:
+		layout = "15:04:05.000"
+	case step < 60:
+		layout = "15:04:05"
+	default:
+		layout = "15:04"
+	}
+
+	var t []tick
+	for v := math.Ceil(min/step) * step; v <= max+step*1e-9; v += step {
+		v = math.Round(v/step) * step
+
+		sec, frac := math.Modf(v)
+		tm := time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC()
+
+		l := layout
+		if step >= 1 && tm.Hour() == 0 && tm.Minute() == 0 && tm.Second() == 0 {
+			l = "2006-01-02"
+		}
+
+		t = append(t, tick{value: v, label: tm.Format(l), major: true})
+	}
+
+	return t
+}
@@ -0,0 +1,92 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	ms "github.com/GeoNet/kit/seis/ms"
+)
+
+const (
+	miniSEEDRecordLength = 512
+	miniSEEDDataOffset   = 64
+	miniSEEDSamples      = (miniSEEDRecordLength - miniSEEDDataOffset) / 4 // float32 samples per record.
+)
+
+// WriteMiniSEED writes the segments to w as 512 byte miniSEED records with IEEE float32 samples.  Sample times
+// are rounded to the 100 microsecond precision of miniSEED.
+func WriteMiniSEED(w io.Writer, segments []Segment) error {
+	seq := 1
+
+	for _, s := range segments {
+		factor, multiplier, err := sampleRateFactors(s.SampleRate)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.ID(), err)
+		}
+
+		for i := 0; i < len(s.Samples); i += miniSEEDSamples {
+			samples := s.Samples[i:min(i+miniSEEDSamples, len(s.Samples))]
+
+			hdr := ms.RecordHeader{
+				DataQualityIndicator:         'D',
+				ReservedByte:                 ' ',
+				NumberOfSamples:              uint16(len(samples)),
+				SampleRateFactor:             factor,
+				SampleRateMultiplier:         multiplier,
+				NumberOfBlockettesThatFollow: 1,
+				BeginningOfData:              miniSEEDDataOffset,
+				FirstBlockette:               ms.RecordHeaderSize,
+			}
+			hdr.SetSeqNumber(seq % 1000000)
+			hdr.SetNetwork(s.Network)
+			hdr.SetStation(s.Station)
+			hdr.SetLocation(s.Location)
+			hdr.SetChannel(s.Channel)
+			hdr.SetStartTime(s.Time(i))
+
+			b := make([]byte, miniSEEDRecordLength)
+			copy(b, ms.EncodeRecordHeader(hdr))
+			copy(b[ms.RecordHeaderSize:], ms.EncodeBlocketteHeader(ms.BlocketteHeader{BlocketteType: 1000}))
+			copy(b[ms.RecordHeaderSize+ms.BlocketteHeaderSize:], ms.EncodeBlockette1000(ms.Blockette1000{
+				Encoding:     uint8(ms.EncodingIEEEFloat),
+				WordOrder:    uint8(ms.BigEndian),
+				RecordLength: 9,
+			}))
+
+			for j, v := range samples {
+				binary.BigEndian.PutUint32(b[miniSEEDDataOffset+4*j:], math.Float32bits(float32(v)))
+			}
+
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+
+			seq++
+		}
+	}
+
+	return nil
+}
+
+// sampleRateFactors returns the miniSEED sample rate factor and multiplier for rate.
+func sampleRateFactors(rate float64) (int16, int16, error) {
+	switch {
+	case rate <= 0:
+		return 0, 0, fmt.Errorf("invalid sample rate %g", rate)
+	case rate == math.Trunc(rate) && rate <= math.MaxInt16:
+		return int16(rate), 1, nil
+	case 1/rate == math.Trunc(1/rate) && 1/rate <= math.MaxInt16:
+		return -int16(1 / rate), 1, nil
+	}
+
+	// rate is factor / -multiplier, use the largest power of ten that keeps the factor in range.
+	for m := 10000; m >= 1; m /= 10 {
+		if f := math.Round(rate * float64(m)); f >= 1 && f <= math.MaxInt16 {
+			return int16(f), -int16(m), nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("sample rate %g can not be represented in miniSEED", rate)
+}
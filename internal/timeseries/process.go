@@ -0,0 +1,327 @@
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// The processing functions return a new segment, the samples in the input segment are not changed.
+
+// Demean removes the mean from the samples in s.
+func Demean(s Segment) Segment {
+	if len(s.Samples) == 0 {
+		return s
+	}
+
+	var sum float64
+	for _, v := range s.Samples {
+		sum += v
+	}
+	mean := sum / float64(len(s.Samples))
+
+	t := s
+	t.Samples = make([]float64, len(s.Samples))
+	for i, v := range s.Samples {
+		t.Samples[i] = v - mean
+	}
+
+	return t
+}
+
+// Taper applies a Hann taper to width (0 to 0.5) of the samples at each end of s.
+func Taper(s Segment, width float64) Segment {
+	t := s
+	t.Samples = append([]float64(nil), s.Samples...)
+
+	n := int(width * float64(len(s.Samples)))
+	if n < 1 {
+		return t
+	}
+
+	for i := 0; i < n; i++ {
+		w := 0.5 * (1 - math.Cos(math.Pi*float64(i)/float64(n)))
+		t.Samples[i] *= w
+		t.Samples[len(t.Samples)-1-i] *= w
+	}
+
+	return t
+}
+
+// Scale multiplies the samples in s by factor and sets the units.
+func Scale(s Segment, factor float64, units string) Segment {
+	t := s
+	t.Units = units
+	t.Samples = make([]float64, len(s.Samples))
+	for i, v := range s.Samples {
+		t.Samples[i] = v * factor
+	}
+
+	return t
+}
+
+// Filter is a Butterworth filter.  Low is the highpass corner and High the lowpass corner (Hz), both are
+// used for a bandpass and zero for no corner.
+type Filter struct {
+	Low, High float64
+	Poles     int  // the number of poles for each corner, 1 to 8.
+	ZeroPhase bool // filter forwards and backwards, this doubles the number of poles.
+}
+
+// Apply returns s filtered by f.
+func (f Filter) Apply(s Segment) (Segment, error) {
+	nyquist := s.SampleRate / 2
+
+	switch {
+	case f.Poles < 1 || f.Poles > 8:
+		return s, fmt.Errorf("number of poles %d must be from 1 to 8", f.Poles)
+	case f.Low < 0 || f.High < 0:
+		return s, fmt.Errorf("filter corners must be positive")
+	case f.Low >= nyquist || f.High >= nyquist:
+		return s, fmt.Errorf("filter corners must be less than the Nyquist frequency %g Hz for %s", nyquist, s.ID())
+	case f.High > 0 && f.Low >= f.High:
+		return s, fmt.Errorf("highpass corner %g Hz must be less than the lowpass corner %g Hz", f.Low, f.High)
+	}
+
+	var sections []biquad
+	if f.Low > 0 {
+		sections = append(sections, butterworth(f.Low/s.SampleRate, f.Poles, true)...)
+	}
+	if f.High > 0 {
+		sections = append(sections, butterworth(f.High/s.SampleRate, f.Poles, false)...)
+	}
+
+	t := s
+	t.Samples = append([]float64(nil), s.Samples...)
+
+	for _, b := range sections {
+		b.filter(t.Samples)
+	}
+
+	if f.ZeroPhase {
+		reverse(t.Samples)
+		for _, b := range sections {
+			b.filter(t.Samples)
+		}
+		reverse(t.Samples)
+	}
+
+	return t, nil
+}
+
+// Decimate reduces the sample rate of s by factor.  A zero phase anti-alias lowpass filter with a corner at 80% of the
+// new Nyquist frequency is applied first.
+func Decimate(s Segment, factor int) (Segment, error) {
+	if factor < 1 {
+		return s, fmt.Errorf("decimation factor %d must be positive", factor)
+	}
+	if factor == 1 {
+		return s, nil
+	}
+
+	f := Filter{High: 0.8 * s.SampleRate / float64(2*factor), Poles: 4, ZeroPhase: true}
+
+	t, err := f.Apply(s)
+	if err != nil {
+		return s, err
+	}
+
+	samples := make([]float64, 0, len(t.Samples)/factor+1)
+	for i := 0; i < len(t.Samples); i += factor {
+		samples = append(samples, t.Samples[i])
+	}
+
+	t.SampleRate = s.SampleRate / float64(factor)
+	t.Samples = samples
+
+	return t, nil
+}
+
+// RemoveResponse removes the instrument response from s by deconvolution in the frequency domain.  response evaluates
+// the complex response at each frequency (Hz), from the input units to counts.  The response is limited to
+// waterLevel dB below its maximum amplitude to avoid amplifying noise where the response is small.  The mean is removed.
+// The samples should be tapered first.
+func RemoveResponse(s Segment, response func(freqs []float64) ([]complex128, error), waterLevel float64, units string) (Segment, error) {
+	if len(s.Samples) == 0 {
+		return s, nil
+	}
+
+	n := 1
+	for n < len(s.Samples) {
+		n *= 2
+	}
+
+	x := make([]complex128, n)
+	for i, v := range s.Samples {
+		x[i] = complex(v, 0)
+	}
+
+	fft(x, false)
+
+	// the positive frequencies, excluding zero.
+	freqs := make([]float64, n/2)
+	for i := range freqs {
+		freqs[i] = float64(i+1) * s.SampleRate / float64(n)
+	}
+
+	r, err := response(freqs)
+	if err != nil {
+		return s, err
+	}
+	if len(r) != len(freqs) {
+		return s, fmt.Errorf("expected %d response values got %d", len(freqs), len(r))
+	}
+
+	var max float64
+	for _, v := range r {
+		max = math.Max(max, cmplx.Abs(v))
+	}
+	if max == 0 {
+		return s, fmt.Errorf("the response for %s is zero", s.ID())
+	}
+
+	level := max * math.Pow(10, -waterLevel/20)
+
+	x[0] = 0
+	for i, v := range r {
+		a := cmplx.Abs(v)
+		switch {
+		case a == 0:
+			v = complex(level, 0)
+		case a < level:
+			v *= complex(level/a, 0)
+		}
+
+		k := i + 1
+		x[k] /= v
+		// keep the spectrum conjugate symmetric so the result is real.
+		if k < n/2 {
+			x[n-k] = cmplx.Conj(x[k])
+		}
+	}
+	if n > 1 {
+		x[n/2] = complex(real(x[n/2]), 0)
+	}
+
+	fft(x, true)
+
+	t := s
+	t.Units = units
+	t.Samples = make([]float64, len(s.Samples))
+	for i := range t.Samples {
+		t.Samples[i] = real(x[i])
+	}
+
+	return t, nil
+}
+
+// biquad is a second order filter section, a1 and a2 are normalised by a0.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// filter applies the section to x in place.
+func (b biquad) filter(x []float64) {
+	var x1, x2, y1, y2 float64
+	for i, v := range x {
+		y := b.b0*v + b.b1*x1 + b.b2*x2 - b.a1*y1 - b.a2*y2
+		x2, x1 = x1, v
+		y2, y1 = y1, y
+		x[i] = y
+	}
+}
+
+// butterworth returns the sections for a Butterworth filter with the corner at f, as a fraction of the sample rate,
+// using the bilinear transform with frequency prewarping.  An odd number of poles has a first order section.
+func butterworth(f float64, poles int, highpass bool) []biquad {
+	var sections []biquad
+
+	w := 2 * math.Pi * f
+	cos, sin := math.Cos(w), math.Sin(w)
+
+	for k := 0; k < poles/2; k++ {
+		// the angle of the pole pair from the negative real axis of the analog prototype.
+		theta := math.Pi * float64(2*k+1) / float64(2*poles)
+		if poles%2 == 1 {
+			theta = math.Pi * float64(k+1) / float64(poles)
+		}
+		q := 1 / (2 * math.Cos(theta))
+		alpha := sin / (2 * q)
+		a0 := 1 + alpha
+
+		b := biquad{a1: -2 * cos / a0, a2: (1 - alpha) / a0}
+		if highpass {
+			b.b0 = (1 + cos) / 2 / a0
+			b.b1 = -(1 + cos) / a0
+		} else {
+			b.b0 = (1 - cos) / 2 / a0
+			b.b1 = (1 - cos) / a0
+		}
+		b.b2 = b.b0
+
+		sections = append(sections, b)
+	}
+
+	if poles%2 == 1 {
+		k := math.Tan(w / 2)
+		b := biquad{a1: (k - 1) / (k + 1)}
+		if highpass {
+			b.b0 = 1 / (k + 1)
+			b.b1 = -b.b0
+		} else {
+			b.b0 = k / (k + 1)
+			b.b1 = b.b0
+		}
+
+		sections = append(sections, b)
+	}
+
+	return sections
+}
+
+// fft is an in place radix 2 fast Fourier transform, len(x) must be a power of 2.  The inverse is scaled by 1/n.
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+
+	// bit reversal permutation.
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, sign*2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k] = a + b
+				x[start+k+size/2] = a - b
+				wk *= w
+			}
+		}
+	}
+
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+func reverse(x []float64) {
+	for i, j := 0, len(x)-1; i < j; i, j = i+1, j-1 {
+		x[i], x[j] = x[j], x[i]
+	}
+}
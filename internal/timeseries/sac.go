@@ -0,0 +1,192 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// SAC header values, see https://ds.iris.edu/files/sac-manual/manual/file_format.html
+const (
+	sacFloats   = 70
+	sacInts     = 40
+	sacChars    = 192
+	sacUndef    = -12345
+	sacVersion  = 6
+	sacTime     = 1 // iftype ITIME
+	sacUnknown  = 5 // idep IUNKN
+	sacDisp     = 6 // idep IDISP
+	sacVel      = 7 // idep IVEL
+	sacAcc      = 8 // idep IACC
+	sacBegin    = 9 // iztype IB
+	sacTrue     = 1
+	sacFalse    = 0
+	sacCharUndf = "-12345"
+)
+
+// the index of the SAC header values used.
+const (
+	sacDelta  = 0
+	sacDepMin = 1
+	sacDepMax = 2
+	sacB      = 5
+	sacE      = 6
+	sacStla   = 31
+	sacStlo   = 32
+	sacStel   = 33
+	sacStdp   = 34
+	sacDepMen = 56
+	sacCmpAz  = 57
+	sacCmpInc = 58
+
+	sacNzYear = 0
+	sacNzJDay = 1
+	sacNzHour = 2
+	sacNzMin  = 3
+	sacNzSec  = 4
+	sacNzMsec = 5
+	sacNvHdr  = 6
+	sacNpts   = 9
+	sacIfType = 15
+	sacIdep   = 16
+	sacIzType = 17
+	sacLeven  = 30
+	sacLpsPol = 31
+	sacLovrOK = 32
+	sacLcalda = 33
+
+	sacKstnm  = 0
+	sacKhole  = 24
+	sacKcmpnm = 160
+	sacKnetwk = 168
+)
+
+// Site is the location and orientation of the sensor for a segment.
+type Site struct {
+	Latitude, Longitude float64 // degrees
+	Elevation, Depth    float64 // metres
+	Azimuth             float64 // degrees clockwise from north, NaN if not known.
+	Dip                 float64 // degrees down from horizontal, NaN if not known.
+}
+
+// WriteSAC writes s to w as a little endian SAC binary file.  site is optional.
+func WriteSAC(w io.Writer, s Segment, site *Site) error {
+	if len(s.Samples) == 0 {
+		return fmt.Errorf("%s has no samples", s.ID())
+	}
+
+	f := make([]float32, sacFloats)
+	for i := range f {
+		f[i] = sacUndef
+	}
+
+	n := make([]int32, sacInts)
+	for i := range n {
+		n[i] = sacUndef
+	}
+
+	c := make([]byte, sacChars)
+	for i := 0; i < sacChars; i += 8 {
+		copy(c[i:i+8], fmt.Sprintf("%-8s", sacCharUndf))
+	}
+	// kevnm is 16 characters.
+	copy(c[8:24], fmt.Sprintf("%-16s", sacCharUndf))
+
+	// the reference time is the first sample truncated to milliseconds.
+	ref := s.Start.UTC().Truncate(time.Millisecond)
+	b := s.Start.Sub(ref).Seconds()
+	delta := 1 / s.SampleRate
+
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, v := range s.Samples {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		sum += v
+	}
+
+	f[sacDelta] = float32(delta)
+	f[sacB] = float32(b)
+	f[sacE] = float32(b + float64(len(s.Samples)-1)*delta)
+	f[sacDepMin] = float32(min)
+	f[sacDepMax] = float32(max)
+	f[sacDepMen] = float32(sum / float64(len(s.Samples)))
+
+	if site != nil {
+		f[sacStla] = float32(site.Latitude)
+		f[sacStlo] = float32(site.Longitude)
+		f[sacStel] = float32(site.Elevation)
+		f[sacStdp] = float32(site.Depth)
+		// the orientation is NaN if it isn't known.
+		if !math.IsNaN(site.Azimuth) {
+			f[sacCmpAz] = float32(site.Azimuth)
+		}
+		// SAC component incidence is measured from vertical up.
+		if !math.IsNaN(site.Dip) {
+			f[sacCmpInc] = float32(site.Dip + 90)
+		}
+	}
+
+	n[sacNzYear] = int32(ref.Year())
+	n[sacNzJDay] = int32(ref.YearDay())
+	n[sacNzHour] = int32(ref.Hour())
+	n[sacNzMin] = int32(ref.Minute())
+	n[sacNzSec] = int32(ref.Second())
+	n[sacNzMsec] = int32(ref.Nanosecond() / int(time.Millisecond))
+	n[sacNvHdr] = sacVersion
+	n[sacNpts] = int32(len(s.Samples))
+	n[sacIfType] = sacTime
+	n[sacIdep] = sacIdepUnits(s.Units)
+	n[sacIzType] = sacBegin
+	n[sacLeven] = sacTrue
+	n[sacLpsPol] = sacFalse
+	n[sacLovrOK] = sacTrue
+	n[sacLcalda] = sacFalse
+
+	sacString(c[sacKstnm:], s.Station)
+	sacString(c[sacKhole:], s.Location)
+	sacString(c[sacKcmpnm:], s.Channel)
+	sacString(c[sacKnetwk:], s.Network)
+
+	data := make([]float32, len(s.Samples))
+	for i, v := range s.Samples {
+		data[i] = float32(v)
+	}
+
+	for _, v := range []any{f, n, c, data} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sacIdepUnits returns the SAC dependent variable type for units.
+func sacIdepUnits(units string) int32 {
+	switch strings.ToLower(units) {
+	case "m":
+		return sacDisp
+	case "m/s":
+		return sacVel
+	case "m/s**2", "m/s/s", "m/s^2":
+		return sacAcc
+	default:
+		return sacUnknown
+	}
+}
+
+// sacString sets an 8 character SAC header value.  Empty strings are left undefined.
+func sacString(c []byte, s string) {
+	if s == "" {
+		return
+	}
+	copy(c[:8], fmt.Sprintf("%-8.8s", s))
+}
+
+// SACName returns a file name for s e.g., NZ.WEL.10.HHZ.D.2024.002.030405.SAC
+func SACName(s Segment) string {
+	return s.ID() + ".D." + s.Start.UTC().Format("2006.002.150405") + ".SAC"
+}
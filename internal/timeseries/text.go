@@ -0,0 +1,75 @@
+package timeseries
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// time format for the sample times.
+const timeFormat = "2006-01-02T15:04:05.000000Z"
+
+// WriteGeoCSV writes the segments to w as GeoCSV 2.0 time, value pairs.  Each segment has its own header.
+// See http://geows.ds.iris.edu/documents/GeoCSV.pdf
+func WriteGeoCSV(w io.Writer, segments []Segment) error {
+	b := bufio.NewWriter(w)
+
+	for _, s := range segments {
+		_, _ = b.WriteString("# dataset: GeoCSV 2.0\n")
+		_, _ = b.WriteString("# delimiter: ,\n")
+		_, _ = b.WriteString("# SID: " + s.Network + "_" + s.Station + "_" + s.Location + "_" + s.Channel + "\n")
+		_, _ = b.WriteString("# sample_count: " + strconv.Itoa(len(s.Samples)) + "\n")
+		_, _ = b.WriteString("# sample_rate_hz: " + formatFloat(s.SampleRate) + "\n")
+		_, _ = b.WriteString("# start_time: " + s.Start.UTC().Format(timeFormat) + "\n")
+		_, _ = b.WriteString("# field_unit: UTC, " + s.units() + "\n")
+		_, _ = b.WriteString("# field_type: datetime, FLOAT\n")
+		_, _ = b.WriteString("Time, Sample\n")
+
+		for i, v := range s.Samples {
+			_, _ = b.WriteString(s.Time(i).UTC().Format(timeFormat))
+			_, _ = b.WriteString(", ")
+			_, _ = b.WriteString(formatFloat(v))
+			_ = b.WriteByte('\n')
+		}
+	}
+
+	return b.Flush()
+}
+
+type jsonSegment struct {
+	Network    string    `json:"network"`
+	Station    string    `json:"station"`
+	Location   string    `json:"location"`
+	Channel    string    `json:"channel"`
+	StartTime  string    `json:"starttime"`
+	EndTime    string    `json:"endtime"`
+	SampleRate float64   `json:"samplerate"`
+	Units      string    `json:"units"`
+	Samples    []float64 `json:"samples"`
+}
+
+// WriteJSON writes the segments to w as a JSON array.
+func WriteJSON(w io.Writer, segments []Segment) error {
+	j := make([]jsonSegment, len(segments))
+
+	for i, s := range segments {
+		j[i] = jsonSegment{
+			Network:    s.Network,
+			Station:    s.Station,
+			Location:   s.Location,
+			Channel:    s.Channel,
+			StartTime:  s.Start.UTC().Format(timeFormat),
+			EndTime:    s.End().UTC().Format(timeFormat),
+			SampleRate: s.SampleRate,
+			Units:      s.units(),
+			Samples:    s.Samples,
+		}
+	}
+
+	return json.NewEncoder(w).Encode(j)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
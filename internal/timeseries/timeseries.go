@@ -0,0 +1,157 @@
+// Package timeseries decodes miniSEED records into continuous segments of samples, processes them
+// and writes them in formats that can be used without miniSEED software.
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	ms "github.com/GeoNet/kit/seis/ms"
+)
+
+// Segment is continuous data for a stream.
+type Segment struct {
+	Network, Station, Location, Channel string
+	Start                               time.Time // the time of the first sample.
+	SampleRate                          float64   // samples per second.
+	Units                               string    // the units of the samples, empty for counts.
+	Samples                             []float64
+}
+
+// ID returns the stream id e.g., NZ.WEL.10.HHZ
+func (s Segment) ID() string {
+	return s.Network + "." + s.Station + "." + s.Location + "." + s.Channel
+}
+
+// units returns the units of the samples, COUNTS if they have not been converted.
+func (s Segment) units() string {
+	if s.Units == "" {
+		return "COUNTS"
+	}
+	return s.Units
+}
+
+// Period returns the time between samples.
+func (s Segment) Period() time.Duration {
+	return time.Duration(float64(time.Second)/s.SampleRate + 0.5)
+}
+
+// End returns the time of the last sample.
+func (s Segment) End() time.Time {
+	if len(s.Samples) == 0 {
+		return s.Start
+	}
+	return s.Time(len(s.Samples) - 1)
+}
+
+// Time returns the time of sample i.
+func (s Segment) Time(i int) time.Time {
+	return s.Start.Add(time.Duration(float64(i) * float64(time.Second) / s.SampleRate))
+}
+
+// Trim returns the part of s with samples from start to end, inclusive.  ok is false if there
+// are no samples in the time window.
+func (s Segment) Trim(start, end time.Time) (Segment, bool) {
+	if len(s.Samples) == 0 || s.End().Before(start) || s.Start.After(end) {
+		return Segment{}, false
+	}
+
+	from := 0
+	if s.Start.Before(start) {
+		from = int(math.Ceil(start.Sub(s.Start).Seconds()*s.SampleRate - 1e-6))
+	}
+
+	to := len(s.Samples)
+	if s.End().After(end) {
+		to = int(math.Floor(end.Sub(s.Start).Seconds()*s.SampleRate+1e-6)) + 1
+	}
+
+	if from >= to {
+		return Segment{}, false
+	}
+
+	t := s
+	t.Start = s.Time(from)
+	t.Samples = s.Samples[from:to]
+
+	return t, true
+}
+
+// Decode decodes miniSEED records, each recordLength bytes, into segments.  Records that follow
+// on from the previous record for the stream, within half a sample, are joined.  Overlapping samples
+// are dropped.  Records with no samples, e.g., log records, are skipped.  Segments are ordered by
+// stream and start time.
+func Decode(b []byte, recordLength int) ([]Segment, error) {
+	if recordLength <= 0 || len(b)%recordLength != 0 {
+		return nil, fmt.Errorf("data length %d is not a multiple of the record length %d", len(b), recordLength)
+	}
+
+	var records []Segment
+
+	for i := 0; i < len(b); i += recordLength {
+		msr, err := ms.NewRecord(b[i : i+recordLength])
+		if err != nil {
+			return nil, err
+		}
+
+		if msr.SampleRate() <= 0 || msr.SampleCount() == 0 || msr.Encoding() == ms.EncodingASCII {
+			continue
+		}
+
+		samples, err := msr.Float64s()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", msr.SrcName(false), err)
+		}
+
+		records = append(records, Segment{
+			Network:    msr.Network(),
+			Station:    msr.Station(),
+			Location:   msr.Location(),
+			Channel:    msr.Channel(),
+			Start:      msr.StartTime(),
+			SampleRate: msr.SampleRate(),
+			Samples:    samples,
+		})
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if a, b := records[i].ID(), records[j].ID(); a != b {
+			return a < b
+		}
+		return records[i].Start.Before(records[j].Start)
+	})
+
+	var segments []Segment
+
+	for _, r := range records {
+		if n := len(segments); n > 0 && segments[n-1].join(r) {
+			continue
+		}
+
+		segments = append(segments, r)
+	}
+
+	return segments, nil
+}
+
+// join appends the samples in r to s if r follows on from or overlaps the end of s.
+func (s *Segment) join(r Segment) bool {
+	if r.ID() != s.ID() || r.SampleRate != s.SampleRate {
+		return false
+	}
+
+	// the number of samples from the next sample expected for s to the start of r.
+	n := r.Start.Sub(s.Time(len(s.Samples))).Seconds() * s.SampleRate
+	if n > 0.5 {
+		return false
+	}
+
+	skip := int(math.Round(-n))
+	if skip < len(r.Samples) {
+		s.Samples = append(s.Samples, r.Samples[skip:]...)
+	}
+
+	return true
+}
@@ -0,0 +1,377 @@
+package timeseries_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GeoNet/fdsn/internal/timeseries"
+	ms "github.com/GeoNet/kit/seis/ms"
+)
+
+// record returns a 512 byte miniSEED record with the samples, int32 encoded, at 1 Hz.
+func record(station string, start time.Time, samples ...int32) []byte {
+	hdr := ms.RecordHeader{
+		SequenceNumber:               [6]byte{'0', '0', '0', '0', '0', '1'},
+		DataQualityIndicator:         'D',
+		ReservedByte:                 ' ',
+		NumberOfSamples:              uint16(len(samples)),
+		SampleRateFactor:             1,
+		SampleRateMultiplier:         1,
+		NumberOfBlockettesThatFollow: 1,
+		BeginningOfData:              64,
+		FirstBlockette:               ms.RecordHeaderSize,
+	}
+	hdr.SetNetwork("NZ")
+	hdr.SetStation(station)
+	hdr.SetLocation("10")
+	hdr.SetChannel("HHZ")
+	hdr.SetStartTime(start)
+
+	b := make([]byte, 512)
+	copy(b, ms.EncodeRecordHeader(hdr))
+	copy(b[ms.RecordHeaderSize:], ms.EncodeBlocketteHeader(ms.BlocketteHeader{BlocketteType: 1000}))
+	copy(b[ms.RecordHeaderSize+ms.BlocketteHeaderSize:], ms.EncodeBlockette1000(ms.Blockette1000{
+		Encoding:     uint8(ms.EncodingInt32),
+		WordOrder:    uint8(ms.BigEndian),
+		RecordLength: 9,
+	}))
+
+	for i, v := range samples {
+		binary.BigEndian.PutUint32(b[64+4*i:], uint32(v))
+	}
+
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var b []byte
+	b = append(b, record("WEL", start.Add(3*time.Second), 4, 5, 6)...)
+	b = append(b, record("WEL", start, 1, 2, 3)...)
+	b = append(b, record("SNZO", start, 7, 8)...)
+	b = append(b, record("WEL", start.Add(5*time.Second), 6, 7, 8)...)    // overlaps by one sample.
+	b = append(b, record("WEL", start.Add(20*time.Second), 9, 10, 11)...) // after a gap.
+
+	s, err := timeseries.Decode(b, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s) != 3 {
+		t.Fatalf("expected 3 segments got %d", len(s))
+	}
+
+	if s[0].ID() != "NZ.SNZO.10.HHZ" || s[1].ID() != "NZ.WEL.10.HHZ" || s[2].ID() != "NZ.WEL.10.HHZ" {
+		t.Errorf("unexpected segments %s %s %s", s[0].ID(), s[1].ID(), s[2].ID())
+	}
+
+	if !s[1].Start.Equal(start) || s[1].SampleRate != 1 || !equal(s[1].Samples, 1, 2, 3, 4, 5, 6, 7, 8) {
+		t.Errorf("unexpected segment %+v", s[1])
+	}
+
+	if !s[1].End().Equal(start.Add(7 * time.Second)) {
+		t.Errorf("unexpected end time %s", s[1].End())
+	}
+
+	if !s[2].Start.Equal(start.Add(20*time.Second)) || !equal(s[2].Samples, 9, 10, 11) {
+		t.Errorf("unexpected segment %+v", s[2])
+	}
+
+	if _, err := timeseries.Decode(b[:100], 512); err == nil {
+		t.Error("expected an error for a partial record")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s := timeseries.Segment{Network: "NZ", Station: "WEL", Start: start, SampleRate: 2, Samples: []float64{0, 1, 2, 3, 4, 5}}
+
+	r, ok := s.Trim(start.Add(400*time.Millisecond), start.Add(2*time.Second))
+	if !ok || !r.Start.Equal(start.Add(500*time.Millisecond)) || !equal(r.Samples, 1, 2, 3, 4) {
+		t.Errorf("unexpected trimmed segment %+v", r)
+	}
+
+	if _, ok := s.Trim(start.Add(time.Hour), start.Add(2*time.Hour)); ok {
+		t.Error("expected no samples")
+	}
+
+	if _, ok := s.Trim(start.Add(100*time.Millisecond), start.Add(400*time.Millisecond)); ok {
+		t.Error("expected no samples between two samples")
+	}
+}
+
+func TestWriteSAC(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 500600000, time.UTC)
+
+	s := timeseries.Segment{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: start, SampleRate: 100, Samples: []float64{1, 2, 3}}
+
+	var b bytes.Buffer
+	if err := timeseries.WriteSAC(&b, s, &timeseries.Site{Latitude: -41.28, Longitude: 174.77, Dip: -90}); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Len() != 632+3*4 {
+		t.Fatalf("expected %d bytes got %d", 632+3*4, b.Len())
+	}
+
+	h := b.Bytes()
+	f := func(i int) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(h[4*i:])) }
+	n := func(i int) int32 { return int32(binary.LittleEndian.Uint32(h[4*(70+i):])) }
+	c := func(o, l int) string { return strings.TrimSpace(string(h[4*110+o : 4*110+o+l])) }
+
+	if math.Abs(float64(f(0))-0.01) > 1e-9 || math.Abs(float64(f(5))-0.0006) > 1e-7 || f(31) != -41.28 || f(58) != 0 || f(35) != -12345 {
+		t.Errorf("unexpected float headers delta %g b %g stla %g cmpinc %g evla %g", f(0), f(5), f(31), f(58), f(35))
+	}
+
+	if n(0) != 2024 || n(1) != 2 || n(2) != 3 || n(3) != 4 || n(4) != 5 || n(5) != 500 || n(6) != 6 || n(9) != 3 || n(15) != 1 || n(30) != 1 {
+		t.Errorf("unexpected int headers %v", []int32{n(0), n(1), n(2), n(3), n(4), n(5), n(6), n(9), n(15), n(30)})
+	}
+
+	if c(0, 8) != "WEL" || c(24, 8) != "10" || c(160, 8) != "HHZ" || c(168, 8) != "NZ" || c(8, 16) != "-12345" {
+		t.Errorf("unexpected char headers %q", h[4*110:])
+	}
+
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(h[632+8:])); v != 3 {
+		t.Errorf("expected the last sample 3 got %g", v)
+	}
+
+	if name := timeseries.SACName(s); name != "NZ.WEL.10.HHZ.D.2024.002.030405.SAC" {
+		t.Errorf("unexpected name %s", name)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s := []timeseries.Segment{{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: start, SampleRate: 2, Samples: []float64{1, -2.5}}}
+
+	var b bytes.Buffer
+	if err := timeseries.WriteGeoCSV(&b, s); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# dataset: GeoCSV 2.0
+# delimiter: ,
+# SID: NZ_WEL_10_HHZ
+# sample_count: 2
+# sample_rate_hz: 2
+# start_time: 2024-01-02T03:04:05.000000Z
+# field_unit: UTC, COUNTS
+# field_type: datetime, FLOAT
+Time, Sample
+2024-01-02T03:04:05.000000Z, 1
+2024-01-02T03:04:05.500000Z, -2.5
+`
+	if b.String() != expected {
+		t.Errorf("unexpected GeoCSV:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := timeseries.WriteJSON(&b, s); err != nil {
+		t.Fatal(err)
+	}
+
+	var j []map[string]any
+	if err := json.Unmarshal(b.Bytes(), &j); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(j) != 1 || j[0]["station"] != "WEL" || j[0]["endtime"] != "2024-01-02T03:04:05.500000Z" || len(j[0]["samples"].([]any)) != 2 {
+		t.Errorf("unexpected JSON %s", b.String())
+	}
+}
+
+func TestProcess(t *testing.T) {
+	s := timeseries.Segment{Network: "NZ", Station: "WEL", SampleRate: 1, Samples: []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+
+	d := timeseries.Demean(s)
+	if !equal(d.Samples, -4.5, -3.5, -2.5, -1.5, -0.5, 0.5, 1.5, 2.5, 3.5, 4.5) || s.Samples[0] != 1 {
+		t.Errorf("unexpected demeaned samples %v", d.Samples)
+	}
+
+	// the taper is 0 and 0.5 for the first and last two samples.
+	p := timeseries.Taper(s, 0.2)
+	if !near(p.Samples, 0, 1, 3, 4, 5, 6, 7, 8, 4.5, 0) {
+		t.Errorf("unexpected tapered samples %v", p.Samples)
+	}
+
+	c := timeseries.Scale(s, 0.5, "m/s")
+	if c.Samples[9] != 5 || c.Units != "m/s" {
+		t.Errorf("unexpected scaled segment %+v", c)
+	}
+}
+
+// sine returns a 100 Hz segment with n samples of a sine wave at f Hz.
+func sine(f float64, n int) timeseries.Segment {
+	s := timeseries.Segment{Network: "NZ", Station: "WEL", Location: "10", Channel: "HHZ", Start: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), SampleRate: 100}
+	for i := 0; i < n; i++ {
+		s.Samples = append(s.Samples, math.Sin(2*math.Pi*f*float64(i)/100))
+	}
+	return s
+}
+
+// amplitude returns the amplitude of a sine wave in the second half of x, after any filter transients,
+// from the root mean square.
+func amplitude(x []float64) float64 {
+	var sum float64
+	for _, v := range x[len(x)/2:] {
+		sum += v * v
+	}
+	return math.Sqrt(2 * sum / float64(len(x)-len(x)/2))
+}
+
+func TestFilter(t *testing.T) {
+	in := []struct {
+		id     string
+		f      timeseries.Filter
+		signal float64
+		min    float64
+		max    float64
+	}{
+		{id: loc(), f: timeseries.Filter{High: 1, Poles: 4}, signal: 0.1, min: 0.99, max: 1.01},
+		{id: loc(), f: timeseries.Filter{High: 1, Poles: 4}, signal: 20, max: 1e-4},
+		{id: loc(), f: timeseries.Filter{High: 1, Poles: 4}, signal: 1, min: 0.69, max: 0.72},
+		{id: loc(), f: timeseries.Filter{High: 1, Poles: 3, ZeroPhase: true}, signal: 1, min: 0.49, max: 0.51},
+		{id: loc(), f: timeseries.Filter{Low: 5, Poles: 4}, signal: 20, min: 0.99, max: 1.01},
+		{id: loc(), f: timeseries.Filter{Low: 5, Poles: 4}, signal: 0.5, max: 1e-3},
+		{id: loc(), f: timeseries.Filter{Low: 1, High: 10, Poles: 2}, signal: 3, min: 0.95, max: 1.01},
+		{id: loc(), f: timeseries.Filter{Low: 1, High: 10, Poles: 2}, signal: 40, max: 0.1},
+	}
+
+	for _, v := range in {
+		s, err := v.f.Apply(sine(v.signal, 10000))
+		if err != nil {
+			t.Fatalf("%s: %s", v.id, err)
+		}
+
+		if p := amplitude(s.Samples); p < v.min || p > v.max {
+			t.Errorf("%s: expected amplitude from %g to %g got %g", v.id, v.min, v.max, p)
+		}
+	}
+
+	if _, err := (timeseries.Filter{High: 50, Poles: 4}).Apply(sine(1, 10)); err == nil {
+		t.Error("expected an error for a corner at the Nyquist frequency")
+	}
+}
+
+func TestDecimate(t *testing.T) {
+	s, err := timeseries.Decimate(sine(0.5, 10000), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.SampleRate != 25 || len(s.Samples) != 2500 {
+		t.Fatalf("unexpected decimated segment rate %g samples %d", s.SampleRate, len(s.Samples))
+	}
+
+	if p := amplitude(s.Samples); p < 0.99 || p > 1.01 {
+		t.Errorf("expected amplitude 1 got %g", p)
+	}
+}
+
+func TestRemoveResponse(t *testing.T) {
+	// 1024 samples so the sine has a whole number of cycles in the transform.
+	in := sine(100.0/1024*8, 1024)
+
+	// a flat response with a gain of 2 counts per m/s.
+	response := func(freqs []float64) ([]complex128, error) {
+		r := make([]complex128, len(freqs))
+		for i := range r {
+			r[i] = 2
+		}
+		return r, nil
+	}
+
+	s, err := timeseries.RemoveResponse(in, response, 60, "m/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Units != "m/s" || len(s.Samples) != len(in.Samples) {
+		t.Fatalf("unexpected segment %s %d", s.Units, len(s.Samples))
+	}
+
+	for i := range s.Samples {
+		if math.Abs(s.Samples[i]-in.Samples[i]/2) > 1e-9 {
+			t.Fatalf("sample %d expected %g got %g", i, in.Samples[i]/2, s.Samples[i])
+		}
+	}
+}
+
+func TestWriteMiniSEED(t *testing.T) {
+	in := []struct {
+		id   string
+		rate float64
+	}{
+		{id: loc(), rate: 100},
+		{id: loc(), rate: 0.1},
+		{id: loc(), rate: 12.5},
+	}
+
+	for _, v := range in {
+		s := sine(1, 250)
+		s.SampleRate = v.rate
+
+		var b bytes.Buffer
+		if err := timeseries.WriteMiniSEED(&b, []timeseries.Segment{s}); err != nil {
+			t.Fatalf("%s: %s", v.id, err)
+		}
+
+		if b.Len() != 3*512 {
+			t.Fatalf("%s: expected 3 records got %d bytes", v.id, b.Len())
+		}
+
+		d, err := timeseries.Decode(b.Bytes(), 512)
+		if err != nil {
+			t.Fatalf("%s: %s", v.id, err)
+		}
+
+		if len(d) != 1 || d[0].SampleRate != v.rate || !d[0].Start.Equal(s.Start) || len(d[0].Samples) != 250 {
+			t.Fatalf("%s: unexpected segments %d", v.id, len(d))
+		}
+
+		for i := range s.Samples {
+			if d[0].Samples[i] != float64(float32(s.Samples[i])) {
+				t.Errorf("%s: sample %d expected %g got %g", v.id, i, s.Samples[i], d[0].Samples[i])
+			}
+		}
+	}
+}
+
+func near(a []float64, b ...float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func loc() string {
+	_, _, l, _ := runtime.Caller(1)
+	return "L" + strconv.Itoa(l)
+}
+
+func equal(a []float64, b ...float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}